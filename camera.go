@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/logging"
+	"github.com/nisarg-dave/camera-viewer/pkg/stream"
+)
+
+// connectTimeout bounds connecting to the camera in the commands that look at its video
+const connectTimeout = 15 * time.Second
+
+// cameraURL resolves a command's camera argument: an rtsp:// or rtsps:// URL as it is, or the ID
+// of the camera set up in the environment, which is also what no argument means. TLS settings for
+// rtsps:// come from the environment either way.
+func cameraURL(arg string) (string, stream.TLSOptions, error) {
+	if strings.HasPrefix(arg, "rtsp://") || strings.HasPrefix(arg, "rtsps://") {
+		return arg, stream.TLSOptions{
+			CAFile:      os.Getenv("RTSP_TLS_CA_FILE"),
+			Fingerprint: os.Getenv("RTSP_TLS_FINGERPRINT"),
+		}, nil
+	}
+
+	err := loadEnv()
+	if err != nil {
+		return "", stream.TLSOptions{}, err
+	}
+	camera, err := cameraFromEnv()
+	if err != nil {
+		return "", stream.TLSOptions{}, err
+	}
+	id := camera.ID
+	if id == "" {
+		id = "camera1"
+	}
+	if arg != "" && arg != id {
+		return "", stream.TLSOptions{}, fmt.Errorf("unknown camera %q, the camera set up in the environment is %q", arg, id)
+	}
+	if os.Getenv("RTSP_HOST") == "" {
+		return "", stream.TLSOptions{}, fmt.Errorf("no camera set up, set RTSP_HOST or give an rtsp:// URL")
+	}
+	return camera.URL, camera.TLS, nil
+}
+
+// openCamera creates the stream for a command's camera argument, see cameraURL. It isn't
+// connected yet, so the packet handler can be set first.
+func openCamera(arg string) (*stream.RTSPStream, string, error) {
+	url, tlsOptions, err := cameraURL(arg)
+	if err != nil {
+		return nil, "", err
+	}
+	rtspStream := stream.NewRTSPStream(url)
+	if strings.HasPrefix(url, "rtsps://") {
+		tlsConfig, err := stream.NewTLSConfig(tlsOptions)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid RTSP TLS settings: %w", err)
+		}
+		rtspStream.SetTLSConfig(tlsConfig)
+	}
+	return rtspStream, url, nil
+}
+
+// connectCamera starts the camera's video, giving up after connectTimeout
+func connectCamera(ctx context.Context, rtspStream *stream.RTSPStream) error {
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	err := rtspStream.Connect(ctx)
+	if err != nil {
+		// The error can quote the URL, password and all
+		return errors.New(logging.Redact(err.Error()))
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/capture"
+
+	"github.com/pion/rtp"
+)
+
+// runCapture writes the camera's RTP, as it arrives, to a pcap or rtpdump file for a while, for
+// attaching to a bug report. The server's GET /api/debug/capture does the same for a running
+// server, and can add what viewers were sent.
+func runCapture(args []string) error {
+	flags := newFlagSet("capture", "[camera-id | rtsp-url]")
+	out := flags.String("o", "capture.pcap", "file to write, .pcap or .rtpdump")
+	duration := flags.Duration("duration", 10*time.Second, "how long to capture for")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return fmt.Errorf("capture takes one camera")
+	}
+	format, err := capture.FormatFromName(*out)
+	if err != nil {
+		return err
+	}
+
+	rtspStream, _, err := openCamera(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("failed to create capture: %w", err)
+	}
+	defer file.Close()
+	buffered := bufio.NewWriterSize(file, 1<<20)
+	writer, err := capture.NewWriter(format, buffered, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	var packets int
+	var writeErr error
+	rtspStream.SetPacketHandler(func(pkt *rtp.Packet) {
+		mu.Lock()
+		defer mu.Unlock()
+		if writeErr != nil {
+			return
+		}
+		writeErr = writer.WritePacket(pkt, capture.Camera, time.Now())
+		packets++
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = connectCamera(ctx, rtspStream)
+	if err != nil {
+		return err
+	}
+	defer rtspStream.Close()
+	fmt.Printf("Capturing %s RTP to %s for %s, Ctrl+C stops early\n", rtspStream.GetCodec(), *out, *duration)
+
+	select {
+	case <-time.After(*duration):
+	case <-ctx.Done():
+	}
+	// No packets reach the handler once Close has returned
+	rtspStream.Close()
+
+	if writeErr != nil {
+		return fmt.Errorf("failed to write capture: %w", writeErr)
+	}
+	err = buffered.Flush()
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write capture: %w", err)
+	}
+	if packets == 0 {
+		log.Printf("The camera sent no video")
+	}
+	fmt.Printf("Wrote %d packets to %s\n", packets, *out)
+	return nil
+}
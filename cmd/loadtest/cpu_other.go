@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "time"
+
+// cpuTime isn't measured here, so CPU shows as 0%
+func cpuTime() time.Duration {
+	return 0
+}
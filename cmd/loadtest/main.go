@@ -0,0 +1,365 @@
+// Command loadtest measures the cost of fanning one camera's video out to many viewers.
+//
+// It connects N in-process fake viewers to the server's real viewer manager over loopback WebRTC,
+// then plays a looped H264 source through the same WritePacket path the RTSP stream uses, and
+// reports packets per second, the allocation rate, and CPU time per viewer.
+//
+//	go run ./cmd/loadtest -viewers 50 -duration 30s
+//	go run ./cmd/loadtest -viewers 200 -file sample.h264 -fps 25 -batch-writes
+//
+// The source is an Annex-B H264 file (e.g. ffmpeg -i in.mp4 -c:v copy -bsf:v h264_mp4toannexb
+// -f h264 sample.h264), or synthetic frames of the given bitrate without -file.
+// The fake viewers run in the same process, so the CPU figures include receiving as well as sending.
+// The fan-out figure is the time spent in WritePacket alone, which is the number to watch for regressions.
+// WritePacket only queues packets for each viewer's writer goroutine, so the sending itself shows up in
+// the CPU figures and in delivered falling behind sent.
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+	"github.com/nisarg-dave/camera-viewer/pkg/stream"
+	"github.com/nisarg-dave/camera-viewer/pkg/viewers"
+
+	"github.com/pion/ice/v4"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+)
+
+const camera = "loadtest"
+
+// frame is one video frame's packets, sent together
+type frame struct {
+	packets []*rtp.Packet
+}
+
+// counters are what the fake viewers received
+type counters struct {
+	packets atomic.Uint64
+	bytes   atomic.Uint64
+}
+
+func main() {
+	numViewers := flag.Int("viewers", 10, "number of fake viewers")
+	duration := flag.Duration("duration", 30*time.Second, "how long to send video for")
+	interval := flag.Duration("interval", 5*time.Second, "how often to print a report")
+	file := flag.String("file", "", "Annex-B H264 file to loop, synthetic frames when empty")
+	fps := flag.Int("fps", 25, "frames per second to send")
+	bitrate := flag.Float64("bitrate", 4e6, "bits per second of the synthetic source")
+	batchWrites := flag.Bool("batch-writes", false, "send through one UDP port in batches, like webrtc.batch_writes")
+	flag.Parse()
+
+	frames, err := loadFrames(*file, *fps, *bitrate)
+	if err != nil {
+		log.Fatalf("Failed to load source: %v", err)
+	}
+
+	// Usage is counted like it would be for real viewers, in a throwaway file
+	dir, err := os.MkdirTemp("", "loadtest")
+	if err != nil {
+		log.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	usage, err := viewers.LoadUsage(filepath.Join(dir, "usage.json"))
+	if err != nil {
+		log.Fatalf("Failed to set up usage: %v", err)
+	}
+	manager := viewers.NewManager(events.NewBus(), usage, config.Bandwidth{})
+
+	var mux ice.UDPMux
+	if *batchWrites {
+		mux, err = stream.NewBatchedUDPMux(stream.BatchConfig{Port: 0, Size: 64, Interval: time.Millisecond})
+		if err != nil {
+			log.Fatalf("Failed to set up batched writes: %v", err)
+		}
+		defer mux.Close()
+	}
+
+	received := &counters{}
+	start := time.Now()
+	for i := range *numViewers {
+		err := connectViewer(manager, fmt.Sprintf("viewer-%d", i), mux, received)
+		if err != nil {
+			log.Fatalf("Failed to connect viewer %d: %v", i, err)
+		}
+	}
+	log.Printf("Connected %d viewers in %s", *numViewers, time.Since(start).Round(time.Millisecond))
+	defer manager.CloseAll()
+
+	send(manager, frames, *fps, *duration, *interval, *numViewers, received)
+}
+
+// connectViewer connects a fake viewer to the manager: a second, in-process peer connection that
+// answers the server's offer and counts what it receives
+func connectViewer(manager *viewers.Manager, id string, mux ice.UDPMux, received *counters) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	peer, err := stream.NewWebRTCPeerWithConfig(stream.PeerConfig{UDPMux: mux})
+	if err != nil {
+		return err
+	}
+	err = peer.CreateVideoTrack("video", webrtc.MimeTypeH264)
+	if err != nil {
+		return err
+	}
+
+	session := &viewers.Session{ID: id, User: "loadtest", Camera: camera, Peer: peer}
+	connected := make(chan struct{})
+	peer.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateConnected {
+			session.SetConnected(true)
+			close(connected)
+		}
+	})
+
+	offer, err := peer.CreateOffer(ctx)
+	if err != nil {
+		return err
+	}
+
+	viewer, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return fmt.Errorf("failed to create viewer peer: %w", err)
+	}
+	viewer.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		buf := make([]byte, 1500)
+		for {
+			n, _, err := track.Read(buf)
+			if err != nil {
+				return
+			}
+			received.packets.Add(1)
+			received.bytes.Add(uint64(n))
+		}
+	})
+	err = viewer.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer})
+	if err != nil {
+		return fmt.Errorf("failed to set offer: %w", err)
+	}
+	answer, err := viewer.CreateAnswer(nil)
+	if err != nil {
+		return fmt.Errorf("failed to create answer: %w", err)
+	}
+	// The answer carries the viewer's candidates, like the browser's does
+	gathered := webrtc.GatheringCompletePromise(viewer)
+	err = viewer.SetLocalDescription(answer)
+	if err != nil {
+		return fmt.Errorf("failed to set answer: %w", err)
+	}
+	<-gathered
+
+	manager.Add(session)
+	err = peer.SetAnswer(ctx, viewer.LocalDescription().SDP)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-connected:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out connecting")
+	}
+}
+
+// send plays the frames in a loop for duration, printing a report every interval
+func send(manager *viewers.Manager, frames []frame, fps int, duration, interval time.Duration, numViewers int, received *counters) {
+	ticker := time.NewTicker(time.Second / time.Duration(fps))
+	defer ticker.Stop()
+	deadline := time.After(duration)
+	nextReport := time.Now().Add(interval)
+
+	first := takeSample(received)
+	last := first
+	var sent, fanoutNanos uint64
+	var seq uint16
+	var timestamp uint32
+
+	for i := 0; ; i++ {
+		select {
+		case <-deadline:
+			report("total", first, takeSample(received), sent, fanoutNanos, numViewers)
+			return
+		case <-ticker.C:
+		}
+
+		// Every loop continues the sequence numbers and timestamps, as if the camera kept going
+		f := frames[i%len(frames)]
+		for _, pkt := range f.packets {
+			pkt.SequenceNumber = seq
+			pkt.Timestamp = timestamp
+			seq++
+
+			started := time.Now()
+			manager.WritePacket(camera, pkt, stream.IsKeyframe("H264", pkt.Payload), stream.IsDisposable("H264", pkt.Payload))
+			fanoutNanos += uint64(time.Since(started))
+			sent++
+		}
+		timestamp += uint32(90000 / fps)
+
+		if time.Now().After(nextReport) {
+			now := takeSample(received)
+			report("last "+interval.String(), last, now, sent-last.sent, fanoutNanos-last.fanoutNanos, numViewers)
+			now.sent, now.fanoutNanos = sent, fanoutNanos
+			last = now
+			nextReport = nextReport.Add(interval)
+		}
+	}
+}
+
+// sample is a snapshot of the counters, reports are the difference between two
+type sample struct {
+	at              time.Time
+	cpu             time.Duration
+	mallocs         uint64
+	allocBytes      uint64
+	receivedPackets uint64
+	receivedBytes   uint64
+	sent            uint64
+	fanoutNanos     uint64
+}
+
+func takeSample(received *counters) sample {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return sample{
+		at:              time.Now(),
+		cpu:             cpuTime(),
+		mallocs:         mem.Mallocs,
+		allocBytes:      mem.TotalAlloc,
+		receivedPackets: received.packets.Load(),
+		receivedBytes:   received.bytes.Load(),
+	}
+}
+
+func report(label string, from, to sample, sent, fanoutNanos uint64, numViewers int) {
+	seconds := to.at.Sub(from.at).Seconds()
+	perSecond := func(n uint64) float64 { return float64(n) / seconds }
+
+	fanoutPerPacket := time.Duration(0)
+	if sent > 0 {
+		fanoutPerPacket = time.Duration(fanoutNanos / sent)
+	}
+	cpu := (to.cpu - from.cpu).Seconds() / seconds
+
+	fmt.Printf("%s: sent %.0f pkt/s, delivered %.0f pkt/s (%.1f Mbit/s), fan-out %s/pkt (%s per viewer), "+
+		"%.0f allocs/s, %.1f MB/s allocated, CPU %.0f%% (%.2f%% per viewer)\n",
+		label,
+		perSecond(sent),
+		perSecond(to.receivedPackets-from.receivedPackets),
+		perSecond(to.receivedBytes-from.receivedBytes)*8/1e6,
+		fanoutPerPacket, fanoutPerPacket/time.Duration(max(numViewers, 1)),
+		perSecond(to.mallocs-from.mallocs),
+		perSecond(to.allocBytes-from.allocBytes)/1e6,
+		cpu*100, cpu*100/float64(max(numViewers, 1)))
+}
+
+// loadFrames packetizes the source once up front, so the loop itself doesn't allocate
+func loadFrames(file string, fps int, bitrate float64) ([]frame, error) {
+	var units [][]byte
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		units = accessUnits(data)
+		if len(units) == 0 {
+			return nil, fmt.Errorf("no H264 frames found in %s", file)
+		}
+	} else {
+		units = syntheticUnits(fps, bitrate)
+	}
+
+	packetizer := rtp.NewPacketizer(1200, 96, rand.Uint32(), &codecs.H264Payloader{}, rtp.NewRandomSequencer(), 90000)
+	frames := make([]frame, len(units))
+	for i, unit := range units {
+		frames[i] = frame{packets: packetizer.Packetize(unit, uint32(90000/fps))}
+	}
+	return frames, nil
+}
+
+// accessUnits splits an Annex-B stream into frames: each one ends with a slice, and parameter sets and
+// SEI go with the slice after them
+func accessUnits(data []byte) [][]byte {
+	var units [][]byte
+	start := 0
+	for _, nal := range splitNALs(data) {
+		naluType := nal.data[0] & 0x1f
+		if naluType == 1 || naluType == 5 {
+			units = append(units, data[start:nal.end])
+			start = nal.end
+		}
+	}
+	return units
+}
+
+type nalUnit struct {
+	data []byte
+	end  int // Offset in the stream just after it
+}
+
+// splitNALs finds the NAL units between 00 00 01 start codes
+func splitNALs(data []byte) []nalUnit {
+	startCode := []byte{0, 0, 1}
+	var nals []nalUnit
+	pos := bytes.Index(data, startCode)
+	for pos >= 0 {
+		begin := pos + len(startCode)
+		next := bytes.Index(data[begin:], startCode)
+		end := len(data)
+		if next >= 0 {
+			end = begin + next
+		}
+		// A four byte start code leaves a zero at the end of the previous unit
+		nal := bytes.TrimRight(data[begin:end], "\x00")
+		if len(nal) > 0 {
+			nals = append(nals, nalUnit{data: nal, end: end})
+		}
+		if next < 0 {
+			break
+		}
+		pos = end
+	}
+	return nals
+}
+
+// syntheticUnits makes two seconds of frames of random data: a keyframe four times the size of the
+// others, then predicted frames, adding up to bitrate
+func syntheticUnits(fps int, bitrate float64) [][]byte {
+	gop := 2 * fps
+	// The keyframe counts as four frames, so two seconds are 2*fps+3 frames' worth
+	frameSize := int(bitrate * 2 / 8 / float64(gop+3))
+	units := make([][]byte, gop)
+	for i := range units {
+		size, naluType := frameSize, byte(1)
+		if i == 0 {
+			size, naluType = 4*frameSize, 5
+		}
+		unit := []byte{0, 0, 0, 1, 0x67, 0x42, 0xc0, 0x1f, 0, 0, 0, 1, 0x68, 0xce, 0x3c, 0x80}
+		if naluType == 1 {
+			unit = nil
+		}
+		unit = append(unit, 0, 0, 0, 1, 0x60|naluType)
+		payload := make([]byte, size)
+		for j := range payload {
+			// Anything but zero, so there are no start codes in the middle
+			payload[j] = byte(rand.IntN(255) + 1)
+		}
+		units[i] = append(unit, payload...)
+	}
+	return units
+}
@@ -0,0 +1,64 @@
+// Package config is where github.com/nisarg-dave/camera-viewer/pkg/config used to be. It only forwards to it.
+//
+// Deprecated: import github.com/nisarg-dave/camera-viewer/pkg/config instead. This package will be removed in v2.
+package config
+
+import (
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+)
+
+type (
+	Config          = config.Config
+	Reconnect       = config.Reconnect
+	RTSP            = config.RTSP
+	JitterBuffer    = config.JitterBuffer
+	WebRTC          = config.WebRTC
+	GOPCache        = config.GOPCache
+	Transcode       = config.Transcode
+	KeyframeRequest = config.KeyframeRequest
+	BatchWrites     = config.BatchWrites
+	ICEServer       = config.ICEServer
+	Storage         = config.Storage
+	Tracing         = config.Tracing
+	Metrics         = config.Metrics
+	APIDocs         = config.APIDocs
+	AdminListener   = config.AdminListener
+	GRPC            = config.GRPC
+	TLS             = config.TLS
+	HTTP2           = config.HTTP2
+	Autocert        = config.Autocert
+	Bandwidth       = config.Bandwidth
+	BandwidthLimit  = config.BandwidthLimit
+	CORS            = config.CORS
+	Auth            = config.Auth
+	OIDC            = config.OIDC
+	OIDCGroup       = config.OIDCGroup
+	RateLimit       = config.RateLimit
+	Rate            = config.Rate
+	Webhook         = config.Webhook
+	MQTT            = config.MQTT
+	Notifier        = config.Notifier
+	TimeRange       = config.TimeRange
+	Cooldown        = config.Cooldown
+	Audio           = config.Audio
+	StreamAlerts    = config.StreamAlerts
+	Rule            = config.Rule
+	RuleAction      = config.RuleAction
+	Duration        = config.Duration
+)
+
+const (
+	DefaultSecretsDir = config.DefaultSecretsDir
+)
+
+func Load(path string) (*Config, error) {
+	return config.Load(path)
+}
+
+func Save(path string, cfg *Config) error {
+	return config.Save(path, cfg)
+}
+
+func Env(name string) (string, error) {
+	return config.Env(name)
+}
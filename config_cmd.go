@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+	"github.com/nisarg-dave/camera-viewer/pkg/server"
+)
+
+// runConfig runs the config subcommands, of which there is only validate for now
+func runConfig(args []string) error {
+	flags := newFlagSet("config", "validate [file]")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.Arg(0) != "validate" || flags.NArg() > 2 {
+		flags.Usage()
+		return fmt.Errorf("unknown config command %q", flags.Arg(0))
+	}
+
+	err = loadEnv()
+	if err != nil {
+		return err
+	}
+	path := flags.Arg(1)
+	if path == "" {
+		path = configPathFromEnv()
+	}
+	return validateConfig(path)
+}
+
+// validateConfig checks the camera settings in the environment and the config file, loaded the way
+// the server does and checked with Validate, printing every problem rather than stopping at the
+// first. Nothing is connected to.
+func validateConfig(path string) error {
+	var problems []string
+	camera, err := cameraFromEnv()
+	if err != nil {
+		problems = append(problems, "environment: "+err.Error())
+	} else {
+		problems = append(problems, cameraProblems(camera)...)
+	}
+
+	_, err = os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("%s doesn't exist, the server will run with the defaults\n", path)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		problems = append(problems, err.Error())
+	} else if err = cfg.Validate(); err != nil {
+		// Validate joins one error per problem, each on its own line
+		problems = append(problems, strings.Split(err.Error(), "\n")...)
+	}
+
+	if len(problems) > 0 {
+		fmt.Printf("Found %d problem(s):\n", len(problems))
+		for _, problem := range problems {
+			fmt.Printf("  %s\n", problem)
+		}
+		return fmt.Errorf("the configuration is not valid")
+	}
+	fmt.Printf("%s and the camera settings are valid\n", path)
+	return nil
+}
+
+// cameraProblems checks the camera's settings from the environment, see cameraFromEnv
+func cameraProblems(camera server.Camera) []string {
+	var problems []string
+	if camera.Host == "" {
+		problems = append(problems, "RTSP_HOST: is required")
+	}
+	port, err := strconv.Atoi(camera.Port)
+	if err != nil || port < 1 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("RTSP_PORT: %q is not a valid port", camera.Port))
+	}
+	scheme := os.Getenv("RTSP_SCHEME")
+	if scheme != "" && scheme != "rtsp" && scheme != "rtsps" {
+		problems = append(problems, fmt.Sprintf("RTSP_SCHEME: must be rtsp or rtsps, not %q", scheme))
+	}
+	if path := os.Getenv("RTSP_PATH"); path != "" && !strings.HasPrefix(path, "/") {
+		problems = append(problems, fmt.Sprintf("RTSP_PATH: must start with /, not %q", path))
+	}
+	if camera.FailoverURL != "" {
+		// The URL can hold a password, so it isn't quoted
+		parsed, err := url.Parse(camera.FailoverURL)
+		if err != nil || (parsed.Scheme != "rtsp" && parsed.Scheme != "rtsps") || parsed.Host == "" {
+			problems = append(problems, "RTSP_FAILOVER_URL: is not an rtsp:// or rtsps:// URL")
+		}
+	}
+	if camera.TLS.CAFile != "" {
+		_, err = os.ReadFile(camera.TLS.CAFile)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("RTSP_TLS_CA_FILE: %v", err))
+		}
+	}
+	return problems
+}
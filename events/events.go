@@ -0,0 +1,50 @@
+// Package events is where github.com/nisarg-dave/camera-viewer/pkg/events used to be. It only forwards to it.
+//
+// Deprecated: import github.com/nisarg-dave/camera-viewer/pkg/events instead. This package will be removed in v2.
+package events
+
+import (
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+)
+
+type (
+	Bus          = events.Bus
+	Subscription = events.Subscription
+	CooldownRule = events.CooldownRule
+	Type         = events.Type
+	Event        = events.Event
+	Filter       = events.Filter
+	History      = events.History
+)
+
+const (
+	TypeMotion            = events.TypeMotion
+	TypeLoudNoise         = events.TypeLoudNoise
+	TypeSoundDetected     = events.TypeSoundDetected
+	TypeCameraConnected   = events.TypeCameraConnected
+	TypeCameraDisabled    = events.TypeCameraDisabled
+	TypeConnectionLost    = events.TypeConnectionLost
+	TypeStreamStalled     = events.TypeStreamStalled
+	TypeStreamResumed     = events.TypeStreamResumed
+	TypeTamperDetected    = events.TypeTamperDetected
+	TypeRecordingStarted  = events.TypeRecordingStarted
+	TypeViewerJoined      = events.TypeViewerJoined
+	TypeViewerLeft        = events.TypeViewerLeft
+	TypeBandwidthExceeded = events.TypeBandwidthExceeded
+	TypeWatchdogRestart   = events.TypeWatchdogRestart
+	TypeDiskSpaceLow      = events.TypeDiskSpaceLow
+	TypeCameraFailover    = events.TypeCameraFailover
+	TypeJobFinished       = events.TypeJobFinished
+)
+
+func NewBus() *Bus {
+	return events.NewBus()
+}
+
+func OfType(types ...Type) func(Event) bool {
+	return events.OfType(types...)
+}
+
+func NewHistory(size int) *History {
+	return events.NewHistory(size)
+}
@@ -0,0 +1,45 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// hideInput turns off the terminal's echo, so a password doesn't show as it is typed, and returns
+// the function that turns it back on. It does nothing when file isn't a terminal.
+func hideInput(file *os.File) func() {
+	fd := int(file.Fd())
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return func() {}
+	}
+	hidden := *termios
+	hidden.Lflag &^= unix.ECHO
+	err = unix.IoctlSetTermios(fd, unix.TCSETS, &hidden)
+	if err != nil {
+		return func() {}
+	}
+
+	// Ctrl+C mid-password mustn't leave the terminal without echo
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-interrupted:
+			unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(interrupted)
+		close(done)
+		unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// hideInput would turn off the terminal's echo while a password is typed. It isn't implemented on
+// this platform, so passwords show.
+func hideInput(file *os.File) func() {
+	return func() {}
+}
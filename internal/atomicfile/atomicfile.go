@@ -0,0 +1,85 @@
+// Package atomicfile replaces files so that a crash or power cut leaves either the old file or the
+// new one in place, never half of one or an empty one
+package atomicfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/metrics"
+)
+
+// Suffix is on the temporary file Write writes next to the file it replaces
+const Suffix = ".tmp"
+
+// Write replaces the file at path with data, creating its directory if it isn't there. The data is
+// written to path.tmp and synced before that is renamed over path, otherwise after a power cut the
+// rename can reach the disk before the data, and the directory is synced so the rename is on disk
+// when Write returns. How much was written and how long it took are in the storage metrics.
+func Write(path string, data []byte, perm os.FileMode) error {
+	start := time.Now()
+	dir := filepath.Dir(path)
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	tmp := path + Suffix
+	err = WriteSynced(tmp, data, perm)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	err = SyncDir(dir)
+	if err != nil {
+		return err
+	}
+	metrics.StorageWrite(dir, len(data), time.Since(start))
+	return nil
+}
+
+// WriteSynced writes data to a new file at path and waits for it to reach the disk
+func WriteSynced(path string, data []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// RemoveStale removes the temporary files Write leaves next to the given files when it is cut
+// short, e.g. by a crash, and returns the ones it removed. Empty paths are skipped. Call it before
+// anything writes to those files.
+func RemoveStale(paths ...string) ([]string, error) {
+	var removed []string
+	var errs []error
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		err := os.Remove(path + Suffix)
+		switch {
+		case err == nil:
+			removed = append(removed, path+Suffix)
+		case !errors.Is(err, os.ErrNotExist):
+			errs = append(errs, err)
+		}
+	}
+	return removed, errors.Join(errs...)
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package atomicfile
+
+import "os"
+
+// SyncDir syncs a directory, so the files just renamed into it are on disk
+func SyncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,92 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// Result is what a classifier thinks a sound is
+type Result struct {
+	Label      string  `json:"label"` // e.g. "glass_break", "baby_cry"
+	Confidence float64 `json:"confidence"`
+}
+
+// Classifier identifies a clip of audio. Implementations can wrap anything from a
+// simple heuristic to an ML model; the detector only calls it when the audio is loud.
+type Classifier interface {
+	Classify(samples []int16, sampleRate int) (Result, error)
+}
+
+// ExecClassifier runs an external program for every clip.
+// The clip is written to the program's stdin as a mono 16-bit WAV file and the program must
+// print a JSON Result, e.g. {"label": "glass_break", "confidence": 0.92}, to stdout.
+// This keeps model runtimes (Python, TensorFlow, ...) out of this binary.
+type ExecClassifier struct {
+	Command []string
+	Timeout time.Duration
+}
+
+// NewExecClassifier creates a classifier that runs command, which must not be empty
+func NewExecClassifier(command []string) (*ExecClassifier, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("classifier command is empty")
+	}
+	return &ExecClassifier{
+		Command: command,
+		Timeout: 10 * time.Second,
+	}, nil
+}
+
+// Classify runs the command on one clip
+func (c *ExecClassifier) Classify(samples []int16, sampleRate int) (Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.Command[0], c.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(encodeWAV(samples, sampleRate))
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return Result{}, fmt.Errorf("classifier command failed: %w: %s", err, stderr.String())
+	}
+
+	var result Result
+	err = json.Unmarshal(output, &result)
+	if err != nil {
+		return Result{}, fmt.Errorf("classifier printed invalid JSON: %w", err)
+	}
+	return result, nil
+}
+
+// encodeWAV wraps samples in a minimal WAV (RIFF) header
+func encodeWAV(samples []int16, sampleRate int) []byte {
+	var buf bytes.Buffer
+	dataSize := uint32(len(samples) * 2)
+
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, 36+dataSize)
+	buf.WriteString("WAVE")
+
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))           // fmt chunk size
+	binary.Write(&buf, binary.LittleEndian, uint16(1))            // PCM
+	binary.Write(&buf, binary.LittleEndian, uint16(1))            // mono
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))   // sample rate
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*2)) // byte rate
+	binary.Write(&buf, binary.LittleEndian, uint16(2))            // block align
+	binary.Write(&buf, binary.LittleEndian, uint16(16))           // bits per sample
+
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, dataSize)
+	binary.Write(&buf, binary.LittleEndian, samples)
+
+	return buf.Bytes()
+}
@@ -0,0 +1,165 @@
+package audio
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+)
+
+// Detector turns a camera's audio into loud noise events.
+// It keeps a rolling window of recent audio and fires when the window's RMS level
+// goes above the threshold. The same window is handed to the classifier, if there is one.
+type Detector struct {
+	camera        string
+	bus           *events.Bus
+	thresholdDB   float64
+	window        time.Duration
+	classifier    Classifier
+	labels        map[string]bool
+	minConfidence float64
+
+	mu         sync.Mutex
+	samples    []int16 // the rolling window
+	sampleRate int
+	loud       bool // currently above the threshold
+
+	classifying atomic.Bool // only one classification runs at a time
+}
+
+// hysteresisDB is how far the level has to drop below the threshold before we consider
+// the noise over. Without it a level hovering around the threshold fires constantly.
+const hysteresisDB = 3
+
+// NewDetector creates a detector for one camera. classifier may be nil.
+func NewDetector(camera string, bus *events.Bus, cfg config.Audio, classifier Classifier) *Detector {
+	d := &Detector{
+		camera:        camera,
+		bus:           bus,
+		thresholdDB:   cfg.ThresholdDB,
+		window:        time.Duration(cfg.Window),
+		classifier:    classifier,
+		minConfidence: cfg.MinConfidence,
+	}
+
+	if d.thresholdDB == 0 {
+		d.thresholdDB = -20
+	}
+	if d.window == 0 {
+		d.window = time.Second
+	}
+	if len(cfg.Labels) > 0 {
+		d.labels = make(map[string]bool)
+		for _, label := range cfg.Labels {
+			d.labels[label] = true
+		}
+	}
+
+	return d
+}
+
+// Process adds newly received samples to the window and checks the level.
+// It matches stream.AudioHandler so it can be passed to RTSPStream.SetAudioHandler directly.
+func (d *Detector) Process(samples []int16, sampleRate int) {
+	d.mu.Lock()
+
+	if sampleRate != d.sampleRate {
+		d.samples = d.samples[:0]
+		d.sampleRate = sampleRate
+	}
+
+	d.samples = append(d.samples, samples...)
+	maxSamples := int(d.window.Seconds() * float64(sampleRate))
+	if len(d.samples) < maxSamples {
+		// Wait for a full window before judging anything
+		d.mu.Unlock()
+		return
+	}
+	if len(d.samples) > maxSamples {
+		d.samples = d.samples[len(d.samples)-maxSamples:]
+	}
+
+	level := levelDB(d.samples)
+
+	triggered := false
+	if !d.loud && level >= d.thresholdDB {
+		d.loud = true
+		triggered = true
+	} else if d.loud && level < d.thresholdDB-hysteresisDB {
+		d.loud = false
+	}
+
+	var clip []int16
+	if triggered && d.classifier != nil {
+		clip = make([]int16, len(d.samples))
+		copy(clip, d.samples)
+	}
+
+	d.mu.Unlock()
+
+	if !triggered {
+		return
+	}
+
+	d.bus.Publish(events.Event{
+		Type:    events.TypeLoudNoise,
+		Camera:  d.camera,
+		Message: fmt.Sprintf("loud noise at %.1f dBFS", level),
+		Data:    map[string]any{"level_db": level},
+	})
+
+	if clip != nil && d.classifying.CompareAndSwap(false, true) {
+		// Classification can be slow (it might run a model), so keep it off the packet path
+		go d.classify(clip, sampleRate)
+	}
+}
+
+func (d *Detector) classify(clip []int16, sampleRate int) {
+	defer d.classifying.Store(false)
+
+	result, err := d.classifier.Classify(clip, sampleRate)
+	if err != nil {
+		log.Printf("Audio classifier failed for %s: %v", d.camera, err)
+		return
+	}
+
+	if result.Label == "" || result.Confidence < d.minConfidence {
+		return
+	}
+	if d.labels != nil && !d.labels[result.Label] {
+		return
+	}
+
+	d.bus.Publish(events.Event{
+		Type:    events.TypeSoundDetected,
+		Camera:  d.camera,
+		Message: fmt.Sprintf("%s detected (%.0f%%)", result.Label, result.Confidence*100),
+		Data: map[string]any{
+			"label":      result.Label,
+			"confidence": result.Confidence,
+		},
+	})
+}
+
+// levelDB returns the RMS level of the samples in dBFS (0 is full scale, silence is very negative)
+func levelDB(samples []int16) float64 {
+	if len(samples) == 0 {
+		return math.Inf(-1)
+	}
+
+	var sum float64
+	for _, sample := range samples {
+		v := float64(sample) / 32768
+		sum += v * v
+	}
+	rms := math.Sqrt(sum / float64(len(samples)))
+	if rms == 0 {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(rms)
+}
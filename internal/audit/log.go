@@ -0,0 +1,234 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Action is what a user did
+type Action string
+
+const (
+	ActionLogin           Action = "login"
+	ActionLoginFailed     Action = "login_failed"
+	ActionLogout          Action = "logout"
+	ActionViewCamera      Action = "view_camera"
+	ActionPasswordChanged Action = "password_changed"
+	ActionTOTPEnabled     Action = "totp_enabled"
+	ActionTOTPDisabled    Action = "totp_disabled"
+	ActionUserCreated     Action = "user_created"
+	ActionUserUpdated     Action = "user_updated"
+	ActionUserDeleted     Action = "user_deleted"
+	ActionShareCreated    Action = "share_created"
+	ActionCameraEnabled   Action = "camera_enabled"
+	ActionCameraDisabled  Action = "camera_disabled"
+	ActionSessionClosed   Action = "session_closed"
+	ActionConfigExported  Action = "config_exported"
+	ActionConfigImported  Action = "config_imported"
+)
+
+// Entry is one security relevant action
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Who did it: a username, "share:<id>" for share links, or "mqtt"/"rule:<name>" for automations
+	User   string `json:"user"`
+	Action Action `json:"action"`
+	Camera string `json:"camera,omitempty"`
+	// What the action was done to, e.g. the user that was changed
+	Target string `json:"target,omitempty"`
+	Detail string `json:"detail,omitempty"`
+	IP     string `json:"ip,omitempty"`
+}
+
+// Filter selects audit entries. Empty fields match everything.
+type Filter struct {
+	User    string
+	Actions []Action
+	Camera  string
+	Since   time.Time
+	Until   time.Time
+}
+
+// Match reports whether the entry passes the filter
+func (f Filter) Match(e Entry) bool {
+	if f.User != "" && e.User != f.User {
+		return false
+	}
+	if len(f.Actions) > 0 && !slices.Contains(f.Actions, e.Action) {
+		return false
+	}
+	if f.Camera != "" && e.Camera != f.Camera {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Log appends entries to a JSON lines file, one entry per line.
+// Appending means a crash can lose at most the line being written, and Open cuts that off.
+type Log struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Open opens (or creates) the audit log at path
+func Open(path string) (*Log, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	err = repairTornLine(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to repair audit log: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Log{path: path, file: file}, nil
+}
+
+// repairTornLine cuts off a half written last line, left behind by a crash or power cut in the middle
+// of a write. Otherwise the next entry would be appended to it and lost along with it.
+func repairTornLine(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil
+	}
+
+	// Search backwards from the end for the last complete line
+	buf := make([]byte, 4096)
+	end := size
+	for end > 0 {
+		start := max(end-int64(len(buf)), 0)
+		chunk := buf[:end-start]
+		_, err = file.ReadAt(chunk, start)
+		if err != nil {
+			return err
+		}
+
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			end = start + int64(i) + 1
+			break
+		}
+		end = start
+	}
+	if end == size {
+		return nil
+	}
+
+	log.Printf("Audit log %s ends with a half written entry, cutting off %d bytes", path, size-end)
+	err = file.Truncate(end)
+	if err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// Record appends an entry. The time is filled in if it isn't set.
+func (l *Log) Record(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err = l.file.Write(line)
+	if err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	// Make sure the entry is on disk, not just in the page cache, before the action is reported as done
+	err = l.file.Sync()
+	if err != nil {
+		return fmt.Errorf("failed to sync audit log: %w", err)
+	}
+	return nil
+}
+
+// Query returns matching entries newest first, or oldest first if oldestFirst is set, skipping offset
+// and returning at most limit, along with the total number of matches.
+// It reads the whole file, which is fine for the few thousand entries a household produces.
+func (l *Log) Query(filter Filter, offset, limit int, oldestFirst bool) ([]Entry, int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Entry{}, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	var matches []Entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e Entry
+		// Skip a half written last line rather than failing the whole query
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		if filter.Match(e) {
+			matches = append(matches, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	// The file is in the order entries were written
+	if !oldestFirst {
+		slices.Reverse(matches)
+	}
+	total := len(matches)
+	if offset >= total {
+		return []Entry{}, total, nil
+	}
+	end := min(offset+limit, total)
+	return matches[offset:end], total, nil
+}
+
+// Close closes the log file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
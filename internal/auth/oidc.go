@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// ErrNoRole is returned when an OIDC user isn't in any of the configured groups
+var ErrNoRole = errors.New("user is not in any group that has access")
+
+// Identity is who the OIDC provider says logged in, after mapping their groups to a role
+type Identity struct {
+	Username string
+	Groups   []string
+	Role     Role
+	Cameras  []string
+}
+
+// OIDCProvider logs users in through an OpenID Connect provider using the authorization code flow
+type OIDCProvider struct {
+	cfg      config.OIDC
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCProvider fetches the provider's discovery document and sets up the client.
+// The issuer has to be reachable at startup.
+func NewOIDCProvider(ctx context.Context, cfg config.OIDC) (*OIDCProvider, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, fmt.Errorf("oidc needs an issuer, client_id and redirect_url")
+	}
+	for _, group := range cfg.Groups {
+		if !Role(group.Role).Valid() {
+			return nil, fmt.Errorf("oidc group %q: unknown role %q", group.Group, group.Role)
+		}
+	}
+
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover oidc provider %s: %w", cfg.Issuer, err)
+	}
+
+	return &OIDCProvider{
+		cfg: cfg,
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       append([]string{oidc.ScopeOpenID}, cfg.Scopes...),
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+	}, nil
+}
+
+// Name is the provider's display name for the login button
+func (p *OIDCProvider) Name() string {
+	return p.cfg.Name
+}
+
+// AuthCodeURL returns the provider URL to send the browser to.
+// state protects the callback against CSRF and nonce ties the ID token to this login attempt.
+func (p *OIDCProvider) AuthCodeURL(state, nonce string) string {
+	return p.oauth.AuthCodeURL(state, oidc.Nonce(nonce))
+}
+
+// Exchange trades the code from the callback for an ID token, verifies it,
+// and maps the user's groups to a role
+func (p *OIDCProvider) Exchange(ctx context.Context, code, nonce string) (Identity, error) {
+	token, err := p.oauth.Exchange(ctx, code)
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return Identity{}, fmt.Errorf("provider did not return an id_token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to verify id_token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return Identity{}, fmt.Errorf("id_token nonce does not match")
+	}
+
+	var claims map[string]any
+	err = idToken.Claims(&claims)
+	if err != nil {
+		return Identity{}, fmt.Errorf("failed to read id_token claims: %w", err)
+	}
+
+	identity := Identity{
+		Username: stringClaim(claims, p.cfg.UsernameClaim),
+		Groups:   stringsClaim(claims, p.cfg.GroupsClaim),
+	}
+	if identity.Username == "" {
+		identity.Username = stringClaim(claims, "email")
+	}
+	if identity.Username == "" {
+		return Identity{}, fmt.Errorf("id_token has no %q or \"email\" claim", p.cfg.UsernameClaim)
+	}
+
+	identity.Role, identity.Cameras = p.mapGroups(identity.Groups)
+	if identity.Role == "" {
+		return identity, ErrNoRole
+	}
+	return identity, nil
+}
+
+// mapGroups picks the role for a set of provider groups.
+// Any admin group makes the user an admin; otherwise they can view the cameras of all their viewer groups.
+func (p *OIDCProvider) mapGroups(groups []string) (Role, []string) {
+	var role Role
+	cameras := []string{}
+
+	for _, mapping := range p.cfg.Groups {
+		if !slices.Contains(groups, mapping.Group) {
+			continue
+		}
+		if Role(mapping.Role) == RoleAdmin {
+			return RoleAdmin, nil
+		}
+		role = RoleViewer
+		for _, camera := range mapping.Cameras {
+			if !slices.Contains(cameras, camera) {
+				cameras = append(cameras, camera)
+			}
+		}
+	}
+	return role, cameras
+}
+
+func stringClaim(claims map[string]any, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// stringsClaim reads a claim that should be a list of strings.
+// Some providers send a single string when there is only one value.
+func stringsClaim(claims map[string]any, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []any:
+		list := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
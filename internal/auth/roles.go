@@ -0,0 +1,40 @@
+package auth
+
+import "slices"
+
+// Role decides what a user is allowed to do
+type Role string
+
+const (
+	// RoleAdmin can see every camera and manage users and settings
+	RoleAdmin Role = "admin"
+	// RoleViewer can only watch the cameras they have been granted
+	RoleViewer Role = "viewer"
+)
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	return r == RoleAdmin || r == RoleViewer
+}
+
+// IsAdmin reports whether the user has the admin role
+func (u User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// CanView reports whether the user may watch a camera (live stream, snapshots, recordings, events)
+func (u User) CanView(camera string) bool {
+	return u.IsAdmin() || slices.Contains(u.Cameras, camera)
+}
+
+// VisibleCameras returns the cameras the user may see, or nil meaning "all of them" for admins
+func (u User) VisibleCameras() []string {
+	if u.IsAdmin() {
+		return nil
+	}
+	if u.Cameras == nil {
+		// An empty, non-nil list means "none", which is different from nil
+		return []string{}
+	}
+	return u.Cameras
+}
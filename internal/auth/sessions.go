@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+// Session is a logged in browser, identified by the token in its cookie
+type Session struct {
+	Token     string
+	Username  string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// SessionStore keeps login sessions in memory. Restarting the server logs everyone out.
+type SessionStore struct {
+	ttl      time.Duration
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// NewSessionStore creates a store whose sessions last for ttl
+func NewSessionStore(ttl time.Duration) *SessionStore {
+	return &SessionStore{
+		ttl:      ttl,
+		sessions: make(map[string]*Session),
+	}
+}
+
+// Create starts a new session for a user
+func (s *SessionStore) Create(username string) (*Session, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &Session{
+		Token:     token,
+		Username:  username,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.ttl),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeExpired(now)
+	s.sessions[token] = session
+	return session, nil
+}
+
+// Get returns the session for a token, or nil if it doesn't exist or has expired
+func (s *SessionStore) Get(token string) *Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[token]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(session.ExpiresAt) {
+		delete(s.sessions, token)
+		return nil
+	}
+	return session
+}
+
+// Delete ends a session (logout)
+func (s *SessionStore) Delete(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, token)
+}
+
+// removeExpired drops sessions past their expiry. Must be called with mu held.
+func (s *SessionStore) removeExpired(now time.Time) {
+	for token, session := range s.sessions {
+		if now.After(session.ExpiresAt) {
+			delete(s.sessions, token)
+		}
+	}
+}
+
+// randomToken returns 32 random bytes, base64 encoded for use in cookies and URLs
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// RandomPassword generates a password for the bootstrap admin account
+func RandomPassword() (string, error) {
+	b := make([]byte, 12)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidShareToken = errors.New("invalid share token")
+	ErrShareTokenExpired = errors.New("share token has expired")
+)
+
+// ShareSigner creates and checks signed, expiring tokens that give access to one camera
+// without an account, e.g. to let a neighbour watch the driveway for a day.
+// Tokens aren't stored anywhere; replacing the key invalidates every token issued with it.
+type ShareSigner struct {
+	key []byte
+}
+
+// ShareToken is what a valid share link gives access to
+type ShareToken struct {
+	// ID is random and differs for every link, even two for the same camera, so each one is a
+	// viewer of its own: its sessions and its bandwidth are kept apart from the other links'.
+	ID      string
+	Camera  string
+	Expires time.Time
+}
+
+// LoadShareSigner reads the signing key from path, creating a random one the first time
+func LoadShareSigner(path string) (*ShareSigner, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key, err := base64.RawStdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) < 32 {
+			return nil, fmt.Errorf("share key %s is not a valid key", path)
+		}
+		return &ShareSigner{key: key}, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read share key: %w", err)
+	}
+
+	key := make([]byte, 32)
+	_, err = rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	err = os.WriteFile(path, []byte(base64.RawStdEncoding.EncodeToString(key)), 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write share key: %w", err)
+	}
+	return &ShareSigner{key: key}, nil
+}
+
+// Sign returns a token that gives access to camera until expires, and the token's random ID.
+// The token is "<payload>.<signature>", both base64url encoded so it can go in a URL.
+func (s *ShareSigner) Sign(camera string, expires time.Time) (string, string) {
+	b := make([]byte, 8)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+
+	payload := camera + "\n" + strconv.FormatInt(expires.Unix(), 10) + "\n" + id
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded)), id
+}
+
+// Verify checks a token's signature and expiry and returns what it gives access to
+func (s *ShareSigner) Verify(token string) (ShareToken, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return ShareToken{}, ErrInvalidShareToken
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.mac(encoded)) {
+		return ShareToken{}, ErrInvalidShareToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ShareToken{}, ErrInvalidShareToken
+	}
+	fields := strings.Split(string(payload), "\n")
+	if len(fields) < 2 || len(fields) > 3 {
+		return ShareToken{}, ErrInvalidShareToken
+	}
+	unix, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return ShareToken{}, ErrInvalidShareToken
+	}
+
+	share := ShareToken{Camera: fields[0], Expires: time.Unix(unix, 0)}
+	if len(fields) == 3 {
+		share.ID = fields[2]
+	} else {
+		// Links made before they had IDs use part of their signature, which is just as much their own
+		share.ID = hex.EncodeToString(mac[:8])
+	}
+	if time.Now().After(share.Expires) {
+		return ShareToken{}, ErrShareTokenExpired
+	}
+	return share, nil
+}
+
+func (s *ShareSigner) mac(payload string) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
@@ -0,0 +1,382 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/atomicfile"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrUserExists         = errors.New("user already exists")
+	ErrUserNotFound       = errors.New("user not found")
+	// ErrLocalUser is returned when a single sign-on login would take over a local account with the same name
+	ErrLocalUser = errors.New("a local user with this name already exists")
+)
+
+// User is an account that can log in to the web UI and API
+type User struct {
+	Username string `json:"username"`
+	// bcrypt hash - the plain password is never stored
+	PasswordHash string    `json:"password_hash" secret:"true"`
+	CreatedAt    time.Time `json:"created_at"`
+	Role         Role      `json:"role"`
+	// Cameras a viewer may watch. Admins can see every camera regardless.
+	Cameras []string `json:"cameras"`
+	// Where the account comes from: empty for local accounts, "oidc" for single sign-on users.
+	// Single sign-on users have no password and get their role from the provider on every login.
+	Source string `json:"source,omitempty"`
+
+	// Two-factor authentication. TOTPSecret is only set once the user has confirmed a code;
+	// until then the new secret waits in TOTPPending.
+	TOTPSecret  string `json:"totp_secret,omitempty" secret:"true"`
+	TOTPPending string `json:"totp_pending,omitempty" secret:"true"`
+	// The time step of the last accepted code, so a code can't be used twice
+	TOTPLastStep int64 `json:"totp_last_step,omitempty"`
+}
+
+// HasTOTP reports whether the user has two-factor authentication turned on
+func (u User) HasTOTP() bool {
+	return u.TOTPSecret != ""
+}
+
+// UserStore keeps user accounts in a JSON file
+type UserStore struct {
+	path  string
+	mu    sync.RWMutex
+	users map[string]*User
+}
+
+// LoadUserStore reads the users file at path. A missing file gives an empty store.
+func LoadUserStore(path string) (*UserStore, error) {
+	store := &UserStore{
+		path:  path,
+		users: make(map[string]*User),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file: %w", err)
+	}
+
+	var users []*User
+	err = json.Unmarshal(data, &users)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse users file %s: %w", path, err)
+	}
+
+	for _, user := range users {
+		// Before roles existed the only account was the bootstrap admin
+		if user.Role == "" {
+			user.Role = RoleAdmin
+		}
+		store.users[user.Username] = user
+	}
+	return store, nil
+}
+
+// Count returns the number of users
+func (s *UserStore) Count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.users)
+}
+
+// Get returns a copy of the user, or ErrUserNotFound
+func (s *UserStore) Get(username string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return User{}, ErrUserNotFound
+	}
+	return *user, nil
+}
+
+// List returns copies of all users, sorted by username
+func (s *UserStore) List() []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]User, 0, len(s.users))
+	for _, user := range s.users {
+		list = append(list, *user)
+	}
+	slices.SortFunc(list, func(a, b User) int {
+		return strings.Compare(a.Username, b.Username)
+	})
+	return list
+}
+
+// Add creates a new user and saves the store
+func (s *UserStore) Add(username, password string, role Role, cameras []string) error {
+	if username == "" || password == "" {
+		return fmt.Errorf("username and password are required")
+	}
+	if !role.Valid() {
+		return fmt.Errorf("unknown role %q", role)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[username]; ok {
+		return ErrUserExists
+	}
+
+	s.users[username] = &User{
+		Username:     username,
+		PasswordHash: string(hash),
+		CreatedAt:    time.Now(),
+		Role:         role,
+		Cameras:      cameras,
+	}
+	return s.save()
+}
+
+// SetAccess changes a user's role and camera grants and saves the store
+func (s *UserStore) SetAccess(username string, role Role, cameras []string) error {
+	if !role.Valid() {
+		return fmt.Errorf("unknown role %q", role)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.Role = role
+	user.Cameras = cameras
+	return s.save()
+}
+
+// SyncExternal creates or updates a user that logs in through an external provider such as OIDC.
+// The role and cameras are replaced with what the provider says each time.
+func (s *UserStore) SyncExternal(source, username string, role Role, cameras []string) (User, error) {
+	if !role.Valid() {
+		return User{}, fmt.Errorf("unknown role %q", role)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[username]
+	if ok && user.Source != source {
+		return User{}, ErrLocalUser
+	}
+	if !ok {
+		user = &User{
+			Username:  username,
+			CreatedAt: time.Now(),
+			Source:    source,
+		}
+		s.users[username] = user
+	}
+	user.Role = role
+	user.Cameras = cameras
+
+	err := s.save()
+	if err != nil {
+		return User{}, err
+	}
+	return *user, nil
+}
+
+// Import adds the users, replacing any that already exist with the same username, and saves the
+// store. It is for restoring a backup, so the accounts are taken as they are, password hashes included.
+func (s *UserStore) Import(list []User) (added, updated int, err error) {
+	for _, user := range list {
+		if user.Username == "" {
+			return 0, 0, fmt.Errorf("a user has no username")
+		}
+		if !user.Role.Valid() {
+			return 0, 0, fmt.Errorf("user %s has unknown role %q", user.Username, user.Role)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range list {
+		if _, ok := s.users[user.Username]; ok {
+			updated++
+		} else {
+			added++
+		}
+		s.users[user.Username] = &user
+	}
+	return added, updated, s.save()
+}
+
+// Delete removes a user and saves the store
+func (s *UserStore) Delete(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[username]; !ok {
+		return ErrUserNotFound
+	}
+	delete(s.users, username)
+	return s.save()
+}
+
+// SetPassword replaces a user's password and saves the store
+func (s *UserStore) SetPassword(username, password string) error {
+	if password == "" {
+		return fmt.Errorf("password is required")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.PasswordHash = string(hash)
+	return s.save()
+}
+
+// Authenticate checks a username and password and returns the user if they match
+func (s *UserStore) Authenticate(username, password string) (User, error) {
+	s.mu.RLock()
+	var user User
+	stored, ok := s.users[username]
+	if ok {
+		user = *stored
+	}
+	s.mu.RUnlock()
+
+	if !ok {
+		// Compare against a dummy hash anyway so unknown usernames take as long as wrong passwords,
+		// otherwise response times reveal which usernames exist
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return User{}, ErrInvalidCredentials
+	}
+
+	// Single sign-on users have no password hash, so this always fails for them
+	err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
+	if err != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// StartTOTP stores a new pending TOTP secret for a user. It only takes effect once ConfirmTOTP succeeds,
+// so a user who never finishes setting up their app isn't locked out.
+func (s *UserStore) StartTOTP(username, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.TOTPPending = secret
+	return s.save()
+}
+
+// ConfirmTOTP turns on two-factor authentication if code matches the pending secret
+func (s *UserStore) ConfirmTOTP(username, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if user.TOTPPending == "" {
+		return ErrTOTPNotEnrolled
+	}
+
+	step, valid := verifyTOTP(user.TOTPPending, code, time.Now())
+	if !valid {
+		return ErrInvalidTOTP
+	}
+
+	user.TOTPSecret = user.TOTPPending
+	user.TOTPPending = ""
+	user.TOTPLastStep = step
+	return s.save()
+}
+
+// CheckTOTP verifies a login code. Each code is only accepted once.
+func (s *UserStore) CheckTOTP(username, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+
+	step, valid := verifyTOTP(user.TOTPSecret, code, time.Now())
+	if !valid || step <= user.TOTPLastStep {
+		return ErrInvalidTOTP
+	}
+
+	user.TOTPLastStep = step
+	return s.save()
+}
+
+// DisableTOTP turns off two-factor authentication for a user
+func (s *UserStore) DisableTOTP(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.TOTPSecret = ""
+	user.TOTPPending = ""
+	user.TOTPLastStep = 0
+	return s.save()
+}
+
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
+// save writes the store to disk. Must be called with mu held.
+// The file is replaced with atomicfile.Write, so a crash can't leave a half-written one.
+func (s *UserStore) save() error {
+	users := make([]*User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode users: %w", err)
+	}
+
+	err = atomicfile.Write(s.path, data, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write users file: %w", err)
+	}
+	return nil
+}
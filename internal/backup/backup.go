@@ -0,0 +1,284 @@
+// Package backup exports the configuration and user accounts as one JSON document, for backups and
+// for moving to a new machine, and reads it back. Secrets (fields tagged secret:"true") are either
+// redacted or encrypted with a passphrase.
+package backup
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/nisarg-dave/camera-viewer/internal/auth"
+	"github.com/nisarg-dave/camera-viewer/internal/logging"
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+)
+
+// Version is the format of the documents Export makes
+const Version = 1
+
+// encryptedPrefix marks an encrypted secret: "enc:" and the base64 of the nonce and ciphertext
+const encryptedPrefix = "enc:"
+
+var (
+	// ErrPassphraseRequired is returned by Open for an encrypted backup without a passphrase
+	ErrPassphraseRequired = errors.New("the backup's secrets are encrypted, a passphrase is required")
+	// ErrWrongPassphrase is returned by Open when the secrets don't decrypt with the passphrase
+	ErrWrongPassphrase = errors.New("the passphrase doesn't decrypt the backup's secrets")
+)
+
+// Document is a backup
+type Document struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	// How the secrets are encrypted, nil when they are redacted
+	Encryption *Encryption   `json:"encryption,omitempty"`
+	Config     config.Config `json:"config"`
+	Users      []auth.User   `json:"users"`
+	// The cameras come from the environment (.env), so they are in the backup for reference only
+	Cameras []Camera `json:"cameras"`
+}
+
+// Encryption says how the secrets were encrypted: AES-256-GCM with a key derived from the
+// passphrase by scrypt
+type Encryption struct {
+	KDF  string `json:"kdf"`
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+// Camera is a camera's connection settings, without its password
+type Camera struct {
+	ID       string `json:"id"`
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	Username string `json:"username,omitempty"`
+}
+
+// Export makes a backup. With a passphrase the secrets are encrypted with it, otherwise they are
+// replaced with "REDACTED". cfg and users are copied, not changed.
+func Export(cfg *config.Config, users []auth.User, cameras []Camera, passphrase string) (*Document, error) {
+	doc := &Document{
+		Version:    Version,
+		ExportedAt: time.Now().UTC(),
+		Config:     *cfg,
+		Users:      users,
+		Cameras:    cameras,
+	}
+
+	// Copy everything through JSON so redacting doesn't reach the maps and slices cfg shares
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode backup: %w", err)
+	}
+	doc = &Document{}
+	err = json.Unmarshal(data, doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy backup: %w", err)
+	}
+
+	seal := func(secret *string, _ string) error {
+		*secret = logging.Redacted
+		return nil
+	}
+	if passphrase != "" {
+		salt := make([]byte, 16)
+		rand.Read(salt)
+		doc.Encryption = &Encryption{KDF: "scrypt", Salt: salt, N: 1 << 15, R: 8, P: 1}
+
+		aead, err := doc.Encryption.cipher(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		seal = func(secret *string, _ string) error {
+			nonce := make([]byte, aead.NonceSize())
+			rand.Read(nonce)
+			*secret = encryptedPrefix + base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(*secret), nil))
+			return nil
+		}
+	}
+
+	err = doc.walk(nil, nil, seal)
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Open decrypts the backup's secrets with passphrase. Redacted secrets are taken from current and
+// currentUsers where the same setting is there, e.g. the same webhook or user, so a redacted backup
+// restored on the machine it came from loses nothing; elsewhere they are left empty.
+func (d *Document) Open(passphrase string, current *config.Config, currentUsers []auth.User) error {
+	if d.Version != Version {
+		return fmt.Errorf("unsupported backup version %d", d.Version)
+	}
+
+	var aead cipher.AEAD
+	if d.Encryption != nil {
+		if passphrase == "" {
+			return ErrPassphraseRequired
+		}
+		var err error
+		aead, err = d.Encryption.cipher(passphrase)
+		if err != nil {
+			return err
+		}
+	}
+
+	return d.walk(current, currentUsers, func(secret *string, previous string) error {
+		switch {
+		case *secret == logging.Redacted:
+			*secret = previous
+		case strings.HasPrefix(*secret, encryptedPrefix):
+			if aead == nil {
+				return fmt.Errorf("the backup has an encrypted secret but no encryption settings")
+			}
+			data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(*secret, encryptedPrefix))
+			if err != nil || len(data) < aead.NonceSize() {
+				return fmt.Errorf("the backup has a malformed encrypted secret")
+			}
+			plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+			if err != nil {
+				return ErrWrongPassphrase
+			}
+			*secret = string(plain)
+		}
+		return nil
+	})
+}
+
+// cipher derives the key from the passphrase
+func (e *Encryption) cipher(passphrase string) (cipher.AEAD, error) {
+	if e.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported key derivation %q", e.KDF)
+	}
+	key, err := scrypt.Key([]byte(passphrase), e.Salt, e.N, e.R, e.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// walk calls fn for every non-empty secret in the document, with the value of the same setting in
+// current and currentUsers, or "" when there is none
+func (d *Document) walk(current *config.Config, currentUsers []auth.User, fn func(secret *string, previous string) error) error {
+	var previous reflect.Value
+	if current != nil {
+		previous = reflect.ValueOf(current).Elem()
+	}
+	err := walkSecrets(reflect.ValueOf(&d.Config).Elem(), previous, false, fn)
+	if err != nil {
+		return err
+	}
+
+	for i := range d.Users {
+		previous := reflect.Value{}
+		for j := range currentUsers {
+			if currentUsers[j].Username == d.Users[i].Username {
+				previous = reflect.ValueOf(currentUsers[j])
+			}
+		}
+		err = walkSecrets(reflect.ValueOf(&d.Users[i]).Elem(), previous, false, fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkSecrets goes through v looking for secrets, following previous along where it has the same
+// fields, list entries or map keys. secret is whether v's field was tagged.
+func walkSecrets(v, previous reflect.Value, secret bool, fn func(secret *string, previous string) error) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		if previous.IsValid() && previous.IsNil() {
+			previous = reflect.Value{}
+		}
+		if previous.IsValid() {
+			previous = previous.Elem()
+		}
+		return walkSecrets(v.Elem(), previous, secret, fn)
+
+	case reflect.Struct:
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			var previousField reflect.Value
+			if previous.IsValid() {
+				previousField = previous.Field(i)
+			}
+			err := walkSecrets(v.Field(i), previousField, field.Tag.Get("secret") == "true", fn)
+			if err != nil {
+				return fmt.Errorf("%s: %w", field.Name, err)
+			}
+		}
+
+	case reflect.Slice:
+		for i := range v.Len() {
+			var previousItem reflect.Value
+			if previous.IsValid() && i < previous.Len() {
+				previousItem = previous.Index(i)
+			}
+			err := walkSecrets(v.Index(i), previousItem, secret, fn)
+			if err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		if !secret || v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+		for _, key := range v.MapKeys() {
+			value := v.MapIndex(key).String()
+			previousValue := ""
+			if previous.IsValid() && !previous.IsNil() {
+				if item := previous.MapIndex(key); item.IsValid() {
+					previousValue = item.String()
+				}
+			}
+			if value == "" {
+				continue
+			}
+			err := fn(&value, previousValue)
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(key, reflect.ValueOf(value).Convert(v.Type().Elem()))
+		}
+
+	case reflect.String:
+		if secret && v.String() != "" {
+			value := v.String()
+			previousValue := ""
+			if previous.IsValid() {
+				previousValue = previous.String()
+			}
+			err := fn(&value, previousValue)
+			if err != nil {
+				return err
+			}
+			v.SetString(value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Package capture writes RTP packets to files that Wireshark and rtptools can read, so a camera's
+// stream, or what viewers were sent, can be attached to a bug report about codecs or packetization.
+package capture
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// Capture file formats
+const (
+	FormatPcap    = "pcap"
+	FormatRTPDump = "rtpdump"
+)
+
+// Flow is the addresses a packet is written with. The camera's RTP often comes over the RTSP
+// connection and viewers' over ICE, so these are made up, but they tell the two apart, and viewers
+// from each other, in Wireshark.
+type Flow struct {
+	Src netip.AddrPort
+	Dst netip.AddrPort
+}
+
+// Camera is the flow of the packets from the camera to the server
+var Camera = Flow{
+	Src: netip.AddrPortFrom(netip.AddrFrom4([4]byte{10, 0, 0, 1}), 5004),
+	Dst: netip.AddrPortFrom(netip.AddrFrom4([4]byte{10, 0, 0, 2}), 5004),
+}
+
+// Viewer is the flow of the packets from the server to the nth viewer
+func Viewer(n int) Flow {
+	return Flow{
+		Src: netip.AddrPortFrom(netip.AddrFrom4([4]byte{10, 0, 0, 2}), 5006),
+		Dst: netip.AddrPortFrom(netip.AddrFrom4([4]byte{10, 0, 1 + byte(n>>8), byte(n)}), 5006),
+	}
+}
+
+// Writer writes packets to a capture file. It is safe for concurrent use.
+type Writer interface {
+	// WritePacket writes pkt as having gone along flow at at
+	WritePacket(pkt *rtp.Packet, flow Flow, at time.Time) error
+}
+
+// FormatFromName returns the format a file's extension asks for: .pcap, or .rtpdump or .rtp
+func FormatFromName(name string) (string, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".pcap":
+		return FormatPcap, nil
+	case ".rtpdump", ".rtp":
+		return FormatRTPDump, nil
+	}
+	return "", fmt.Errorf("can't tell the capture format from %s, use .pcap or .rtpdump", name)
+}
+
+// NewWriter starts a capture in format on w. rtpdump files hold one flow, the camera's, and give
+// packets' times from start.
+func NewWriter(format string, w io.Writer, start time.Time) (Writer, error) {
+	switch format {
+	case FormatPcap:
+		return NewPcapWriter(w)
+	case FormatRTPDump:
+		return NewRTPDumpWriter(w, Camera, start)
+	}
+	return nil, fmt.Errorf("unknown capture format %q, must be %s or %s", format, FormatPcap, FormatRTPDump)
+}
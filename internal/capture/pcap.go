@@ -0,0 +1,103 @@
+package capture
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+const (
+	// linkTypeRaw says the packets start with their IP header, with no link layer in front
+	linkTypeRaw    = 101
+	ipv4HeaderSize = 20
+	udpHeaderSize  = 8
+)
+
+// pcapWriter writes the classic pcap format, with each packet in a made-up UDP datagram.
+// Wireshark shows them as RTP with Decode As, or with the rtp_udp heuristic turned on.
+type pcapWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf []byte
+}
+
+// NewPcapWriter writes the file header to w and returns the writer for the packets
+func NewPcapWriter(w io.Writer) (Writer, error) {
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], 0xa1b2c3d4) // microsecond timestamps
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535) // snapshot length
+	binary.LittleEndian.PutUint32(header[20:], linkTypeRaw)
+	_, err := w.Write(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write pcap header: %w", err)
+	}
+	return &pcapWriter{w: w}, nil
+}
+
+// WritePacket writes pkt in a UDP datagram between flow's addresses, which must be IPv4
+func (p *pcapWriter) WritePacket(pkt *rtp.Packet, flow Flow, at time.Time) error {
+	payload, err := pkt.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal packet: %w", err)
+	}
+	if !flow.Src.Addr().Is4() || !flow.Dst.Addr().Is4() {
+		return fmt.Errorf("only IPv4 flows can be written")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	size := ipv4HeaderSize + udpHeaderSize + len(payload)
+	if size > 65535 {
+		return fmt.Errorf("packet of %d bytes is too big for UDP", len(payload))
+	}
+
+	buf := p.buf[:0]
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(at.Unix()))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(at.Nanosecond()/1000))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(size))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(size))
+
+	ip := len(buf)
+	buf = append(buf, 0x45, 0)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(size))
+	// Identification, then don't fragment
+	buf = append(buf, 0, 0, 0x40, 0)
+	// TTL, UDP, and the checksum, filled in below
+	buf = append(buf, 64, 17, 0, 0)
+	buf = append(buf, flow.Src.Addr().AsSlice()...)
+	buf = append(buf, flow.Dst.Addr().AsSlice()...)
+	binary.BigEndian.PutUint16(buf[ip+10:], ipv4Checksum(buf[ip:]))
+
+	buf = binary.BigEndian.AppendUint16(buf, flow.Src.Port())
+	buf = binary.BigEndian.AppendUint16(buf, flow.Dst.Port())
+	buf = binary.BigEndian.AppendUint16(buf, uint16(udpHeaderSize+len(payload)))
+	// No checksum, which UDP over IPv4 allows
+	buf = append(buf, 0, 0)
+	buf = append(buf, payload...)
+	p.buf = buf
+
+	_, err = p.w.Write(buf)
+	if err != nil {
+		return fmt.Errorf("failed to write packet: %w", err)
+	}
+	return nil
+}
+
+// ipv4Checksum is the checksum of an IPv4 header, with its own checksum field zero
+func ipv4Checksum(header []byte) uint16 {
+	var sum uint32
+	for i := 0; i < ipv4HeaderSize; i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(header[i:]))
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,70 @@
+package capture
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// rtpdumpWriter writes the rtpdump format of rtptools, which rtpplay can send back out to a player
+// or to the server under test. It holds one flow, given in its header, and packets' times are
+// milliseconds from the start.
+type rtpdumpWriter struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+	buf   []byte
+}
+
+// NewRTPDumpWriter writes the file header, for packets along flow from start, to w and returns the
+// writer for the packets. Packets' own flows are ignored.
+func NewRTPDumpWriter(w io.Writer, flow Flow, start time.Time) (Writer, error) {
+	header := fmt.Appendf(nil, "#!rtpplay1.0 %s/%d\n", flow.Dst.Addr(), flow.Dst.Port())
+	header = binary.BigEndian.AppendUint32(header, uint32(start.Unix()))
+	header = binary.BigEndian.AppendUint32(header, uint32(start.Nanosecond()/1000))
+	var source [4]byte
+	if flow.Src.Addr().Is4() {
+		source = flow.Src.Addr().As4()
+	}
+	header = append(header, source[:]...)
+	header = binary.BigEndian.AppendUint16(header, flow.Src.Port())
+	// Padding
+	header = append(header, 0, 0)
+	_, err := w.Write(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write rtpdump header: %w", err)
+	}
+	return &rtpdumpWriter{w: w, start: start}, nil
+}
+
+// WritePacket writes pkt with its time from the start
+func (r *rtpdumpWriter) WritePacket(pkt *rtp.Packet, _ Flow, at time.Time) error {
+	payload, err := pkt.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal packet: %w", err)
+	}
+	// The record's length includes its own 8 byte header
+	if len(payload)+8 > 65535 {
+		return fmt.Errorf("packet of %d bytes is too big for rtpdump", len(payload))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	buf := r.buf[:0]
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(payload)+8))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(payload)))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(max(at.Sub(r.start), 0).Milliseconds()))
+	buf = append(buf, payload...)
+	r.buf = buf
+
+	_, err = r.w.Write(buf)
+	if err != nil {
+		return fmt.Errorf("failed to write packet: %w", err)
+	}
+	return nil
+}
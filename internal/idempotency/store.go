@@ -0,0 +1,152 @@
+// Package idempotency remembers the responses to requests sent with an Idempotency-Key header,
+// so a client retrying after a dropped connection gets the first response again instead of
+// creating a second user, share link or viewer session.
+package idempotency
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrInProgress is returned by Begin while the first request with a key hasn't finished
+var ErrInProgress = errors.New("a request with this idempotency key is still in progress")
+
+// ErrKeyReused is returned by Begin when a key comes back with a different request
+var ErrKeyReused = errors.New("the idempotency key was already used for a different request")
+
+// Response is what was sent for a key, to send again
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+type entry struct {
+	fingerprint string
+	// nil while the first request is still being handled
+	response *Response
+	expires  time.Time
+}
+
+// size is how much of the byte limit a stored response counts for
+func (r *Response) size() int {
+	n := len(r.Body)
+	for name, values := range r.Header {
+		n += len(name)
+		for _, value := range values {
+			n += len(value)
+		}
+	}
+	return n
+}
+
+// answered is a stored response, in the order they were stored, so the oldest can be evicted
+type answered struct {
+	key   string
+	entry *entry
+}
+
+// Store keeps responses by key for ttl after they were sent, up to maxEntries of them and maxBytes
+// in all. Past either limit the oldest responses are forgotten first, so a flood of keys costs
+// bounded memory; a retry of an evicted key runs the request again.
+type Store struct {
+	ttl        time.Duration
+	maxEntries int
+	maxBytes   int
+
+	mu          sync.Mutex
+	entries     map[string]*entry
+	answered    []answered
+	bytes       int
+	lastCleanup time.Time
+}
+
+// NewStore creates a store that remembers each response for ttl, keeping at most maxEntries
+// responses and maxBytes of them
+func NewStore(ttl time.Duration, maxEntries, maxBytes int) *Store {
+	return &Store{
+		ttl:         ttl,
+		maxEntries:  maxEntries,
+		maxBytes:    maxBytes,
+		entries:     make(map[string]*entry),
+		lastCleanup: time.Now(),
+	}
+}
+
+// Begin claims key for a request. fingerprint identifies the request (e.g. a hash of its body),
+// so a key sent again with something else can be refused. It returns the stored response when the
+// key has been answered before, and nil when the caller should handle the request and then call Finish.
+func (s *Store) Begin(key, fingerprint string) (*Response, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Forget expired keys now and then so the map doesn't grow forever. Responses are kept for
+	// the same time, so the expired ones are the oldest.
+	if now.Sub(s.lastCleanup) > s.ttl/10 {
+		for len(s.answered) > 0 && now.After(s.answered[0].entry.expires) {
+			s.evictOldest()
+		}
+		s.lastCleanup = now
+	}
+
+	e, ok := s.entries[key]
+	if ok && e.response != nil && now.After(e.expires) {
+		// It stays in answered until evicted, which sees it has been replaced
+		s.forget(key, e)
+		ok = false
+	}
+	if !ok {
+		s.entries[key] = &entry{fingerprint: fingerprint}
+		return nil, nil
+	}
+	if e.fingerprint != fingerprint {
+		return nil, ErrKeyReused
+	}
+	if e.response == nil {
+		return nil, ErrInProgress
+	}
+	return e.response, nil
+}
+
+// Finish stores the response to the request that claimed key with Begin. A nil response forgets
+// the key instead, so a request that failed can be retried with it.
+func (s *Store) Finish(key string, response *Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if response == nil {
+		delete(s.entries, key)
+		return
+	}
+	e, ok := s.entries[key]
+	if !ok {
+		return
+	}
+	e.response = response
+	e.expires = time.Now().Add(s.ttl)
+	s.answered = append(s.answered, answered{key: key, entry: e})
+	s.bytes += response.size()
+	for len(s.answered) > s.maxEntries || s.bytes > s.maxBytes {
+		s.evictOldest()
+	}
+}
+
+// evictOldest forgets the oldest stored response
+func (s *Store) evictOldest() {
+	oldest := s.answered[0]
+	s.answered[0] = answered{}
+	s.answered = s.answered[1:]
+	s.forget(oldest.key, oldest.entry)
+	s.bytes -= oldest.entry.response.size()
+}
+
+// forget removes key, unless it has been claimed again since e was stored for it
+func (s *Store) forget(key string, e *entry) {
+	if s.entries[key] == e {
+		delete(s.entries, key)
+	}
+}
@@ -0,0 +1,256 @@
+// Package jobs runs long operations, like probing a camera, in the background. The request that
+// starts one gets its ID straight away and polls for progress and the result, instead of holding
+// an HTTP connection open for minutes.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("job not found")
+	// ErrFinished is returned by Cancel for a job that has already finished
+	ErrFinished = errors.New("job has already finished")
+)
+
+// State is where a job is in its life
+type State string
+
+const (
+	StateQueued    State = "queued"
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateCancelled State = "cancelled"
+)
+
+// Finished reports whether a job in this state is done, one way or another
+func (s State) Finished() bool {
+	return s == StateSucceeded || s == StateFailed || s == StateCancelled
+}
+
+// Job is a background operation's progress, and once it has finished, its result or error
+type Job struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Who started it
+	User   string `json:"user"`
+	Camera string `json:"camera,omitempty"`
+	State  State  `json:"state"`
+	// From 0 to 1
+	Progress float64 `json:"progress"`
+	// What it is doing now, for people
+	Message string `json:"message,omitempty"`
+	// Set when it succeeded, depending on the type
+	Result any `json:"result,omitempty"`
+	// Set when it failed or was cancelled
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	StartedAt  time.Time `json:"started_at,omitzero"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+}
+
+// Func does a job's work and returns its result. report updates the job's progress (0 to 1) and
+// message. ctx is cancelled when the job is cancelled or the server shuts down.
+type Func func(ctx context.Context, report func(progress float64, message string)) (any, error)
+
+type entry struct {
+	job    Job
+	cancel context.CancelFunc
+}
+
+// Manager runs jobs, a few at a time, and keeps finished ones for a while so their results can be fetched
+type Manager struct {
+	// Jobs run under ctx, so cancelling it cancels them all
+	ctx    context.Context
+	retain time.Duration
+	// Holds a token for every running job
+	slots chan struct{}
+
+	mu       sync.Mutex
+	jobs     map[string]*entry
+	onFinish func(Job)
+}
+
+// NewManager runs up to concurrency jobs at once under ctx. Finished jobs are forgotten after retain.
+func NewManager(ctx context.Context, concurrency int, retain time.Duration) *Manager {
+	return &Manager{
+		ctx:    ctx,
+		retain: retain,
+		slots:  make(chan struct{}, concurrency),
+		jobs:   make(map[string]*entry),
+	}
+}
+
+// OnFinish sets a function that is called with every job once it has finished
+func (m *Manager) OnFinish(handler func(Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onFinish = handler
+}
+
+// Start queues a job and returns it. It runs once fewer than concurrency jobs are running.
+func (m *Manager) Start(jobType, user, camera string, fn Func) Job {
+	ctx, cancel := context.WithCancel(m.ctx)
+	e := &entry{
+		job: Job{
+			ID:        newID(),
+			Type:      jobType,
+			User:      user,
+			Camera:    camera,
+			State:     StateQueued,
+			CreatedAt: time.Now(),
+		},
+		cancel: cancel,
+	}
+
+	m.mu.Lock()
+	m.prune(time.Now())
+	m.jobs[e.job.ID] = e
+	job := e.job
+	m.mu.Unlock()
+
+	go m.run(ctx, e, fn)
+	return job
+}
+
+// run waits for a slot and does the job
+func (m *Manager) run(ctx context.Context, e *entry, fn Func) {
+	defer e.cancel()
+
+	select {
+	case m.slots <- struct{}{}:
+		defer func() { <-m.slots }()
+	case <-ctx.Done():
+		m.finish(e, nil, ctx.Err())
+		return
+	}
+
+	m.update(e, func(job *Job) {
+		job.State = StateRunning
+		job.StartedAt = time.Now()
+	})
+
+	var result any
+	err := func() (err error) {
+		// A panicking job fails instead of taking the server down
+		defer func() {
+			if p := recover(); p != nil {
+				err = fmt.Errorf("job panicked: %v", p)
+			}
+		}()
+		result, err = fn(ctx, func(progress float64, message string) {
+			m.update(e, func(job *Job) {
+				job.Progress = min(max(progress, 0), 1)
+				job.Message = message
+			})
+		})
+		return err
+	}()
+	// Work that finished anyway after being cancelled still counts as cancelled
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	m.finish(e, result, err)
+}
+
+// update changes a job under the lock
+func (m *Manager) update(e *entry, change func(*Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	change(&e.job)
+}
+
+// finish records how a job ended and tells OnFinish's handler
+func (m *Manager) finish(e *entry, result any, err error) {
+	m.mu.Lock()
+	job := &e.job
+	job.FinishedAt = time.Now()
+	switch {
+	case errors.Is(err, context.Canceled):
+		job.State = StateCancelled
+		job.Error = "cancelled"
+	case err != nil:
+		job.State = StateFailed
+		job.Error = err.Error()
+	default:
+		job.State = StateSucceeded
+		job.Progress = 1
+		job.Result = result
+	}
+	finished := *job
+	onFinish := m.onFinish
+	m.mu.Unlock()
+
+	if onFinish != nil {
+		onFinish(finished)
+	}
+}
+
+// Get returns a job, or ErrNotFound
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return e.job, nil
+}
+
+// List returns every job that hasn't been forgotten yet, newest first
+func (m *Manager) List() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune(time.Now())
+	list := make([]Job, 0, len(m.jobs))
+	for _, e := range m.jobs {
+		list = append(list, e.job)
+	}
+	slices.SortFunc(list, func(a, b Job) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return list
+}
+
+// Cancel stops a queued or running job. It returns the job as it is; the job's state changes
+// to cancelled once its work has stopped.
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	if e.job.State.Finished() {
+		return e.job, ErrFinished
+	}
+	e.cancel()
+	return e.job, nil
+}
+
+// prune forgets jobs that finished more than retain ago. Must be called with mu held.
+func (m *Manager) prune(now time.Time) {
+	for id, e := range m.jobs {
+		if e.job.State.Finished() && now.Sub(e.job.FinishedAt) > m.retain {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// newID returns a random job ID
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// Sample is one minute of a camera's key numbers
+type Sample struct {
+	Time       time.Time `json:"time"`
+	BitrateBps float64   `json:"bitrate_bps"`
+	FPS        float64   `json:"fps"`
+	LossRatio  float64   `json:"loss_ratio"`
+	JitterMs   float64   `json:"jitter_ms"`
+	Viewers    int       `json:"viewers"`
+}
+
+// History keeps the last samples of each camera in memory, so there are basic graphs
+// without running Prometheus. Old samples are overwritten once a camera's buffer is full.
+type History struct {
+	size int
+
+	mu      sync.RWMutex
+	cameras map[string]*ring
+}
+
+// ring is a fixed size circular buffer of samples
+type ring struct {
+	samples []Sample
+	next    int
+	full    bool
+}
+
+// NewHistory keeps up to size samples per camera, e.g. 1440 for a day of one minute samples
+func NewHistory(size int) *History {
+	return &History{
+		size:    size,
+		cameras: make(map[string]*ring),
+	}
+}
+
+// Add records a sample for camera
+func (h *History) Add(camera string, sample Sample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, ok := h.cameras[camera]
+	if !ok {
+		r = &ring{samples: make([]Sample, h.size)}
+		h.cameras[camera] = r
+	}
+
+	r.samples[r.next] = sample
+	r.next = (r.next + 1) % h.size
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Since returns the camera's samples from since onwards, oldest first
+func (h *History) Since(camera string, since time.Time) []Sample {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	list := []Sample{}
+	r, ok := h.cameras[camera]
+	if !ok {
+		return list
+	}
+
+	// When the buffer has wrapped the oldest sample is the one about to be overwritten
+	start, count := 0, r.next
+	if r.full {
+		start, count = r.next, h.size
+	}
+	for i := range count {
+		sample := r.samples[(start+i)%h.size]
+		if !sample.Time.Before(since) {
+			list = append(list, sample)
+		}
+	}
+	return list
+}
@@ -0,0 +1,353 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// All metric names start with this, e.g. camera_viewer_rtp_packets_received_total
+const namespace = "camera_viewer"
+
+var (
+	rtpPacketsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rtp_packets_received_total",
+		Help:      "RTP packets received from the camera.",
+	}, []string{"camera"})
+
+	rtpBytesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rtp_bytes_received_total",
+		Help:      "RTP bytes received from the camera, including RTP headers.",
+	}, []string{"camera"})
+
+	rtpPacketsLost = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rtp_packets_lost_total",
+		Help:      "RTP packets from the camera that never arrived, from gaps in the sequence numbers.",
+	}, []string{"camera"})
+
+	ingestJitter = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ingest_jitter_seconds",
+		Help:      "RFC 3550 interarrival jitter of the camera's RTP packets.",
+	}, []string{"camera"})
+
+	ingestBitrate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ingest_bitrate_bits_per_second",
+		Help:      "Video bitrate arriving from the camera.",
+	}, []string{"camera"})
+
+	ingestFPS = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ingest_frames_per_second",
+		Help:      "Video frame rate arriving from the camera.",
+	}, []string{"camera"})
+
+	rtpPacketsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rtp_packets_sent_total",
+		Help:      "RTP packets sent to viewers, counting each viewer separately.",
+	}, []string{"camera"})
+
+	rtpBytesSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rtp_bytes_sent_total",
+		Help:      "RTP bytes sent to viewers, counting each viewer separately.",
+	}, []string{"camera"})
+
+	packetWriteErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "packet_write_errors_total",
+		Help:      "Errors writing a camera packet to a viewer's WebRTC track.",
+	}, []string{"camera"})
+
+	viewerPacketsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "viewer_packets_dropped_total",
+		Help:      "Packets dropped because a viewer's send queue was full, counting each viewer separately.",
+	}, []string{"camera"})
+
+	gopCacheBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "gop_cache_bytes",
+		Help:      "Bytes of video held in the camera's GOP cache for viewers who join mid-GOP.",
+	}, []string{"camera"})
+
+	gopCacheDrops = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "gop_cache_drops_total",
+		Help:      "Times the camera's GOP cache went over its byte budget and was thrown away until the next keyframe.",
+	}, []string{"camera"})
+
+	keyframeRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "viewer_keyframe_requests_total",
+		Help:      "Keyframe requests (PLI or FIR) from viewers' browsers, not counting repeats within a second.",
+	}, []string{"camera"})
+
+	nackedPackets = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "viewer_nacked_packets_total",
+		Help:      "Packets viewers' browsers reported lost with a NACK and asked to be sent again.",
+	}, []string{"camera"})
+
+	timestampJumps = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "video_timestamp_jumps_total",
+		Help:      "Times the video's RTP timestamps jumped, e.g. after a reconnect, and were re-stamped to carry on.",
+	}, []string{"camera"})
+
+	viewerSessions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "viewer_sessions",
+		Help:      "Viewer sessions currently open.",
+	}, []string{"camera"})
+
+	rtspReconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rtsp_reconnects_total",
+		Help:      "Times the RTSP connection to the camera was re-established after the first connect.",
+	}, []string{"camera"})
+
+	rtspWatchdogRestarts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rtsp_watchdog_restarts_total",
+		Help:      "Times a connected camera was torn down and reconnected because it stopped sending packets.",
+	}, []string{"camera"})
+
+	webrtcConnectionStates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webrtc_connection_states_total",
+		Help:      "WebRTC peer connection state changes, by the state entered.",
+	}, []string{"state"})
+
+	viewerStartup = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "viewer_startup_seconds",
+		Help:      "How long new viewers waited for video, by phase: signaling, ice, dtls, first_packet, keyframe_wait and total.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 3, 5, 10, 20},
+	}, []string{"phase"})
+
+	storageFree = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "storage_free_bytes",
+		Help:      "Free space on the filesystem data is written to.",
+	}, []string{"path"})
+
+	storageTotal = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "storage_total_bytes",
+		Help:      "Size of the filesystem data is written to.",
+	}, []string{"path"})
+
+	storageWritten = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_written_bytes_total",
+		Help:      "Bytes of the files replaced in a directory, e.g. users and bandwidth usage in the data directory.",
+	}, []string{"path"})
+
+	storageFinalize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_finalize_seconds",
+		Help:      "How long replacing a file in a directory took to reach the disk: writing and syncing it, renaming it into place and syncing the directory.",
+		Buckets:   []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+	}, []string{"path"})
+
+	panics = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "panics_total",
+		Help:      "Panics that were recovered instead of crashing the process, by component.",
+	}, []string{"component"})
+
+	subsystemRestarts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "subsystem_restarts_total",
+		Help:      "Times a background subsystem failed and was restarted, by subsystem.",
+	}, []string{"subsystem"})
+
+	eventsPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_total",
+		Help:      "Events published on the event bus, by type.",
+	}, []string{"type"})
+)
+
+// Camera holds the per-packet counters for one camera, looked up once so the packet path
+// doesn't pay for a label lookup on every packet
+type Camera struct {
+	PacketsReceived  prometheus.Counter
+	BytesReceived    prometheus.Counter
+	PacketsLost      prometheus.Counter
+	IngestJitter     prometheus.Gauge
+	IngestBitrate    prometheus.Gauge
+	IngestFPS        prometheus.Gauge
+	PacketsSent      prometheus.Counter
+	BytesSent        prometheus.Counter
+	WriteErrors      prometheus.Counter
+	ViewerDrops      prometheus.Counter
+	GOPCacheBytes    prometheus.Gauge
+	GOPCacheDrops    prometheus.Counter
+	KeyframeRequests prometheus.Counter
+	NACKedPackets    prometheus.Counter
+	TimestampJumps   prometheus.Counter
+	ViewerSessions   prometheus.Gauge
+	Reconnects       prometheus.Counter
+	// Reconnects forced by the no-packet watchdog
+	WatchdogRestarts prometheus.Counter
+}
+
+var cameras sync.Map // camera ID -> *Camera
+
+// ForCamera returns the metrics for a camera
+func ForCamera(camera string) *Camera {
+	if m, ok := cameras.Load(camera); ok {
+		return m.(*Camera)
+	}
+
+	m, _ := cameras.LoadOrStore(camera, &Camera{
+		PacketsReceived:  rtpPacketsReceived.WithLabelValues(camera),
+		BytesReceived:    rtpBytesReceived.WithLabelValues(camera),
+		PacketsLost:      rtpPacketsLost.WithLabelValues(camera),
+		IngestJitter:     ingestJitter.WithLabelValues(camera),
+		IngestBitrate:    ingestBitrate.WithLabelValues(camera),
+		IngestFPS:        ingestFPS.WithLabelValues(camera),
+		PacketsSent:      rtpPacketsSent.WithLabelValues(camera),
+		BytesSent:        rtpBytesSent.WithLabelValues(camera),
+		WriteErrors:      packetWriteErrors.WithLabelValues(camera),
+		ViewerDrops:      viewerPacketsDropped.WithLabelValues(camera),
+		GOPCacheBytes:    gopCacheBytes.WithLabelValues(camera),
+		GOPCacheDrops:    gopCacheDrops.WithLabelValues(camera),
+		KeyframeRequests: keyframeRequests.WithLabelValues(camera),
+		NACKedPackets:    nackedPackets.WithLabelValues(camera),
+		TimestampJumps:   timestampJumps.WithLabelValues(camera),
+		ViewerSessions:   viewerSessions.WithLabelValues(camera),
+		Reconnects:       rtspReconnects.WithLabelValues(camera),
+		WatchdogRestarts: rtspWatchdogRestarts.WithLabelValues(camera),
+	})
+	return m.(*Camera)
+}
+
+// WebRTCConnectionState counts a viewer's peer connection entering a state
+func WebRTCConnectionState(state string) {
+	webrtcConnectionStates.WithLabelValues(state).Inc()
+}
+
+// ViewerStartup records how long a phase of a new viewer's startup took
+func ViewerStartup(phase string, ms float64) {
+	viewerStartup.WithLabelValues(phase).Observe(ms / 1000)
+}
+
+// StorageFree records the free space on the filesystem path is on
+func StorageFree(path string, bytes uint64) {
+	storageFree.WithLabelValues(path).Set(float64(bytes))
+}
+
+// StorageTotal records the size of the filesystem path is on
+func StorageTotal(path string, bytes uint64) {
+	storageTotal.WithLabelValues(path).Set(float64(bytes))
+}
+
+// StorageWrite records a file of bytes replaced in the directory path, which took finalize to reach the disk
+func StorageWrite(path string, bytes int, finalize time.Duration) {
+	storageWritten.WithLabelValues(path).Add(float64(bytes))
+	storageFinalize.WithLabelValues(path).Observe(finalize.Seconds())
+}
+
+// Panic counts a recovered panic in a component, see the recovery package
+func Panic(component string) {
+	panics.WithLabelValues(component).Inc()
+}
+
+// SubsystemRestart counts a background subsystem being restarted after it failed
+func SubsystemRestart(subsystem string) {
+	subsystemRestarts.WithLabelValues(subsystem).Inc()
+}
+
+// CountEvents counts every event published on the bus by type until stop is closed.
+// This blocks, so call it in a goroutine.
+func CountEvents(bus *events.Bus, stop <-chan struct{}) {
+	sub := bus.Subscribe(256, nil)
+	defer sub.Close()
+	for {
+		select {
+		case <-stop:
+			return
+		case event := <-sub.C:
+			eventsPublished.WithLabelValues(string(event.Type)).Inc()
+		}
+	}
+}
+
+// funcCounter is a counter registered with CounterFunc. Every Server in a program registers the
+// same ones, so it adds up their functions, and keeps the last value of those that have gone so
+// it never goes down.
+type funcCounter struct {
+	mu   sync.Mutex
+	fns  map[*func() float64]struct{}
+	gone float64
+}
+
+func (c *funcCounter) value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	total := c.gone
+	for fn := range c.fns {
+		total += (*fn)()
+	}
+	return total
+}
+
+var (
+	funcCountersMu sync.Mutex
+	// By name and labels
+	funcCounters = map[string]*funcCounter{}
+)
+
+// CounterFunc registers a counter whose value is read from fn when scraped,
+// for things that already keep their own count like the rate limiters.
+// The returned func stops reading fn, once what it counts has gone.
+func CounterFunc(name, help string, labels map[string]string, fn func() float64) (unregister func()) {
+	key := name + fmt.Sprint(labels)
+
+	funcCountersMu.Lock()
+	counter, ok := funcCounters[key]
+	if !ok {
+		counter = &funcCounter{fns: map[*func() float64]struct{}{}}
+		funcCounters[key] = counter
+		prometheus.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        name,
+			Help:        help,
+			ConstLabels: labels,
+		}, counter.value))
+	}
+	funcCountersMu.Unlock()
+
+	counter.mu.Lock()
+	counter.fns[&fn] = struct{}{}
+	counter.mu.Unlock()
+
+	return func() {
+		counter.mu.Lock()
+		defer counter.mu.Unlock()
+		if _, ok := counter.fns[&fn]; ok {
+			delete(counter.fns, &fn)
+			counter.gone += fn()
+		}
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
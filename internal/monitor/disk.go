@@ -0,0 +1,101 @@
+package monitor
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/metrics"
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+)
+
+// DiskUsage is the space on the filesystem a directory is on
+type DiskUsage struct {
+	Path       string `json:"path"`
+	FreeBytes  uint64 `json:"free_bytes"`
+	TotalBytes uint64 `json:"total_bytes"`
+	Low        bool   `json:"low"`
+}
+
+// DiskMonitor checks the free space where data is written and publishes an event when it runs low,
+// before writes start failing
+type DiskMonitor struct {
+	path    string
+	minFree uint64
+	bus     *events.Bus
+
+	mu    sync.Mutex
+	usage DiskUsage
+}
+
+// NewDiskMonitor watches the filesystem path is on, warning when less than minFree bytes are left
+func NewDiskMonitor(path string, minFree uint64, bus *events.Bus) *DiskMonitor {
+	// Cleaned, so the metrics' path is the same as for the files written there, see atomicfile.Write
+	path = filepath.Clean(path)
+	return &DiskMonitor{
+		path:    path,
+		minFree: minFree,
+		bus:     bus,
+		usage:   DiskUsage{Path: path},
+	}
+}
+
+// Run checks the free space every minute until stop is closed. This blocks, so call it in a goroutine.
+func (d *DiskMonitor) Run(stop <-chan struct{}) {
+	d.check()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			d.check()
+		}
+	}
+}
+
+// Usage returns the result of the last check
+func (d *DiskMonitor) Usage() DiskUsage {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.usage
+}
+
+func (d *DiskMonitor) check() {
+	free, total, err := diskSpace(d.path)
+	if err != nil {
+		log.Printf("Failed to check free space in %s: %v", d.path, err)
+		return
+	}
+
+	metrics.StorageFree(d.path, free)
+	metrics.StorageTotal(d.path, total)
+
+	d.mu.Lock()
+	wasLow := d.usage.Low
+	d.usage.FreeBytes = free
+	d.usage.TotalBytes = total
+	d.usage.Low = free < d.minFree
+	low := d.usage.Low
+	d.mu.Unlock()
+
+	// Only the change is published, not every minute it stays low
+	if low && !wasLow {
+		d.bus.Publish(events.Event{
+			Type:    events.TypeDiskSpaceLow,
+			Message: fmt.Sprintf("only %.1f GB free in %s", float64(free)/1e9, d.path),
+			Data: map[string]any{
+				"path":       d.path,
+				"free_bytes": free,
+			},
+		})
+	}
+	if !low && wasLow {
+		log.Printf("Free space in %s is back to %.1f GB", d.path, float64(free)/1e9)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package monitor
+
+import "errors"
+
+// diskSpace isn't implemented on this platform
+func diskSpace(path string) (uint64, uint64, error) {
+	return 0, 0, errors.New("free space checks are not supported on this platform")
+}
@@ -0,0 +1,16 @@
+//go:build unix
+
+package monitor
+
+import "syscall"
+
+// diskSpace returns the free and total bytes of the filesystem path is on
+func diskSpace(path string) (uint64, uint64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, 0, err
+	}
+	// Bavail is what unprivileged users can use, which is what we are
+	return stat.Bavail * uint64(stat.Bsize), stat.Blocks * uint64(stat.Bsize), nil
+}
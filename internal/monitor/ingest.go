@@ -0,0 +1,165 @@
+package monitor
+
+import (
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// videoClockRate is the RTP clock rate of H.264 and H.265 video
+const videoClockRate = 90000
+
+// ingestWindow is how often the bitrate and frame rate are recalculated
+const ingestWindow = time.Second
+
+// IngestStats describes the video arriving from the camera, worked out from the RTP headers.
+// Loss and jitter here are between the camera and this server, so if they are high the problem
+// is the camera or its network (often Wi-Fi), not the viewers' WebRTC connections.
+type IngestStats struct {
+	PacketsReceived uint64 `json:"packets_received"`
+	// Video payload bytes and frames, for working out averages over longer periods
+	BytesReceived  uint64 `json:"bytes_received"`
+	FramesReceived uint64 `json:"frames_received"`
+	// Packets that never arrived, from gaps in the sequence numbers
+	PacketsLost uint64 `json:"packets_lost"`
+	// Packets that arrived after a later one had already been seen
+	PacketsReordered uint64  `json:"packets_reordered"`
+	LossRatio        float64 `json:"loss_ratio"`
+	// Interarrival jitter as defined in RFC 3550
+	JitterMs float64 `json:"jitter_ms"`
+	// How long after the camera captured a frame it arrived here, from the camera's RTCP sender
+	// reports. Only meaningful if the camera's clock is synced with NTP; zero until known.
+	CaptureDelayMs float64   `json:"capture_delay_ms,omitempty"`
+	BitrateBps     float64   `json:"bitrate_bps"`
+	FPS            float64   `json:"fps"`
+	LastPacket     time.Time `json:"last_packet,omitzero"`
+}
+
+// ingestTracker keeps the running numbers behind IngestStats. It isn't safe for concurrent use,
+// the StreamMonitor's mutex protects it.
+type ingestTracker struct {
+	started   bool
+	lastSeq   uint16
+	received  uint64
+	bytes     uint64
+	frames    uint64
+	lost      uint64
+	reordered uint64
+
+	// RFC 3550 jitter, in RTP timestamp units
+	lastArrival time.Time
+	lastRTPTime uint32
+	jitter      float64
+
+	captureDelay float64 // milliseconds, smoothed
+
+	windowStart     time.Time
+	windowBytes     int
+	windowFrames    int
+	lastTimestamp   uint32
+	bitrate, fps    float64
+	lastPacket      time.Time
+	windowCompleted bool
+}
+
+// observe records one packet and returns how many packets were found to be lost before it
+func (t *ingestTracker) observe(pkt *rtp.Packet, now time.Time) uint64 {
+	t.received++
+	t.lastPacket = now
+
+	var lost uint64
+	if !t.started {
+		t.started = true
+		t.lastSeq = pkt.SequenceNumber
+		t.windowStart = now
+		t.lastTimestamp = pkt.Timestamp
+	} else {
+		// Sequence numbers are 16 bits and wrap around, so the difference is taken modulo 2^16.
+		// A small step forward is normal (more than one means packets were lost), a huge one
+		// really means the packet is behind the last one, i.e. it arrived late.
+		diff := pkt.SequenceNumber - t.lastSeq
+		switch {
+		case diff == 0:
+			// Duplicate
+		case diff < 0x8000:
+			lost = uint64(diff - 1)
+			t.lost += lost
+			t.lastSeq = pkt.SequenceNumber
+		default:
+			t.reordered++
+			// It was counted as lost when the gap was seen, but it did turn up in the end
+			if t.lost > 0 {
+				t.lost--
+			}
+		}
+
+		// Jitter is how much the transit time (arrival time minus RTP timestamp) varies between packets.
+		// Working with differences from the previous packet keeps the 32 bit timestamp wrapping out of it.
+		d := now.Sub(t.lastArrival).Seconds()*videoClockRate - float64(int32(pkt.Timestamp-t.lastRTPTime))
+		if d < 0 {
+			d = -d
+		}
+		t.jitter += (d - t.jitter) / 16
+	}
+	t.lastArrival = now
+	t.lastRTPTime = pkt.Timestamp
+
+	// Every frame has its own RTP timestamp, so a new timestamp is a new frame
+	t.windowBytes += len(pkt.Payload)
+	t.bytes += uint64(len(pkt.Payload))
+	if pkt.Timestamp != t.lastTimestamp {
+		t.windowFrames++
+		t.frames++
+		t.lastTimestamp = pkt.Timestamp
+	}
+
+	elapsed := now.Sub(t.windowStart)
+	if elapsed >= ingestWindow {
+		t.bitrate = float64(t.windowBytes) * 8 / elapsed.Seconds()
+		t.fps = float64(t.windowFrames) / elapsed.Seconds()
+		t.windowStart = now
+		t.windowBytes = 0
+		t.windowFrames = 0
+		t.windowCompleted = true
+	}
+
+	return lost
+}
+
+// observeCaptureDelay records how long after capture a frame arrived
+func (t *ingestTracker) observeCaptureDelay(delay time.Duration) {
+	ms := float64(delay) / float64(time.Millisecond)
+	if t.captureDelay == 0 {
+		t.captureDelay = ms
+		return
+	}
+	t.captureDelay += (ms - t.captureDelay) / 16
+}
+
+// restart forgets the last sequence number and timestamp, for after a reconnect when the camera starts counting again.
+// The totals are kept.
+func (t *ingestTracker) restart() {
+	t.started = false
+}
+
+// stats returns the current numbers. The bitrate and frame rate read as zero once packets stop arriving.
+func (t *ingestTracker) stats(now time.Time) IngestStats {
+	stats := IngestStats{
+		PacketsReceived:  t.received,
+		BytesReceived:    t.bytes,
+		FramesReceived:   t.frames,
+		PacketsLost:      t.lost,
+		PacketsReordered: t.reordered,
+		JitterMs:         t.jitter / videoClockRate * 1000,
+		CaptureDelayMs:   t.captureDelay,
+		LastPacket:       t.lastPacket,
+	}
+	if t.received+t.lost > 0 {
+		stats.LossRatio = float64(t.lost) / float64(t.received+t.lost)
+	}
+	if t.windowCompleted && now.Sub(t.lastPacket) < 2*ingestWindow {
+		stats.BitrateBps = t.bitrate
+		stats.FPS = t.fps
+	}
+	return stats
+}
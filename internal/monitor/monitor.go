@@ -0,0 +1,263 @@
+package monitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/metrics"
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+
+	"github.com/pion/rtp"
+)
+
+// StreamMonitor watches one camera's RTP packets and publishes events when something looks wrong:
+//   - the RTSP connection drops (reported through Disconnected)
+//   - no packets arrive for StallTimeout
+//   - the picture suddenly becomes trivially simple to encode, which is what happens when the
+//     lens is covered, spray painted or blinded. See checkTamper.
+type StreamMonitor struct {
+	camera       string
+	bus          *events.Bus
+	metrics      *metrics.Camera
+	stallTimeout time.Duration
+
+	tamperEnabled bool
+	tamperRatio   float64
+	tamperWindow  time.Duration
+
+	mu         sync.Mutex
+	lastPacket time.Time
+	stalled    bool
+	ingest     ingestTracker
+
+	// Frame size tracking for tamper detection
+	frameTimestamp uint32 // RTP timestamp of the frame being assembled
+	frameBytes     int
+	windowStart    time.Time
+	windowMax      int     // biggest frame in the current window
+	baseline       float64 // moving average of windowMax while the picture looked normal
+	lowWindows     int     // consecutive windows well below the baseline
+	tampered       bool
+}
+
+// NewStreamMonitor creates a monitor for a camera. Call Run to start the stall checks.
+func NewStreamMonitor(camera string, bus *events.Bus, cfg config.StreamAlerts) *StreamMonitor {
+	m := &StreamMonitor{
+		camera:        camera,
+		bus:           bus,
+		metrics:       metrics.ForCamera(camera),
+		stallTimeout:  time.Duration(cfg.StallTimeout),
+		tamperEnabled: cfg.Tamper,
+		tamperRatio:   cfg.TamperRatio,
+		tamperWindow:  time.Duration(cfg.TamperWindow),
+	}
+
+	if m.stallTimeout == 0 {
+		m.stallTimeout = 10 * time.Second
+	}
+	if m.tamperRatio == 0 {
+		m.tamperRatio = 0.1
+	}
+	if m.tamperWindow == 0 {
+		m.tamperWindow = 10 * time.Second
+	}
+
+	return m
+}
+
+// Run checks for stalled streams and updates the ingest metrics until stop is closed. This blocks, so call it in a goroutine.
+func (m *StreamMonitor) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			m.checkStall(now)
+			m.updateIngestMetrics(now)
+		}
+	}
+}
+
+// Packet records a video packet from the camera. Call it from the RTSP packet handler.
+func (m *StreamMonitor) Packet(pkt *rtp.Packet) {
+	now := time.Now()
+
+	m.mu.Lock()
+	resumed := m.stalled
+	m.lastPacket = now
+	m.stalled = false
+	lost := m.ingest.observe(pkt, now)
+
+	var tamperEvent *events.Event
+	if m.tamperEnabled {
+		tamperEvent = m.trackFrame(pkt, now)
+	}
+	m.mu.Unlock()
+
+	if lost > 0 {
+		m.metrics.PacketsLost.Add(float64(lost))
+	}
+	if resumed {
+		m.bus.Publish(events.Event{
+			Type:    events.TypeStreamResumed,
+			Camera:  m.camera,
+			Message: "packets are arriving again",
+		})
+	}
+	if tamperEvent != nil {
+		m.bus.Publish(*tamperEvent)
+	}
+}
+
+// CaptureDelay records how long after the camera captured a frame it arrived, see IngestStats.CaptureDelayMs
+func (m *StreamMonitor) CaptureDelay(delay time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ingest.observeCaptureDelay(delay)
+}
+
+// Disconnected reports that the RTSP connection dropped
+func (m *StreamMonitor) Disconnected(err error) {
+	// The connection is gone, so there's no point also reporting a stall for it
+	m.Pause()
+
+	m.bus.Publish(events.Event{
+		Type:    events.TypeConnectionLost,
+		Camera:  m.camera,
+		Message: fmt.Sprintf("RTSP connection lost: %v", err),
+	})
+}
+
+// Connected resets the monitor after a (re)connect so time spent disconnected doesn't count as a stall
+func (m *StreamMonitor) Connected() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastPacket = time.Now()
+	m.stalled = false
+	m.ingest.restart()
+}
+
+// Pause stops stall checks until the next packet arrives, for when the camera is disabled on purpose
+func (m *StreamMonitor) Pause() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastPacket = time.Time{}
+	m.stalled = false
+	m.ingest.restart()
+}
+
+// LastPacket returns when the last video packet arrived, or zero if none has since the camera was disabled or disconnected
+func (m *StreamMonitor) LastPacket() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastPacket
+}
+
+// StallTimeout is how long without packets counts as a stall
+func (m *StreamMonitor) StallTimeout() time.Duration {
+	return m.stallTimeout
+}
+
+// Ingest returns statistics about the video arriving from the camera
+func (m *StreamMonitor) Ingest() IngestStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ingest.stats(time.Now())
+}
+
+func (m *StreamMonitor) updateIngestMetrics(now time.Time) {
+	m.mu.Lock()
+	stats := m.ingest.stats(now)
+	m.mu.Unlock()
+
+	m.metrics.IngestJitter.Set(stats.JitterMs / 1000)
+	m.metrics.IngestBitrate.Set(stats.BitrateBps)
+	m.metrics.IngestFPS.Set(stats.FPS)
+}
+
+func (m *StreamMonitor) checkStall(now time.Time) {
+	m.mu.Lock()
+	if m.stalled || m.lastPacket.IsZero() || now.Sub(m.lastPacket) < m.stallTimeout {
+		m.mu.Unlock()
+		return
+	}
+	m.stalled = true
+	silence := now.Sub(m.lastPacket)
+	m.mu.Unlock()
+
+	m.bus.Publish(events.Event{
+		Type:    events.TypeStreamStalled,
+		Camera:  m.camera,
+		Message: fmt.Sprintf("no packets received for %s", silence.Round(time.Second)),
+	})
+}
+
+// trackFrame adds up packet sizes per frame (packets of a frame share an RTP timestamp)
+// and runs the tamper check at the end of each window. Must be called with mu held.
+func (m *StreamMonitor) trackFrame(pkt *rtp.Packet, now time.Time) *events.Event {
+	if pkt.Timestamp != m.frameTimestamp {
+		m.windowMax = max(m.windowMax, m.frameBytes)
+		m.frameTimestamp = pkt.Timestamp
+		m.frameBytes = 0
+	}
+	m.frameBytes += len(pkt.Payload)
+
+	if m.windowStart.IsZero() {
+		m.windowStart = now
+		return nil
+	}
+	if now.Sub(m.windowStart) < m.tamperWindow {
+		return nil
+	}
+
+	event := m.checkTamper()
+	m.windowStart = now
+	m.windowMax = 0
+	return event
+}
+
+// checkTamper compares the biggest frame of the window with what is normal for this camera.
+//
+// The biggest frame in a window of several seconds is a keyframe, and a keyframe's size is
+// driven by how much detail is in the picture. A black, white or covered image has almost
+// none, so its keyframes shrink to a small fraction of their usual size. This lets us spot
+// tampering from packet sizes alone without decoding any video.
+func (m *StreamMonitor) checkTamper() *events.Event {
+	size := float64(m.windowMax)
+
+	if m.baseline == 0 {
+		m.baseline = size
+		return nil
+	}
+
+	if size < m.baseline*m.tamperRatio {
+		m.lowWindows++
+		// Two windows in a row, so a single odd GOP doesn't trigger it
+		if m.lowWindows == 2 && !m.tampered {
+			m.tampered = true
+			return &events.Event{
+				Type:    events.TypeTamperDetected,
+				Camera:  m.camera,
+				Message: "picture detail dropped sharply - camera may be covered, blinded or pointing at a black/saturated scene",
+				Data: map[string]any{
+					"keyframe_bytes": m.windowMax,
+					"baseline_bytes": int(m.baseline),
+				},
+			}
+		}
+		return nil
+	}
+
+	m.lowWindows = 0
+	m.tampered = false
+	// Slowly follow the normal size as the scene changes (day/night, weather)
+	m.baseline = 0.9*m.baseline + 0.1*size
+	return nil
+}
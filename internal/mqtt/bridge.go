@@ -0,0 +1,251 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// CommandHandler runs a command received on a camera's command topic.
+// arg is whatever followed the command name in the payload, e.g. "3" for "ptz_preset 3".
+type CommandHandler func(camera string, arg string) error
+
+// Bridge publishes events and camera status to MQTT and dispatches commands coming back from it.
+//
+// Topic layout (prefix defaults to "camera-viewer"):
+//
+//	<prefix>/status                  bridge availability, "online"/"offline" (retained, last will)
+//	<prefix>/<camera>/status         camera connection, "online"/"offline" (retained)
+//	<prefix>/<camera>/enabled        "ON"/"OFF" (retained)
+//	<prefix>/<camera>/motion         "ON" whenever motion is detected
+//	<prefix>/<camera>/events         every event for the camera as JSON
+//	<prefix>/<camera>/command        commands in, e.g. "disable" or "ptz_preset 3"
+type Bridge struct {
+	cfg      config.MQTT
+	client   paho.Client
+	cameras  []string
+	mu       sync.RWMutex
+	commands map[string]CommandHandler
+}
+
+// NewBridge creates a bridge for the given cameras. Call Handle to register commands before Start.
+func NewBridge(cfg config.MQTT, cameras []string) (*Bridge, error) {
+	if cfg.Broker == "" {
+		return nil, fmt.Errorf("mqtt broker is not set")
+	}
+	if cfg.TopicPrefix == "" {
+		cfg.TopicPrefix = "camera-viewer"
+	}
+	if cfg.DiscoveryPrefix == "" {
+		cfg.DiscoveryPrefix = "homeassistant"
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "camera-viewer"
+	}
+
+	return &Bridge{
+		cfg:      cfg,
+		cameras:  cameras,
+		commands: make(map[string]CommandHandler),
+	}, nil
+}
+
+// Handle registers a command that can be sent on the command topic
+func (b *Bridge) Handle(command string, handler CommandHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.commands[command] = handler
+}
+
+// Start connects to the broker and begins forwarding events from the bus.
+// paho reconnects on its own; the subscriptions and discovery payloads are re-sent in the
+// OnConnect handler so they survive broker restarts.
+func (b *Bridge) Start(bus *events.Bus) error {
+	opts := paho.NewClientOptions().
+		AddBroker(b.cfg.Broker).
+		SetClientID(b.cfg.ClientID).
+		SetUsername(b.cfg.Username).
+		SetPassword(b.cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetWill(b.topic("status"), "offline", 1, true).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Printf("MQTT connection lost: %v", err)
+		})
+
+	b.client = paho.NewClient(opts)
+
+	token := b.client.Connect()
+	if !token.WaitTimeout(10 * time.Second) {
+		// With ConnectRetry the client keeps trying in the background, so this isn't fatal
+		log.Printf("MQTT broker %s not reachable yet, will keep retrying", b.cfg.Broker)
+	} else if token.Error() != nil {
+		return fmt.Errorf("failed to connect to MQTT broker: %w", token.Error())
+	}
+
+	go b.forwardEvents(bus)
+	return nil
+}
+
+// Close publishes the offline status and disconnects
+func (b *Bridge) Close() {
+	if b.client == nil {
+		return
+	}
+	b.publish(b.topic("status"), "offline", true)
+	b.client.Disconnect(250)
+}
+
+func (b *Bridge) onConnect(client paho.Client) {
+	log.Printf("Connected to MQTT broker %s", b.cfg.Broker)
+
+	b.publish(b.topic("status"), "online", true)
+
+	for _, camera := range b.cameras {
+		topic := b.topic(camera, "command")
+		token := client.Subscribe(topic, 1, func(_ paho.Client, msg paho.Message) {
+			b.handleCommand(camera, string(msg.Payload()))
+		})
+		if token.Wait() && token.Error() != nil {
+			log.Printf("Failed to subscribe to %s: %v", topic, token.Error())
+		}
+
+		if b.cfg.HomeAssistant {
+			b.publishDiscovery(camera)
+		}
+	}
+}
+
+func (b *Bridge) handleCommand(camera string, payload string) {
+	// Commands are "<name>" or "<name> <arg>"
+	name, arg, _ := strings.Cut(strings.TrimSpace(payload), " ")
+
+	b.mu.RLock()
+	handler, ok := b.commands[name]
+	b.mu.RUnlock()
+
+	if !ok {
+		log.Printf("MQTT: unknown command %q for camera %s", name, camera)
+		return
+	}
+
+	log.Printf("MQTT: running command %q for camera %s", name, camera)
+	err := handler(camera, strings.TrimSpace(arg))
+	if err != nil {
+		log.Printf("MQTT: command %q for camera %s failed: %v", name, camera, err)
+	}
+}
+
+func (b *Bridge) forwardEvents(bus *events.Bus) {
+	sub := bus.Subscribe(64, nil)
+	defer sub.Close()
+	for event := range sub.C {
+		if event.Camera == "" {
+			continue
+		}
+
+		payload, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("MQTT: failed to encode event: %v", err)
+			continue
+		}
+		b.publish(b.topic(event.Camera, "events"), string(payload), false)
+
+		switch event.Type {
+		case events.TypeCameraConnected:
+			b.publish(b.topic(event.Camera, "status"), "online", true)
+			b.publish(b.topic(event.Camera, "enabled"), "ON", true)
+		case events.TypeConnectionLost, events.TypeStreamStalled:
+			b.publish(b.topic(event.Camera, "status"), "offline", true)
+		case events.TypeStreamResumed:
+			b.publish(b.topic(event.Camera, "status"), "online", true)
+		case events.TypeCameraDisabled:
+			b.publish(b.topic(event.Camera, "status"), "offline", true)
+			b.publish(b.topic(event.Camera, "enabled"), "OFF", true)
+		case events.TypeMotion:
+			b.publish(b.topic(event.Camera, "motion"), "ON", false)
+		}
+	}
+}
+
+// publishDiscovery announces the camera's entities to Home Assistant.
+// See https://www.home-assistant.io/integrations/mqtt/#mqtt-discovery
+func (b *Bridge) publishDiscovery(camera string) {
+	nodeID := "camera_viewer_" + camera
+	device := map[string]any{
+		"identifiers":  []string{nodeID},
+		"name":         camera,
+		"manufacturer": "camera-viewer",
+	}
+	availability := b.topic("status")
+
+	entities := map[string]map[string]any{
+		"binary_sensor/" + nodeID + "/connectivity": {
+			"name":               "Connected",
+			"unique_id":          nodeID + "_connectivity",
+			"device_class":       "connectivity",
+			"state_topic":        b.topic(camera, "status"),
+			"payload_on":         "online",
+			"payload_off":        "offline",
+			"availability_topic": availability,
+			"device":             device,
+		},
+		"binary_sensor/" + nodeID + "/motion": {
+			"name":               "Motion",
+			"unique_id":          nodeID + "_motion",
+			"device_class":       "motion",
+			"state_topic":        b.topic(camera, "motion"),
+			"payload_on":         "ON",
+			"off_delay":          30, // we only ever send ON, HA turns it off again
+			"availability_topic": availability,
+			"device":             device,
+		},
+	}
+
+	// Only advertise the switch if something can actually act on it
+	b.mu.RLock()
+	_, canEnable := b.commands["enable"]
+	_, canDisable := b.commands["disable"]
+	b.mu.RUnlock()
+	if canEnable && canDisable {
+		entities["switch/"+nodeID+"/enabled"] = map[string]any{
+			"name":               "Enabled",
+			"unique_id":          nodeID + "_enabled",
+			"command_topic":      b.topic(camera, "command"),
+			"state_topic":        b.topic(camera, "enabled"),
+			"payload_on":         "enable",
+			"payload_off":        "disable",
+			"state_on":           "ON",
+			"state_off":          "OFF",
+			"availability_topic": availability,
+			"device":             device,
+		}
+	}
+
+	for path, entity := range entities {
+		payload, err := json.Marshal(entity)
+		if err != nil {
+			log.Printf("MQTT: failed to encode discovery payload: %v", err)
+			continue
+		}
+		b.publish(b.cfg.DiscoveryPrefix+"/"+path+"/config", string(payload), true)
+	}
+}
+
+func (b *Bridge) topic(parts ...string) string {
+	return b.cfg.TopicPrefix + "/" + strings.Join(parts, "/")
+}
+
+func (b *Bridge) publish(topic string, payload string, retained bool) {
+	// Don't wait on the token - publishing happens on the event path and paho queues it for us
+	b.client.Publish(topic, 1, retained, payload)
+}
@@ -0,0 +1,128 @@
+package notify
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+)
+
+// SnapshotFunc returns a JPEG image of the camera's current view.
+// Notifiers attach it to their message when one is available.
+type SnapshotFunc func(camera string) ([]byte, error)
+
+// chatSender is implemented by each chat service (Telegram, Discord)
+type chatSender interface {
+	// send posts a message, with an optional JPEG image attached
+	send(text string, image []byte) error
+}
+
+// ChatNotifier sends a chat message for every matching event
+type ChatNotifier struct {
+	cfg      config.Notifier
+	sender   chatSender
+	snapshot SnapshotFunc
+}
+
+// NewChatNotifier creates a notifier for the configured chat service.
+// snapshot may be nil, in which case messages are sent without an image.
+func NewChatNotifier(cfg config.Notifier, snapshot SnapshotFunc) (*ChatNotifier, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	n := &ChatNotifier{
+		cfg:      cfg,
+		snapshot: snapshot,
+	}
+
+	switch cfg.Type {
+	case "telegram":
+		if cfg.BotToken == "" || cfg.ChatID == "" {
+			return nil, fmt.Errorf("telegram notifier %q needs bot_token and chat_id", cfg.Name)
+		}
+		n.sender = &telegramSender{token: cfg.BotToken, chatID: cfg.ChatID, client: client}
+	case "discord":
+		if cfg.WebhookURL == "" {
+			return nil, fmt.Errorf("discord notifier %q needs webhook_url", cfg.Name)
+		}
+		n.sender = &discordSender{webhookURL: cfg.WebhookURL, client: client}
+	default:
+		return nil, fmt.Errorf("notifier %q has unknown type %q", cfg.Name, cfg.Type)
+	}
+
+	if cfg.QuietHours != nil {
+		err := cfg.QuietHours.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("notifier %q quiet_hours %w", cfg.Name, err)
+		}
+	}
+
+	return n, nil
+}
+
+// Run sends messages for events from the bus until stop is closed.
+// This blocks, so call it in a goroutine.
+func (n *ChatNotifier) Run(bus *events.Bus, stop <-chan struct{}) {
+	sub := bus.Subscribe(32, n.matches)
+	defer sub.Close()
+	for {
+		var event events.Event
+		select {
+		case <-stop:
+			return
+		case event = <-sub.C:
+		}
+		if n.inQuietHours(event.Time) {
+			continue
+		}
+
+		err := n.Notify(event)
+		if err != nil {
+			log.Printf("Notifier %s failed: %v", n.cfg.Name, err)
+		}
+	}
+}
+
+// Notify sends one event, attaching a snapshot if we can get one
+func (n *ChatNotifier) Notify(e events.Event) error {
+	var image []byte
+	if n.snapshot != nil && e.Camera != "" {
+		var err error
+		image, err = n.snapshot(e.Camera)
+		if err != nil {
+			// A message without a picture is still better than no message
+			log.Printf("Notifier %s: failed to get snapshot for %s: %v", n.cfg.Name, e.Camera, err)
+			image = nil
+		}
+	}
+
+	return n.sender.send(formatMessage(e), image)
+}
+
+func (n *ChatNotifier) matches(e events.Event) bool {
+	if len(n.cfg.Events) > 0 && !slices.Contains(n.cfg.Events, string(e.Type)) {
+		return false
+	}
+	if len(n.cfg.Cameras) > 0 && !slices.Contains(n.cfg.Cameras, e.Camera) {
+		return false
+	}
+	return true
+}
+
+func (n *ChatNotifier) inQuietHours(t time.Time) bool {
+	return n.cfg.QuietHours != nil && n.cfg.QuietHours.Contains(t)
+}
+
+func formatMessage(e events.Event) string {
+	text := fmt.Sprintf("📷 %s: %s", e.Camera, e.Type)
+	if e.Camera == "" {
+		text = fmt.Sprintf("📷 %s", e.Type)
+	}
+	if e.Message != "" {
+		text += "\n" + e.Message
+	}
+	return text + "\n" + e.Time.Local().Format("2006-01-02 15:04:05")
+}
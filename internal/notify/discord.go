@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+// discordSender posts messages to a Discord channel webhook.
+// See https://discord.com/developers/docs/resources/webhook#execute-webhook
+type discordSender struct {
+	webhookURL string
+	client     *http.Client
+}
+
+func (d *discordSender) send(text string, image []byte) error {
+	payload, err := json.Marshal(map[string]string{
+		"content": text,
+	})
+	if err != nil {
+		return err
+	}
+
+	if image == nil {
+		return d.post("application/json", payload)
+	}
+
+	// With an attachment the JSON goes in a payload_json field next to the file
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	form.WriteField("payload_json", string(payload))
+
+	part, err := form.CreateFormFile("files[0]", "snapshot.jpg")
+	if err != nil {
+		return fmt.Errorf("failed to create form file: %w", err)
+	}
+	part.Write(image)
+
+	err = form.Close()
+	if err != nil {
+		return fmt.Errorf("failed to build form: %w", err)
+	}
+
+	return d.post(form.FormDataContentType(), buf.Bytes())
+}
+
+func (d *discordSender) post(contentType string, body []byte) error {
+	resp, err := d.client.Post(d.webhookURL, contentType, bytes.NewReader(body))
+	if err != nil {
+		// The webhook URL is a secret, so it is left out of the error
+		return fmt.Errorf("discord webhook request failed")
+	}
+	defer resp.Body.Close()
+
+	// Discord answers 204 No Content on success
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("discord webhook returned %s: %s", resp.Status, detail)
+	}
+	return nil
+}
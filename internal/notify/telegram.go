@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+// telegramSender posts messages through the Telegram Bot API.
+// See https://core.telegram.org/bots/api#sendmessage and #sendphoto
+type telegramSender struct {
+	token  string
+	chatID string
+	client *http.Client
+}
+
+func (t *telegramSender) send(text string, image []byte) error {
+	if image == nil {
+		body, err := json.Marshal(map[string]string{
+			"chat_id": t.chatID,
+			"text":    text,
+		})
+		if err != nil {
+			return err
+		}
+		return t.post("sendMessage", "application/json", body)
+	}
+
+	// Photos have to be uploaded as multipart form data, with the text as the caption
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	form.WriteField("chat_id", t.chatID)
+	form.WriteField("caption", text)
+
+	part, err := form.CreateFormFile("photo", "snapshot.jpg")
+	if err != nil {
+		return fmt.Errorf("failed to create form file: %w", err)
+	}
+	part.Write(image)
+
+	err = form.Close()
+	if err != nil {
+		return fmt.Errorf("failed to build form: %w", err)
+	}
+
+	return t.post("sendPhoto", form.FormDataContentType(), buf.Bytes())
+}
+
+func (t *telegramSender) post(method string, contentType string, body []byte) error {
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/%s", t.token, method)
+
+	resp, err := t.client.Post(url, contentType, bytes.NewReader(body))
+	if err != nil {
+		// The error contains the URL, which contains the bot token - don't leak it into logs
+		return fmt.Errorf("telegram %s request failed", method)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("telegram %s returned %s: %s", method, resp.Status, detail)
+	}
+	return nil
+}
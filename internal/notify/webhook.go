@@ -0,0 +1,186 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+)
+
+// SignatureHeader carries the hex encoded HMAC-SHA256 of "<timestamp>.<body>" when a secret is configured.
+// The receiver should recompute it with the shared secret and reject requests that don't match.
+const (
+	SignatureHeader = "X-Camera-Viewer-Signature"
+	TimestampHeader = "X-Camera-Viewer-Timestamp"
+)
+
+// Webhook posts events to a single HTTP endpoint
+type Webhook struct {
+	cfg      config.Webhook
+	template *template.Template // nil means "send the event as JSON"
+	client   *http.Client
+}
+
+// NewWebhook validates the webhook configuration and parses its payload template
+func NewWebhook(cfg config.Webhook) (*Webhook, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("webhook %q has no url", cfg.Name)
+	}
+
+	timeout := time.Duration(cfg.Timeout)
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	w := &Webhook{
+		cfg:    cfg,
+		client: &http.Client{Timeout: timeout},
+	}
+
+	if cfg.Template != "" {
+		tmpl, err := template.New(cfg.Name).Funcs(templateFuncs).Parse(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template for webhook %q: %w", cfg.Name, err)
+		}
+		w.template = tmpl
+	}
+
+	return w, nil
+}
+
+// templateFuncs are available inside payload templates.
+// json is the important one - it quotes/escapes values so the output stays valid JSON:
+//
+//	{"text": {{json .Message}}, "camera": {{json .Camera}}}
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// Run consumes events from the bus until stop is closed.
+// This blocks, so call it in a goroutine.
+func (w *Webhook) Run(bus *events.Bus, stop <-chan struct{}) {
+	sub := bus.Subscribe(32, w.matches)
+	defer sub.Close()
+	for {
+		select {
+		case <-stop:
+			return
+		case event := <-sub.C:
+			err := w.Send(event, stop)
+			if err != nil {
+				log.Printf("Webhook %s failed: %v", w.cfg.Name, err)
+			}
+		}
+	}
+}
+
+// matches reports whether the webhook is configured to fire for this event
+func (w *Webhook) matches(e events.Event) bool {
+	if len(w.cfg.Events) == 0 {
+		return true
+	}
+	for _, t := range w.cfg.Events {
+		if events.Type(t) == e.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// Send delivers one event, retrying with exponential backoff on failure.
+// It stops retrying once stop is closed; a nil stop never is.
+func (w *Webhook) Send(e events.Event, stop <-chan struct{}) error {
+	body, err := w.render(e)
+	if err != nil {
+		return err
+	}
+
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		err = w.post(body)
+		if err == nil {
+			return nil
+		}
+		if attempt >= w.cfg.MaxRetries {
+			return fmt.Errorf("giving up after %d attempt(s): %w", attempt+1, err)
+		}
+
+		log.Printf("Webhook %s attempt %d failed, retrying in %s: %v", w.cfg.Name, attempt+1, backoff, err)
+		select {
+		case <-stop:
+			return fmt.Errorf("giving up after %d attempt(s), shutting down: %w", attempt+1, err)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// render builds the request body for an event
+func (w *Webhook) render(e events.Event) ([]byte, error) {
+	if w.template == nil {
+		return json.Marshal(e)
+	}
+
+	var buf bytes.Buffer
+	err := w.template.Execute(&buf, e)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("template did not produce valid JSON: %s", buf.String())
+	}
+	return buf.Bytes(), nil
+}
+
+func (w *Webhook) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range w.cfg.Headers {
+		req.Header.Set(name, value)
+	}
+
+	if w.cfg.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, "sha256="+Sign(w.cfg.Secret, timestamp, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign computes the webhook signature for a body.
+// The timestamp is part of the signed data so a captured request can't be replayed later.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
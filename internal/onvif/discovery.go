@@ -0,0 +1,176 @@
+package onvif
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/ipv4"
+)
+
+// discoveryAddr is where WS-Discovery probes are sent, and cameras answer from
+var discoveryAddr = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 3702}
+
+// Device is a camera that answered a WS-Discovery probe
+type Device struct {
+	// The camera's endpoint reference, e.g. urn:uuid:..., which stays the same when its address changes
+	ID string
+	// Its device service, e.g. http://192.168.1.10/onvif/device_service. Cameras with more than one
+	// address list them all.
+	XAddrs []string
+	// What the camera calls itself and its model, from its scopes. Either can be empty.
+	Name     string
+	Hardware string
+}
+
+// Host is the address of the camera's first device service, e.g. 192.168.1.10, or "" if it gave none
+func (d Device) Host() string {
+	for _, xaddr := range d.XAddrs {
+		u, err := url.Parse(xaddr)
+		if err == nil && u.Hostname() != "" {
+			return u.Hostname()
+		}
+	}
+	return ""
+}
+
+// Discover sends a WS-Discovery probe for cameras (ONVIF's NetworkVideoTransmitter) out of every
+// network interface and returns those that answer within timeout, in the order they answered.
+// Cameras on other subnets don't hear it, since the probe is multicast.
+func Discover(ctx context.Context, timeout time.Duration) ([]Device, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open socket: %w", err)
+	}
+	defer conn.Close()
+
+	messageID := "uuid:" + uuid.NewString()
+	probe := []byte(probeMessage(messageID))
+	err = sendProbe(conn, probe)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetReadDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	var devices []Device
+	seen := make(map[string]bool)
+	buf := make([]byte, 64<<10)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return devices, ctx.Err()
+		}
+		if err != nil {
+			return devices, fmt.Errorf("failed to read answers: %w", err)
+		}
+		for _, device := range parseProbeMatches(buf[:n], messageID) {
+			if !seen[device.ID] {
+				seen[device.ID] = true
+				devices = append(devices, device)
+			}
+		}
+	}
+}
+
+// sendProbe multicasts probe out of every interface that can, rather than only the one the default
+// route goes through, so cameras on a second network are found too
+func sendProbe(conn net.PacketConn, probe []byte) error {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return fmt.Errorf("failed to list network interfaces: %w", err)
+	}
+	packetConn := ipv4.NewPacketConn(conn)
+	sent := false
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		if packetConn.SetMulticastInterface(&iface) != nil {
+			continue
+		}
+		_, err = conn.WriteTo(probe, discoveryAddr)
+		if err == nil {
+			sent = true
+		}
+	}
+	if !sent {
+		// e.g. no interface has multicast, so leave it to the routing table
+		_, err = conn.WriteTo(probe, discoveryAddr)
+		if err != nil {
+			return fmt.Errorf("failed to send probe: %w", err)
+		}
+	}
+	return nil
+}
+
+// probeMessage is a WS-Discovery Probe for ONVIF cameras
+func probeMessage(messageID string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing">` +
+		`<s:Header>` +
+		`<a:Action s:mustUnderstand="1">http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</a:Action>` +
+		`<a:MessageID>` + messageID + `</a:MessageID>` +
+		`<a:ReplyTo><a:Address>http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</a:Address></a:ReplyTo>` +
+		`<a:To s:mustUnderstand="1">urn:schemas-xmlsoap-org:ws:2005:04:discovery</a:To>` +
+		`</s:Header><s:Body>` +
+		`<d:Probe xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery">` +
+		`<d:Types xmlns:dn="http://www.onvif.org/ver10/network/wsdl">dn:NetworkVideoTransmitter</d:Types>` +
+		`</d:Probe></s:Body></s:Envelope>`
+}
+
+// parseProbeMatches reads the cameras out of an answer to the probe with messageID. Anything else,
+// like another program's probe or answers to it, gives none.
+func parseProbeMatches(data []byte, messageID string) []Device {
+	var envelope struct {
+		RelatesTo string `xml:"Header>RelatesTo"`
+		Matches   []struct {
+			Address string `xml:"EndpointReference>Address"`
+			Scopes  string `xml:"Scopes"`
+			XAddrs  string `xml:"XAddrs"`
+		} `xml:"Body>ProbeMatches>ProbeMatch"`
+	}
+	if xml.Unmarshal(data, &envelope) != nil || strings.TrimSpace(envelope.RelatesTo) != messageID {
+		return nil
+	}
+
+	var devices []Device
+	for _, match := range envelope.Matches {
+		device := Device{ID: strings.TrimSpace(match.Address), XAddrs: strings.Fields(match.XAddrs)}
+		if device.ID == "" || len(device.XAddrs) == 0 {
+			continue
+		}
+		// Scopes are URIs like onvif://www.onvif.org/name/Front%20Door
+		for _, scope := range strings.Fields(match.Scopes) {
+			if value, ok := strings.CutPrefix(scope, "onvif://www.onvif.org/name/"); ok {
+				device.Name = unescapeScope(value)
+			} else if value, ok := strings.CutPrefix(scope, "onvif://www.onvif.org/hardware/"); ok {
+				device.Hardware = unescapeScope(value)
+			}
+		}
+		devices = append(devices, device)
+	}
+	return devices
+}
+
+// unescapeScope decodes a scope's value, leaving it as it is when it isn't escaped properly
+func unescapeScope(value string) string {
+	unescaped, err := url.PathUnescape(value)
+	if err != nil {
+		return value
+	}
+	return unescaped
+}
@@ -0,0 +1,86 @@
+package onvif
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Profile is one of the streams a camera's media service offers, usually the main stream and a
+// smaller sub-stream
+type Profile struct {
+	Token string
+	Name  string
+	// The video's encoding (H264, H265, JPEG or MPEG4) and size, empty for a profile without video
+	Encoding      string
+	Width, Height int
+}
+
+// GetMediaURL asks the camera's device service where its media service is, which is what GetProfiles,
+// GetStreamURI and SetSynchronizationPoint are called on
+func (c *Client) GetMediaURL(ctx context.Context) (string, error) {
+	var response struct {
+		XAddr string `xml:"Body>GetCapabilitiesResponse>Capabilities>Media>XAddr"`
+	}
+	err := c.call(ctx, `<GetCapabilities xmlns="http://www.onvif.org/ver10/device/wsdl"><Category>Media</Category></GetCapabilities>`, &response)
+	if err != nil {
+		return "", err
+	}
+	url := strings.TrimSpace(response.XAddr)
+	if url == "" {
+		return "", fmt.Errorf("the camera has no media service")
+	}
+	return url, nil
+}
+
+// GetProfiles lists the media profiles of the camera's media service, in the camera's order
+func (c *Client) GetProfiles(ctx context.Context) ([]Profile, error) {
+	var response struct {
+		Profiles []struct {
+			Token string `xml:"token,attr"`
+			Name  string `xml:"Name"`
+			Video struct {
+				Encoding string `xml:"Encoding"`
+				Width    int    `xml:"Resolution>Width"`
+				Height   int    `xml:"Resolution>Height"`
+			} `xml:"VideoEncoderConfiguration"`
+		} `xml:"Body>GetProfilesResponse>Profiles"`
+	}
+	err := c.call(ctx, `<GetProfiles xmlns="http://www.onvif.org/ver10/media/wsdl"/>`, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make([]Profile, len(response.Profiles))
+	for i, profile := range response.Profiles {
+		profiles[i] = Profile{
+			Token:    profile.Token,
+			Name:     profile.Name,
+			Encoding: profile.Video.Encoding,
+			Width:    profile.Video.Width,
+			Height:   profile.Video.Height,
+		}
+	}
+	return profiles, nil
+}
+
+// GetStreamURI asks the camera's media service for the rtsp:// URL of a media profile's stream. It
+// comes without the username and password.
+func (c *Client) GetStreamURI(ctx context.Context, profileToken string) (string, error) {
+	body := `<GetStreamUri xmlns="http://www.onvif.org/ver10/media/wsdl"><StreamSetup>` +
+		`<Stream xmlns="http://www.onvif.org/ver10/schema">RTP-Unicast</Stream>` +
+		`<Transport xmlns="http://www.onvif.org/ver10/schema"><Protocol>RTSP</Protocol></Transport>` +
+		`</StreamSetup><ProfileToken>` + escape(profileToken) + `</ProfileToken></GetStreamUri>`
+	var response struct {
+		URI string `xml:"Body>GetStreamUriResponse>MediaUri>Uri"`
+	}
+	err := c.call(ctx, body, &response)
+	if err != nil {
+		return "", err
+	}
+	uri := strings.TrimSpace(response.URI)
+	if uri == "" {
+		return "", fmt.Errorf("the camera gave no stream URL for profile %s", profileToken)
+	}
+	return uri, nil
+}
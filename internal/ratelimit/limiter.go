@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limiter is a token bucket per key (usually the client's IP address).
+// Each key can make burst requests at once, refilling at perMinute requests per minute.
+type Limiter struct {
+	limit rate.Limit
+	burst int
+
+	mu          sync.Mutex
+	visitors    map[string]*visitor
+	lastCleanup time.Time
+
+	rejected atomic.Uint64
+}
+
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// idleTimeout is how long a key is remembered after its last request
+const idleTimeout = 10 * time.Minute
+
+// NewLimiter creates a limiter allowing perMinute requests per minute per key, with bursts of up to burst
+func NewLimiter(perMinute float64, burst int) *Limiter {
+	// A burst of 0 would reject every request
+	burst = max(burst, 1)
+
+	return &Limiter{
+		limit:       rate.Limit(perMinute / 60),
+		burst:       burst,
+		visitors:    make(map[string]*visitor),
+		lastCleanup: time.Now(),
+	}
+}
+
+// Allow reports whether a request for key may go ahead.
+// When it may not, it also returns how long until the next request would be allowed.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget keys that have gone quiet so the map doesn't grow forever
+	if now.Sub(l.lastCleanup) > idleTimeout {
+		for k, v := range l.visitors {
+			if now.Sub(v.lastSeen) > idleTimeout {
+				delete(l.visitors, k)
+			}
+		}
+		l.lastCleanup = now
+	}
+
+	v, ok := l.visitors[key]
+	if !ok {
+		v = &visitor{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.visitors[key] = v
+	}
+	v.lastSeen = now
+
+	reservation := v.limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay == 0 {
+		return true, 0
+	}
+	// Don't use up a token for a request we are turning away
+	reservation.CancelAt(now)
+	l.rejected.Add(1)
+	return false, delay
+}
+
+// Rejected returns how many requests have been turned away
+func (l *Limiter) Rejected() uint64 {
+	return l.rejected.Load()
+}
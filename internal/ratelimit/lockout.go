@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Lockout blocks a key (a username or IP address) after repeated authentication failures.
+// Once threshold failures have been seen the key is locked for base, and every further
+// failure doubles the lock, up to max. A successful login clears it.
+type Lockout struct {
+	threshold int
+	base      time.Duration
+	max       time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*lockoutEntry
+
+	rejected atomic.Uint64
+}
+
+type lockoutEntry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// NewLockout creates a lockout that starts after threshold failures
+func NewLockout(threshold int, base, max time.Duration) *Lockout {
+	return &Lockout{
+		threshold: threshold,
+		base:      base,
+		max:       max,
+		entries:   make(map[string]*lockoutEntry),
+	}
+}
+
+// Locked reports whether key is currently locked out, and for how much longer
+func (l *Lockout) Locked(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[key]
+	if !ok {
+		return false, 0
+	}
+	remaining := time.Until(entry.lockedUntil)
+	if remaining <= 0 {
+		return false, 0
+	}
+	l.rejected.Add(1)
+	return true, remaining
+}
+
+// Failure records a failed attempt for key and returns how long it is now locked for (0 if not locked)
+func (l *Lockout) Failure(key string) time.Duration {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.removeStale(now)
+
+	entry, ok := l.entries[key]
+	if !ok {
+		entry = &lockoutEntry{}
+		l.entries[key] = entry
+	}
+	entry.failures++
+	entry.lastFailure = now
+
+	if entry.failures < l.threshold {
+		return 0
+	}
+
+	// base, 2x base, 4x base... for each failure past the threshold
+	lock := l.base
+	for i := l.threshold; i < entry.failures && lock < l.max; i++ {
+		lock *= 2
+	}
+	lock = min(lock, l.max)
+	entry.lockedUntil = now.Add(lock)
+	return lock
+}
+
+// Success clears the failures for key
+func (l *Lockout) Success(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+}
+
+// Rejected returns how many attempts were refused because of a lockout
+func (l *Lockout) Rejected() uint64 {
+	return l.rejected.Load()
+}
+
+// removeStale forgets keys whose last failure was long enough ago that they would no longer be locked.
+// Must be called with mu held.
+func (l *Lockout) removeStale(now time.Time) {
+	for key, entry := range l.entries {
+		if now.After(entry.lockedUntil) && now.Sub(entry.lastFailure) > l.max {
+			delete(l.entries, key)
+		}
+	}
+}
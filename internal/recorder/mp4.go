@@ -0,0 +1,311 @@
+// Package recorder writes a camera's video to files people can play, without ffmpeg
+package recorder
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/transcode"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mp4"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/pmp4"
+	"github.com/pion/rtp"
+)
+
+// videoClockRate is the RTP clock of every video codec the camera can send
+const videoClockRate = 90000
+
+// writeBufferSize is how much is gathered before a write reaches the disk. Several cameras
+// recording at once would otherwise make thousands of small writes a second, which SD cards
+// like those of a Raspberry Pi are slow at and wear out from.
+const writeBufferSize = 1 << 20
+
+// tempPattern names the temporary files MP4 recordings' pictures wait in, see NewMP4
+const tempPattern = "camera-viewer-recording-*"
+
+// staleAfter is how long a recording's temporary file goes without a write before RemoveStale takes
+// it for one a crash left behind. A recording still going writes to it every few seconds at least.
+const staleAfter = time.Hour
+
+// ErrTooBig is returned by MP4.WritePacket once the recording has reached the 4 GB an MP4 file's
+// media data can hold. Close still writes what was recorded up to then.
+var ErrTooBig = errors.New("the recording has reached the 4 GB limit of an MP4 file")
+
+// ErrFallingBehind is returned by MP4.WritePacket, wrapped in transcode.ErrPictureLost, when the
+// disk has fallen too far behind to take the picture. Pictures are left out until the next keyframe,
+// which the recording carries on from.
+var ErrFallingBehind = errors.New("the disk is falling behind, leaving pictures out until the next keyframe")
+
+// mp4Sample is a picture of the recording, kept in the temporary file until Close
+type mp4Sample struct {
+	// Presentation and decode times, in the RTP clock from the first picture
+	pts, dts int64
+	keyframe bool
+	offset   int64
+	size     uint32
+}
+
+// MP4 records a camera's H264, H265 or MPEG-4 video to an MP4 file, starting at its first keyframe.
+// Pictures wait in a temporary file until Close, which writes the MP4 with its index in front of
+// the video, so it plays straight away, even streamed, and recording takes little memory however
+// long it runs. The MP4 has no audio.
+type MP4 struct {
+	out    io.Writer
+	codec  string
+	video  *transcode.ElementaryStream
+	params func() [][]byte
+	// Decode times, for H264 and H265, whose pictures can be sent out of display order
+	dts func(au [][]byte, pts int64) (int64, error)
+
+	track mp4.Codec
+	data  *os.File
+	// The temporary file's writes, made from their own goroutine, which Close waits for before
+	// reading the pictures back
+	buffered *chunkWriter
+	// Whether pictures are being left out until the next keyframe, see ErrFallingBehind
+	skipping bool
+	size     int64
+	samples  []mp4Sample
+	// The last picture's RTP timestamp and its time from the first, for unwrapping timestamps
+	lastTimestamp uint32
+	lastPTS       int64
+}
+
+// NewMP4 starts an MP4 recording of codec, as RTSPStream.GetCodec names it, to be written to out.
+// params returns the camera's parameter sets, see RTSPStream.VideoParameterSets. Writes, to out
+// and to the temporary file alike, are gathered into 1 MB chunks, and those to the temporary file
+// are made from a goroutine of their own so a slow disk doesn't hold up the camera's packets.
+func NewMP4(out io.Writer, codec string, params func() [][]byte) (*MP4, error) {
+	video := transcode.NewElementaryStream(codec, params)
+	if video == nil {
+		return nil, fmt.Errorf("%s video can't be recorded to MP4", codec)
+	}
+	data, err := os.CreateTemp("", tempPattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	m := &MP4{
+		out:      out,
+		codec:    codec,
+		video:    video,
+		params:   params,
+		data:     data,
+		buffered: newChunkWriter(data),
+	}
+	switch codec {
+	case "H264":
+		m.dts = h264.NewDTSExtractor().Extract
+	case "H265":
+		m.dts = h265.NewDTSExtractor().Extract
+	}
+	return m, nil
+}
+
+// WritePacket adds a video packet. Pictures that lost packets, or that the disk is too far behind
+// to take (see ErrFallingBehind), are left out, and the error, wrapping transcode.ErrPictureLost,
+// says so; the recording carries on. Any other error means nothing more can be recorded, though
+// Close still writes what was. It never waits for the disk.
+func (m *MP4) WritePacket(pkt *rtp.Packet) error {
+	err := m.buffered.Err()
+	if err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	picture, keyframe, err := m.video.Write(pkt)
+	if err != nil || picture == nil {
+		return err
+	}
+
+	var pts int64
+	if len(m.samples) > 0 {
+		// The difference of two timestamps survives them wrapping around
+		pts = m.lastPTS + int64(int32(pkt.Timestamp-m.lastTimestamp))
+	}
+	m.lastTimestamp, m.lastPTS = pkt.Timestamp, pts
+
+	payload := picture
+	dts := pts
+	if m.dts != nil {
+		var au h264.AnnexB
+		err = au.Unmarshal(picture)
+		if err != nil {
+			return fmt.Errorf("failed to split picture: %w", err)
+		}
+		if m.track == nil {
+			m.track, err = m.nalTrack(au)
+			if err != nil {
+				return err
+			}
+		}
+		dts, err = m.dts(au, pts)
+		if err != nil {
+			// The picture still plays, a little out of time
+			dts = pts
+		}
+		payload, err = h264.AVCC(au).Marshal()
+		if err != nil {
+			return fmt.Errorf("failed to encode picture: %w", err)
+		}
+	} else if m.track == nil {
+		params := m.params()
+		if len(params) == 0 {
+			return fmt.Errorf("the camera's MPEG-4 configuration is unknown")
+		}
+		m.track = &mp4.CodecMPEG4Video{Config: params[0]}
+	}
+	// Decode times only go forward, whatever the camera's timestamps do
+	if len(m.samples) > 0 {
+		dts = max(dts, m.samples[len(m.samples)-1].dts+1)
+	}
+
+	if m.size+int64(len(payload)) > math.MaxUint32-8 {
+		return ErrTooBig
+	}
+
+	// Without the pictures before it a picture can't be decoded, so once one is left out the rest
+	// are too, until a keyframe
+	if m.skipping && !keyframe {
+		return nil
+	}
+	if len(payload) > m.buffered.room() {
+		m.skipping = true
+		return fmt.Errorf("%w: %w", transcode.ErrPictureLost, ErrFallingBehind)
+	}
+	m.skipping = false
+	m.buffered.Write(payload)
+	m.samples = append(m.samples, mp4Sample{pts: pts, dts: dts, keyframe: keyframe, offset: m.size, size: uint32(len(payload))})
+	m.size += int64(len(payload))
+	return nil
+}
+
+// nalTrack finds the H264 or H265 parameter sets for the MP4's track in the first picture, which
+// ElementaryStream starts with them
+func (m *MP4) nalTrack(au [][]byte) (mp4.Codec, error) {
+	if m.codec == "H264" {
+		track := &mp4.CodecH264{}
+		for _, nalu := range au {
+			switch h264.NALUType(nalu[0] & 0x1f) {
+			case h264.NALUTypeSPS:
+				track.SPS = nalu
+			case h264.NALUTypePPS:
+				track.PPS = nalu
+			}
+		}
+		if track.SPS == nil || track.PPS == nil {
+			return nil, fmt.Errorf("the camera's H264 SPS and PPS are unknown")
+		}
+		return track, nil
+	}
+
+	track := &mp4.CodecH265{}
+	for _, nalu := range au {
+		switch h265.NALUType((nalu[0] >> 1) & 0x3f) {
+		case h265.NALUType_VPS_NUT:
+			track.VPS = nalu
+		case h265.NALUType_SPS_NUT:
+			track.SPS = nalu
+		case h265.NALUType_PPS_NUT:
+			track.PPS = nalu
+		}
+	}
+	if track.VPS == nil || track.SPS == nil || track.PPS == nil {
+		return nil, fmt.Errorf("the camera's H265 VPS, SPS and PPS are unknown")
+	}
+	return track, nil
+}
+
+// Pictures reports how many pictures have been recorded
+func (m *MP4) Pictures() int {
+	return len(m.samples)
+}
+
+// Close writes the MP4 and removes the temporary file. A recording without a single picture is an
+// error, and nothing is written.
+func (m *MP4) Close() error {
+	defer os.Remove(m.data.Name())
+	defer m.data.Close()
+
+	err := m.buffered.Close()
+	if len(m.samples) == 0 {
+		return fmt.Errorf("the camera sent no keyframe, so nothing was recorded")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	samples := make([]*pmp4.Sample, len(m.samples))
+	for i, sample := range m.samples {
+		// A picture lasts until the next one is decoded, and the last as long as the one before it
+		var duration int64
+		switch {
+		case i+1 < len(m.samples):
+			duration = m.samples[i+1].dts - sample.dts
+		case i > 0:
+			duration = sample.dts - m.samples[i-1].dts
+		default:
+			duration = videoClockRate / 25
+		}
+		samples[i] = &pmp4.Sample{
+			Duration:        uint32(duration),
+			PTSOffset:       int32(sample.pts - sample.dts),
+			IsNonSyncSample: !sample.keyframe,
+			PayloadSize:     sample.size,
+			GetPayload: func() ([]byte, error) {
+				payload := make([]byte, sample.size)
+				_, err := m.data.ReadAt(payload, sample.offset)
+				return payload, err
+			},
+		}
+	}
+
+	presentation := pmp4.Presentation{Tracks: []*pmp4.Track{{
+		ID:        1,
+		TimeScale: videoClockRate,
+		Codec:     m.track,
+		Samples:   samples,
+	}}}
+	out := bufio.NewWriterSize(m.out, writeBufferSize)
+	err = presentation.Marshal(out)
+	if err == nil {
+		err = out.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write MP4: %w", err)
+	}
+	return nil
+}
+
+// RemoveStale removes the temporary files of recordings that never finished, e.g. because the
+// program recording them crashed, and returns the ones it removed. Those of recordings still going,
+// in this program or another, are left alone.
+func RemoveStale() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(os.TempDir(), tempPattern))
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	var errs []error
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || time.Since(info.ModTime()) < staleAfter {
+			continue
+		}
+		err = os.Remove(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed = append(removed, path)
+	}
+	return removed, errors.Join(errs...)
+}
@@ -0,0 +1,118 @@
+package recorder
+
+import (
+	"io"
+	"sync"
+)
+
+// writeQueueChunks is how many chunks of writeBufferSize can be waiting for the disk at once.
+// A recording takes at most this many MB of memory, and pictures are only dropped once the disk
+// has fallen this far behind.
+const writeQueueChunks = 8
+
+// chunkWriter writes to out from a goroutine of its own, in chunks of exactly writeBufferSize but
+// the last, so the camera's packets never wait for the disk. A full chunk is handed over on a
+// bounded queue; room says how much more can be written before that queue is full, and Write must
+// not be given more than that. A write error is kept, see Err, and everything after it is thrown away.
+type chunkWriter struct {
+	out io.Writer
+
+	chunk  []byte      // Being filled, nil until the first Write and after a full one is queued
+	queue  chan []byte // Full chunks on their way to out
+	free   chan []byte // Written chunks, to be filled again
+	chunks int         // How many chunks have been made, at most writeQueueChunks
+	done   chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+func newChunkWriter(out io.Writer) *chunkWriter {
+	w := &chunkWriter{
+		out:   out,
+		queue: make(chan []byte, writeQueueChunks),
+		free:  make(chan []byte, writeQueueChunks),
+		done:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// run writes the queued chunks until Close
+func (w *chunkWriter) run() {
+	defer close(w.done)
+	for chunk := range w.queue {
+		if w.Err() == nil {
+			_, err := w.out.Write(chunk)
+			if err != nil {
+				w.mu.Lock()
+				w.err = err
+				w.mu.Unlock()
+			}
+		}
+		w.free <- chunk[:0]
+	}
+}
+
+// room returns how many bytes Write can take without waiting. Chunks the goroutine finishes in the
+// meantime only add to it.
+func (w *chunkWriter) room() int {
+	room := (len(w.free) + writeQueueChunks - w.chunks) * writeBufferSize
+	if w.chunk != nil {
+		room += cap(w.chunk) - len(w.chunk)
+	}
+	return room
+}
+
+// Write queues p to be written. p must fit in room.
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if w.chunk == nil {
+			w.chunk = w.nextChunk()
+		}
+		copied := copy(w.chunk[len(w.chunk):cap(w.chunk)], p)
+		w.chunk = w.chunk[:len(w.chunk)+copied]
+		p = p[copied:]
+		if len(w.chunk) == cap(w.chunk) {
+			// There are never more chunks than the queue holds, so this doesn't wait
+			w.queue <- w.chunk
+			w.chunk = nil
+		}
+	}
+	return n, nil
+}
+
+// nextChunk returns an empty chunk, one the goroutine has written if there is one. Only called
+// when room says there is a chunk to be had.
+func (w *chunkWriter) nextChunk() []byte {
+	select {
+	case chunk := <-w.free:
+		return chunk
+	default:
+	}
+	if w.chunks < writeQueueChunks {
+		w.chunks++
+		return make([]byte, 0, writeBufferSize)
+	}
+	// room counted a chunk that is on its way back
+	return <-w.free
+}
+
+// Err returns the error writing to out failed with, if it has
+func (w *chunkWriter) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Close writes what is left and waits for everything queued to be written. It returns Err.
+func (w *chunkWriter) Close() error {
+	if len(w.chunk) > 0 {
+		w.queue <- w.chunk
+		w.chunk = nil
+	}
+	close(w.queue)
+	<-w.done
+	return w.Err()
+}
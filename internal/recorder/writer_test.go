@@ -0,0 +1,64 @@
+package recorder
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// slowWriter is a disk that takes delay over every write
+type slowWriter struct {
+	bytes.Buffer
+	delay time.Duration
+	sizes []int
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	w.sizes = append(w.sizes, len(p))
+	return w.Buffer.Write(p)
+}
+
+// TestChunkWriterDoesntBlock writes pictures faster than a slow disk takes them, the way
+// MP4.WritePacket does, and checks no write waits for the disk, pictures are left out once the
+// queue is full, and what was taken reaches the disk in order in whole chunks
+func TestChunkWriterDoesntBlock(t *testing.T) {
+	out := &slowWriter{delay: 100 * time.Millisecond}
+	w := newChunkWriter(out)
+
+	var taken bytes.Buffer
+	dropped := 0
+	picture := make([]byte, 300<<10)
+	for i := range 100 {
+		picture[0] = byte(i)
+		start := time.Now()
+		fits := len(picture) <= w.room()
+		if fits {
+			w.Write(picture)
+		}
+		if elapsed := time.Since(start); elapsed > out.delay/2 {
+			t.Fatalf("picture %d took %s, as long as the disk does", i, elapsed)
+		}
+		if fits {
+			taken.Write(picture)
+		} else {
+			dropped++
+		}
+	}
+	if dropped == 0 {
+		t.Error("no pictures were left out, though the disk couldn't keep up")
+	}
+
+	err := w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), taken.Bytes()) {
+		t.Errorf("the disk got %d bytes that differ from the %d taken", out.Len(), taken.Len())
+	}
+	for i, size := range out.sizes[:len(out.sizes)-1] {
+		if size != writeBufferSize {
+			t.Errorf("write %d was %d bytes, want %d", i, size, writeBufferSize)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package recovery
+
+import (
+	"log"
+	"runtime/debug"
+
+	"github.com/nisarg-dave/camera-viewer/internal/metrics"
+)
+
+// Recover stops a panic from taking down the whole process. Defer it at the top of a goroutine or a
+// callback that a library runs in its own goroutine:
+//
+//	defer recovery.Recover("packet_handler", nil)
+//
+// The panic is logged with its stack trace and counted in the panics_total metric under component.
+// onPanic, when set, is called afterwards to clean up, e.g. to close the viewer session that panicked.
+func Recover(component string, onPanic func(value any)) {
+	value := recover()
+	if value == nil {
+		return
+	}
+
+	log.Printf("Recovered from panic in %s: %v\n%s", component, value, debug.Stack())
+	metrics.Panic(component)
+	if onPanic != nil {
+		onPanic(value)
+	}
+}
@@ -0,0 +1,132 @@
+package rules
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+)
+
+// ActionFunc carries out one rule action for the event that triggered the rule
+type ActionFunc func(action config.RuleAction, e events.Event) error
+
+// Engine evaluates the configured rules against every event on the bus.
+// What an action can do depends on what has been registered with RegisterAction,
+// which keeps this package independent of webhooks, cameras and so on.
+type Engine struct {
+	rules   []config.Rule
+	actions map[string]ActionFunc
+}
+
+// NewEngine creates an engine for the given rules. Register actions, then call Validate.
+func NewEngine(rules []config.Rule) *Engine {
+	return &Engine{
+		rules:   rules,
+		actions: make(map[string]ActionFunc),
+	}
+}
+
+// RegisterAction makes an action type available to rules
+func (e *Engine) RegisterAction(actionType string, fn ActionFunc) {
+	e.actions[actionType] = fn
+}
+
+// Validate checks every rule up front, so a typo in the config fails at startup
+// rather than silently when the rule first fires
+func (e *Engine) Validate() error {
+	for _, rule := range e.rules {
+		if len(rule.Actions) == 0 {
+			return fmt.Errorf("rule %q has no actions", rule.Name)
+		}
+		if rule.Between != nil {
+			err := rule.Between.Validate()
+			if err != nil {
+				return fmt.Errorf("rule %q between %w", rule.Name, err)
+			}
+		}
+		for _, action := range rule.Actions {
+			if _, ok := e.actions[action.Type]; !ok {
+				return fmt.Errorf("rule %q uses unknown action type %q", rule.Name, action.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// ruleQueueSize is how many triggers of one rule can wait while its actions are still running
+const ruleQueueSize = 16
+
+// Run evaluates rules for events from the bus until stop is closed.
+// Each rule runs its actions on its own goroutine, one trigger after another, so a slow action
+// (HTTP calls, reconnects) doesn't hold up other rules and an event storm can't start a goroutine
+// per event. Triggers that arrive while a rule's queue is full are skipped.
+// Run returns once those goroutines have finished the triggers already queued.
+// This blocks, so call it in a goroutine.
+func (e *Engine) Run(bus *events.Bus, stop <-chan struct{}) {
+	sub := bus.Subscribe(64, nil)
+	defer sub.Close()
+
+	var running sync.WaitGroup
+	queues := make([]chan events.Event, len(e.rules))
+	for i, rule := range e.rules {
+		queues[i] = make(chan events.Event, ruleQueueSize)
+		running.Go(func() {
+			for event := range queues[i] {
+				e.runActions(rule, event)
+			}
+		})
+	}
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		running.Wait()
+	}()
+
+	for {
+		var event events.Event
+		select {
+		case <-stop:
+			return
+		case event = <-sub.C:
+		}
+		for i, rule := range e.rules {
+			if !matches(rule, event) {
+				continue
+			}
+			select {
+			case queues[i] <- event:
+			default:
+				log.Printf("Rule %q is still busy with earlier events, skipping %s", rule.Name, event)
+			}
+		}
+	}
+}
+
+// runActions runs a rule's actions in order. A failing action is logged and the rest still run.
+func (e *Engine) runActions(rule config.Rule, event events.Event) {
+	log.Printf("Rule %q triggered by %s", rule.Name, event)
+
+	for _, action := range rule.Actions {
+		err := e.actions[action.Type](action, event)
+		if err != nil {
+			log.Printf("Rule %q action %s failed: %v", rule.Name, action.Type, err)
+		}
+	}
+}
+
+func matches(rule config.Rule, e events.Event) bool {
+	if len(rule.Events) > 0 && !slices.Contains(rule.Events, string(e.Type)) {
+		return false
+	}
+	if len(rule.Cameras) > 0 && !slices.Contains(rule.Cameras, e.Camera) {
+		return false
+	}
+	if rule.Between != nil && !rule.Between.Contains(e.Time) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,424 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/metrics"
+	"github.com/nisarg-dave/camera-viewer/internal/monitor"
+	"github.com/nisarg-dave/camera-viewer/internal/recovery"
+	"github.com/nisarg-dave/camera-viewer/internal/tracing"
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+	"github.com/nisarg-dave/camera-viewer/pkg/stream"
+
+	"github.com/pion/rtp"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxPacketPanics panics handling packets within a minute make the supervisor reconnect the camera,
+// in case the connection itself is in a bad state
+const maxPacketPanics = 10
+
+// Camera keeps one camera's RTSP connection up. It reconnects with backoff when the connection drops,
+// and runs a watchdog that tears down connections that are nominally up but have stopped delivering
+// packets, which some camera firmware does instead of closing the connection.
+// With a failover URL it switches to that after repeated failures, and back once the primary answers again.
+type Camera struct {
+	// Cancelling ctx closes the camera connection and stops reconnects
+	ctx     context.Context
+	id      string
+	stream  *stream.RTSPStream
+	monitor *monitor.StreamMonitor
+	bus     *events.Bus
+	metrics *metrics.Camera
+	cfg     config.Reconnect
+
+	// Reported by the RTSP client's goroutine, handled in Run
+	lost chan error
+	// Reconnects asked for from outside Run, e.g. after repeated panics in the packet handler
+	restart chan string
+
+	// Panics in the packet handler over the last minute, see PacketHandler
+	panicMu          sync.Mutex
+	panicWindowStart time.Time
+	panicCount       int
+
+	// mu is held for connects and closes so they never overlap
+	mu          sync.Mutex
+	enabled     bool
+	connected   bool
+	failures    int
+	nextAttempt time.Time
+	onConnected func()
+	// Kept outside mu so State doesn't wait for a slow connect
+	state atomic.Value
+	// Why the last connect failed, nil after one succeeds. Outside mu for the same reason as state.
+	errMu   sync.Mutex
+	lastErr error
+
+	// The stream's own URL is the primary; failover is empty when there is no backup
+	primary          string
+	failover         string
+	onFailover       bool
+	nextPrimaryCheck time.Time
+}
+
+// NewCamera supervises the connection of s. Set its disconnect handler to Disconnected.
+// ctx is how long the camera may stay connected, usually the server's context: once it is
+// cancelled the connection is closed and no more reconnects are tried.
+func NewCamera(ctx context.Context, id string, s *stream.RTSPStream, m *monitor.StreamMonitor, bus *events.Bus, cfg config.Reconnect) *Camera {
+	// The stream's ctx only bounds each connect, so the connection itself is closed from here
+	context.AfterFunc(ctx, func() { s.Close() })
+	return &Camera{
+		ctx:     ctx,
+		id:      id,
+		stream:  s,
+		monitor: m,
+		bus:     bus,
+		metrics: metrics.ForCamera(id),
+		cfg:     cfg,
+		lost:    make(chan error, 1),
+		restart: make(chan string, 1),
+		primary: s.URL,
+	}
+}
+
+// SetFailoverURL sets a backup stream, e.g. the camera's sub-stream or an NVR relay, to use while the primary is failing.
+// It must be called before Connect.
+func (c *Camera) SetFailoverURL(url string) {
+	c.failover = url
+}
+
+// URLs returns the primary stream URL, and the failover URL or "" without one
+func (c *Camera) URLs() (primary, failover string) {
+	return c.primary, c.failover
+}
+
+// OnConnected sets a function that is called after every successful connect and reconnect
+func (c *Camera) OnConnected(handler func()) {
+	c.onConnected = handler
+}
+
+// Connect connects to the camera now and keeps it connected from then on.
+// An existing connection is closed first. ctx bounds this connect, on top of the configured
+// connect timeout; the connection itself lasts as long as the context given to NewCamera.
+func (c *Camera) Connect(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.updateState()
+
+	c.enabled = true
+	if c.connected {
+		c.stream.Close()
+		c.connected = false
+	}
+	// Shows as connecting while the attempt runs, rather than whatever it was before
+	c.updateState()
+	// Shutting down stops the connect too
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(c.ctx, cancel)
+	defer stop()
+	return c.connect(ctx)
+}
+
+// Disable closes the connection and stops reconnecting until Connect is called again
+func (c *Camera) Disable() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.enabled = false
+	c.connected = false
+	c.updateState()
+	err := c.stream.Close()
+	c.monitor.Pause()
+	return err
+}
+
+// Connected reports whether the camera is connected
+func (c *Camera) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+// State is "connected", "connecting" while it should be connected but isn't (e.g. the camera was
+// unreachable at startup), or "disabled"
+func (c *Camera) State() string {
+	state, ok := c.state.Load().(string)
+	if !ok {
+		return "disabled"
+	}
+	return state
+}
+
+// updateState sets what State reports from enabled and connected. Must be called with mu held.
+func (c *Camera) updateState() {
+	switch {
+	case c.connected:
+		c.state.Store("connected")
+	case c.enabled:
+		c.state.Store("connecting")
+	default:
+		c.state.Store("disabled")
+	}
+}
+
+// LastError returns why the last connect failed, or nil if it succeeded or there hasn't been one yet.
+// It wraps stream.ErrAuthFailed, stream.ErrCameraUnreachable or stream.ErrUnsupportedCodec when
+// the failure was one of those.
+func (c *Camera) LastError() error {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	return c.lastErr
+}
+
+// Disconnected is the RTSP stream's disconnect handler. The reconnect happens in Run.
+func (c *Camera) Disconnected(err error) {
+	c.monitor.Disconnected(err)
+	select {
+	case c.lost <- err:
+	default:
+	}
+}
+
+// PacketHandler wraps the stream's packet handler so a panic while handling one packet, e.g. a
+// malformed packet hitting a bug, drops that packet instead of crashing the process.
+// If it keeps happening the camera is reconnected.
+func (c *Camera) PacketHandler(handler func(*rtp.Packet)) func(*rtp.Packet) {
+	return func(pkt *rtp.Packet) {
+		defer recovery.Recover("packet_handler", c.packetPanicked)
+		handler(pkt)
+	}
+}
+
+// packetPanicked counts a panic in the packet handler and asks Run for a reconnect when there are too many
+func (c *Camera) packetPanicked(any) {
+	now := time.Now()
+
+	c.panicMu.Lock()
+	if now.Sub(c.panicWindowStart) > time.Minute {
+		c.panicWindowStart = now
+		c.panicCount = 0
+	}
+	c.panicCount++
+	restart := c.panicCount == maxPacketPanics
+	c.panicMu.Unlock()
+
+	// Closing the connection from the client's own packet callback could deadlock, so Run does it
+	if restart {
+		select {
+		case c.restart <- fmt.Sprintf("%d panics handling packets within a minute", maxPacketPanics):
+		default:
+		}
+	}
+}
+
+// Run reconnects the camera when it drops and runs the watchdog until stop is closed.
+// This blocks, so call it in a goroutine.
+func (c *Camera) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-c.lost:
+			c.mu.Lock()
+			c.connected = false
+			c.nextAttempt = time.Now().Add(c.backoff())
+			c.updateState()
+			c.mu.Unlock()
+		case reason := <-c.restart:
+			c.mu.Lock()
+			if c.enabled && c.connected {
+				log.Printf("Reconnecting camera %s: %s", c.id, reason)
+				c.reconnectNow(time.Now())
+			}
+			c.mu.Unlock()
+		case now := <-ticker.C:
+			c.checkWatchdog(now)
+			c.reconnectIfDue(now)
+			c.checkPrimary(now)
+		}
+	}
+}
+
+// checkWatchdog tears down a connection that hasn't delivered a packet within the watchdog timeout
+func (c *Camera) checkWatchdog(now time.Time) {
+	if c.cfg.DisableWatchdog {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.enabled || !c.connected {
+		return
+	}
+	// The monitor resets the last packet time on connect, so a camera that never sends anything is caught too
+	lastPacket := c.monitor.LastPacket()
+	silence := now.Sub(lastPacket)
+	if lastPacket.IsZero() || silence < time.Duration(c.cfg.WatchdogTimeout) {
+		return
+	}
+
+	log.Printf("Camera %s has sent no packets for %s while connected, reconnecting", c.id, silence.Round(time.Second))
+	c.metrics.WatchdogRestarts.Inc()
+	c.bus.Publish(events.Event{
+		Type:    events.TypeWatchdogRestart,
+		Camera:  c.id,
+		Message: fmt.Sprintf("no packets for %s while connected, reconnecting", silence.Round(time.Second)),
+		Data:    map[string]any{"silence_seconds": silence.Seconds()},
+	})
+
+	c.reconnectNow(now)
+}
+
+// reconnectNow closes the connection so it is reconnected on the next tick. Must be called with mu held.
+func (c *Camera) reconnectNow(now time.Time) {
+	c.stream.Close()
+	c.monitor.Pause()
+	c.connected = false
+	c.nextAttempt = now
+	c.updateState()
+}
+
+// reconnectIfDue tries to reconnect a camera that should be connected but isn't, once its backoff is over
+func (c *Camera) reconnectIfDue(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Once ctx is cancelled the server is shutting down and a reconnect would be closed straight away
+	if !c.enabled || c.connected || now.Before(c.nextAttempt) || c.ctx.Err() != nil {
+		return
+	}
+
+	ctx, span := tracing.Start(c.ctx, "camera.reconnect",
+		attribute.String("camera", c.id), attribute.Int("attempt", c.failures+1))
+	defer span.End()
+
+	err := c.connect(ctx)
+	if err != nil {
+		tracing.Fail(span, err)
+		log.Printf("Failed to reconnect camera %s (attempt %d, next in %s): %v", c.id, c.failures, c.backoff(), err)
+		return
+	}
+	c.metrics.Reconnects.Inc()
+}
+
+// checkPrimary switches back from the failover URL once the primary answers again.
+// The probe runs without mu held since a camera that is still down can take a while to time out.
+func (c *Camera) checkPrimary(now time.Time) {
+	c.mu.Lock()
+	due := c.enabled && c.connected && c.onFailover && !now.Before(c.nextPrimaryCheck)
+	if due {
+		c.nextPrimaryCheck = now.Add(time.Duration(c.cfg.PrimaryCheckInterval))
+	}
+	c.mu.Unlock()
+	if !due {
+		return
+	}
+
+	// A camera that answers DESCRIBE slower than it is allowed to connect isn't ready to go back to
+	ctx, cancel := context.WithTimeout(c.ctx, time.Duration(c.cfg.ConnectTimeout))
+	err := c.stream.Probe(ctx, c.primary)
+	cancel()
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// The camera may have been disabled or dropped while probing, in which case the normal reconnect handles it
+	if !c.enabled || !c.connected || !c.onFailover {
+		return
+	}
+
+	c.stream.Close()
+	c.monitor.Pause()
+	c.connected = false
+	c.updateState()
+	c.switchURL(false, "primary stream is available again")
+
+	ctx, span := tracing.Start(c.ctx, "camera.failback", attribute.String("camera", c.id))
+	defer span.End()
+	err = c.connect(ctx)
+	if err != nil {
+		tracing.Fail(span, err)
+		log.Printf("Failed to reconnect camera %s to its primary stream: %v", c.id, err)
+	}
+}
+
+// switchURL points the stream at the failover or the primary URL. Must be called with mu held.
+func (c *Camera) switchURL(failover bool, reason string) {
+	c.onFailover = failover
+	c.failures = 0
+	c.nextAttempt = time.Now()
+
+	name := "primary"
+	c.stream.URL = c.primary
+	if failover {
+		name = "failover"
+		c.stream.URL = c.failover
+		c.nextPrimaryCheck = time.Now().Add(time.Duration(c.cfg.PrimaryCheckInterval))
+	}
+
+	log.Printf("Switching camera %s to its %s stream: %s", c.id, name, reason)
+	c.bus.Publish(events.Event{
+		Type:    events.TypeCameraFailover,
+		Camera:  c.id,
+		Message: fmt.Sprintf("switched to the %s stream: %s", name, reason),
+		Data:    map[string]any{"stream": name},
+	})
+}
+
+// connect connects the stream, keeping track of failures for the backoff. Must be called with mu held.
+// With a failover URL, enough failures in a row switch to the other URL.
+func (c *Camera) connect(ctx context.Context) error {
+	// The deadline only bounds the connect, not how long the connection lasts
+	timeout := time.Duration(c.cfg.ConnectTimeout)
+	connectCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := c.stream.Connect(connectCtx)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		err = fmt.Errorf("failed to connect within %s: %w", timeout, err)
+	}
+	c.errMu.Lock()
+	c.lastErr = err
+	c.errMu.Unlock()
+	if err != nil {
+		c.failures++
+		c.nextAttempt = time.Now().Add(c.backoff())
+		if c.failover != "" && c.failures >= c.cfg.FailoverAfter {
+			// If the failover is failing too, this goes back to trying the primary
+			c.switchURL(!c.onFailover, fmt.Sprintf("%d failed attempts", c.failures))
+		}
+		return err
+	}
+
+	c.connected = true
+	c.failures = 0
+	c.updateState()
+	c.monitor.Connected()
+	if c.onConnected != nil {
+		c.onConnected()
+	}
+	return nil
+}
+
+// backoff is how long to wait before the next attempt: doubling with every failure up to the maximum
+func (c *Camera) backoff() time.Duration {
+	backoff := time.Duration(c.cfg.MinBackoff)
+	for i := 1; i < c.failures && backoff < time.Duration(c.cfg.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	return min(backoff, time.Duration(c.cfg.MaxBackoff))
+}
@@ -0,0 +1,132 @@
+package supervisor
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/metrics"
+	"github.com/nisarg-dave/camera-viewer/internal/recovery"
+)
+
+const (
+	// Wait between restarts of a failed subsystem, doubling while it keeps failing
+	minRestartDelay = time.Second
+	maxRestartDelay = time.Minute
+	// A subsystem that ran this long before failing starts over from minRestartDelay
+	stableAfter = time.Minute
+)
+
+// Subsystem is a long-running background job such as an event consumer or a monitor.
+// It should run until stop is closed. Returning before that, or panicking, counts as failing.
+type Subsystem func(stop <-chan struct{})
+
+// SubsystemStatus is how a subsystem is doing, for GET /api/subsystems
+type SubsystemStatus struct {
+	Name     string `json:"name"`
+	Running  bool   `json:"running"`
+	Restarts int    `json:"restarts"`
+	// Why it last failed: the panic, or that it returned
+	LastError   string    `json:"last_error,omitempty"`
+	LastFailure time.Time `json:"last_failure,omitzero"`
+}
+
+// Tree runs the background subsystems and restarts each one independently, with backoff, when it
+// fails, so a bug in one event consumer doesn't silently leave the server without it.
+// Failures are logged, counted in subsystem_restarts_total and reported by Status.
+type Tree struct {
+	stop     chan struct{}
+	stopOnce sync.Once
+	// The subsystems' goroutines, which Stop waits for
+	running sync.WaitGroup
+
+	mu       sync.Mutex
+	children []*SubsystemStatus
+}
+
+// NewTree creates an empty tree. Add subsystems with Go.
+func NewTree() *Tree {
+	return &Tree{stop: make(chan struct{})}
+}
+
+// Go starts a subsystem under the tree
+func (t *Tree) Go(name string, run Subsystem) {
+	status := &SubsystemStatus{Name: name, Running: true}
+	t.mu.Lock()
+	t.children = append(t.children, status)
+	t.mu.Unlock()
+
+	t.running.Go(func() { t.supervise(status, run) })
+}
+
+// Stop closes every subsystem's stop channel, stops restarting them and waits for them to return
+func (t *Tree) Stop() {
+	t.stopOnce.Do(func() { close(t.stop) })
+	t.running.Wait()
+}
+
+// Status returns how every subsystem is doing, in the order they were started
+func (t *Tree) Status() []SubsystemStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	list := make([]SubsystemStatus, len(t.children))
+	for i, status := range t.children {
+		list[i] = *status
+	}
+	return list
+}
+
+// supervise runs a subsystem until the tree is stopped, restarting it whenever it fails
+func (t *Tree) supervise(status *SubsystemStatus, run Subsystem) {
+	delay := minRestartDelay
+	for {
+		started := time.Now()
+		err := t.runOnce(status.Name, run)
+
+		select {
+		case <-t.stop:
+			t.setRunning(status, false)
+			return
+		default:
+		}
+
+		if time.Since(started) >= stableAfter {
+			delay = minRestartDelay
+		}
+		log.Printf("Subsystem %s failed: %v, restarting in %s", status.Name, err, delay)
+		metrics.SubsystemRestart(status.Name)
+
+		t.mu.Lock()
+		status.Running = false
+		status.Restarts++
+		status.LastError = err.Error()
+		status.LastFailure = time.Now()
+		t.mu.Unlock()
+
+		select {
+		case <-t.stop:
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRestartDelay)
+		t.setRunning(status, true)
+	}
+}
+
+// runOnce runs a subsystem and returns why it stopped
+func (t *Tree) runOnce(name string, run Subsystem) (err error) {
+	err = fmt.Errorf("returned unexpectedly")
+	defer recovery.Recover(name, func(value any) {
+		err = fmt.Errorf("panic: %v", value)
+	})
+	run(t.stop)
+	return err
+}
+
+func (t *Tree) setRunning(status *SubsystemStatus, running bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status.Running = running
+}
@@ -0,0 +1,87 @@
+package transcode
+
+import (
+	"bytes"
+	"io"
+)
+
+// h264NALAUD is the access unit delimiter, which ffmpeg is asked to put before every picture
+const h264NALAUD = 9
+
+var startCode = []byte{0, 0, 1}
+
+// readAccessUnits reads an Annex-B H264 stream and calls emit with each access unit's NAL units,
+// splitting at access unit delimiters, which are left out. It returns when r does, with its error.
+func readAccessUnits(r io.Reader, emit func(au [][]byte)) error {
+	var au [][]byte
+	err := readNALUnits(r, func(nalu []byte) {
+		if nalu[0]&0x1f != h264NALAUD {
+			au = append(au, nalu)
+			return
+		}
+		if len(au) > 0 {
+			emit(au)
+			au = nil
+		}
+	})
+	if len(au) > 0 {
+		emit(au)
+	}
+	return err
+}
+
+// readNALUnits reads an Annex-B stream and calls emit with each NAL unit, without its start code.
+// A NAL unit is only known to be complete once the next start code has been read.
+func readNALUnits(r io.Reader, emit func(nalu []byte)) error {
+	var buf []byte
+	chunk := make([]byte, 64<<10)
+	start := -1  // Where the NAL unit being read starts in buf, just after its start code
+	scanned := 0 // How far buf has been searched for start codes
+
+	for {
+		n, err := r.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+
+		for {
+			i := bytes.Index(buf[scanned:], startCode)
+			if i < 0 {
+				// A start code may be split across reads
+				scanned = max(len(buf)-len(startCode)+1, start, 0)
+				break
+			}
+			pos := scanned + i
+			if start >= 0 {
+				emitNALUnit(buf[start:pos], emit)
+			}
+			start = pos + len(startCode)
+			scanned = start
+		}
+
+		// Keep only the unfinished NAL unit, with its start code, for the next read
+		if start >= 0 {
+			keep := start - len(startCode)
+			buf = append(buf[:0], buf[keep:]...)
+			start -= keep
+			scanned -= keep
+		}
+
+		if err != nil {
+			if start >= 0 {
+				emitNALUnit(buf[start:], emit)
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// emitNALUnit passes on a copy of a NAL unit, since the buffer it was read into is reused.
+// The zeros at the end belong to the next start code, when it is the 4 byte form.
+func emitNALUnit(nalu []byte, emit func([]byte)) {
+	nalu = bytes.TrimRight(nalu, "\x00")
+	if len(nalu) > 0 {
+		emit(bytes.Clone(nalu))
+	}
+}
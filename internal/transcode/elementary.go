@@ -0,0 +1,58 @@
+package transcode
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pion/rtp"
+)
+
+// ErrPictureLost is returned by ElementaryStream.Write for a picture that lost packets
+var ErrPictureLost = errors.New("picture lost")
+
+// ElementaryStream turns a camera's RTP packets into the raw video stream ffmpeg and most players
+// read: Annex-B for H264 and H265, and MPEG-4 Visual as it is. It starts at the first keyframe,
+// with the camera's parameter sets in front, so the stream can be decoded from its first byte.
+type ElementaryStream struct {
+	input  input
+	params func() [][]byte
+	// Whether the first keyframe has been written
+	started bool
+}
+
+// NewElementaryStream returns the stream for codec, as RTSPStream.GetCodec names it, or nil for one
+// it can't make (AV1). params returns the camera's parameter sets, as for New.
+func NewElementaryStream(codec string, params func() [][]byte) *ElementaryStream {
+	in := newSnapshotInput(codec)
+	if in == nil {
+		return nil
+	}
+	return &ElementaryStream{input: in, params: params}
+}
+
+// Write takes a packet and returns the stream's next bytes, a whole picture once its last packet
+// has been given and nil before then or before the first keyframe, and whether it is a keyframe.
+// The picture's timestamp is pkt's. A picture that lost packets is left out, and the error says
+// so, wrapping ErrPictureLost; the stream carries on with the next picture.
+func (e *ElementaryStream) Write(pkt *rtp.Packet) (picture []byte, keyframe bool, err error) {
+	picture, keyframe, err = e.input.decode(pkt)
+	if errors.Is(err, errMorePacketsNeeded) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %w", ErrPictureLost, err)
+	}
+	if !e.started {
+		if !keyframe {
+			return nil, false, nil
+		}
+		e.started = true
+		return e.input.withConfig(picture, e.params()), true, nil
+	}
+	return picture, keyframe, nil
+}
+
+// Format is the stream's ffmpeg format name: h264, hevc or m4v
+func (e *ElementaryStream) Format() string {
+	return e.input.ffmpegFormat()
+}
@@ -0,0 +1,136 @@
+package transcode
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Encoders, for Options.Encoder
+const (
+	EncoderSoftware = "libx264"
+	EncoderVAAPI    = "vaapi"   // Intel and AMD GPUs
+	EncoderNVENC    = "nvenc"   // NVIDIA GPUs
+	EncoderV4L2M2M  = "v4l2m2m" // Raspberry Pi 4 and other boards with a V4L2 memory-to-memory encoder
+)
+
+// defaultVAAPIDevice is the first GPU's render node, which is the only one on most machines
+const defaultVAAPIDevice = "/dev/dri/renderD128"
+
+// checkEncoder returns an error for an encoder ffmpegArgs doesn't know
+func checkEncoder(encoder string) error {
+	switch encoder {
+	case EncoderSoftware, EncoderVAAPI, EncoderNVENC, EncoderV4L2M2M:
+		return nil
+	default:
+		return fmt.Errorf("unknown encoder %q, must be %s, %s, %s or %s", encoder, EncoderSoftware, EncoderVAAPI, EncoderNVENC, EncoderV4L2M2M)
+	}
+}
+
+// ffmpegArgs builds the command line that reads the camera's video on stdin, as an elementary stream
+// in inputFormat (see input.ffmpegFormat), and writes Annex-B H264 on stdout. Everything is tuned for
+// latency over compression: no B-frames, no lookahead, and ffmpeg's input buffering turned off.
+func ffmpegArgs(opts Options, inputFormat string) []string {
+	// GPUs that can decode MPEG-4 Part 2 at all are rare, and its low resolutions decode fine in software
+	hwDecode := inputFormat == "hevc"
+
+	args := []string{
+		"-hide_banner", "-loglevel", "error",
+		"-fflags", "nobuffer", "-flags", "low_delay",
+		// A raw stream has no timestamps of its own, so they are taken from when each picture arrives
+		"-use_wallclock_as_timestamps", "1",
+	}
+	args = append(args, decoderArgs(opts, hwDecode)...)
+	args = append(args,
+		"-f", inputFormat, "-i", "pipe:0",
+		"-an",
+	)
+	args = append(args, encoderArgs(opts, hwDecode)...)
+	return append(args,
+		"-bf", "0",
+		// Browsers can only start decoding at a keyframe, so viewers shouldn't have to wait long for one
+		"-force_key_frames", "expr:gte(t,n_forced*2)",
+		// Delimiters mark where each picture ends, see readAccessUnits
+		"-bsf:v", "h264_metadata=aud=insert",
+		"-f", "h264", "pipe:1",
+	)
+}
+
+// decoderArgs decodes H265 on the same GPU as the encoder where there is one, and keeps the
+// pictures in its memory in between. Decoding 4K H265 is as much work as encoding the H264.
+func decoderArgs(opts Options, hwDecode bool) []string {
+	switch opts.Encoder {
+	case EncoderVAAPI:
+		if !hwDecode {
+			// Only opened for the encoder, see encoderArgs
+			return []string{"-vaapi_device", opts.Device}
+		}
+		return []string{
+			"-hwaccel", "vaapi", "-hwaccel_device", opts.Device,
+			"-hwaccel_output_format", "vaapi",
+		}
+	case EncoderNVENC:
+		if !hwDecode {
+			// NVENC takes pictures from ordinary memory as they are
+			return nil
+		}
+		return []string{"-hwaccel", "cuda", "-hwaccel_output_format", "cuda"}
+	default:
+		// The Raspberry Pi's H265 decoder isn't a V4L2 memory-to-memory one, so it decodes in software
+		return nil
+	}
+}
+
+// encoderArgs picks and configures the H264 encoder
+func encoderArgs(opts Options, hwDecode bool) []string {
+	bitrate := strconv.Itoa(opts.BitrateKbps) + "k"
+	rate := []string{"-b:v", bitrate, "-maxrate", bitrate, "-bufsize", bitrate}
+
+	switch opts.Encoder {
+	case EncoderVAAPI:
+		var upload []string
+		if !hwDecode {
+			// Pictures decoded in software have to be copied to the GPU first
+			upload = []string{"-vf", "format=nv12,hwupload"}
+		}
+		return append(append(upload,
+			"-c:v", "h264_vaapi",
+			"-profile:v", "constrained_baseline",
+			"-rc_mode", "CBR",
+		), rate...)
+	case EncoderNVENC:
+		return append([]string{
+			"-c:v", "h264_nvenc",
+			"-preset", "p2", "-tune", "ll",
+			"-profile:v", "baseline",
+			"-rc", "cbr", "-zerolatency", "1",
+			// Otherwise forced keyframes aren't IDR pictures, and browsers can't start from them
+			"-forced-idr", "1",
+		}, rate...)
+	case EncoderV4L2M2M:
+		return append([]string{
+			"-c:v", "h264_v4l2m2m",
+			"-pix_fmt", "yuv420p",
+		}, rate...)
+	default:
+		return append([]string{
+			"-c:v", "libx264",
+			"-preset", opts.Preset,
+			"-tune", "zerolatency",
+			// Constrained baseline is the one profile every browser can decode
+			"-profile:v", "baseline",
+			"-pix_fmt", "yuv420p",
+		}, rate...)
+	}
+}
+
+// ffmpegLog logs what ffmpeg writes to stderr, a line at a time
+type ffmpegLog struct{}
+
+func (ffmpegLog) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		log.Printf("ffmpeg: %s", line)
+	}
+	return len(p), nil
+}
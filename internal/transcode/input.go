@@ -0,0 +1,187 @@
+package transcode
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/format/rtpfragmented"
+	"github.com/bluenviron/gortsplib/v4/pkg/format/rtph264"
+	"github.com/bluenviron/gortsplib/v4/pkg/format/rtph265"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/mpeg4video"
+	"github.com/pion/rtp"
+)
+
+// errMorePacketsNeeded is returned by input.decode until a picture is complete
+var errMorePacketsNeeded = errors.New("more packets needed")
+
+// input turns one camera codec's RTP packets into the elementary stream ffmpeg reads
+type input interface {
+	// decode returns a whole picture once its last packet has been given, and errMorePacketsNeeded
+	// before then. Any other error means packets were lost and the picture is gone.
+	decode(pkt *rtp.Packet) (picture []byte, keyframe bool, err error)
+	// withConfig puts the camera's parameter sets or configuration in front of a keyframe that doesn't
+	// start with its own, since ffmpeg can't decode anything without them
+	withConfig(keyframe []byte, params [][]byte) []byte
+	// ffmpegFormat is the demuxer ffmpeg reads the stream with
+	ffmpegFormat() string
+}
+
+// newInput returns the input for a codec as RTSPStream.GetCodec names it, or nil if it can't be transcoded
+func newInput(codec string) input {
+	switch codec {
+	case "H265":
+		return newH265Input()
+	case "MPEG4":
+		return newMPEG4Input()
+	}
+	return nil
+}
+
+// newSnapshotInput is newInput plus H264, which is never transcoded but can be taken snapshots of
+func newSnapshotInput(codec string) input {
+	if codec == "H264" {
+		return newH264Input()
+	}
+	return newInput(codec)
+}
+
+// h264Input reads H264, written to ffmpeg as Annex-B
+type h264Input struct {
+	decoder *rtph264.Decoder
+}
+
+func newH264Input() *h264Input {
+	decoder := &rtph264.Decoder{}
+	decoder.Init()
+	return &h264Input{decoder: decoder}
+}
+
+func (in *h264Input) decode(pkt *rtp.Packet) ([]byte, bool, error) {
+	au, err := in.decoder.Decode(pkt)
+	if errors.Is(err, rtph264.ErrMorePacketsNeeded) {
+		return nil, false, errMorePacketsNeeded
+	}
+	if err != nil {
+		in.decoder = newH264Input().decoder
+		return nil, false, err
+	}
+	buf, err := h264.AnnexB(au).Marshal()
+	if err != nil {
+		return nil, false, err
+	}
+	return buf, h264.IsRandomAccess(au), nil
+}
+
+func (in *h264Input) withConfig(keyframe []byte, params [][]byte) []byte {
+	// Cameras that repeat their parameter sets send the SPS first
+	if len(keyframe) > 4 && h264.NALUType(keyframe[4]&0x1f) == h264.NALUTypeSPS {
+		return keyframe
+	}
+	if len(params) == 0 {
+		return keyframe
+	}
+	buf, err := h264.AnnexB(params).Marshal()
+	if err != nil {
+		return keyframe
+	}
+	return append(buf, keyframe...)
+}
+
+func (in *h264Input) ffmpegFormat() string {
+	return "h264"
+}
+
+// h265Input reads H265, written to ffmpeg as Annex-B
+type h265Input struct {
+	decoder *rtph265.Decoder
+}
+
+func newH265Input() *h265Input {
+	decoder := &rtph265.Decoder{}
+	// Init only fails for options that aren't set here
+	decoder.Init()
+	return &h265Input{decoder: decoder}
+}
+
+func (in *h265Input) decode(pkt *rtp.Packet) ([]byte, bool, error) {
+	au, err := in.decoder.Decode(pkt)
+	if errors.Is(err, rtph265.ErrMorePacketsNeeded) {
+		return nil, false, errMorePacketsNeeded
+	}
+	if err != nil {
+		// The decoder starts again from the next picture
+		in.decoder = newH265Input().decoder
+		return nil, false, err
+	}
+	buf, err := h264.AnnexB(au).Marshal()
+	if err != nil {
+		return nil, false, err
+	}
+	return buf, h265.IsRandomAccess(au), nil
+}
+
+func (in *h265Input) withConfig(keyframe []byte, params [][]byte) []byte {
+	// Marshal starts every NAL unit with a 4 byte start code, and cameras send the VPS first
+	if len(keyframe) > 4 && h265.NALUType((keyframe[4]>>1)&0x3f) == h265.NALUType_VPS_NUT {
+		return keyframe
+	}
+	if len(params) == 0 {
+		return keyframe
+	}
+	buf, err := h264.AnnexB(params).Marshal()
+	if err != nil {
+		return keyframe
+	}
+	return append(buf, keyframe...)
+}
+
+func (in *h265Input) ffmpegFormat() string {
+	return "hevc"
+}
+
+// mpeg4Input reads MPEG-4 Part 2 (MPEG-4 Visual), whose frames are already in the raw form ffmpeg reads
+type mpeg4Input struct {
+	decoder *rtpfragmented.Decoder
+}
+
+func newMPEG4Input() *mpeg4Input {
+	decoder := &rtpfragmented.Decoder{}
+	decoder.Init()
+	return &mpeg4Input{decoder: decoder}
+}
+
+func (in *mpeg4Input) decode(pkt *rtp.Packet) ([]byte, bool, error) {
+	frame, err := in.decoder.Decode(pkt)
+	if errors.Is(err, rtpfragmented.ErrMorePacketsNeeded) {
+		return nil, false, errMorePacketsNeeded
+	}
+	if err != nil {
+		in.decoder = newMPEG4Input().decoder
+		return nil, false, err
+	}
+	// A frame that fit in one packet is the packet's payload, whose memory may be reused by the RTSP client
+	return bytes.Clone(frame), isMPEG4Keyframe(frame), nil
+}
+
+// isMPEG4Keyframe looks for an intra-coded VOP: the two bits after the VOP start code are its coding type
+func isMPEG4Keyframe(frame []byte) bool {
+	i := bytes.Index(frame, []byte{0, 0, 1, byte(mpeg4video.VOPStartCode)})
+	return i >= 0 && i+4 < len(frame) && frame[i+4]>>6 == 0
+}
+
+func (in *mpeg4Input) withConfig(keyframe []byte, params [][]byte) []byte {
+	// A frame with its own configuration starts with the visual object sequence or the video object layer
+	if len(keyframe) > 3 && bytes.HasPrefix(keyframe, []byte{0, 0, 1}) && keyframe[3] != byte(mpeg4video.VOPStartCode) {
+		return keyframe
+	}
+	if len(params) == 0 {
+		return keyframe
+	}
+	return append(bytes.Clone(params[0]), keyframe...)
+}
+
+func (in *mpeg4Input) ffmpegFormat() string {
+	return "m4v"
+}
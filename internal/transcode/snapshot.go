@@ -0,0 +1,146 @@
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/rtp"
+)
+
+// Image formats a Snapshotter can make
+const (
+	FormatJPEG = "jpeg"
+	FormatWebP = "webp"
+	FormatPNG  = "png"
+)
+
+// Snapshotter makes still images of the camera's picture. A snapshot waits for the camera's next
+// keyframe and has ffmpeg decode it and encode it as an image, so it is never more than a keyframe
+// interval old. Packets are only decoded while a snapshot is waiting.
+type Snapshotter struct {
+	ffmpeg string
+	params func() [][]byte
+
+	// Set while anyone is waiting for a keyframe, so WritePacket can return straight away otherwise
+	waiting atomic.Bool
+
+	// Only touched by the packet goroutine, in WritePacket
+	codec string
+	input input
+
+	mu      sync.Mutex
+	waiters []chan keyframe
+}
+
+// keyframe is one keyframe with the camera's configuration in front, ready for ffmpeg
+type keyframe struct {
+	data   []byte
+	format string
+}
+
+// NewSnapshotter creates a snapshotter that runs the ffmpeg binary, "ffmpeg" from the PATH when
+// empty. params returns the camera's parameter sets, as for New.
+func NewSnapshotter(ffmpeg string, params func() [][]byte) *Snapshotter {
+	if ffmpeg == "" {
+		ffmpeg = "ffmpeg"
+	}
+	return &Snapshotter{ffmpeg: ffmpeg, params: params}
+}
+
+// CanSnapshot reports whether snapshots can be taken of codec, as RTSPStream.GetCodec names it
+func CanSnapshot(codec string) bool {
+	return newSnapshotInput(codec) != nil
+}
+
+// WritePacket hands a camera packet to the snapshots waiting for a keyframe, if there are any.
+// It never blocks.
+func (s *Snapshotter) WritePacket(codec string, pkt *rtp.Packet) {
+	if !s.waiting.Load() {
+		// Start from a clean decoder next time, not halfway through a picture
+		s.input = nil
+		return
+	}
+	if codec != s.codec || s.input == nil {
+		s.codec = codec
+		s.input = newSnapshotInput(codec)
+	}
+	if s.input == nil {
+		return
+	}
+
+	picture, isKeyframe, err := s.input.decode(pkt)
+	if err != nil || !isKeyframe {
+		return
+	}
+	frame := keyframe{data: s.input.withConfig(picture, s.params()), format: s.input.ffmpegFormat()}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, waiter := range s.waiters {
+		waiter <- frame
+	}
+	s.waiters = nil
+	s.waiting.Store(false)
+}
+
+// Grab waits for the camera's next keyframe and returns it as an image in format, one of the Format
+// constants. ctx bounds both the wait and ffmpeg.
+func (s *Snapshotter) Grab(ctx context.Context, format string) ([]byte, error) {
+	var encoder []string
+	switch format {
+	case FormatJPEG:
+		// -q:v goes from 2 (best) to 31
+		encoder = []string{"-c:v", "mjpeg", "-pix_fmt", "yuvj420p", "-q:v", "3", "-f", "mjpeg"}
+	case FormatWebP:
+		encoder = []string{"-c:v", "libwebp", "-quality", "80", "-f", "webp"}
+	case FormatPNG:
+		encoder = []string{"-c:v", "png", "-f", "image2pipe"}
+	default:
+		return nil, fmt.Errorf("unknown image format %q", format)
+	}
+
+	waiter := make(chan keyframe, 1)
+	s.mu.Lock()
+	s.waiters = append(s.waiters, waiter)
+	s.waiting.Store(true)
+	s.mu.Unlock()
+
+	var frame keyframe
+	select {
+	case frame = <-waiter:
+	case <-ctx.Done():
+		s.mu.Lock()
+		for i, w := range s.waiters {
+			if w == waiter {
+				s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+				break
+			}
+		}
+		s.waiting.Store(len(s.waiters) > 0)
+		s.mu.Unlock()
+		return nil, fmt.Errorf("failed to get a keyframe from the camera: %w", ctx.Err())
+	}
+
+	args := []string{
+		"-hide_banner", "-loglevel", "error",
+		"-f", frame.format, "-i", "pipe:0",
+		"-frames:v", "1", "-an",
+	}
+	args = append(append(args, encoder...), "pipe:1")
+	cmd := exec.CommandContext(ctx, s.ffmpeg, args...)
+	cmd.Stdin = bytes.NewReader(frame.data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	image, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if len(image) == 0 {
+		return nil, fmt.Errorf("failed to encode snapshot: ffmpeg made no image")
+	}
+	return image, nil
+}
@@ -0,0 +1,293 @@
+// Package transcode converts a camera's H265 or MPEG-4 Part 2 video to H264 for browsers that can't
+// decode it, and makes still images of its picture, by running ffmpeg as a subprocess.
+package transcode
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/format/rtph264"
+	"github.com/pion/rtp"
+)
+
+const (
+	// ffmpeg is stopped once no packets have been written for this long, i.e. nobody is watching
+	// the transcoded video any more
+	idleTimeout = 10 * time.Second
+	// After ffmpeg fails, e.g. because it isn't installed, it isn't started again for this long
+	restartDelay = 5 * time.Second
+	// Access units waiting to be written to ffmpeg. More than this and ffmpeg isn't keeping up.
+	inputQueue = 64
+	// How long ffmpeg gets to exit after its input is closed before it is killed
+	stopTimeout = 5 * time.Second
+	// Small enough to fit in any viewer's path MTU along with the SRTP overhead
+	payloadMaxSize = 1200
+)
+
+// Options configures a Transcoder
+type Options struct {
+	FFmpeg      string // The ffmpeg binary, looked up on the PATH if it has no slashes
+	BitrateKbps int
+	Preset      string // libx264 preset, e.g. "veryfast". Hardware encoders have their own low latency settings.
+	Encoder     string // One of the Encoder constants, EncoderSoftware when empty
+	Device      string // The GPU's render node for EncoderVAAPI, the first one when empty
+}
+
+// Transcoder turns a camera's H265 or MPEG-4 RTP packets into H264 RTP packets.
+// ffmpeg is started when packets are written and stopped once they stop coming, so it only uses
+// CPU while someone is watching the transcoded video.
+type Transcoder struct {
+	opts   Options
+	params func() [][]byte
+	output func(*rtp.Packet)
+
+	// Only touched by the packet goroutine, in WritePacket
+	codec string
+	input input
+
+	mu        sync.Mutex
+	proc      *process // The running ffmpeg, nil when stopped
+	lastWrite time.Time
+	nextStart time.Time // Don't start ffmpeg before this, after it failed
+}
+
+// process is one run of ffmpeg
+type process struct {
+	cmd          *exec.Cmd
+	input        chan []byte   // Annex-B access units for stdin, closed to stop ffmpeg
+	done         chan struct{} // Closed once ffmpeg has exited
+	stopOnce     sync.Once
+	waitKeyframe bool // Set after an access unit was dropped, so ffmpeg isn't fed broken pictures
+}
+
+// New creates a transcoder that calls output with every H264 RTP packet, from a goroutine of its own.
+// params returns the camera's parameter sets (VPS, SPS, PPS) or MPEG-4 configuration, which ffmpeg
+// needs before the first keyframe when the camera doesn't repeat them in the stream.
+func New(opts Options, params func() [][]byte, output func(*rtp.Packet)) (*Transcoder, error) {
+	if opts.Encoder == "" {
+		opts.Encoder = EncoderSoftware
+	}
+	err := checkEncoder(opts.Encoder)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Encoder == EncoderVAAPI && opts.Device == "" {
+		opts.Device = defaultVAAPIDevice
+	}
+
+	return &Transcoder{
+		opts:   opts,
+		params: params,
+		output: output,
+	}, nil
+}
+
+// CanTranscode reports whether codec, as RTSPStream.GetCodec names it, can be transcoded
+func CanTranscode(codec string) bool {
+	return newInput(codec) != nil
+}
+
+// WritePacket feeds a camera packet to ffmpeg, starting it if needed. codec is the camera's, see
+// CanTranscode; when it changes, e.g. after the camera was reconfigured, ffmpeg is restarted.
+// It never blocks: when ffmpeg falls behind, pictures are dropped until the next keyframe.
+func (t *Transcoder) WritePacket(codec string, pkt *rtp.Packet) {
+	if codec != t.codec {
+		t.codec = codec
+		t.input = newInput(codec)
+		t.mu.Lock()
+		if t.proc != nil {
+			go t.proc.stop()
+			t.proc = nil
+		}
+		t.mu.Unlock()
+	}
+	if t.input == nil {
+		return
+	}
+
+	picture, keyframe, err := t.input.decode(pkt)
+	if err != nil {
+		// Not complete yet, or lost along with a packet
+		return
+	}
+
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastWrite = now
+
+	if t.proc == nil {
+		// ffmpeg can only start decoding at a keyframe
+		if now.Before(t.nextStart) || !keyframe {
+			return
+		}
+		proc, err := t.start(codec, t.input.ffmpegFormat())
+		if err != nil {
+			log.Printf("Failed to start transcoder, retrying in %s: %v", restartDelay, err)
+			t.nextStart = now.Add(restartDelay)
+			return
+		}
+		t.proc = proc
+		picture = t.input.withConfig(picture, t.params())
+	} else if t.proc.waitKeyframe {
+		if !keyframe {
+			return
+		}
+		t.proc.waitKeyframe = false
+		picture = t.input.withConfig(picture, t.params())
+	}
+
+	select {
+	case t.proc.input <- picture:
+	default:
+		t.proc.waitKeyframe = true
+	}
+}
+
+// Run stops ffmpeg when packets stop coming, and whenever it has exited on its own notices so the
+// next packet can start it again. It returns when stop is closed, stopping ffmpeg.
+// This blocks, so call it in a goroutine.
+func (t *Transcoder) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			t.mu.Lock()
+			proc := t.proc
+			t.proc = nil
+			t.mu.Unlock()
+			if proc != nil {
+				proc.stop()
+			}
+			return
+		case now := <-ticker.C:
+			t.checkProcess(now)
+		}
+	}
+}
+
+// checkProcess stops an idle ffmpeg and forgets one that has exited
+func (t *Transcoder) checkProcess(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.proc == nil {
+		return
+	}
+	select {
+	case <-t.proc.done:
+		// It exited without being asked to, so something is wrong with it
+		t.proc.stop()
+		t.proc = nil
+		t.nextStart = now.Add(restartDelay)
+		return
+	default:
+	}
+
+	if now.Sub(t.lastWrite) >= idleTimeout {
+		log.Printf("Stopping transcoder, nobody is watching the transcoded video")
+		proc := t.proc
+		t.proc = nil
+		// Stopping waits for ffmpeg to exit, which mustn't hold up the packet goroutine
+		go proc.stop()
+	}
+}
+
+// start runs ffmpeg with goroutines feeding its stdin and reading its stdout. Must be called with mu held.
+func (t *Transcoder) start(codec, inputFormat string) (*process, error) {
+	cmd := exec.Command(t.opts.FFmpeg, ffmpegArgs(t.opts, inputFormat)...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ffmpeg's stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ffmpeg's stdout: %w", err)
+	}
+	cmd.Stderr = ffmpegLog{}
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w", t.opts.FFmpeg, err)
+	}
+	log.Printf("Started transcoder: %s to H264 at %d kbps with %s", codec, t.opts.BitrateKbps, t.opts.Encoder)
+
+	proc := &process{
+		cmd:   cmd,
+		input: make(chan []byte, inputQueue),
+		done:  make(chan struct{}),
+	}
+	go proc.writeInput(stdin)
+	go t.readOutput(proc, stdout)
+	return proc, nil
+}
+
+// writeInput writes access units to ffmpeg until input is closed, then closes its stdin so it exits
+func (p *process) writeInput(stdin io.WriteCloser) {
+	defer stdin.Close()
+	for buf := range p.input {
+		_, err := stdin.Write(buf)
+		if err != nil {
+			// ffmpeg has exited, drain the queue so WritePacket never blocks
+			for range p.input {
+			}
+			return
+		}
+	}
+}
+
+// readOutput packetizes ffmpeg's H264 until it exits. The RTP timestamps come from the wall clock,
+// since ffmpeg's raw output has none.
+func (t *Transcoder) readOutput(p *process, stdout io.Reader) {
+	defer close(p.done)
+
+	encoder := &rtph264.Encoder{
+		PayloadType:       96,
+		PayloadMaxSize:    payloadMaxSize,
+		PacketizationMode: 1,
+	}
+	err := encoder.Init()
+	if err == nil {
+		started := time.Now()
+		err = readAccessUnits(stdout, func(au [][]byte) {
+			packets, err := encoder.Encode(au)
+			if err != nil {
+				log.Printf("Failed to packetize transcoded video: %v", err)
+				return
+			}
+			timestamp := uint32(time.Since(started).Milliseconds() * 90)
+			for _, pkt := range packets {
+				pkt.Timestamp = timestamp
+				t.output(pkt)
+			}
+		})
+	}
+	if err != nil {
+		log.Printf("Failed to read transcoded video: %v", err)
+	}
+
+	// Unblock ffmpeg in case it is the one still writing
+	io.Copy(io.Discard, stdout)
+	err = p.cmd.Wait()
+	if err != nil {
+		log.Printf("Transcoder exited: %v", err)
+	}
+}
+
+// stop closes ffmpeg's input and waits for it to exit, killing it if it takes too long
+func (p *process) stop() {
+	p.stopOnce.Do(func() {
+		close(p.input)
+	})
+	select {
+	case <-p.done:
+	case <-time.After(stopTimeout):
+		p.cmd.Process.Kill()
+		<-p.done
+	}
+}
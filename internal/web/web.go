@@ -0,0 +1,16 @@
+// Package web is the browser UI: a camera grid and a player. It is built into the binary, so the
+// server works without any files next to it.
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed index.html
+var files embed.FS
+
+// FS returns the UI's files, with index.html at the root
+func FS() fs.FS {
+	return files
+}
@@ -0,0 +1,61 @@
+// Package managementpb is where github.com/nisarg-dave/camera-viewer/pkg/managementpb used to be. It only forwards to it.
+//
+// Deprecated: import github.com/nisarg-dave/camera-viewer/pkg/managementpb instead. This package will be removed in v2.
+package managementpb
+
+import (
+	"github.com/nisarg-dave/camera-viewer/pkg/managementpb"
+
+	"google.golang.org/grpc"
+)
+
+type (
+	ListCamerasRequest            = managementpb.ListCamerasRequest
+	ListCamerasResponse           = managementpb.ListCamerasResponse
+	Camera                        = managementpb.Camera
+	VideoInfo                     = managementpb.VideoInfo
+	IngestStats                   = managementpb.IngestStats
+	ListSessionsRequest           = managementpb.ListSessionsRequest
+	ListSessionsResponse          = managementpb.ListSessionsResponse
+	Session                       = managementpb.Session
+	GetSessionStatsRequest        = managementpb.GetSessionStatsRequest
+	SessionStats                  = managementpb.SessionStats
+	CloseSessionRequest           = managementpb.CloseSessionRequest
+	CloseSessionResponse          = managementpb.CloseSessionResponse
+	StreamEventsRequest           = managementpb.StreamEventsRequest
+	Event                         = managementpb.Event
+	StreamStatsRequest            = managementpb.StreamStatsRequest
+	StatsSnapshot                 = managementpb.StatsSnapshot
+	CameraStats                   = managementpb.CameraStats
+	SessionSnapshot               = managementpb.SessionSnapshot
+	ManagementClient              = managementpb.ManagementClient
+	Management_StreamEventsClient = managementpb.Management_StreamEventsClient
+	Management_StreamStatsClient  = managementpb.Management_StreamStatsClient
+	ManagementServer              = managementpb.ManagementServer
+	UnimplementedManagementServer = managementpb.UnimplementedManagementServer
+	UnsafeManagementServer        = managementpb.UnsafeManagementServer
+	Management_StreamEventsServer = managementpb.Management_StreamEventsServer
+	Management_StreamStatsServer  = managementpb.Management_StreamStatsServer
+)
+
+const (
+	Management_ListCameras_FullMethodName     = managementpb.Management_ListCameras_FullMethodName
+	Management_ListSessions_FullMethodName    = managementpb.Management_ListSessions_FullMethodName
+	Management_GetSessionStats_FullMethodName = managementpb.Management_GetSessionStats_FullMethodName
+	Management_CloseSession_FullMethodName    = managementpb.Management_CloseSession_FullMethodName
+	Management_StreamEvents_FullMethodName    = managementpb.Management_StreamEvents_FullMethodName
+	Management_StreamStats_FullMethodName     = managementpb.Management_StreamStats_FullMethodName
+)
+
+var (
+	File_management_proto  = managementpb.File_management_proto
+	Management_ServiceDesc = managementpb.Management_ServiceDesc
+)
+
+func NewManagementClient(cc grpc.ClientConnInterface) ManagementClient {
+	return managementpb.NewManagementClient(cc)
+}
+
+func RegisterManagementServer(s grpc.ServiceRegistrar, srv ManagementServer) {
+	managementpb.RegisterManagementServer(s, srv)
+}
@@ -0,0 +1,783 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/atomicfile"
+	"github.com/nisarg-dave/camera-viewer/internal/metrics"
+)
+
+// Config holds the settings that don't fit comfortably in environment variables.
+// It is loaded from a JSON file; RTSP credentials still come from the .env file.
+// Fields tagged secret:"true" are left out of backups, or encrypted, see the backup package.
+type Config struct {
+	// Where users and other state are stored. Defaults to "data".
+	DataDir string `json:"data_dir"`
+	Auth    Auth   `json:"auth"`
+
+	Webhooks []Webhook `json:"webhooks"`
+	MQTT     *MQTT     `json:"mqtt"`
+	// Chat notifiers (Telegram, Discord) that send a message for selected events
+	Notifiers []Notifier `json:"notifiers"`
+	// Repeated events within the window are merged into one
+	Cooldowns []Cooldown `json:"cooldowns"`
+	// Loud noise detection from the camera's audio. Disabled when not set.
+	Audio *Audio `json:"audio"`
+	// Stall and tamper detection settings. Stall detection is always on.
+	StreamAlerts *StreamAlerts `json:"stream_alerts"`
+	// Automations run when matching events happen
+	Rules []Rule `json:"rules"`
+	// Which other websites may call the API from a browser
+	CORS CORS `json:"cors"`
+	// Per-IP request limits and lockout after failed logins
+	RateLimit RateLimit `json:"rate_limit"`
+	// Reverse proxies (nginx, Traefik, Caddy...) whose X-Forwarded-For and X-Forwarded-Proto
+	// headers are believed, as IPs or CIDRs like "172.18.0.0/16". Headers from anyone else are ignored.
+	TrustedProxies []string `json:"trusted_proxies"`
+	// Per-user bandwidth limits for people on metered uplinks
+	Bandwidth Bandwidth `json:"bandwidth"`
+	// Serve HTTPS, from certificate files or with automatic Let's Encrypt certificates
+	TLS *TLS `json:"tls"`
+	// HTTP/2 settings. HTTPS is always served over HTTP/2 as well as HTTP/1.1.
+	HTTP2 HTTP2 `json:"http2"`
+	// Optional separate listener for the management API, authenticated with client certificates
+	AdminListener *AdminListener `json:"admin_listener"`
+	// Optional gRPC management service, authenticated with client certificates like the admin listener
+	GRPC *GRPC `json:"grpc"`
+	// Prometheus metrics on /metrics
+	Metrics Metrics `json:"metrics"`
+	// The OpenAPI document on /api/openapi.json, and Swagger UI
+	APIDocs APIDocs `json:"api_docs"`
+	// How dropped camera connections are retried, and the no-packet watchdog
+	Reconnect Reconnect `json:"reconnect"`
+	// Timeouts and keepalives for the camera's RTSP connection
+	RTSP RTSP `json:"rtsp"`
+	// STUN and TURN servers for viewers' connections
+	WebRTC WebRTC `json:"webrtc"`
+	// Convert an H265 or MPEG-4 camera's video to H264 for browsers that can't play it. Off when not set.
+	Transcode *Transcode `json:"transcode,omitempty"`
+	// Ask the camera for a keyframe when a viewer's picture breaks. Off when not set.
+	KeyframeRequest *KeyframeRequest `json:"keyframe_request,omitempty"`
+	// Warnings about the data directory's disk filling up
+	Storage Storage `json:"storage"`
+	// Send OpenTelemetry traces of signaling and camera connects to a collector. Off when not set.
+	Tracing *Tracing `json:"tracing"`
+}
+
+// Reconnect configures how a camera's RTSP connection is kept up
+type Reconnect struct {
+	// Reconnect a camera that is connected but hasn't sent a packet for this long. Defaults to 20s.
+	WatchdogTimeout Duration `json:"watchdog_timeout"`
+	DisableWatchdog bool     `json:"disable_watchdog"`
+	// Wait between reconnect attempts, doubling after every failure. Default 1s to 30s.
+	MinBackoff Duration `json:"min_backoff"`
+	MaxBackoff Duration `json:"max_backoff"`
+	// Give up on a connect attempt that hasn't finished within this long. Defaults to 20s.
+	ConnectTimeout Duration `json:"connect_timeout"`
+	// With a failover URL (RTSP_FAILOVER_URL), switch to it after this many failed attempts in a row. Defaults to 3.
+	FailoverAfter int `json:"failover_after"`
+	// While on the failover URL, check whether the primary is back this often. Defaults to 1m.
+	PrimaryCheckInterval Duration `json:"primary_check_interval"`
+}
+
+// RTSP configures the camera's RTSP connection. Zero values keep the RTSP library's defaults.
+type RTSP struct {
+	// How long to wait for the camera to answer or send something before giving up. Defaults to 10s.
+	ReadTimeout  Duration `json:"read_timeout"`
+	WriteTimeout Duration `json:"write_timeout"`
+	// Send a keepalive (OPTIONS) this often while playing. Some cameras silently drop sessions that
+	// don't get one often enough. By default it is sent at 80% of the session timeout the camera
+	// asks for, or every 30s. Rounded to whole seconds, erring on the side of more often.
+	KeepalivePeriod Duration `json:"keepalive_period"`
+	// Reorder video packets that arrive out of order, e.g. from a camera on flaky Wi-Fi. Off when nil.
+	JitterBuffer *JitterBuffer `json:"jitter_buffer,omitempty"`
+}
+
+// JitterBuffer trades a little latency for putting out of order packets back in order
+type JitterBuffer struct {
+	// Most packets held back while waiting for a missing one. Defaults to 64.
+	Packets int `json:"packets"`
+	// Longest a missing packet is waited for. Defaults to 50ms.
+	Latency Duration `json:"latency"`
+}
+
+// WebRTC configures viewers' peer connections
+type WebRTC struct {
+	// Used by both ends of the connection. Defaults to Google's public STUN server.
+	// TURN credentials are handed to the browser, so use ones meant for viewers.
+	ICEServers []ICEServer `json:"ice_servers"`
+	// A viewer whose ICE is still new or checking this long after answering is ended. Defaults to 15s.
+	ICETimeout Duration `json:"ice_timeout"`
+	// Opt-in performance mode for many viewers on one camera, off when nil
+	BatchWrites *BatchWrites `json:"batch_writes,omitempty"`
+	// Send viewers who join mid-GOP the video since the last keyframe so they start straight away. Off when nil.
+	GOPCache *GOPCache `json:"gop_cache,omitempty"`
+}
+
+// GOPCache keeps each camera's packets since its last keyframe in memory for new viewers
+type GOPCache struct {
+	// Most bytes held per camera. A GOP bigger than this is dropped and new viewers wait for the next
+	// keyframe instead. Defaults to 8 MiB, which fits a 2s keyframe interval at 30 Mbps.
+	MaxBytes int `json:"max_bytes"`
+}
+
+// Transcode runs ffmpeg to make H264 from the camera's H265 or MPEG-4 Part 2, only while someone is
+// watching it. Browsers that can play H265 still get the camera's own video; MPEG-4 always needs it.
+type Transcode struct {
+	// The ffmpeg binary. Defaults to "ffmpeg" from the PATH.
+	FFmpeg string `json:"ffmpeg"`
+	// Bitrate of the H264 video. Defaults to 2000.
+	BitrateKbps int `json:"bitrate_kbps"`
+	// libx264 preset, from "ultrafast" to "veryslow". Slower ones look better at the same bitrate
+	// but use more CPU. Defaults to "veryfast". Not used by the hardware encoders.
+	Preset string `json:"preset"`
+	// "libx264" (software, the default), or a GPU: "vaapi" (Intel, AMD), "nvenc" (NVIDIA) or
+	// "v4l2m2m" (Raspberry Pi 4). vaapi and nvenc decode the camera's H265 on the GPU too,
+	// MPEG-4 is decoded in software.
+	Encoder string `json:"encoder"`
+	// The GPU's render node for vaapi. Defaults to /dev/dri/renderD128.
+	Device string `json:"device"`
+}
+
+// KeyframeRequest asks the camera for a keyframe straight away when a viewer's decoder has lost the
+// picture, instead of leaving it frozen until the camera's next scheduled one. The camera is logged in
+// to with RTSP_USERNAME and RTSP_PASSWORD.
+type KeyframeRequest struct {
+	// "onvif" for cameras with an ONVIF media service, or "http" for a vendor's own "force I-frame" URL
+	Type string `json:"type"`
+	// The ONVIF media service, e.g. http://192.168.1.10/onvif/media_service, or the vendor's URL
+	URL string `json:"url"`
+	// The ONVIF media profile of the stream being watched, e.g. "Profile_1". Only for onvif.
+	ProfileToken string `json:"profile_token"`
+	// HTTP method for the vendor's URL. Defaults to GET. Only for http.
+	Method string `json:"method"`
+	// Shortest time between requests to the camera, however many viewers ask. Defaults to 2s.
+	MinInterval Duration `json:"min_interval"`
+}
+
+// BatchWrites sends every viewer's video through one UDP port and hands the kernel packets in batches
+// (one sendmmsg call on Linux) instead of one system call per packet per viewer
+type BatchWrites struct {
+	// The UDP port all viewers connect to, which has to be reachable from the browsers. Defaults to 8189.
+	Port int `json:"port"`
+	// Most packets sent in one batch. Defaults to 64.
+	Size int `json:"size"`
+	// Longest a packet waits for the batch to fill up. Defaults to 1ms, which the browser's jitter buffer hides.
+	Interval Duration `json:"interval"`
+}
+
+// ICEServer is a STUN or TURN server
+type ICEServer struct {
+	// e.g. "stun:stun.l.google.com:19302" or "turn:turn.example.com:3478?transport=udp"
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty" secret:"true"`
+}
+
+// HasTURN reports whether any of the servers is a TURN relay
+func (w WebRTC) HasTURN() bool {
+	for _, server := range w.ICEServers {
+		for _, url := range server.URLs {
+			if strings.HasPrefix(url, "turn:") || strings.HasPrefix(url, "turns:") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Storage configures the free space check on the data directory
+type Storage struct {
+	// A disk_space_low event is published when less than this is free. Defaults to 1 GB.
+	MinFreeGB float64 `json:"min_free_gb"`
+}
+
+// Tracing configures exporting OpenTelemetry traces over OTLP/HTTP.
+// The standard OTEL_EXPORTER_OTLP_* environment variables work too.
+type Tracing struct {
+	// Collector URL, e.g. "http://localhost:4318"
+	Endpoint string `json:"endpoint"`
+	// Extra headers to send, e.g. for authentication
+	Headers map[string]string `json:"headers" secret:"true"`
+	// Defaults to "camera-viewer"
+	ServiceName string `json:"service_name"`
+	// Fraction of traces to keep, between 0 and 1. Defaults to all of them.
+	SampleRatio float64 `json:"sample_ratio"`
+}
+
+// Metrics configures the Prometheus /metrics endpoint, which is on by default
+type Metrics struct {
+	Disabled bool `json:"disabled"`
+	// When set, scrapers have to send "Authorization: Bearer <token>"
+	BearerToken string `json:"bearer_token" secret:"true"`
+}
+
+// APIDocs configures the API's documentation. The OpenAPI document is always served.
+type APIDocs struct {
+	// Serve Swagger UI on /api/docs for trying the API out in a browser. It loads its scripts from unpkg.com.
+	SwaggerUI bool `json:"swagger_ui"`
+}
+
+// AdminListener serves the management API (users, audit log, share links...) on its own address
+// using mutual TLS: only clients presenting a certificate signed by ClientCAFile can connect.
+type AdminListener struct {
+	Addr     string `json:"addr"` // e.g. "127.0.0.1:9443"
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// CA that signs the client certificates
+	ClientCAFile string `json:"client_ca_file"`
+	// Only accept client certificates with one of these common names. Empty accepts any certificate from the CA.
+	AllowedNames []string `json:"allowed_names"`
+}
+
+// GRPC serves the gRPC management service (managementpb.Management) on its own address using
+// mutual TLS, the same way as AdminListener
+type GRPC struct {
+	Addr     string `json:"addr"` // e.g. "127.0.0.1:9444"
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// CA that signs the client certificates
+	ClientCAFile string `json:"client_ca_file"`
+	// Only accept client certificates with one of these common names. Empty accepts any certificate from the CA.
+	AllowedNames []string `json:"allowed_names"`
+}
+
+// TLS configures HTTPS. Set either CertFile and KeyFile, or Autocert.
+type TLS struct {
+	// Address to serve HTTPS on. Defaults to ":8443".
+	Addr     string    `json:"addr"`
+	CertFile string    `json:"cert_file"`
+	KeyFile  string    `json:"key_file"`
+	Autocert *Autocert `json:"autocert"`
+	// Redirect plain HTTP requests on :8080 to HTTPS instead of serving them
+	RedirectHTTP bool `json:"redirect_http"`
+}
+
+// HTTP2 tunes HTTP/2, which lets a browser send all its requests, event streams and snapshots over
+// one connection instead of queueing behind HTTP/1.1's six per host
+type HTTP2 struct {
+	// Accept HTTP/2 without TLS (h2c, with prior knowledge) on the plain HTTP port, for reverse
+	// proxies that talk HTTP/2 to their backends. Only connections from trusted_proxies may use it.
+	H2C bool `json:"h2c"`
+	// Requests one connection can have in flight at once. Defaults to 250.
+	MaxConcurrentStreams int `json:"max_concurrent_streams"`
+}
+
+// Autocert gets certificates from Let's Encrypt automatically. The TLS-ALPN challenge is answered
+// on the HTTPS address, so that has to be reachable on port 443 from the internet;
+// set HTTPChallengeAddr to also answer the HTTP challenge, which needs port 80.
+type Autocert struct {
+	Domains []string `json:"domains"`
+	// Let's Encrypt uses this to warn about expiring certificates
+	Email string `json:"email"`
+	// Where certificates are kept between restarts. Defaults to "<data_dir>/certs".
+	CacheDir string `json:"cache_dir"`
+	// e.g. ":80". Empty means only the TLS-ALPN challenge is used.
+	HTTPChallengeAddr string `json:"http_challenge_addr"`
+	// Use Let's Encrypt's staging server, for testing without hitting rate limits
+	Staging bool `json:"staging"`
+}
+
+// Bandwidth limits how much video is sent to viewers. Users listed in Users get their
+// own limits instead of Default. Share links count as the user "share:<id>", with the id /api/share returned.
+type Bandwidth struct {
+	Default BandwidthLimit            `json:"default"`
+	Users   map[string]BandwidthLimit `json:"users"`
+}
+
+// BandwidthLimit caps a user's viewing. Zero means no limit.
+type BandwidthLimit struct {
+	// Total video sent to the user per calendar month, across all their sessions
+	MonthlyGB float64 `json:"monthly_gb"`
+	// Highest average bitrate one session may use before it is disconnected
+	MaxKbps int `json:"max_kbps"`
+}
+
+// CORS controls cross-origin requests to the API. By default only the built in web UI,
+// which is served from the same origin, can call it.
+type CORS struct {
+	// Origins allowed to call the API, e.g. "https://dashboard.example.com".
+	// "*" allows any origin but can't be combined with AllowCredentials.
+	AllowedOrigins []string `json:"allowed_origins"`
+	// Let allowed origins send the session cookie
+	AllowCredentials bool `json:"allow_credentials"`
+	// How long browsers may cache a preflight response. Defaults to 10m.
+	MaxAge Duration `json:"max_age"`
+}
+
+// Auth configures logins for the web UI and API
+type Auth struct {
+	// Turns off logins completely. Only do this on a trusted network.
+	Disabled bool `json:"disabled"`
+	// How long a login lasts. Defaults to 7 days.
+	SessionTTL Duration `json:"session_ttl"`
+	// Optional single sign-on through an OpenID Connect provider
+	OIDC *OIDC `json:"oidc"`
+}
+
+// OIDC configures login through an OpenID Connect provider such as Authentik, Keycloak or Google
+type OIDC struct {
+	// Shown on the login button, e.g. "Authentik". Defaults to "SSO".
+	Name   string `json:"name"`
+	Issuer string `json:"issuer"` // e.g. https://auth.example.com/application/o/camera-viewer/
+
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret" secret:"true"`
+	// Must match what is registered with the provider, e.g. https://cameras.example.com/api/oidc/callback
+	RedirectURL string `json:"redirect_url"`
+	// Extra scopes to request on top of "openid". Defaults to "profile", "email" and "groups".
+	Scopes []string `json:"scopes"`
+
+	// ID token claim holding the username. Defaults to "preferred_username", falling back to "email".
+	UsernameClaim string `json:"username_claim"`
+	// ID token claim holding the user's groups. Defaults to "groups".
+	GroupsClaim string `json:"groups_claim"`
+	// Maps provider groups to roles. Users not in any listed group can't log in.
+	Groups []OIDCGroup `json:"groups"`
+}
+
+// OIDCGroup gives members of a provider group a role, and for viewers, the cameras they may watch
+type OIDCGroup struct {
+	Group   string   `json:"group"`
+	Role    string   `json:"role"` // "admin" or "viewer"
+	Cameras []string `json:"cameras"`
+}
+
+// RateLimit protects the login and signaling endpoints from brute force and floods
+type RateLimit struct {
+	// Login attempts per minute per IP. Defaults to 10, with bursts of 5.
+	Login Rate `json:"login"`
+	// Offer/answer requests per minute per IP. Defaults to 30, with bursts of 10.
+	Signaling Rate `json:"signaling"`
+
+	// Failed logins from an IP before it is locked out. Defaults to 5.
+	LockoutThreshold int `json:"lockout_threshold"`
+	// Failed logins as one user, from any IP, before the user is locked out. Higher than
+	// LockoutThreshold and only ever locked for LockoutBase, so failing to log in as someone slows
+	// guessing their password down without locking them out for long. Defaults to 4 times LockoutThreshold.
+	AccountLockoutThreshold int `json:"account_lockout_threshold"`
+	// First lockout. Each further failure doubles it. Defaults to 30s.
+	LockoutBase Duration `json:"lockout_base"`
+	// Longest lockout. Defaults to 1h.
+	LockoutMax Duration `json:"lockout_max"`
+}
+
+// Rate is a request limit, refilling at PerMinute with up to Burst requests at once
+type Rate struct {
+	PerMinute float64 `json:"per_minute"`
+	Burst     int     `json:"burst"`
+}
+
+// Webhook describes an HTTP endpoint that is called when selected events happen
+type Webhook struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Events to fire on. Empty means every event.
+	Events []string `json:"events"`
+	// Optional Go text/template producing the JSON body. The event is passed as the template data.
+	// When empty the event itself is sent as JSON.
+	Template string `json:"template"`
+	// Optional secret used to sign the body with HMAC-SHA256
+	Secret  string            `json:"secret" secret:"true"`
+	Headers map[string]string `json:"headers" secret:"true"`
+	// Number of extra attempts after the first one fails
+	MaxRetries int      `json:"max_retries"`
+	Timeout    Duration `json:"timeout"`
+	// Only call this webhook from rule actions, not for every matching event
+	OnlyRules bool `json:"only_rules"`
+}
+
+// MQTT configures the connection to an MQTT broker for publishing events and receiving commands
+type MQTT struct {
+	Broker   string `json:"broker"` // e.g. tcp://192.168.1.10:1883
+	ClientID string `json:"client_id"`
+	Username string `json:"username"`
+	Password string `json:"password" secret:"true"`
+	// All topics are published under this prefix. Defaults to "camera-viewer".
+	TopicPrefix string `json:"topic_prefix"`
+	// Publish Home Assistant MQTT discovery payloads so cameras show up automatically
+	HomeAssistant bool `json:"home_assistant"`
+	// Defaults to "homeassistant", which is what HA listens on out of the box
+	DiscoveryPrefix string `json:"discovery_prefix"`
+}
+
+// Notifier sends event messages to a chat service
+type Notifier struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // "telegram" or "discord"
+
+	// Telegram
+	BotToken string `json:"bot_token" secret:"true"`
+	ChatID   string `json:"chat_id"`
+
+	// Discord
+	WebhookURL string `json:"webhook_url" secret:"true"`
+
+	// Events and cameras to notify about. Empty means all of them.
+	Events  []string `json:"events"`
+	Cameras []string `json:"cameras"`
+
+	// No messages are sent during quiet hours
+	QuietHours *TimeRange `json:"quiet_hours"`
+}
+
+// TimeRange is a daily time window in local time, e.g. 22:00 to 07:00.
+// The window may cross midnight.
+type TimeRange struct {
+	Start string `json:"start"` // "HH:MM"
+	End   string `json:"end"`   // "HH:MM"
+}
+
+// Validate checks that both ends are valid HH:MM times
+func (r TimeRange) Validate() error {
+	_, err := parseClock(r.Start)
+	if err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	_, err = parseClock(r.End)
+	if err != nil {
+		return fmt.Errorf("end: %w", err)
+	}
+	return nil
+}
+
+// Contains reports whether t falls within the window. Call Validate first;
+// an invalid range contains nothing.
+func (r TimeRange) Contains(t time.Time) bool {
+	start, err := parseClock(r.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(r.End)
+	if err != nil {
+		return false
+	}
+
+	t = t.Local()
+	minute := t.Hour()*60 + t.Minute()
+
+	// e.g. 09:00-17:00
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	// e.g. 22:00-07:00, which crosses midnight
+	return minute >= start || minute < end
+}
+
+// parseClock turns "HH:MM" into minutes since midnight
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM, got %q", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Cooldown merges repeated events of the same type from the same camera.
+// A rule with a camera set takes priority over one without.
+type Cooldown struct {
+	Camera string   `json:"camera"` // empty applies to every camera
+	Events []string `json:"events"` // empty applies to every event type
+	Window Duration `json:"window"`
+}
+
+// Audio configures loud noise detection and optional sound classification
+type Audio struct {
+	// RMS level in dBFS that counts as loud. Defaults to -20.
+	ThresholdDB float64 `json:"threshold_db"`
+	// Length of the rolling window the level is measured over. Defaults to 1s.
+	Window Duration `json:"window"`
+	// Optional program that classifies loud clips, see audio.ExecClassifier
+	ClassifierCommand []string `json:"classifier_command"`
+	// Only report these classifier labels. Empty means all.
+	Labels        []string `json:"labels"`
+	MinConfidence float64  `json:"min_confidence"`
+}
+
+// StreamAlerts configures the stream monitor
+type StreamAlerts struct {
+	// How long without packets before a stream counts as stalled. Defaults to 10s.
+	StallTimeout Duration `json:"stall_timeout"`
+	// Detect covered/blinded cameras from a sudden drop in keyframe size
+	Tamper bool `json:"tamper"`
+	// Keyframes smaller than this fraction of normal count as tampering. Defaults to 0.1.
+	TamperRatio float64 `json:"tamper_ratio"`
+	// Window the largest frame is measured over. Should be longer than the camera's GOP. Defaults to 10s.
+	TamperWindow Duration `json:"tamper_window"`
+}
+
+// Rule runs actions when a matching event happens, e.g.
+// "on motion at the driveway camera between 22:00 and 06:00, call the alarm webhook"
+type Rule struct {
+	Name    string       `json:"name"`
+	Events  []string     `json:"events"`  // empty matches every event type
+	Cameras []string     `json:"cameras"` // empty matches every camera
+	Between *TimeRange   `json:"between"` // only during this time of day, if set
+	Actions []RuleAction `json:"actions"`
+}
+
+// RuleAction is one step of a rule. Which fields are used depends on the type:
+//
+//	webhook         target is the name of a configured webhook
+//	notify          target is the name of a configured notifier
+//	enable_camera   target is the camera ID, defaulting to the event's camera
+//	disable_camera  target is the camera ID, defaulting to the event's camera
+type RuleAction struct {
+	Type   string `json:"type"`
+	Target string `json:"target"`
+	Arg    string `json:"arg"`
+}
+
+// Duration is a time.Duration that is written as a string ("10s", "1m30s") in JSON
+type Duration time.Duration
+
+// UnmarshalJSON parses durations like "10s"
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"10s\": %w", err)
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON writes durations back out as strings
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Load reads the config file at path.
+// A missing file is not an error - the application just runs with the defaults.
+func Load(path string) (*Config, error) {
+	cfg, err := load(path, true)
+	if err != nil {
+		return nil, err
+	}
+	cfg.applyDefaults()
+	return cfg, nil
+}
+
+// LoadRaw reads the config file at path as it is written: ${NAME} placeholders are left in and no
+// defaults are filled in, so it can be changed and written back with Save without putting secrets
+// from the environment or every default into the file. A missing file gives an empty config.
+func LoadRaw(path string) (*Config, error) {
+	return load(path, false)
+}
+
+// load reads the config file at path, with its placeholders expanded if expand is set
+func load(path string, expand bool) (*Config, error) {
+	cfg := &Config{}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if expand {
+		data, err = expandPlaceholders(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = json.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Save writes cfg to path, keeping the file it replaces as path.bak. The new file is written and
+// synced next to the old one before the old one is linked to path.bak and the new one renamed over
+// it, so whenever a crash or power cut happens path holds either the old config or the new one.
+func Save(path string, cfg *Config) error {
+	start := time.Now()
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	tmp := path + atomicfile.Suffix
+	err = atomicfile.WriteSynced(tmp, append(data, '\n'), 0o600)
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	err = keepBackup(path)
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to keep the old config file: %w", err)
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace config file: %w", err)
+	}
+
+	// The rename is only on disk once the directory is
+	err = atomicfile.SyncDir(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("failed to sync config directory: %w", err)
+	}
+	metrics.StorageWrite(filepath.Dir(path), len(data)+1, time.Since(start))
+	return nil
+}
+
+// keepBackup makes path.bak the file at path, leaving path where it is. A hard link does that
+// without copying; where the filesystem has no hard links the file is copied instead.
+func keepBackup(path string) error {
+	bak := path + ".bak"
+	err := os.Remove(bak)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	err = os.Link(path, bak)
+	if err == nil || errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteSynced(bak, data, 0o600)
+}
+
+func (c *Config) applyDefaults() {
+	if c.DataDir == "" {
+		c.DataDir = "data"
+	}
+	if c.Auth.SessionTTL == 0 {
+		c.Auth.SessionTTL = Duration(7 * 24 * time.Hour)
+	}
+	if c.RateLimit.Login.PerMinute == 0 {
+		c.RateLimit.Login = Rate{PerMinute: 10, Burst: 5}
+	}
+	if c.RateLimit.Signaling.PerMinute == 0 {
+		c.RateLimit.Signaling = Rate{PerMinute: 30, Burst: 10}
+	}
+	if c.RateLimit.LockoutThreshold == 0 {
+		c.RateLimit.LockoutThreshold = 5
+	}
+	if c.RateLimit.AccountLockoutThreshold == 0 {
+		c.RateLimit.AccountLockoutThreshold = 4 * c.RateLimit.LockoutThreshold
+	}
+	if c.RateLimit.LockoutBase == 0 {
+		c.RateLimit.LockoutBase = Duration(30 * time.Second)
+	}
+	if c.RateLimit.LockoutMax == 0 {
+		c.RateLimit.LockoutMax = Duration(time.Hour)
+	}
+	if c.TLS != nil {
+		if c.TLS.Addr == "" {
+			c.TLS.Addr = ":8443"
+		}
+		if c.TLS.Autocert != nil && c.TLS.Autocert.CacheDir == "" {
+			c.TLS.Autocert.CacheDir = filepath.Join(c.DataDir, "certs")
+		}
+	}
+	if c.HTTP2.MaxConcurrentStreams == 0 {
+		c.HTTP2.MaxConcurrentStreams = 250
+	}
+	if c.Reconnect.WatchdogTimeout == 0 {
+		c.Reconnect.WatchdogTimeout = Duration(20 * time.Second)
+	}
+	if c.Reconnect.MinBackoff == 0 {
+		c.Reconnect.MinBackoff = Duration(time.Second)
+	}
+	if c.Reconnect.MaxBackoff == 0 {
+		c.Reconnect.MaxBackoff = Duration(30 * time.Second)
+	}
+	if c.Reconnect.ConnectTimeout == 0 {
+		c.Reconnect.ConnectTimeout = Duration(20 * time.Second)
+	}
+	if c.Reconnect.FailoverAfter == 0 {
+		c.Reconnect.FailoverAfter = 3
+	}
+	if c.Reconnect.PrimaryCheckInterval == 0 {
+		c.Reconnect.PrimaryCheckInterval = Duration(time.Minute)
+	}
+	if len(c.WebRTC.ICEServers) == 0 {
+		c.WebRTC.ICEServers = []ICEServer{{URLs: []string{"stun:stun.l.google.com:19302"}}}
+	}
+	if c.WebRTC.ICETimeout == 0 {
+		c.WebRTC.ICETimeout = Duration(15 * time.Second)
+	}
+	if c.RTSP.JitterBuffer != nil {
+		if c.RTSP.JitterBuffer.Packets == 0 {
+			c.RTSP.JitterBuffer.Packets = 64
+		}
+		if c.RTSP.JitterBuffer.Latency == 0 {
+			c.RTSP.JitterBuffer.Latency = Duration(50 * time.Millisecond)
+		}
+	}
+	if c.WebRTC.BatchWrites != nil {
+		if c.WebRTC.BatchWrites.Port == 0 {
+			c.WebRTC.BatchWrites.Port = 8189
+		}
+		if c.WebRTC.BatchWrites.Size == 0 {
+			c.WebRTC.BatchWrites.Size = 64
+		}
+		if c.WebRTC.BatchWrites.Interval == 0 {
+			c.WebRTC.BatchWrites.Interval = Duration(time.Millisecond)
+		}
+	}
+	if c.WebRTC.GOPCache != nil && c.WebRTC.GOPCache.MaxBytes == 0 {
+		c.WebRTC.GOPCache.MaxBytes = 8 << 20
+	}
+	if c.Transcode != nil {
+		if c.Transcode.FFmpeg == "" {
+			c.Transcode.FFmpeg = "ffmpeg"
+		}
+		if c.Transcode.BitrateKbps == 0 {
+			c.Transcode.BitrateKbps = 2000
+		}
+		if c.Transcode.Preset == "" {
+			c.Transcode.Preset = "veryfast"
+		}
+	}
+	if c.KeyframeRequest != nil {
+		if c.KeyframeRequest.Method == "" {
+			c.KeyframeRequest.Method = "GET"
+		}
+		if c.KeyframeRequest.MinInterval == 0 {
+			c.KeyframeRequest.MinInterval = Duration(2 * time.Second)
+		}
+	}
+	if c.Storage.MinFreeGB == 0 {
+		c.Storage.MinFreeGB = 1
+	}
+	if c.CORS.MaxAge == 0 {
+		c.CORS.MaxAge = Duration(10 * time.Minute)
+	}
+	if c.Auth.OIDC != nil {
+		if c.Auth.OIDC.Name == "" {
+			c.Auth.OIDC.Name = "SSO"
+		}
+		if c.Auth.OIDC.Scopes == nil {
+			c.Auth.OIDC.Scopes = []string{"profile", "email", "groups"}
+		}
+		if c.Auth.OIDC.UsernameClaim == "" {
+			c.Auth.OIDC.UsernameClaim = "preferred_username"
+		}
+		if c.Auth.OIDC.GroupsClaim == "" {
+			c.Auth.OIDC.GroupsClaim = "groups"
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultSecretsDir is where Docker and Kubernetes mount secrets
+const DefaultSecretsDir = "/run/secrets"
+
+// Env reads a setting that may be a secret. In order it tries:
+//
+//  1. NAME_FILE: a path to a file holding the value, e.g. RTSP_PASSWORD_FILE=/run/secrets/rtsp_password
+//  2. a file named after the variable in the secrets directory (SECRETS_DIR, default /run/secrets),
+//     either as written (RTSP_PASSWORD) or lower case (rtsp_password)
+//  3. the NAME environment variable itself
+//
+// Trailing newlines are removed from files, since editors and `echo` add them.
+func Env(name string) (string, error) {
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		return readSecretFile(path)
+	}
+
+	dir := os.Getenv("SECRETS_DIR")
+	if dir == "" {
+		dir = DefaultSecretsDir
+	}
+	for _, file := range []string{name, strings.ToLower(name)} {
+		value, err := readSecretFile(filepath.Join(dir, file))
+		if err == nil {
+			return value, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	return os.Getenv(name), nil
+}
+
+// placeholderPattern matches ${NAME}. Bare $NAME is left alone so webhook templates can use $ variables.
+var placeholderPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandPlaceholders replaces ${NAME} in the config file with Env(NAME), so secrets like
+// "client_secret": "${OIDC_CLIENT_SECRET}" can come from mounted secret files.
+// The values are JSON-escaped because they are substituted into JSON text.
+func expandPlaceholders(data []byte) ([]byte, error) {
+	var expandErr error
+	expanded := placeholderPattern.ReplaceAllFunc(data, func(match []byte) []byte {
+		name := string(placeholderPattern.FindSubmatch(match)[1])
+		value, err := Env(name)
+		if err != nil {
+			expandErr = err
+			return match
+		}
+		quoted, _ := json.Marshal(value)
+		// Strip the quotes json.Marshal adds; the placeholder is already inside a JSON string
+		return quoted[1 : len(quoted)-1]
+	})
+	return expanded, expandErr
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file %s: %w", path, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,336 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// httpAddr is where plain HTTP is always served, which the other listeners can't share
+const httpAddr = ":8080"
+
+// problems collects what is wrong with a config, so all of it can be reported at once
+type problems []error
+
+// add records a problem with the setting at field, e.g. "webhooks[0].url"
+func (p *problems) add(field, format string, args ...any) {
+	*p = append(*p, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+}
+
+// Validate checks the settings the server would otherwise only trip over once it is running, or
+// while starting up one at a time: URLs, listen addresses and ports, schedules, names that refer
+// to each other, and that the files and directories it reads and writes are usable.
+// It reports every problem it finds, joined with errors.Join, and never touches the network.
+// Call it on a config from Load, which has the defaults filled in.
+func (c *Config) Validate() error {
+	var p problems
+	c.validateStorage(&p)
+	c.validateListeners(&p)
+	c.validateNotifications(&p)
+	c.validateAuth(&p)
+
+	for i, server := range c.WebRTC.ICEServers {
+		for j, value := range server.URLs {
+			scheme, _, _ := strings.Cut(value, ":")
+			if !slices.Contains([]string{"stun", "stuns", "turn", "turns"}, scheme) {
+				p.add(fmt.Sprintf("webrtc.ice_servers[%d].urls[%d]", i, j), "%q is not a stun:, stuns:, turn: or turns: URL", value)
+			}
+		}
+	}
+	for i, proxy := range c.TrustedProxies {
+		_, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			_, err = netip.ParseAddr(proxy)
+		}
+		if err != nil {
+			p.add(fmt.Sprintf("trusted_proxies[%d]", i), "%q is not an IP or CIDR", proxy)
+		}
+	}
+	if slices.Contains(c.CORS.AllowedOrigins, "*") && c.CORS.AllowCredentials {
+		p.add("cors", `allowed_origins "*" can't be combined with allow_credentials`)
+	}
+	if c.Transcode != nil {
+		if !slices.Contains([]string{"", "libx264", "vaapi", "nvenc", "v4l2m2m"}, c.Transcode.Encoder) {
+			p.add("transcode.encoder", "unknown encoder %q, must be libx264, vaapi, nvenc or v4l2m2m", c.Transcode.Encoder)
+		}
+		if c.Transcode.BitrateKbps < 0 {
+			p.add("transcode.bitrate_kbps", "can't be negative")
+		}
+	}
+	if c.KeyframeRequest != nil {
+		switch c.KeyframeRequest.Type {
+		case "onvif", "http":
+			checkURL(&p, "keyframe_request.url", c.KeyframeRequest.URL, "http", "https")
+		default:
+			p.add("keyframe_request.type", "unknown type %q, must be onvif or http", c.KeyframeRequest.Type)
+		}
+	}
+	if c.Tracing != nil {
+		// Without one it comes from OTEL_EXPORTER_OTLP_ENDPOINT
+		if c.Tracing.Endpoint != "" {
+			checkURL(&p, "tracing.endpoint", c.Tracing.Endpoint, "http", "https")
+		}
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			p.add("tracing.sample_ratio", "must be between 0 and 1")
+		}
+	}
+	if c.Reconnect.MinBackoff > c.Reconnect.MaxBackoff {
+		p.add("reconnect.min_backoff", "is longer than max_backoff")
+	}
+	if c.RateLimit.LockoutBase > c.RateLimit.LockoutMax {
+		p.add("rate_limit.lockout_base", "is longer than lockout_max")
+	}
+	return errors.Join(p...)
+}
+
+// validateStorage checks the data directory and the files the server reads at startup
+func (c *Config) validateStorage(p *problems) {
+	checkDir(p, "data_dir", c.DataDir)
+	if c.TLS != nil {
+		if c.TLS.Autocert != nil {
+			checkDir(p, "tls.autocert.cache_dir", c.TLS.Autocert.CacheDir)
+		} else {
+			checkFile(p, "tls.cert_file", c.TLS.CertFile)
+			checkFile(p, "tls.key_file", c.TLS.KeyFile)
+		}
+	}
+	if c.AdminListener != nil {
+		checkFile(p, "admin_listener.cert_file", c.AdminListener.CertFile)
+		checkFile(p, "admin_listener.key_file", c.AdminListener.KeyFile)
+		checkFile(p, "admin_listener.client_ca_file", c.AdminListener.ClientCAFile)
+	}
+	if c.GRPC != nil {
+		checkFile(p, "grpc.cert_file", c.GRPC.CertFile)
+		checkFile(p, "grpc.key_file", c.GRPC.KeyFile)
+		checkFile(p, "grpc.client_ca_file", c.GRPC.ClientCAFile)
+	}
+}
+
+// validateListeners checks the addresses and ports the server listens on, and that no two share a port
+func (c *Config) validateListeners(p *problems) {
+	// The port each address listens on, to find clashes
+	ports := map[string]string{portOf(httpAddr): "the HTTP server"}
+	listen := func(field, addr string) {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			p.add(field, "%q is not a host:port address", addr)
+			return
+		}
+		if !validPort(port) {
+			p.add(field, "%q has no valid port", addr)
+			return
+		}
+		other, taken := ports[port]
+		// Port 0 is a different free port every time
+		if taken && port != "0" {
+			p.add(field, "port %s is also used by %s", port, other)
+			return
+		}
+		ports[port] = field
+	}
+
+	if c.TLS != nil {
+		listen("tls.addr", c.TLS.Addr)
+		if c.TLS.Autocert != nil {
+			if len(c.TLS.Autocert.Domains) == 0 {
+				p.add("tls.autocert.domains", "at least one domain is needed")
+			}
+			if c.TLS.Autocert.HTTPChallengeAddr != "" {
+				listen("tls.autocert.http_challenge_addr", c.TLS.Autocert.HTTPChallengeAddr)
+			}
+		}
+	}
+	if c.AdminListener != nil {
+		listen("admin_listener.addr", c.AdminListener.Addr)
+	}
+	if c.GRPC != nil {
+		listen("grpc.addr", c.GRPC.Addr)
+	}
+	if c.WebRTC.BatchWrites != nil {
+		port := c.WebRTC.BatchWrites.Port
+		if port < 1 || port > 65535 {
+			p.add("webrtc.batch_writes.port", "%d is not a valid port", port)
+		}
+	}
+}
+
+// validateNotifications checks webhooks, MQTT, notifiers and the rules that use them
+func (c *Config) validateNotifications(p *problems) {
+	webhooks := make(map[string]bool)
+	for i, webhook := range c.Webhooks {
+		field := fmt.Sprintf("webhooks[%d]", i)
+		checkURL(p, field+".url", webhook.URL, "http", "https")
+		if webhook.Name != "" && webhooks[webhook.Name] {
+			p.add(field+".name", "%q is used by another webhook", webhook.Name)
+		}
+		webhooks[webhook.Name] = true
+	}
+
+	if c.MQTT != nil {
+		checkURL(p, "mqtt.broker", c.MQTT.Broker, "tcp", "ssl", "tls", "mqtt", "mqtts", "ws", "wss")
+	}
+
+	notifiers := make(map[string]bool)
+	for i, notifier := range c.Notifiers {
+		field := fmt.Sprintf("notifiers[%d]", i)
+		switch notifier.Type {
+		case "telegram":
+			if notifier.BotToken == "" || notifier.ChatID == "" {
+				p.add(field, "telegram needs bot_token and chat_id")
+			}
+		case "discord":
+			checkURL(p, field+".webhook_url", notifier.WebhookURL, "https", "http")
+		default:
+			p.add(field+".type", "unknown type %q, must be telegram or discord", notifier.Type)
+		}
+		if notifier.QuietHours != nil {
+			err := notifier.QuietHours.Validate()
+			if err != nil {
+				p.add(field+".quiet_hours", "%v", err)
+			}
+		}
+		if notifier.Name != "" && notifiers[notifier.Name] {
+			p.add(field+".name", "%q is used by another notifier", notifier.Name)
+		}
+		notifiers[notifier.Name] = true
+	}
+
+	for i, rule := range c.Rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		if len(rule.Actions) == 0 {
+			p.add(field+".actions", "rule %q has no actions", rule.Name)
+		}
+		if rule.Between != nil {
+			err := rule.Between.Validate()
+			if err != nil {
+				p.add(field+".between", "%v", err)
+			}
+		}
+		for j, action := range rule.Actions {
+			actionField := fmt.Sprintf("%s.actions[%d]", field, j)
+			switch action.Type {
+			case "webhook":
+				if !webhooks[action.Target] {
+					p.add(actionField+".target", "there is no webhook named %q", action.Target)
+				}
+			case "notify":
+				if !notifiers[action.Target] {
+					p.add(actionField+".target", "there is no notifier named %q", action.Target)
+				}
+			case "enable_camera", "disable_camera":
+			default:
+				p.add(actionField+".type", "unknown action type %q", action.Type)
+			}
+		}
+	}
+}
+
+// validateAuth checks single sign-on
+func (c *Config) validateAuth(p *problems) {
+	oidc := c.Auth.OIDC
+	if oidc == nil {
+		return
+	}
+	checkURL(p, "auth.oidc.issuer", oidc.Issuer, "https", "http")
+	checkURL(p, "auth.oidc.redirect_url", oidc.RedirectURL, "https", "http")
+	if oidc.ClientID == "" {
+		p.add("auth.oidc.client_id", "is required")
+	}
+	for i, group := range oidc.Groups {
+		if group.Role != "admin" && group.Role != "viewer" {
+			p.add(fmt.Sprintf("auth.oidc.groups[%d].role", i), "unknown role %q, must be admin or viewer", group.Role)
+		}
+	}
+}
+
+// checkURL records a problem unless value is an absolute URL with a host and one of schemes
+func checkURL(p *problems, field, value string, schemes ...string) {
+	if value == "" {
+		p.add(field, "is required")
+		return
+	}
+	parsed, err := url.Parse(value)
+	if err != nil {
+		// The URL can hold a password or token, so it isn't quoted
+		p.add(field, "is not a valid URL")
+		return
+	}
+	if !slices.Contains(schemes, parsed.Scheme) {
+		p.add(field, "must start with %s://", strings.Join(schemes, ":// or "))
+		return
+	}
+	if parsed.Host == "" {
+		p.add(field, "has no host")
+		return
+	}
+	port := parsed.Port()
+	if port != "" && !validPort(port) {
+		p.add(field, "has an invalid port %q", port)
+	}
+}
+
+// checkDir records a problem unless path is a directory or could be created as one
+func checkDir(p *problems, field, path string) {
+	info, err := os.Stat(path)
+	if err == nil {
+		if !info.IsDir() {
+			p.add(field, "%s is not a directory", path)
+		}
+		return
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		p.add(field, "%v", err)
+		return
+	}
+	// The server creates the directory, which needs the closest existing parent to be a directory
+	parent := filepath.Dir(filepath.Clean(path))
+	for {
+		info, err = os.Stat(parent)
+		if err == nil || !errors.Is(err, os.ErrNotExist) || parent == filepath.Dir(parent) {
+			break
+		}
+		parent = filepath.Dir(parent)
+	}
+	if err != nil {
+		p.add(field, "%v", err)
+	} else if !info.IsDir() {
+		p.add(field, "%s can't be created, %s is not a directory", path, parent)
+	}
+}
+
+// checkFile records a problem unless path is a file that can be read
+func checkFile(p *problems, field, path string) {
+	if path == "" {
+		p.add(field, "is required")
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		p.add(field, "%v", err)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err == nil && info.IsDir() {
+		p.add(field, "%s is a directory", path)
+	}
+}
+
+// portOf returns the port of a host:port address
+func portOf(addr string) string {
+	_, port, _ := net.SplitHostPort(addr)
+	return port
+}
+
+// validPort reports whether port is a number from 1 to 65535, or 0 for any free port
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n >= 0 && n <= 65535
+}
@@ -0,0 +1,141 @@
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Bus fans out published events to every subscriber.
+// Publishing never blocks: a subscriber that can't keep up loses events rather than stalling
+// the publisher, which is usually sitting on the RTP packet path.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[int]*Subscription
+	nextID      int
+	merger      merger
+}
+
+// Subscription is a stream of events delivered to one consumer (webhooks, MQTT, SSE, ...)
+type Subscription struct {
+	C <-chan Event // Events are received from this channel
+
+	ch      chan Event
+	filter  func(Event) bool
+	updates bool // also receive updates to events merged by a cooldown rule
+	bus     *Bus
+	id      int
+	once    sync.Once
+}
+
+// NewBus creates an empty event bus
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[int]*Subscription),
+		merger: merger{
+			open: make(map[mergeKey]*Event),
+		},
+	}
+}
+
+// SetCooldowns replaces the rules used to merge repeated events
+func (b *Bus) SetCooldowns(rules []CooldownRule) {
+	b.merger.mu.Lock()
+	defer b.merger.mu.Unlock()
+	b.merger.rules = rules
+}
+
+// Publish sends an event to all subscribers.
+// ID and Time are filled in if the publisher left them empty.
+//
+// If a cooldown rule folds the event into an earlier one, only subscribers that asked for
+// updates (SubscribeWithUpdates) see it: they receive the earlier event, with the same ID,
+// carrying the new EndTime and Count.
+func (b *Bus) Publish(e Event) {
+	if e.ID == "" {
+		e.ID = uuid.NewString()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	e, isUpdate := b.merger.merge(e)
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, sub := range b.subscribers {
+		if isUpdate && !sub.updates {
+			continue
+		}
+		if sub.filter != nil && !sub.filter(e) {
+			continue
+		}
+
+		// select with a default case makes the send non-blocking
+		select {
+		case sub.ch <- e:
+		default:
+			log.Printf("Event subscriber %d is full, dropping event %s", sub.id, e.Type)
+		}
+	}
+}
+
+// Subscribe registers a new consumer.
+// bufferSize controls how many events can queue up before new ones are dropped.
+// filter is optional - when set, only events for which it returns true are delivered.
+func (b *Bus) Subscribe(bufferSize int, filter func(Event) bool) *Subscription {
+	return b.subscribe(bufferSize, filter, false)
+}
+
+// SubscribeWithUpdates is like Subscribe, but the subscriber is also sent an event again
+// every time a cooldown rule merges another occurrence into it.
+// This is for consumers that show events (history, SSE) rather than act on them (webhooks).
+func (b *Bus) SubscribeWithUpdates(bufferSize int, filter func(Event) bool) *Subscription {
+	return b.subscribe(bufferSize, filter, true)
+}
+
+func (b *Bus) subscribe(bufferSize int, filter func(Event) bool, updates bool) *Subscription {
+	ch := make(chan Event, bufferSize)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	sub := &Subscription{
+		C:       ch,
+		ch:      ch,
+		filter:  filter,
+		updates: updates,
+		bus:     b,
+		id:      b.nextID,
+	}
+	b.subscribers[sub.id] = sub
+
+	return sub
+}
+
+// Close removes the subscription from the bus and closes its channel
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subscribers, s.id)
+		s.bus.mu.Unlock()
+
+		close(s.ch)
+	})
+}
+
+// OfType returns a filter that matches any of the given event types
+func OfType(types ...Type) func(Event) bool {
+	return func(e Event) bool {
+		for _, t := range types {
+			if e.Type == t {
+				return true
+			}
+		}
+		return false
+	}
+}
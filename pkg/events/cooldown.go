@@ -0,0 +1,85 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// CooldownRule merges repeated events of the same type from the same camera.
+// Any event arriving within Window of the previous one is folded into it instead of
+// being published as a new event, so one person walking past is one motion event, not forty.
+type CooldownRule struct {
+	Camera string // empty matches every camera
+	Types  []Type // empty matches every type
+	Window time.Duration
+}
+
+func (r CooldownRule) matches(e Event) bool {
+	if r.Camera != "" && r.Camera != e.Camera {
+		return false
+	}
+	return len(r.Types) == 0 || OfType(r.Types...)(e)
+}
+
+type mergeKey struct {
+	camera    string
+	eventType Type
+}
+
+// merger tracks the currently open (still merging) event per camera and type
+type merger struct {
+	mu    sync.Mutex
+	rules []CooldownRule
+	open  map[mergeKey]*Event
+}
+
+// windowFor picks the rule for an event. Camera specific rules win over global ones.
+func (m *merger) windowFor(e Event) time.Duration {
+	var window time.Duration
+	for _, rule := range m.rules {
+		if !rule.matches(e) {
+			continue
+		}
+		if rule.Camera != "" {
+			return rule.Window
+		}
+		if window == 0 {
+			window = rule.Window
+		}
+	}
+	return window
+}
+
+// merge either records e as a new open event, or folds it into the open one.
+// It returns the event to publish and whether it is an update of an earlier event.
+func (m *merger) merge(e Event) (Event, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	window := m.windowFor(e)
+	if window == 0 {
+		return e, false
+	}
+
+	key := mergeKey{camera: e.Camera, eventType: e.Type}
+	open, ok := m.open[key]
+
+	lastSeen := time.Time{}
+	if ok {
+		lastSeen = open.EndTime
+		if lastSeen.IsZero() {
+			lastSeen = open.Time
+		}
+	}
+
+	if !ok || e.Time.Sub(lastSeen) > window {
+		e.Count = 1
+		stored := e
+		m.open[key] = &stored
+		return e, false
+	}
+
+	open.EndTime = e.Time
+	open.Count++
+	return *open, true
+}
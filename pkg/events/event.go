@@ -0,0 +1,59 @@
+package events
+
+import (
+	"fmt"
+	"time"
+)
+
+// Type identifies what kind of thing happened.
+// It is a string so that it can be used directly in JSON payloads, MQTT topics and query filters.
+type Type string
+
+const (
+	TypeMotion           Type = "motion"
+	TypeLoudNoise        Type = "loud_noise"
+	TypeSoundDetected    Type = "sound_detected"
+	TypeCameraConnected  Type = "camera_connected"
+	TypeCameraDisabled   Type = "camera_disabled"
+	TypeConnectionLost   Type = "connection_lost"
+	TypeStreamStalled    Type = "stream_stalled"
+	TypeStreamResumed    Type = "stream_resumed"
+	TypeTamperDetected   Type = "tamper_detected"
+	TypeRecordingStarted Type = "recording_started"
+	TypeViewerJoined     Type = "viewer_joined"
+	TypeViewerLeft       Type = "viewer_left"
+	// A viewer was disconnected for going over their bandwidth cap or bitrate ceiling
+	TypeBandwidthExceeded Type = "bandwidth_exceeded"
+	// A camera that was connected but had stopped sending packets was torn down and reconnected
+	TypeWatchdogRestart Type = "watchdog_restart"
+	// The disk the data directory is on is running out of space
+	TypeDiskSpaceLow Type = "disk_space_low"
+	// A camera switched between its primary and failover stream URLs
+	TypeCameraFailover Type = "camera_failover"
+	// A background job, e.g. a camera probe, succeeded, failed or was cancelled
+	TypeJobFinished Type = "job_finished"
+)
+
+// Event is a single thing that happened somewhere in the application.
+// Every subsystem publishes these to the Bus instead of logging ad-hoc messages.
+type Event struct {
+	ID      string         `json:"id"`
+	Type    Type           `json:"type"`
+	Camera  string         `json:"camera,omitempty"`
+	Time    time.Time      `json:"time"`
+	Message string         `json:"message,omitempty"`
+	Data    map[string]any `json:"data,omitempty"`
+
+	// Set when repeated events were merged into this one by a cooldown rule.
+	// EndTime is when the last merged occurrence happened.
+	EndTime time.Time `json:"end_time,omitzero"`
+	Count   int       `json:"count,omitempty"`
+}
+
+// String formats the event for log output
+func (e Event) String() string {
+	if e.Camera == "" {
+		return fmt.Sprintf("[%s] %s", e.Type, e.Message)
+	}
+	return fmt.Sprintf("[%s] camera=%s %s", e.Type, e.Camera, e.Message)
+}
@@ -0,0 +1,126 @@
+package events
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Filter selects events by camera and/or type. Empty fields match everything.
+type Filter struct {
+	Camera string
+	Types  []Type
+	// Only events from these cameras, used to hide cameras a user can't see.
+	// nil means every camera, an empty list means none.
+	Cameras []string
+	// Only events at or after Since and before Until, when set
+	Since time.Time
+	Until time.Time
+}
+
+// Match reports whether the event passes the filter
+func (f Filter) Match(e Event) bool {
+	if f.Camera != "" && e.Camera != f.Camera {
+		return false
+	}
+	if f.Cameras != nil && e.Camera != "" && !slices.Contains(f.Cameras, e.Camera) {
+		return false
+	}
+	if len(f.Types) > 0 && !OfType(f.Types...)(e) {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// History keeps the most recent events in memory so they can be listed through the API.
+// It is a fixed size ring buffer: once full, the oldest event is overwritten.
+type History struct {
+	mu     sync.RWMutex
+	events []Event
+	next   int  // index the next event will be written to
+	full   bool // true once we've wrapped around at least once
+}
+
+// NewHistory creates a history that remembers up to size events
+func NewHistory(size int) *History {
+	return &History{
+		events: make([]Event, size),
+	}
+}
+
+// Run records every event published on the bus until stop is closed. This blocks, so call it in a goroutine.
+func (h *History) Run(bus *Bus, stop <-chan struct{}) {
+	sub := bus.SubscribeWithUpdates(256, nil)
+	defer sub.Close()
+	for {
+		select {
+		case <-stop:
+			return
+		case event := <-sub.C:
+			h.Add(event)
+		}
+	}
+}
+
+// Add records a single event. An event with the same ID as a recent one replaces it in place,
+// which is how merged events get their updated end time.
+func (h *History) Add(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if e.Count > 1 {
+		for i := range h.events {
+			if h.events[i].ID == e.ID {
+				h.events[i] = e
+				return
+			}
+		}
+	}
+
+	h.events[h.next] = e
+	h.next = (h.next + 1) % len(h.events)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Query returns matching events newest first, or oldest first if oldestFirst is set, skipping offset
+// and returning at most limit. The total number of matching events is returned as well so callers
+// can page through them.
+func (h *History) Query(filter Filter, offset, limit int, oldestFirst bool) ([]Event, int) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	count := h.next
+	if h.full {
+		count = len(h.events)
+	}
+
+	results := []Event{}
+	total := 0
+
+	// Walk backwards from the newest event, or forwards from the oldest
+	for i := 0; i < count; i++ {
+		index := (h.next - 1 - i + len(h.events)) % len(h.events)
+		if oldestFirst {
+			index = (h.next - count + i + len(h.events)) % len(h.events)
+		}
+		e := h.events[index]
+		if !filter.Match(e) {
+			continue
+		}
+
+		if total >= offset && len(results) < limit {
+			results = append(results, e)
+		}
+		total++
+	}
+
+	return results, total
+}
@@ -0,0 +1,5 @@
+// Package managementpb is the gRPC management service, generated from management.proto.
+// Install protoc-gen-go and protoc-gen-go-grpc, then run go generate after changing the .proto.
+package managementpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative management.proto
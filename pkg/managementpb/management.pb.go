@@ -0,0 +1,1361 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.8
+// 	protoc        (unknown)
+// source: management.proto
+
+package managementpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ListCamerasRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListCamerasRequest) Reset() {
+	*x = ListCamerasRequest{}
+	mi := &file_management_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListCamerasRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListCamerasRequest) ProtoMessage() {}
+
+func (x *ListCamerasRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_management_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListCamerasRequest.ProtoReflect.Descriptor instead.
+func (*ListCamerasRequest) Descriptor() ([]byte, []int) {
+	return file_management_proto_rawDescGZIP(), []int{0}
+}
+
+type ListCamerasResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Cameras       []*Camera              `protobuf:"bytes,1,rep,name=cameras,proto3" json:"cameras,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListCamerasResponse) Reset() {
+	*x = ListCamerasResponse{}
+	mi := &file_management_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListCamerasResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListCamerasResponse) ProtoMessage() {}
+
+func (x *ListCamerasResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_management_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListCamerasResponse.ProtoReflect.Descriptor instead.
+func (*ListCamerasResponse) Descriptor() ([]byte, []int) {
+	return file_management_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ListCamerasResponse) GetCameras() []*Camera {
+	if x != nil {
+		return x.Cameras
+	}
+	return nil
+}
+
+// Camera is a camera's state and the video it is sending
+type Camera struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// connected, connecting or disabled
+	State string `protobuf:"bytes,2,opt,name=state,proto3" json:"state,omitempty"`
+	// Whether a packet arrived within the stall timeout
+	Healthy bool `protobuf:"varint,3,opt,name=healthy,proto3" json:"healthy,omitempty"`
+	// Unset when the camera has never sent anything
+	LastPacket *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=last_packet,json=lastPacket,proto3" json:"last_packet,omitempty"`
+	// Unset until the camera has sent its parameter sets
+	Video  *VideoInfo   `protobuf:"bytes,5,opt,name=video,proto3" json:"video,omitempty"`
+	Ingest *IngestStats `protobuf:"bytes,6,opt,name=ingest,proto3" json:"ingest,omitempty"`
+	// Open viewer sessions watching this camera
+	Viewers       int32 `protobuf:"varint,7,opt,name=viewers,proto3" json:"viewers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Camera) Reset() {
+	*x = Camera{}
+	mi := &file_management_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Camera) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Camera) ProtoMessage() {}
+
+func (x *Camera) ProtoReflect() protoreflect.Message {
+	mi := &file_management_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Camera.ProtoReflect.Descriptor instead.
+func (*Camera) Descriptor() ([]byte, []int) {
+	return file_management_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Camera) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Camera) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *Camera) GetHealthy() bool {
+	if x != nil {
+		return x.Healthy
+	}
+	return false
+}
+
+func (x *Camera) GetLastPacket() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastPacket
+	}
+	return nil
+}
+
+func (x *Camera) GetVideo() *VideoInfo {
+	if x != nil {
+		return x.Video
+	}
+	return nil
+}
+
+func (x *Camera) GetIngest() *IngestStats {
+	if x != nil {
+		return x.Ingest
+	}
+	return nil
+}
+
+func (x *Camera) GetViewers() int32 {
+	if x != nil {
+		return x.Viewers
+	}
+	return 0
+}
+
+// VideoInfo is the video format from the camera's parameter sets
+type VideoInfo struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Codec  string                 `protobuf:"bytes,1,opt,name=codec,proto3" json:"codec,omitempty"`
+	Width  int32                  `protobuf:"varint,2,opt,name=width,proto3" json:"width,omitempty"`
+	Height int32                  `protobuf:"varint,3,opt,name=height,proto3" json:"height,omitempty"`
+	// Zero when the camera doesn't say
+	Fps           float64 `protobuf:"fixed64,4,opt,name=fps,proto3" json:"fps,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VideoInfo) Reset() {
+	*x = VideoInfo{}
+	mi := &file_management_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VideoInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VideoInfo) ProtoMessage() {}
+
+func (x *VideoInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_management_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VideoInfo.ProtoReflect.Descriptor instead.
+func (*VideoInfo) Descriptor() ([]byte, []int) {
+	return file_management_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *VideoInfo) GetCodec() string {
+	if x != nil {
+		return x.Codec
+	}
+	return ""
+}
+
+func (x *VideoInfo) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *VideoInfo) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *VideoInfo) GetFps() float64 {
+	if x != nil {
+		return x.Fps
+	}
+	return 0
+}
+
+// IngestStats describes the video arriving from a camera
+type IngestStats struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	PacketsReceived  uint64                 `protobuf:"varint,1,opt,name=packets_received,json=packetsReceived,proto3" json:"packets_received,omitempty"`
+	BytesReceived    uint64                 `protobuf:"varint,2,opt,name=bytes_received,json=bytesReceived,proto3" json:"bytes_received,omitempty"`
+	FramesReceived   uint64                 `protobuf:"varint,3,opt,name=frames_received,json=framesReceived,proto3" json:"frames_received,omitempty"`
+	PacketsLost      uint64                 `protobuf:"varint,4,opt,name=packets_lost,json=packetsLost,proto3" json:"packets_lost,omitempty"`
+	PacketsReordered uint64                 `protobuf:"varint,5,opt,name=packets_reordered,json=packetsReordered,proto3" json:"packets_reordered,omitempty"`
+	LossRatio        float64                `protobuf:"fixed64,6,opt,name=loss_ratio,json=lossRatio,proto3" json:"loss_ratio,omitempty"`
+	JitterMs         float64                `protobuf:"fixed64,7,opt,name=jitter_ms,json=jitterMs,proto3" json:"jitter_ms,omitempty"`
+	// Zero unless the camera's clock is synced with NTP
+	CaptureDelayMs float64 `protobuf:"fixed64,8,opt,name=capture_delay_ms,json=captureDelayMs,proto3" json:"capture_delay_ms,omitempty"`
+	BitrateBps     float64 `protobuf:"fixed64,9,opt,name=bitrate_bps,json=bitrateBps,proto3" json:"bitrate_bps,omitempty"`
+	Fps            float64 `protobuf:"fixed64,10,opt,name=fps,proto3" json:"fps,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *IngestStats) Reset() {
+	*x = IngestStats{}
+	mi := &file_management_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IngestStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IngestStats) ProtoMessage() {}
+
+func (x *IngestStats) ProtoReflect() protoreflect.Message {
+	mi := &file_management_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IngestStats.ProtoReflect.Descriptor instead.
+func (*IngestStats) Descriptor() ([]byte, []int) {
+	return file_management_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *IngestStats) GetPacketsReceived() uint64 {
+	if x != nil {
+		return x.PacketsReceived
+	}
+	return 0
+}
+
+func (x *IngestStats) GetBytesReceived() uint64 {
+	if x != nil {
+		return x.BytesReceived
+	}
+	return 0
+}
+
+func (x *IngestStats) GetFramesReceived() uint64 {
+	if x != nil {
+		return x.FramesReceived
+	}
+	return 0
+}
+
+func (x *IngestStats) GetPacketsLost() uint64 {
+	if x != nil {
+		return x.PacketsLost
+	}
+	return 0
+}
+
+func (x *IngestStats) GetPacketsReordered() uint64 {
+	if x != nil {
+		return x.PacketsReordered
+	}
+	return 0
+}
+
+func (x *IngestStats) GetLossRatio() float64 {
+	if x != nil {
+		return x.LossRatio
+	}
+	return 0
+}
+
+func (x *IngestStats) GetJitterMs() float64 {
+	if x != nil {
+		return x.JitterMs
+	}
+	return 0
+}
+
+func (x *IngestStats) GetCaptureDelayMs() float64 {
+	if x != nil {
+		return x.CaptureDelayMs
+	}
+	return 0
+}
+
+func (x *IngestStats) GetBitrateBps() float64 {
+	if x != nil {
+		return x.BitrateBps
+	}
+	return 0
+}
+
+func (x *IngestStats) GetFps() float64 {
+	if x != nil {
+		return x.Fps
+	}
+	return 0
+}
+
+type ListSessionsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListSessionsRequest) Reset() {
+	*x = ListSessionsRequest{}
+	mi := &file_management_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListSessionsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListSessionsRequest) ProtoMessage() {}
+
+func (x *ListSessionsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_management_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListSessionsRequest.ProtoReflect.Descriptor instead.
+func (*ListSessionsRequest) Descriptor() ([]byte, []int) {
+	return file_management_proto_rawDescGZIP(), []int{5}
+}
+
+type ListSessionsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sessions      []*Session             `protobuf:"bytes,1,rep,name=sessions,proto3" json:"sessions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListSessionsResponse) Reset() {
+	*x = ListSessionsResponse{}
+	mi := &file_management_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListSessionsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListSessionsResponse) ProtoMessage() {}
+
+func (x *ListSessionsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_management_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListSessionsResponse.ProtoReflect.Descriptor instead.
+func (*ListSessionsResponse) Descriptor() ([]byte, []int) {
+	return file_management_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListSessionsResponse) GetSessions() []*Session {
+	if x != nil {
+		return x.Sessions
+	}
+	return nil
+}
+
+// Session is a viewer watching a camera
+type Session struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	User          string                 `protobuf:"bytes,2,opt,name=user,proto3" json:"user,omitempty"`
+	Camera        string                 `protobuf:"bytes,3,opt,name=camera,proto3" json:"camera,omitempty"`
+	StartedAt     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	Connected     bool                   `protobuf:"varint,5,opt,name=connected,proto3" json:"connected,omitempty"`
+	BytesSent     uint64                 `protobuf:"varint,6,opt,name=bytes_sent,json=bytesSent,proto3" json:"bytes_sent,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Session) Reset() {
+	*x = Session{}
+	mi := &file_management_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Session) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Session) ProtoMessage() {}
+
+func (x *Session) ProtoReflect() protoreflect.Message {
+	mi := &file_management_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Session.ProtoReflect.Descriptor instead.
+func (*Session) Descriptor() ([]byte, []int) {
+	return file_management_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Session) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Session) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *Session) GetCamera() string {
+	if x != nil {
+		return x.Camera
+	}
+	return ""
+}
+
+func (x *Session) GetStartedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartedAt
+	}
+	return nil
+}
+
+func (x *Session) GetConnected() bool {
+	if x != nil {
+		return x.Connected
+	}
+	return false
+}
+
+func (x *Session) GetBytesSent() uint64 {
+	if x != nil {
+		return x.BytesSent
+	}
+	return 0
+}
+
+type GetSessionStatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSessionStatsRequest) Reset() {
+	*x = GetSessionStatsRequest{}
+	mi := &file_management_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSessionStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSessionStatsRequest) ProtoMessage() {}
+
+func (x *GetSessionStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_management_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSessionStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetSessionStatsRequest) Descriptor() ([]byte, []int) {
+	return file_management_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *GetSessionStatsRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+// SessionStats is a session together with its WebRTC stats
+type SessionStats struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Session *Session               `protobuf:"bytes,1,opt,name=session,proto3" json:"session,omitempty"`
+	// Bits per second sent since the previous stats request
+	Bitrate              float64 `protobuf:"fixed64,2,opt,name=bitrate,proto3" json:"bitrate,omitempty"`
+	PacketsSent          uint32  `protobuf:"varint,3,opt,name=packets_sent,json=packetsSent,proto3" json:"packets_sent,omitempty"`
+	NackCount            uint32  `protobuf:"varint,4,opt,name=nack_count,json=nackCount,proto3" json:"nack_count,omitempty"`
+	PliCount             uint32  `protobuf:"varint,5,opt,name=pli_count,json=pliCount,proto3" json:"pli_count,omitempty"`
+	PacketsLost          int32   `protobuf:"varint,6,opt,name=packets_lost,json=packetsLost,proto3" json:"packets_lost,omitempty"`
+	FractionLost         float64 `protobuf:"fixed64,7,opt,name=fraction_lost,json=fractionLost,proto3" json:"fraction_lost,omitempty"`
+	JitterSeconds        float64 `protobuf:"fixed64,8,opt,name=jitter_seconds,json=jitterSeconds,proto3" json:"jitter_seconds,omitempty"`
+	RoundTripTimeSeconds float64 `protobuf:"fixed64,9,opt,name=round_trip_time_seconds,json=roundTripTimeSeconds,proto3" json:"round_trip_time_seconds,omitempty"`
+	// The viewer's end of the connection: host, srflx or relay (through TURN). Empty until connected.
+	CandidateType string `protobuf:"bytes,10,opt,name=candidate_type,json=candidateType,proto3" json:"candidate_type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SessionStats) Reset() {
+	*x = SessionStats{}
+	mi := &file_management_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SessionStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SessionStats) ProtoMessage() {}
+
+func (x *SessionStats) ProtoReflect() protoreflect.Message {
+	mi := &file_management_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SessionStats.ProtoReflect.Descriptor instead.
+func (*SessionStats) Descriptor() ([]byte, []int) {
+	return file_management_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *SessionStats) GetSession() *Session {
+	if x != nil {
+		return x.Session
+	}
+	return nil
+}
+
+func (x *SessionStats) GetBitrate() float64 {
+	if x != nil {
+		return x.Bitrate
+	}
+	return 0
+}
+
+func (x *SessionStats) GetPacketsSent() uint32 {
+	if x != nil {
+		return x.PacketsSent
+	}
+	return 0
+}
+
+func (x *SessionStats) GetNackCount() uint32 {
+	if x != nil {
+		return x.NackCount
+	}
+	return 0
+}
+
+func (x *SessionStats) GetPliCount() uint32 {
+	if x != nil {
+		return x.PliCount
+	}
+	return 0
+}
+
+func (x *SessionStats) GetPacketsLost() int32 {
+	if x != nil {
+		return x.PacketsLost
+	}
+	return 0
+}
+
+func (x *SessionStats) GetFractionLost() float64 {
+	if x != nil {
+		return x.FractionLost
+	}
+	return 0
+}
+
+func (x *SessionStats) GetJitterSeconds() float64 {
+	if x != nil {
+		return x.JitterSeconds
+	}
+	return 0
+}
+
+func (x *SessionStats) GetRoundTripTimeSeconds() float64 {
+	if x != nil {
+		return x.RoundTripTimeSeconds
+	}
+	return 0
+}
+
+func (x *SessionStats) GetCandidateType() string {
+	if x != nil {
+		return x.CandidateType
+	}
+	return ""
+}
+
+type CloseSessionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CloseSessionRequest) Reset() {
+	*x = CloseSessionRequest{}
+	mi := &file_management_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CloseSessionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CloseSessionRequest) ProtoMessage() {}
+
+func (x *CloseSessionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_management_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CloseSessionRequest.ProtoReflect.Descriptor instead.
+func (*CloseSessionRequest) Descriptor() ([]byte, []int) {
+	return file_management_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *CloseSessionRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type CloseSessionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CloseSessionResponse) Reset() {
+	*x = CloseSessionResponse{}
+	mi := &file_management_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CloseSessionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CloseSessionResponse) ProtoMessage() {}
+
+func (x *CloseSessionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_management_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CloseSessionResponse.ProtoReflect.Descriptor instead.
+func (*CloseSessionResponse) Descriptor() ([]byte, []int) {
+	return file_management_proto_rawDescGZIP(), []int{11}
+}
+
+type StreamEventsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Only this camera's events, all cameras when empty
+	Camera string `protobuf:"bytes,1,opt,name=camera,proto3" json:"camera,omitempty"`
+	// Only these event types, all types when empty
+	Types         []string `protobuf:"bytes,2,rep,name=types,proto3" json:"types,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamEventsRequest) Reset() {
+	*x = StreamEventsRequest{}
+	mi := &file_management_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamEventsRequest) ProtoMessage() {}
+
+func (x *StreamEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_management_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamEventsRequest.ProtoReflect.Descriptor instead.
+func (*StreamEventsRequest) Descriptor() ([]byte, []int) {
+	return file_management_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *StreamEventsRequest) GetCamera() string {
+	if x != nil {
+		return x.Camera
+	}
+	return ""
+}
+
+func (x *StreamEventsRequest) GetTypes() []string {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+// Event is something that happened, see the events section of the README for the types
+type Event struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Id      string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type    string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Camera  string                 `protobuf:"bytes,3,opt,name=camera,proto3" json:"camera,omitempty"`
+	Time    *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=time,proto3" json:"time,omitempty"`
+	Message string                 `protobuf:"bytes,5,opt,name=message,proto3" json:"message,omitempty"`
+	Data    *structpb.Struct       `protobuf:"bytes,6,opt,name=data,proto3" json:"data,omitempty"`
+	// Set when repeated events were merged into this one, which is then sent again with the same id
+	EndTime       *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=end_time,json=endTime,proto3" json:"end_time,omitempty"`
+	Count         int32                  `protobuf:"varint,8,opt,name=count,proto3" json:"count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_management_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_management_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_management_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *Event) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Event) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Event) GetCamera() string {
+	if x != nil {
+		return x.Camera
+	}
+	return ""
+}
+
+func (x *Event) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Event) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Event) GetData() *structpb.Struct {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *Event) GetEndTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EndTime
+	}
+	return nil
+}
+
+func (x *Event) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+type StreamStatsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Defaults to 2s, at least 500ms
+	Interval      *durationpb.Duration `protobuf:"bytes,1,opt,name=interval,proto3" json:"interval,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamStatsRequest) Reset() {
+	*x = StreamStatsRequest{}
+	mi := &file_management_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamStatsRequest) ProtoMessage() {}
+
+func (x *StreamStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_management_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamStatsRequest.ProtoReflect.Descriptor instead.
+func (*StreamStatsRequest) Descriptor() ([]byte, []int) {
+	return file_management_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *StreamStatsRequest) GetInterval() *durationpb.Duration {
+	if x != nil {
+		return x.Interval
+	}
+	return nil
+}
+
+// StatsSnapshot is the statistics at one moment, like a message from /api/stats/ws
+type StatsSnapshot struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	Cameras       []*CameraStats         `protobuf:"bytes,2,rep,name=cameras,proto3" json:"cameras,omitempty"`
+	Sessions      []*SessionSnapshot     `protobuf:"bytes,3,rep,name=sessions,proto3" json:"sessions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatsSnapshot) Reset() {
+	*x = StatsSnapshot{}
+	mi := &file_management_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatsSnapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatsSnapshot) ProtoMessage() {}
+
+func (x *StatsSnapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_management_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatsSnapshot.ProtoReflect.Descriptor instead.
+func (*StatsSnapshot) Descriptor() ([]byte, []int) {
+	return file_management_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *StatsSnapshot) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *StatsSnapshot) GetCameras() []*CameraStats {
+	if x != nil {
+		return x.Cameras
+	}
+	return nil
+}
+
+func (x *StatsSnapshot) GetSessions() []*SessionSnapshot {
+	if x != nil {
+		return x.Sessions
+	}
+	return nil
+}
+
+type CameraStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Camera        string                 `protobuf:"bytes,1,opt,name=camera,proto3" json:"camera,omitempty"`
+	Ingest        *IngestStats           `protobuf:"bytes,2,opt,name=ingest,proto3" json:"ingest,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CameraStats) Reset() {
+	*x = CameraStats{}
+	mi := &file_management_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CameraStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CameraStats) ProtoMessage() {}
+
+func (x *CameraStats) ProtoReflect() protoreflect.Message {
+	mi := &file_management_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CameraStats.ProtoReflect.Descriptor instead.
+func (*CameraStats) Descriptor() ([]byte, []int) {
+	return file_management_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *CameraStats) GetCamera() string {
+	if x != nil {
+		return x.Camera
+	}
+	return ""
+}
+
+func (x *CameraStats) GetIngest() *IngestStats {
+	if x != nil {
+		return x.Ingest
+	}
+	return nil
+}
+
+type SessionSnapshot struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Session *Session               `protobuf:"bytes,1,opt,name=session,proto3" json:"session,omitempty"`
+	// Bits per second since the previous snapshot
+	Bitrate       float64 `protobuf:"fixed64,2,opt,name=bitrate,proto3" json:"bitrate,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SessionSnapshot) Reset() {
+	*x = SessionSnapshot{}
+	mi := &file_management_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SessionSnapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SessionSnapshot) ProtoMessage() {}
+
+func (x *SessionSnapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_management_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SessionSnapshot.ProtoReflect.Descriptor instead.
+func (*SessionSnapshot) Descriptor() ([]byte, []int) {
+	return file_management_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *SessionSnapshot) GetSession() *Session {
+	if x != nil {
+		return x.Session
+	}
+	return nil
+}
+
+func (x *SessionSnapshot) GetBitrate() float64 {
+	if x != nil {
+		return x.Bitrate
+	}
+	return 0
+}
+
+var File_management_proto protoreflect.FileDescriptor
+
+const file_management_proto_rawDesc = "" +
+	"\n" +
+	"\x10management.proto\x12\x1acameraviewer.management.v1\x1a\x1egoogle/protobuf/duration.proto\x1a\x1cgoogle/protobuf/struct.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\x14\n" +
+	"\x12ListCamerasRequest\"S\n" +
+	"\x13ListCamerasResponse\x12<\n" +
+	"\acameras\x18\x01 \x03(\v2\".cameraviewer.management.v1.CameraR\acameras\"\x9d\x02\n" +
+	"\x06Camera\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05state\x18\x02 \x01(\tR\x05state\x12\x18\n" +
+	"\ahealthy\x18\x03 \x01(\bR\ahealthy\x12;\n" +
+	"\vlast_packet\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"lastPacket\x12;\n" +
+	"\x05video\x18\x05 \x01(\v2%.cameraviewer.management.v1.VideoInfoR\x05video\x12?\n" +
+	"\x06ingest\x18\x06 \x01(\v2'.cameraviewer.management.v1.IngestStatsR\x06ingest\x12\x18\n" +
+	"\aviewers\x18\a \x01(\x05R\aviewers\"a\n" +
+	"\tVideoInfo\x12\x14\n" +
+	"\x05codec\x18\x01 \x01(\tR\x05codec\x12\x14\n" +
+	"\x05width\x18\x02 \x01(\x05R\x05width\x12\x16\n" +
+	"\x06height\x18\x03 \x01(\x05R\x06height\x12\x10\n" +
+	"\x03fps\x18\x04 \x01(\x01R\x03fps\"\xf1\x02\n" +
+	"\vIngestStats\x12)\n" +
+	"\x10packets_received\x18\x01 \x01(\x04R\x0fpacketsReceived\x12%\n" +
+	"\x0ebytes_received\x18\x02 \x01(\x04R\rbytesReceived\x12'\n" +
+	"\x0fframes_received\x18\x03 \x01(\x04R\x0eframesReceived\x12!\n" +
+	"\fpackets_lost\x18\x04 \x01(\x04R\vpacketsLost\x12+\n" +
+	"\x11packets_reordered\x18\x05 \x01(\x04R\x10packetsReordered\x12\x1d\n" +
+	"\n" +
+	"loss_ratio\x18\x06 \x01(\x01R\tlossRatio\x12\x1b\n" +
+	"\tjitter_ms\x18\a \x01(\x01R\bjitterMs\x12(\n" +
+	"\x10capture_delay_ms\x18\b \x01(\x01R\x0ecaptureDelayMs\x12\x1f\n" +
+	"\vbitrate_bps\x18\t \x01(\x01R\n" +
+	"bitrateBps\x12\x10\n" +
+	"\x03fps\x18\n" +
+	" \x01(\x01R\x03fps\"\x15\n" +
+	"\x13ListSessionsRequest\"W\n" +
+	"\x14ListSessionsResponse\x12?\n" +
+	"\bsessions\x18\x01 \x03(\v2#.cameraviewer.management.v1.SessionR\bsessions\"\xbd\x01\n" +
+	"\aSession\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04user\x18\x02 \x01(\tR\x04user\x12\x16\n" +
+	"\x06camera\x18\x03 \x01(\tR\x06camera\x129\n" +
+	"\n" +
+	"started_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\tstartedAt\x12\x1c\n" +
+	"\tconnected\x18\x05 \x01(\bR\tconnected\x12\x1d\n" +
+	"\n" +
+	"bytes_sent\x18\x06 \x01(\x04R\tbytesSent\"(\n" +
+	"\x16GetSessionStatsRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x93\x03\n" +
+	"\fSessionStats\x12=\n" +
+	"\asession\x18\x01 \x01(\v2#.cameraviewer.management.v1.SessionR\asession\x12\x18\n" +
+	"\abitrate\x18\x02 \x01(\x01R\abitrate\x12!\n" +
+	"\fpackets_sent\x18\x03 \x01(\rR\vpacketsSent\x12\x1d\n" +
+	"\n" +
+	"nack_count\x18\x04 \x01(\rR\tnackCount\x12\x1b\n" +
+	"\tpli_count\x18\x05 \x01(\rR\bpliCount\x12!\n" +
+	"\fpackets_lost\x18\x06 \x01(\x05R\vpacketsLost\x12#\n" +
+	"\rfraction_lost\x18\a \x01(\x01R\ffractionLost\x12%\n" +
+	"\x0ejitter_seconds\x18\b \x01(\x01R\rjitterSeconds\x125\n" +
+	"\x17round_trip_time_seconds\x18\t \x01(\x01R\x14roundTripTimeSeconds\x12%\n" +
+	"\x0ecandidate_type\x18\n" +
+	" \x01(\tR\rcandidateType\"%\n" +
+	"\x13CloseSessionRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x16\n" +
+	"\x14CloseSessionResponse\"C\n" +
+	"\x13StreamEventsRequest\x12\x16\n" +
+	"\x06camera\x18\x01 \x01(\tR\x06camera\x12\x14\n" +
+	"\x05types\x18\x02 \x03(\tR\x05types\"\x87\x02\n" +
+	"\x05Event\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x16\n" +
+	"\x06camera\x18\x03 \x01(\tR\x06camera\x12.\n" +
+	"\x04time\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x18\n" +
+	"\amessage\x18\x05 \x01(\tR\amessage\x12+\n" +
+	"\x04data\x18\x06 \x01(\v2\x17.google.protobuf.StructR\x04data\x125\n" +
+	"\bend_time\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\aendTime\x12\x14\n" +
+	"\x05count\x18\b \x01(\x05R\x05count\"K\n" +
+	"\x12StreamStatsRequest\x125\n" +
+	"\binterval\x18\x01 \x01(\v2\x19.google.protobuf.DurationR\binterval\"\xcb\x01\n" +
+	"\rStatsSnapshot\x12.\n" +
+	"\x04time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12A\n" +
+	"\acameras\x18\x02 \x03(\v2'.cameraviewer.management.v1.CameraStatsR\acameras\x12G\n" +
+	"\bsessions\x18\x03 \x03(\v2+.cameraviewer.management.v1.SessionSnapshotR\bsessions\"f\n" +
+	"\vCameraStats\x12\x16\n" +
+	"\x06camera\x18\x01 \x01(\tR\x06camera\x12?\n" +
+	"\x06ingest\x18\x02 \x01(\v2'.cameraviewer.management.v1.IngestStatsR\x06ingest\"j\n" +
+	"\x0fSessionSnapshot\x12=\n" +
+	"\asession\x18\x01 \x01(\v2#.cameraviewer.management.v1.SessionR\asession\x12\x18\n" +
+	"\abitrate\x18\x02 \x01(\x01R\abitrate2\xa5\x05\n" +
+	"\n" +
+	"Management\x12n\n" +
+	"\vListCameras\x12..cameraviewer.management.v1.ListCamerasRequest\x1a/.cameraviewer.management.v1.ListCamerasResponse\x12q\n" +
+	"\fListSessions\x12/.cameraviewer.management.v1.ListSessionsRequest\x1a0.cameraviewer.management.v1.ListSessionsResponse\x12o\n" +
+	"\x0fGetSessionStats\x122.cameraviewer.management.v1.GetSessionStatsRequest\x1a(.cameraviewer.management.v1.SessionStats\x12q\n" +
+	"\fCloseSession\x12/.cameraviewer.management.v1.CloseSessionRequest\x1a0.cameraviewer.management.v1.CloseSessionResponse\x12d\n" +
+	"\fStreamEvents\x12/.cameraviewer.management.v1.StreamEventsRequest\x1a!.cameraviewer.management.v1.Event0\x01\x12j\n" +
+	"\vStreamStats\x12..cameraviewer.management.v1.StreamStatsRequest\x1a).cameraviewer.management.v1.StatsSnapshot0\x01B7Z5github.com/nisarg-dave/camera-viewer/pkg/managementpbb\x06proto3"
+
+var (
+	file_management_proto_rawDescOnce sync.Once
+	file_management_proto_rawDescData []byte
+)
+
+func file_management_proto_rawDescGZIP() []byte {
+	file_management_proto_rawDescOnce.Do(func() {
+		file_management_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_management_proto_rawDesc), len(file_management_proto_rawDesc)))
+	})
+	return file_management_proto_rawDescData
+}
+
+var file_management_proto_msgTypes = make([]protoimpl.MessageInfo, 18)
+var file_management_proto_goTypes = []any{
+	(*ListCamerasRequest)(nil),     // 0: cameraviewer.management.v1.ListCamerasRequest
+	(*ListCamerasResponse)(nil),    // 1: cameraviewer.management.v1.ListCamerasResponse
+	(*Camera)(nil),                 // 2: cameraviewer.management.v1.Camera
+	(*VideoInfo)(nil),              // 3: cameraviewer.management.v1.VideoInfo
+	(*IngestStats)(nil),            // 4: cameraviewer.management.v1.IngestStats
+	(*ListSessionsRequest)(nil),    // 5: cameraviewer.management.v1.ListSessionsRequest
+	(*ListSessionsResponse)(nil),   // 6: cameraviewer.management.v1.ListSessionsResponse
+	(*Session)(nil),                // 7: cameraviewer.management.v1.Session
+	(*GetSessionStatsRequest)(nil), // 8: cameraviewer.management.v1.GetSessionStatsRequest
+	(*SessionStats)(nil),           // 9: cameraviewer.management.v1.SessionStats
+	(*CloseSessionRequest)(nil),    // 10: cameraviewer.management.v1.CloseSessionRequest
+	(*CloseSessionResponse)(nil),   // 11: cameraviewer.management.v1.CloseSessionResponse
+	(*StreamEventsRequest)(nil),    // 12: cameraviewer.management.v1.StreamEventsRequest
+	(*Event)(nil),                  // 13: cameraviewer.management.v1.Event
+	(*StreamStatsRequest)(nil),     // 14: cameraviewer.management.v1.StreamStatsRequest
+	(*StatsSnapshot)(nil),          // 15: cameraviewer.management.v1.StatsSnapshot
+	(*CameraStats)(nil),            // 16: cameraviewer.management.v1.CameraStats
+	(*SessionSnapshot)(nil),        // 17: cameraviewer.management.v1.SessionSnapshot
+	(*timestamppb.Timestamp)(nil),  // 18: google.protobuf.Timestamp
+	(*structpb.Struct)(nil),        // 19: google.protobuf.Struct
+	(*durationpb.Duration)(nil),    // 20: google.protobuf.Duration
+}
+var file_management_proto_depIdxs = []int32{
+	2,  // 0: cameraviewer.management.v1.ListCamerasResponse.cameras:type_name -> cameraviewer.management.v1.Camera
+	18, // 1: cameraviewer.management.v1.Camera.last_packet:type_name -> google.protobuf.Timestamp
+	3,  // 2: cameraviewer.management.v1.Camera.video:type_name -> cameraviewer.management.v1.VideoInfo
+	4,  // 3: cameraviewer.management.v1.Camera.ingest:type_name -> cameraviewer.management.v1.IngestStats
+	7,  // 4: cameraviewer.management.v1.ListSessionsResponse.sessions:type_name -> cameraviewer.management.v1.Session
+	18, // 5: cameraviewer.management.v1.Session.started_at:type_name -> google.protobuf.Timestamp
+	7,  // 6: cameraviewer.management.v1.SessionStats.session:type_name -> cameraviewer.management.v1.Session
+	18, // 7: cameraviewer.management.v1.Event.time:type_name -> google.protobuf.Timestamp
+	19, // 8: cameraviewer.management.v1.Event.data:type_name -> google.protobuf.Struct
+	18, // 9: cameraviewer.management.v1.Event.end_time:type_name -> google.protobuf.Timestamp
+	20, // 10: cameraviewer.management.v1.StreamStatsRequest.interval:type_name -> google.protobuf.Duration
+	18, // 11: cameraviewer.management.v1.StatsSnapshot.time:type_name -> google.protobuf.Timestamp
+	16, // 12: cameraviewer.management.v1.StatsSnapshot.cameras:type_name -> cameraviewer.management.v1.CameraStats
+	17, // 13: cameraviewer.management.v1.StatsSnapshot.sessions:type_name -> cameraviewer.management.v1.SessionSnapshot
+	4,  // 14: cameraviewer.management.v1.CameraStats.ingest:type_name -> cameraviewer.management.v1.IngestStats
+	7,  // 15: cameraviewer.management.v1.SessionSnapshot.session:type_name -> cameraviewer.management.v1.Session
+	0,  // 16: cameraviewer.management.v1.Management.ListCameras:input_type -> cameraviewer.management.v1.ListCamerasRequest
+	5,  // 17: cameraviewer.management.v1.Management.ListSessions:input_type -> cameraviewer.management.v1.ListSessionsRequest
+	8,  // 18: cameraviewer.management.v1.Management.GetSessionStats:input_type -> cameraviewer.management.v1.GetSessionStatsRequest
+	10, // 19: cameraviewer.management.v1.Management.CloseSession:input_type -> cameraviewer.management.v1.CloseSessionRequest
+	12, // 20: cameraviewer.management.v1.Management.StreamEvents:input_type -> cameraviewer.management.v1.StreamEventsRequest
+	14, // 21: cameraviewer.management.v1.Management.StreamStats:input_type -> cameraviewer.management.v1.StreamStatsRequest
+	1,  // 22: cameraviewer.management.v1.Management.ListCameras:output_type -> cameraviewer.management.v1.ListCamerasResponse
+	6,  // 23: cameraviewer.management.v1.Management.ListSessions:output_type -> cameraviewer.management.v1.ListSessionsResponse
+	9,  // 24: cameraviewer.management.v1.Management.GetSessionStats:output_type -> cameraviewer.management.v1.SessionStats
+	11, // 25: cameraviewer.management.v1.Management.CloseSession:output_type -> cameraviewer.management.v1.CloseSessionResponse
+	13, // 26: cameraviewer.management.v1.Management.StreamEvents:output_type -> cameraviewer.management.v1.Event
+	15, // 27: cameraviewer.management.v1.Management.StreamStats:output_type -> cameraviewer.management.v1.StatsSnapshot
+	22, // [22:28] is the sub-list for method output_type
+	16, // [16:22] is the sub-list for method input_type
+	16, // [16:16] is the sub-list for extension type_name
+	16, // [16:16] is the sub-list for extension extendee
+	0,  // [0:16] is the sub-list for field type_name
+}
+
+func init() { file_management_proto_init() }
+func file_management_proto_init() {
+	if File_management_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_management_proto_rawDesc), len(file_management_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   18,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_management_proto_goTypes,
+		DependencyIndexes: file_management_proto_depIdxs,
+		MessageInfos:      file_management_proto_msgTypes,
+	}.Build()
+	File_management_proto = out.File
+	file_management_proto_goTypes = nil
+	file_management_proto_depIdxs = nil
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+)
+
+// clientCertContextKey marks requests authenticated by a client certificate on the admin listener
+const clientCertContextKey contextKey = "client_cert"
+
+// startAdminListener serves the management API on a separate address that requires client certificates.
+// Anyone with a valid certificate is treated as an admin, without needing a session.
+// The returned server is shut down along with the others by serve.
+func (s *Server) startAdminListener(ctx context.Context, cfg config.AdminListener) (*http.Server, error) {
+	if cfg.Addr == "" || cfg.CertFile == "" || cfg.KeyFile == "" || cfg.ClientCAFile == "" {
+		return nil, fmt.Errorf("admin_listener needs addr, cert_file, key_file and client_ca_file")
+	}
+
+	clientCAs, err := loadClientCAs(cfg.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fail at startup rather than on the first connection if the server certificate is bad
+	_, err = tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load admin listener certificate: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	requireCert := func(next http.HandlerFunc) http.HandlerFunc {
+		return s.requireClientCert(cfg.AllowedNames, next)
+	}
+	handleAPI(mux, "/users", requireCert(s.idempotent(s.handleUsers)))
+	handleAPI(mux, "/users/{username}", requireCert(s.handleUser))
+	handleAPI(mux, "/share", requireCert(s.idempotent(s.handleShare)))
+	handleAPI(mux, "/usage", requireCert(s.handleUsage))
+	handleAPI(mux, "/summary", requireCert(s.handleSummary))
+	handleAPI(mux, "/audit", requireCert(s.handleAudit))
+	handleAPI(mux, "/config/export", requireCert(s.handleConfigExport))
+	handleAPI(mux, "/config/import", requireCert(s.handleConfigImport))
+	handleAPI(mux, "/ratelimit", requireCert(s.handleRateLimitStats))
+	handleAPI(mux, "/events", requireCert(s.handleEvents))
+	handleAPI(mux, "/cameras/{id}/probe", requireCert(s.idempotent(s.handleCameraProbe)))
+	handleAPI(mux, "/jobs", requireCert(s.handleJobs))
+	handleAPI(mux, "/jobs/{id}", requireCert(s.handleJob))
+	mux.Handle("/api/v1/", apiV1(http.NotFoundHandler()))
+
+	server := &http.Server{
+		Addr:    cfg.Addr,
+		Handler: s.logRequests(mux),
+		// Like the main listener, requests are cancelled when shutdown starts
+		BaseContext: func(net.Listener) context.Context { return ctx },
+		TLSConfig: &tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  clientCAs,
+			MinVersion: tls.VersionTLS12,
+		},
+	}
+
+	go func() {
+		log.Printf("Starting admin API with client certificate authentication on %s", cfg.Addr)
+		err := server.ListenAndServeTLS(cfg.CertFile, cfg.KeyFile)
+		if !errors.Is(err, http.ErrServerClosed) {
+			s.listenerErrs <- fmt.Errorf("admin listener: %w", err)
+		}
+	}()
+	return server, nil
+}
+
+// loadClientCAs reads the CA certificates that client certificates have to be signed by
+func loadClientCAs(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in client CA file %s", file)
+	}
+	return clientCAs, nil
+}
+
+// requireClientCert lets a request through if its verified client certificate has an allowed common name.
+// The TLS handshake has already checked the certificate against the client CA.
+func (s *Server) requireClientCert(allowedNames []string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			http.Error(w, "Client certificate required", http.StatusUnauthorized)
+			return
+		}
+
+		name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		if len(allowedNames) > 0 && !slices.Contains(allowedNames, name) {
+			log.Printf("Rejected admin API client certificate %q from %s", name, s.clientIP(r))
+			http.Error(w, "Client certificate not allowed", http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), clientCertContextKey, name)
+		ctx = context.WithValue(ctx, userContextKey, "cert:"+name)
+		next(w, r.WithContext(ctx))
+	}
+}
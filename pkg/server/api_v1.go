@@ -0,0 +1,212 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// apiVersionContextKey marks a request that came in under /api/v1, see apiVersion
+const apiVersionContextKey contextKey = "api_version"
+
+// apiError is the error object every /api/v1 error response carries as {"error": {...}}.
+// Code is stable and meant for programs to branch on, Message is for people and may change.
+type apiError struct {
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// handleAPI serves an API route at its versioned path under /api/v1, and at its original path under
+// /api as it always was, for the frontend and existing integrations. pattern starts after the prefix,
+// e.g. "/sessions/{id}/stats".
+func handleAPI(mux *http.ServeMux, pattern string, handler http.HandlerFunc) {
+	addAPIRoute(pattern)
+	mux.HandleFunc("/api"+pattern, handler)
+	mux.Handle("/api/v1"+pattern, apiV1(handler))
+}
+
+// apiVersion returns 1 for a request under /api/v1, and 0 for the unversioned /api
+func apiVersion(r *http.Request) int {
+	version, _ := r.Context().Value(apiVersionContextKey).(int)
+	return version
+}
+
+// apiV1 gives a handler the /api/v1 response shapes without it having to know about them: a JSON body
+// is sent as {"data": ...}, and a plain text error from http.Error as {"error": {"code", "message"}}
+// with the code taken from the status, e.g. NOT_FOUND. Other bodies, like the event stream, are
+// passed through untouched.
+func apiV1(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), apiVersionContextKey, 1))
+		writer := &apiV1Writer{ResponseWriter: w}
+		next.ServeHTTP(writer, r)
+		writer.finish()
+	})
+}
+
+// How apiV1Writer sends a response's body, decided when its header is written
+const (
+	apiBodyPassThrough = iota
+	apiBodyData        // Wrapped in {"data": ...} as it is written
+	apiBodyError       // Held back and sent as an apiError once the handler returns
+)
+
+// apiV1Writer reshapes responses for apiV1. Like statusRecorder it passes Flush and Hijack through,
+// so streaming responses and WebSockets keep working.
+type apiV1Writer struct {
+	http.ResponseWriter
+	wroteHeader bool
+	status      int
+	body        int
+	opened      bool         // Whether {"data": has gone out
+	message     bytes.Buffer // The text of an error
+	raw         bool         // Set by writeAPIError, whose body is already in shape
+}
+
+func (a *apiV1Writer) WriteHeader(status int) {
+	if a.wroteHeader {
+		return
+	}
+	a.wroteHeader = true
+	a.status = status
+
+	contentType := a.Header().Get("Content-Type")
+	switch {
+	case a.raw:
+	case status >= 400 && strings.HasPrefix(contentType, "text/plain"):
+		a.body = apiBodyError
+		a.Header().Set("Content-Type", "application/json")
+	case strings.HasPrefix(contentType, "application/json"):
+		a.body = apiBodyData
+	}
+	if a.body != apiBodyPassThrough {
+		// The body's length changes
+		a.Header().Del("Content-Length")
+	}
+	a.ResponseWriter.WriteHeader(status)
+}
+
+func (a *apiV1Writer) Write(data []byte) (int, error) {
+	if !a.wroteHeader {
+		a.WriteHeader(http.StatusOK)
+	}
+	switch a.body {
+	case apiBodyError:
+		return a.message.Write(data)
+	case apiBodyData:
+		if !a.opened {
+			a.opened = true
+			_, err := io.WriteString(a.ResponseWriter, `{"data":`)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	return a.ResponseWriter.Write(data)
+}
+
+// finish closes the data envelope, or sends the error, once the handler has returned
+func (a *apiV1Writer) finish() {
+	switch a.body {
+	case apiBodyError:
+		json.NewEncoder(a.ResponseWriter).Encode(map[string]apiError{
+			"error": {Code: errorCode(a.status), Message: strings.TrimSpace(a.message.String())},
+		})
+	case apiBodyData:
+		if a.opened {
+			io.WriteString(a.ResponseWriter, "}\n")
+		}
+	}
+}
+
+func (a *apiV1Writer) Flush() {
+	if flusher, ok := a.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (a *apiV1Writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := a.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter
+func (a *apiV1Writer) Unwrap() http.ResponseWriter {
+	return a.ResponseWriter
+}
+
+// asAPIV1Writer finds the apiV1Writer under any middleware that wraps the ResponseWriter, e.g. idempotent
+func asAPIV1Writer(w http.ResponseWriter) (*apiV1Writer, bool) {
+	for {
+		switch writer := w.(type) {
+		case *apiV1Writer:
+			return writer, true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = writer.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// errorCode is the code for an error that only has a status, e.g. NOT_FOUND for 404
+func errorCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "ERROR"
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z':
+			return r
+		case r == ' ' || r == '-':
+			return '_'
+		}
+		return -1
+	}, text)
+}
+
+// legacyErrorCodes are the names errors had in the "error" field under /api before their code was renamed
+var legacyErrorCodes = map[string]string{
+	"CODEC_UNSUPPORTED": "unsupported_codec",
+}
+
+// writeAPIError sends an error with a code of its own, e.g. CODEC_UNSUPPORTED, and any details that
+// help the caller react to it. Under /api/v1 it is an apiError. Under /api the same code comes in the
+// shape errors always had there, {"code": "CODEC_UNSUPPORTED", "message": "..."} with the details
+// alongside, and "error" still has the lower case name older clients look for, e.g. "unsupported_codec".
+func writeAPIError(w http.ResponseWriter, r *http.Request, status int, code, message string, details map[string]any) {
+	var body any
+	if apiVersion(r) >= 1 {
+		if writer, ok := asAPIV1Writer(w); ok {
+			writer.raw = true
+		}
+		body = map[string]apiError{"error": {Code: code, Message: message, Details: details}}
+	} else {
+		legacyCode, ok := legacyErrorCodes[code]
+		if !ok {
+			legacyCode = strings.ToLower(code)
+		}
+		legacy := map[string]any{"code": code, "error": legacyCode, "message": message}
+		for key, value := range details {
+			legacy[key] = value
+		}
+		body = legacy
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/nisarg-dave/camera-viewer/internal/audit"
+)
+
+// auditResponse is one page of the audit log. Total counts every matching entry, not just this page's.
+type auditResponse struct {
+	Entries []audit.Entry `json:"entries"`
+	Total   int           `json:"total"`
+	Limit   int           `json:"limit"`
+	Offset  int           `json:"offset"`
+}
+
+// recordAudit adds an entry for an action taken through the API, filling in the user and their IP
+func (s *Server) recordAudit(r *http.Request, entry audit.Entry) {
+	if entry.User == "" {
+		entry.User = currentUser(r)
+	}
+	entry.IP = s.clientIP(r)
+	s.recordAuditEntry(entry)
+}
+
+// recordAuditEntry adds an entry for an action that didn't come from an API request, e.g. an MQTT command
+func (s *Server) recordAuditEntry(entry audit.Entry) {
+	err := s.auditLog.Record(entry)
+	if err != nil {
+		// Not being able to audit shouldn't stop people from watching their cameras, but it should be loud
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
+
+// auditedCameraCommand wraps a camera command so it is recorded in the audit log as done by user
+func (s *Server) auditedCameraCommand(user string, action audit.Action, command func(camera, arg string) error) func(camera, arg string) error {
+	return func(camera, arg string) error {
+		err := command(camera, arg)
+		entry := audit.Entry{User: user, Action: action, Camera: camera}
+		if err != nil {
+			entry.Detail = "failed: " + err.Error()
+		}
+		s.recordAuditEntry(entry)
+		return err
+	}
+}
+
+// handleAudit returns audit log entries, newest first unless ?sort=time. Admin only.
+// GET /api/audit?user=alice&action=view_camera,login&camera=driveway&since=2024-01-01T00:00:00Z&until=...&limit=50&offset=0
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, err := parseListQuery(r, []string{"time"}, "-time")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := audit.Filter{
+		User:   query.Get("user"),
+		Camera: query.Get("camera"),
+	}
+	for _, action := range queryValues(r, "action") {
+		filter.Actions = append(filter.Actions, audit.Action(action))
+	}
+	filter.Since, filter.Until, err = parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, total, err := s.auditLog.Query(filter, list.Offset, list.Limit, !list.Descending)
+	if err != nil {
+		log.Printf("Failed to query audit log: %v", err)
+		http.Error(w, "Failed to read audit log", http.StatusInternalServerError)
+		return
+	}
+
+	setTotalCount(w, total)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(auditResponse{Entries: entries, Total: total, Limit: list.Limit, Offset: list.Offset})
+}
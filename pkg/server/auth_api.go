@@ -0,0 +1,382 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/audit"
+	"github.com/nisarg-dave/camera-viewer/internal/auth"
+)
+
+// sessionCookieName is the cookie that carries the login session token
+const sessionCookieName = "camera_viewer_session"
+
+type contextKey string
+
+// userContextKey stores the logged in username on the request context
+const userContextKey contextKey = "user"
+
+// shareContextKey stores the camera a share token gives access to, for requests that came in with one
+const shareContextKey contextKey = "share"
+
+// currentUser returns the username of the logged in user, or "" when auth is disabled
+func currentUser(r *http.Request) string {
+	username, _ := r.Context().Value(userContextKey).(string)
+	return username
+}
+
+// requestUser returns the logged in user's account.
+// With auth disabled everyone is treated as an admin.
+func (s *Server) requestUser(r *http.Request) auth.User {
+	if s.authDisabled {
+		return auth.User{Role: auth.RoleAdmin}
+	}
+	if _, ok := r.Context().Value(clientCertContextKey).(string); ok {
+		// Clients on the admin listener proved who they are with a certificate
+		return auth.User{Username: currentUser(r), Role: auth.RoleAdmin}
+	}
+	if camera, ok := r.Context().Value(shareContextKey).(string); ok {
+		// Someone with a share link can only watch the one camera
+		return auth.User{Username: currentUser(r), Role: auth.RoleViewer, Cameras: []string{camera}}
+	}
+	user, err := s.users.Get(currentUser(r))
+	if err != nil {
+		// requireAuth already checked the user exists, so this only happens if they were just deleted
+		return auth.User{}
+	}
+	return user
+}
+
+// canViewCamera reports whether the logged in user has been granted access to a camera
+func (s *Server) canViewCamera(r *http.Request, camera string) bool {
+	return s.requestUser(r).CanView(camera)
+}
+
+// requireAdmin only lets admins through. It must be wrapped in requireAuth.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.requestUser(r).IsAdmin() {
+			http.Error(w, "Admin access required", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requireAuth rejects requests without a valid session cookie.
+// The username is put on the request context for the handler (see currentUser).
+func (s *Server) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.authDisabled {
+			next(w, r)
+			return
+		}
+
+		cookie, err := r.Cookie(sessionCookieName)
+		if err != nil {
+			http.Error(w, "Not logged in", http.StatusUnauthorized)
+			return
+		}
+
+		session := s.sessions.Get(cookie.Value)
+		if session == nil {
+			http.Error(w, "Session expired", http.StatusUnauthorized)
+			return
+		}
+
+		// The user may have been deleted since logging in
+		_, err = s.users.Get(session.Username)
+		if err != nil {
+			s.sessions.Delete(cookie.Value)
+			http.Error(w, "Session expired", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userContextKey, session.Username)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// requireAuthOrShare is requireAuth, but also accepts a signed share token in the ?share= query parameter.
+// It is only used on the endpoints needed to watch a stream.
+func (s *Server) requireAuthOrShare(next http.HandlerFunc) http.HandlerFunc {
+	withSession := s.requireAuth(next)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("share")
+		if token == "" || s.authDisabled {
+			withSession(w, r)
+			return
+		}
+
+		if !s.checkLockout(w, r, "") {
+			return
+		}
+
+		share, err := s.shareSigner.Verify(token)
+		if errors.Is(err, auth.ErrShareTokenExpired) {
+			http.Error(w, "This link has expired", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			// Forged tokens count as failed logins for the IP
+			s.recordLoginFailure(r, "")
+			http.Error(w, "Invalid link", http.StatusUnauthorized)
+			return
+		}
+
+		// Each link is a user of its own, so one link can't see or close another's sessions or use up its bandwidth
+		ctx := context.WithValue(r.Context(), shareContextKey, share.Camera)
+		ctx = context.WithValue(ctx, userContextKey, "share:"+share.ID)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// bootstrapAdmin creates the first user when the store is empty, so a fresh install can be logged into.
+// The password comes from ADMIN_PASSWORD, or is generated and printed once.
+func bootstrapAdmin(users *auth.UserStore, password string) error {
+	if users.Count() > 0 {
+		return nil
+	}
+
+	generated := password == ""
+	if generated {
+		var err error
+		password, err = auth.RandomPassword()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := users.Add("admin", password, auth.RoleAdmin, nil)
+	if err != nil {
+		return err
+	}
+
+	if generated {
+		log.Printf("Created user \"admin\" with password %q - change it after logging in", password)
+	} else {
+		log.Println("Created user \"admin\" with the password from ADMIN_PASSWORD")
+	}
+	return nil
+}
+
+// loginRequest is the body of POST /api/login
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Only needed for users with two-factor authentication turned on
+	Code string `json:"code"`
+}
+
+// loginResponse is who logged in
+type loginResponse struct {
+	Username string    `json:"username"`
+	Role     auth.Role `json:"role"`
+}
+
+// loginOptionsResponse is which ways of logging in the login screen offers
+type loginOptionsResponse struct {
+	Password bool `json:"password"`
+	OIDC     bool `json:"oidc"`
+	// What to call the single sign-on button
+	OIDCName string `json:"oidc_name,omitempty"`
+}
+
+// meResponse is the logged in user, as the web UI needs them
+type meResponse struct {
+	Username string    `json:"username"`
+	Role     auth.Role `json:"role"`
+	// The cameras they can watch
+	Cameras []string `json:"cameras"`
+	TOTP    bool     `json:"totp_enabled"`
+	// Set when the server runs without logins, so the UI hides logging out
+	AuthDisabled bool `json:"auth_disabled"`
+}
+
+// changePasswordRequest is the body of POST /api/password
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// handleLogin checks a username/password and sets the session cookie.
+// POST /api/login {"username": "...", "password": "..."}
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var credentials loginRequest
+	err := json.NewDecoder(r.Body).Decode(&credentials)
+	if err != nil {
+		http.Error(w, "Failed to decode login request", http.StatusBadRequest)
+		return
+	}
+
+	if !s.checkLockout(w, r, credentials.Username) {
+		return
+	}
+
+	user, err := s.users.Authenticate(credentials.Username, credentials.Password)
+	if err != nil {
+		log.Printf("Failed login for %q from %s", credentials.Username, s.clientIP(r))
+		s.recordLoginFailure(r, credentials.Username)
+		s.recordAudit(r, audit.Entry{User: credentials.Username, Action: audit.ActionLoginFailed})
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+
+	if user.HasTOTP() {
+		// The header tells the login screen to ask for the code and try again
+		if credentials.Code == "" {
+			w.Header().Set("X-TOTP-Required", "true")
+			http.Error(w, "Two-factor code required", http.StatusUnauthorized)
+			return
+		}
+		err = s.users.CheckTOTP(user.Username, credentials.Code)
+		if err != nil {
+			log.Printf("Wrong two-factor code for %q from %s", user.Username, s.clientIP(r))
+			s.recordLoginFailure(r, user.Username)
+			s.recordAudit(r, audit.Entry{User: user.Username, Action: audit.ActionLoginFailed, Detail: "wrong two-factor code"})
+			w.Header().Set("X-TOTP-Required", "true")
+			http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+			return
+		}
+	}
+	s.recordLoginSuccess(r, credentials.Username)
+
+	err = s.startSession(w, r, user.Username)
+	if err != nil {
+		log.Printf("Failed to create session: %v", err)
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %s logged in from %s", user.Username, s.clientIP(r))
+	s.recordAudit(r, audit.Entry{User: user.Username, Action: audit.ActionLogin})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(loginResponse{Username: user.Username, Role: user.Role})
+}
+
+// startSession creates a session for a user and sets the session cookie
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, username string) error {
+	session, err := s.sessions.Create(username)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    session.Token,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true, // JavaScript can't read it, so XSS can't steal it
+		Secure:   s.isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// handleLoginOptions tells the login screen which ways of logging in are available.
+// GET /api/login/options
+func (s *Server) handleLoginOptions(w http.ResponseWriter, r *http.Request) {
+	options := loginOptionsResponse{Password: true, OIDC: s.oidcProvider != nil}
+	if s.oidcProvider != nil {
+		options.OIDCName = s.oidcProvider.Name()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(options)
+}
+
+// handleLogout ends the current session
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cookie, err := r.Cookie(sessionCookieName)
+	if err == nil {
+		if session := s.sessions.Get(cookie.Value); session != nil {
+			s.recordAudit(r, audit.Entry{User: session.Username, Action: audit.ActionLogout})
+		}
+		s.sessions.Delete(cookie.Value)
+	}
+
+	// Expire the cookie in the browser too
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMe returns the logged in user. The web UI uses it to decide whether to show the login screen.
+func (s *Server) handleMe(w http.ResponseWriter, r *http.Request) {
+	user := s.requestUser(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(meResponse{
+		Username:     user.Username,
+		Role:         user.Role,
+		Cameras:      user.VisibleCameras(),
+		TOTP:         user.HasTOTP(),
+		AuthDisabled: s.authDisabled,
+	})
+}
+
+// handleChangePassword lets the logged in user change their own password.
+// POST /api/password {"current_password": "...", "new_password": "..."}
+func (s *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body changePasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, "Failed to decode request", http.StatusBadRequest)
+		return
+	}
+
+	// A stolen session shouldn't be a way to brute force the password either
+	username := currentUser(r)
+	if !s.checkLockout(w, r, username) {
+		return
+	}
+	_, err = s.users.Authenticate(username, body.CurrentPassword)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		s.recordLoginFailure(r, username)
+		http.Error(w, "Current password is wrong", http.StatusForbidden)
+		return
+	}
+
+	if len(body.NewPassword) < 8 {
+		http.Error(w, "New password must be at least 8 characters", http.StatusBadRequest)
+		return
+	}
+
+	err = s.users.SetPassword(username, body.NewPassword)
+	if err != nil {
+		log.Printf("Failed to change password for %s: %v", username, err)
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+	s.recordAudit(r, audit.Entry{Action: audit.ActionPasswordChanged, Target: username})
+
+	w.WriteHeader(http.StatusNoContent)
+}
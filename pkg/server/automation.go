@@ -0,0 +1,72 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/nisarg-dave/camera-viewer/internal/audit"
+	"github.com/nisarg-dave/camera-viewer/internal/notify"
+	"github.com/nisarg-dave/camera-viewer/internal/rules"
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+)
+
+// newRuleEngine creates the rules engine and registers the actions rules can use.
+// Recording and PTZ actions will be registered here once those features exist.
+func (s *Server) newRuleEngine(ruleConfigs []config.Rule, webhooks map[string]*notify.Webhook, notifiers map[string]*notify.ChatNotifier) (*rules.Engine, error) {
+	engine := rules.NewEngine(ruleConfigs)
+
+	engine.RegisterAction("webhook", func(action config.RuleAction, e events.Event) error {
+		webhook, ok := webhooks[action.Target]
+		if !ok {
+			return fmt.Errorf("no webhook named %q", action.Target)
+		}
+		return webhook.Send(e, s.ctx.Done())
+	})
+
+	engine.RegisterAction("notify", func(action config.RuleAction, e events.Event) error {
+		notifier, ok := notifiers[action.Target]
+		if !ok {
+			return fmt.Errorf("no notifier named %q", action.Target)
+		}
+		return notifier.Notify(e)
+	})
+
+	engine.RegisterAction("enable_camera", func(action config.RuleAction, e events.Event) error {
+		return s.auditedCameraCommand("rule", audit.ActionCameraEnabled, s.enableCamera)(actionCamera(action, e), action.Arg)
+	})
+
+	engine.RegisterAction("disable_camera", func(action config.RuleAction, e events.Event) error {
+		return s.auditedCameraCommand("rule", audit.ActionCameraDisabled, s.disableCamera)(actionCamera(action, e), action.Arg)
+	})
+
+	err := engine.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	// Catch references to webhooks/notifiers that don't exist now rather than when the rule fires
+	for _, rule := range ruleConfigs {
+		for _, action := range rule.Actions {
+			switch action.Type {
+			case "webhook":
+				if _, ok := webhooks[action.Target]; !ok {
+					return nil, fmt.Errorf("rule %q: no webhook named %q", rule.Name, action.Target)
+				}
+			case "notify":
+				if _, ok := notifiers[action.Target]; !ok {
+					return nil, fmt.Errorf("rule %q: no notifier named %q", rule.Name, action.Target)
+				}
+			}
+		}
+	}
+
+	return engine, nil
+}
+
+// actionCamera is the camera an action applies to: its target, or the camera the event came from
+func actionCamera(action config.RuleAction, e events.Event) string {
+	if action.Target != "" {
+		return action.Target
+	}
+	return e.Camera
+}
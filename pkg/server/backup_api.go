@@ -0,0 +1,180 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/audit"
+	"github.com/nisarg-dave/camera-viewer/internal/backup"
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+)
+
+// minBackupPassphrase is the shortest passphrase an export's secrets are encrypted with
+const minBackupPassphrase = 12
+
+// maxBackupSize is the largest backup POST /api/config/import reads
+const maxBackupSize = 10 << 20
+
+// exportRequest is the body of POST /api/config/export
+type exportRequest struct {
+	// Encrypts the secrets instead of redacting them, at least 12 characters
+	Passphrase string `json:"passphrase"`
+}
+
+// importRequest is the body of POST /api/config/import
+type importRequest struct {
+	// Needed when the backup's secrets are encrypted
+	Passphrase string          `json:"passphrase"`
+	Backup     backup.Document `json:"backup"`
+}
+
+// importResponse says what an import changed
+type importResponse struct {
+	UsersAdded   int `json:"users_added"`
+	UsersUpdated int `json:"users_updated"`
+	// Local users whose password was redacted in the backup, who can't log in until an admin sets one
+	UsersWithoutPassword []string `json:"users_without_password"`
+	// The config file that was written. The one it replaced is kept with .bak on the end.
+	ConfigFile string `json:"config_file"`
+	// The imported config takes effect when the server restarts, unlike the users, which already have
+	RestartRequired bool `json:"restart_required"`
+}
+
+// handleConfigExport sends the config and the user accounts as one JSON document, for backups and
+// for moving to a new machine. Secrets are redacted, or with a passphrase, encrypted. Admin only.
+// GET  /api/config/export
+// POST /api/config/export {"passphrase": "..."}
+func (s *Server) handleConfigExport(w http.ResponseWriter, r *http.Request) {
+	var passphrase string
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var body exportRequest
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			http.Error(w, "Failed to decode export request", http.StatusBadRequest)
+			return
+		}
+		if len(body.Passphrase) < minBackupPassphrase {
+			http.Error(w, fmt.Sprintf("The passphrase must be at least %d characters", minBackupPassphrase), http.StatusBadRequest)
+			return
+		}
+		passphrase = body.Passphrase
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg, err := s.fileConfig()
+	if err != nil {
+		log.Printf("Failed to export config: %v", err)
+		http.Error(w, "Failed to export config", http.StatusInternalServerError)
+		return
+	}
+	doc, err := backup.Export(cfg, s.users.List(), []backup.Camera{s.backupCamera}, passphrase)
+	if err != nil {
+		log.Printf("Failed to export config: %v", err)
+		http.Error(w, "Failed to export config", http.StatusInternalServerError)
+		return
+	}
+
+	detail := "secrets redacted"
+	if passphrase != "" {
+		detail = "secrets encrypted"
+	}
+	log.Printf("User %s exported the config (%s)", currentUser(r), detail)
+	s.recordAudit(r, audit.Entry{Action: audit.ActionConfigExported, Detail: detail})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="camera-viewer-backup-%s.json"`, doc.ExportedAt.Format(time.DateOnly)))
+	json.NewEncoder(w).Encode(doc)
+}
+
+// handleConfigImport restores a backup from handleConfigExport. Users are added or replaced straight
+// away, and the config file is replaced, taking effect on the next restart. Admin only.
+// POST /api/config/import {"passphrase": "...", "backup": {...}}
+func (s *Server) handleConfigImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body importRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBackupSize)).Decode(&body)
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, "INVALID_BACKUP", "failed to decode backup: "+err.Error(), nil)
+		return
+	}
+
+	// Redacted secrets are taken from the file as written, so a ${NAME} placeholder stays one
+	// instead of the secret it stands for ending up in the file
+	current, err := s.fileConfig()
+	if err != nil {
+		log.Printf("Failed to read the config file to import into: %v", err)
+		http.Error(w, "Failed to read the current config", http.StatusInternalServerError)
+		return
+	}
+
+	doc := &body.Backup
+	err = doc.Open(body.Passphrase, current, s.users.List())
+	switch {
+	case errors.Is(err, backup.ErrPassphraseRequired):
+		writeAPIError(w, r, http.StatusBadRequest, "BACKUP_PASSPHRASE_REQUIRED", err.Error(), nil)
+		return
+	case errors.Is(err, backup.ErrWrongPassphrase):
+		writeAPIError(w, r, http.StatusBadRequest, "BACKUP_PASSPHRASE_WRONG", backup.ErrWrongPassphrase.Error(), nil)
+		return
+	case err != nil:
+		writeAPIError(w, r, http.StatusBadRequest, "INVALID_BACKUP", err.Error(), nil)
+		return
+	}
+
+	added, updated, err := s.users.Import(doc.Users)
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, "INVALID_BACKUP", err.Error(), nil)
+		return
+	}
+
+	err = config.Save(s.configPath, &doc.Config)
+	if err != nil {
+		log.Printf("Failed to save imported config: %v", err)
+		http.Error(w, "Failed to save the imported config", http.StatusInternalServerError)
+		return
+	}
+
+	response := importResponse{
+		UsersAdded:           added,
+		UsersUpdated:         updated,
+		UsersWithoutPassword: []string{},
+		ConfigFile:           s.configPath,
+		RestartRequired:      true,
+	}
+	for _, user := range doc.Users {
+		if user.Source == "" && user.PasswordHash == "" {
+			response.UsersWithoutPassword = append(response.UsersWithoutPassword, user.Username)
+		}
+	}
+
+	log.Printf("User %s imported a backup from %s: %d user(s) added, %d updated, config written to %s",
+		currentUser(r), doc.ExportedAt.Format(time.RFC3339), added, updated, s.configPath)
+	s.recordAudit(r, audit.Entry{
+		Action: audit.ActionConfigImported,
+		Detail: fmt.Sprintf("backup from %s, %d user(s) added, %d updated", doc.ExportedAt.Format(time.RFC3339), added, updated),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// fileConfig returns the config as its file is written, with ${NAME} placeholders and without defaults,
+// which is what backups hold. A server given its config without a file only has the one it loaded.
+func (s *Server) fileConfig() (*config.Config, error) {
+	if s.configPath == "" {
+		return s.loadedConfig, nil
+	}
+	return config.LoadRaw(s.configPath)
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+)
+
+// TestConfigImportKeepsPlaceholders restores a redacted backup where it was made and checks the
+// config file still has its ${NAME} placeholder, not the secret from the environment, and that the
+// defaults the server runs with weren't written into it. The file it replaced is kept as config.json.bak.
+func TestConfigImportKeepsPlaceholders(t *testing.T) {
+	t.Setenv("TEST_METRICS_TOKEN", "token-from-the-environment")
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	original := []byte(`{"metrics": {"bearer_token": "${TEST_METRICS_TOKEN}"}}`)
+	err := os.WriteFile(configPath, original, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DataDir = t.TempDir()
+	cfg.Auth.Disabled = true
+
+	srv, err := New(Options{
+		Config:      cfg,
+		ConfigPath:  configPath,
+		Camera:      Camera{ID: "front", URL: "rtsp://127.0.0.1:1/stream"},
+		NoListeners: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Error("the server didn't shut down")
+		}
+	}()
+
+	w := httptest.NewRecorder()
+	srv.handleConfigExport(w, httptest.NewRequest(http.MethodGet, "/api/config/export", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("export: got %d: %s", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), "token-from-the-environment") {
+		t.Error("the export has the secret from the environment in it")
+	}
+
+	body, _ := json.Marshal(map[string]json.RawMessage{"backup": w.Body.Bytes()})
+	w = httptest.NewRecorder()
+	srv.handleConfigImport(w, httptest.NewRequest(http.MethodPost, "/api/config/import", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("import: got %d: %s", w.Code, w.Body)
+	}
+
+	saved, err := config.LoadRaw(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Metrics.BearerToken != "${TEST_METRICS_TOKEN}" {
+		t.Errorf("bearer_token was written as %q, want the placeholder", saved.Metrics.BearerToken)
+	}
+	if saved.DataDir != "" || saved.Auth.SessionTTL != 0 {
+		t.Errorf("defaults were written to the config file: data_dir %q, session_ttl %s", saved.DataDir, time.Duration(saved.Auth.SessionTTL))
+	}
+
+	bak, err := os.ReadFile(configPath + ".bak")
+	if err != nil || !bytes.Equal(bak, original) {
+		t.Errorf("config.json.bak is %q (%v), want the file that was replaced", bak, err)
+	}
+}
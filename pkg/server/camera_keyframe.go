@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/onvif"
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+)
+
+// cameraKeyframeTimeout is how long the camera gets to answer a keyframe request
+const cameraKeyframeTimeout = 5 * time.Second
+
+// cameraKeyframes asks the camera for a keyframe, at most once per MinInterval however many viewers
+// ask, so a room full of viewers on a lossy network doesn't turn the camera into all keyframes
+type cameraKeyframes struct {
+	request     func(ctx context.Context) error
+	minInterval time.Duration
+	last        atomic.Int64 // Unix nanoseconds of the last request
+	running     atomic.Bool
+}
+
+// newCameraKeyframes validates the keyframe request config and logs in to the camera with username and password
+func newCameraKeyframes(cfg config.KeyframeRequest, username, password string) (*cameraKeyframes, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+	client := &http.Client{Timeout: cameraKeyframeTimeout}
+	k := &cameraKeyframes{minInterval: time.Duration(cfg.MinInterval)}
+
+	switch cfg.Type {
+	case "onvif":
+		if cfg.ProfileToken == "" {
+			return nil, fmt.Errorf("profile_token is required for onvif")
+		}
+		camera := &onvif.Client{URL: cfg.URL, Username: username, Password: password, HTTP: client}
+		k.request = func(ctx context.Context) error {
+			return camera.SetSynchronizationPoint(ctx, cfg.ProfileToken)
+		}
+	case "http":
+		k.request = func(ctx context.Context) error {
+			req, err := http.NewRequestWithContext(ctx, cfg.Method, cfg.URL, nil)
+			if err != nil {
+				return fmt.Errorf("failed to create request: %w", err)
+			}
+			req.SetBasicAuth(username, password)
+			resp, err := client.Do(req)
+			if err != nil {
+				return fmt.Errorf("failed to call camera: %w", err)
+			}
+			defer resp.Body.Close()
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			if resp.StatusCode/100 != 2 {
+				return fmt.Errorf("camera answered %s", resp.Status)
+			}
+			return nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q, expected \"onvif\" or \"http\"", cfg.Type)
+	}
+	return k, nil
+}
+
+// Request asks the camera for a keyframe in the background, unless it was asked too recently or is
+// still answering the last request. It never blocks, since it is called from viewers' RTCP goroutines.
+func (k *cameraKeyframes) Request() {
+	now := time.Now().UnixNano()
+	last := k.last.Load()
+	if now-last < int64(k.minInterval) || !k.last.CompareAndSwap(last, now) {
+		return
+	}
+	if !k.running.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer k.running.Store(false)
+		ctx, cancel := context.WithTimeout(context.Background(), cameraKeyframeTimeout)
+		defer cancel()
+		err := k.request(ctx)
+		if err != nil {
+			log.Printf("Failed to request a keyframe from the camera: %v", err)
+		}
+	}()
+}
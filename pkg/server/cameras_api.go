@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/stream"
+)
+
+// cameraStatus is a camera's entry in GET /api/cameras
+type cameraStatus struct {
+	ID string `json:"id"`
+	// connected, connecting or disabled, see supervisor.Camera.State
+	State string `json:"state"`
+	// Whether a packet arrived within the stall timeout
+	Healthy bool `json:"healthy"`
+	// H264, H265, AV1 or MPEG4, empty until the camera has connected for the first time
+	Codec string `json:"codec,omitempty"`
+	// From the camera's SPS, zero until it has sent one
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// Measured from the arriving video
+	BitrateBps float64   `json:"bitrate_bps"`
+	FPS        float64   `json:"fps"`
+	Viewers    int       `json:"viewers"`
+	LastPacket time.Time `json:"last_packet,omitzero"`
+	// Whether viewers are sent a transcoded H264 copy
+	Transcoding bool `json:"transcoding"`
+	// Why the last connect failed, see cameraErrorCode. Empty once it has connected.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// currentCameraStatus puts together what the dashboard shows about a camera
+func (s *Server) currentCameraStatus(camera string) cameraStatus {
+	ingest := s.streamMonitor.Ingest()
+	status := cameraStatus{
+		ID:          camera,
+		State:       s.cameraSupervisor.State(),
+		Healthy:     !ingest.LastPacket.IsZero() && time.Since(ingest.LastPacket) < s.streamMonitor.StallTimeout(),
+		BitrateBps:  ingest.BitrateBps,
+		FPS:         ingest.FPS,
+		Viewers:     s.cameraViewers(camera),
+		LastPacket:  ingest.LastPacket,
+		Transcoding: s.viewerSessions.Transcoding(camera),
+		LastError:   cameraErrorCode(s.cameraSupervisor.LastError()),
+	}
+	status.Codec, _ = s.videoCodec.Load().(string)
+	if video, ok := s.videoSource.VideoInfo(); ok {
+		status.Width = video.Width
+		status.Height = video.Height
+	}
+	return status
+}
+
+// cameraErrorCode names the kind of error a camera failed to connect with, for API responses:
+// CAMERA_AUTH_FAILED, CAMERA_UNREACHABLE, CODEC_UNSUPPORTED, or CONNECT_FAILED for anything else.
+// The error's message isn't given out since it can quote the camera's URL.
+func cameraErrorCode(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, stream.ErrAuthFailed):
+		return "CAMERA_AUTH_FAILED"
+	case errors.Is(err, stream.ErrCameraUnreachable):
+		return "CAMERA_UNREACHABLE"
+	case errors.Is(err, stream.ErrUnsupportedCodec):
+		return "CODEC_UNSUPPORTED"
+	}
+	return "CONNECT_FAILED"
+}
+
+// cameraOfflineDetails are the details of a CAMERA_OFFLINE error: what the camera is doing,
+// and as reason, why its last connect failed if it did
+func cameraOfflineDetails(state string, err error) map[string]any {
+	details := map[string]any{"state": state}
+	if code := cameraErrorCode(err); code != "" {
+		details["reason"] = code
+	}
+	return details
+}
+
+// cameraViewers counts the open viewer sessions watching camera
+func (s *Server) cameraViewers(camera string) int {
+	count := 0
+	for _, session := range s.viewerSessions.List() {
+		if session.Camera == camera {
+			count++
+		}
+	}
+	return count
+}
+
+// handleCameras lists the cameras the user can view with their connection state, video format,
+// bitrate and viewer count, for a dashboard. Poll it, or use /api/stats/ws for live numbers.
+// GET /api/cameras
+func (s *Server) handleCameras(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cameras := []cameraStatus{}
+	if s.canViewCamera(r, s.cameraID) {
+		cameras = append(cameras, s.currentCameraStatus(s.cameraID))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cameras)
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/capture"
+	"github.com/nisarg-dave/camera-viewer/pkg/viewers"
+
+	"github.com/pion/rtp"
+)
+
+const (
+	// defaultCaptureDuration and maxCaptureDuration bound GET /api/debug/capture
+	defaultCaptureDuration = 10 * time.Second
+	maxCaptureDuration     = time.Minute
+	// maxCaptureBytes is the most a capture holds. It is kept in memory, so a slow download
+	// can't hold up the camera, and packets past this are left out.
+	maxCaptureBytes = 64 << 20
+)
+
+// packetCapture collects the camera's packets, and optionally those sent to viewers, into a file
+type packetCapture struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	writer  capture.Writer
+	stopped bool
+	// Packets left out because the capture was full
+	dropped int
+	// Viewer sessions by ID, numbered in the order they were first seen, for their flows
+	viewers map[string]int
+}
+
+// write adds a packet along flow, unless the capture has stopped or is full
+func (c *packetCapture) write(pkt *rtp.Packet, flow capture.Flow) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return
+	}
+	if c.buf.Len() >= maxCaptureBytes {
+		c.dropped++
+		return
+	}
+	c.writer.WritePacket(pkt, flow, time.Now())
+}
+
+// writeSent adds a packet sent to a viewer session
+func (c *packetCapture) writeSent(s *viewers.Session, pkt *rtp.Packet) {
+	c.mu.Lock()
+	n, ok := c.viewers[s.ID]
+	if !ok {
+		n = len(c.viewers)
+		c.viewers[s.ID] = n
+	}
+	c.mu.Unlock()
+	c.write(pkt, capture.Viewer(n))
+}
+
+// stop ends the capture; packets that arrive after it returns are ignored
+func (c *packetCapture) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopped = true
+}
+
+// capturePacket adds a packet from the camera to the running capture, if there is one
+func (s *Server) capturePacket(pkt *rtp.Packet) {
+	c := s.activeCapture.Load()
+	if c != nil {
+		c.write(pkt, capture.Camera)
+	}
+}
+
+// handleDebugCapture records the camera's RTP for a while and returns it as a pcap file (or
+// rtpdump with format=rtpdump), for bug reports about codecs and packetization. With viewers=1
+// a pcap also holds what each viewer was sent, before the WebRTC library's SRTP, as flows of
+// their own. One capture runs at a time. Admins only.
+// GET /api/debug/capture
+func (s *Server) handleDebugCapture(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	duration := defaultCaptureDuration
+	if value := query.Get("duration"); value != "" {
+		var err error
+		duration, err = time.ParseDuration(value)
+		if err != nil || duration <= 0 || duration > maxCaptureDuration {
+			writeAPIError(w, r, http.StatusBadRequest, "INVALID_DURATION",
+				fmt.Sprintf("duration must be a duration up to %s, like 10s", maxCaptureDuration), nil)
+			return
+		}
+	}
+	format := query.Get("format")
+	if format == "" {
+		format = capture.FormatPcap
+	}
+	if format != capture.FormatPcap && format != capture.FormatRTPDump {
+		writeAPIError(w, r, http.StatusBadRequest, "INVALID_FORMAT", "format must be pcap or rtpdump", nil)
+		return
+	}
+	withViewers := query.Get("viewers") == "1"
+	if withViewers && format != capture.FormatPcap {
+		writeAPIError(w, r, http.StatusBadRequest, "INVALID_FORMAT", "an rtpdump file only holds the camera's packets, use pcap for viewers=1", nil)
+		return
+	}
+
+	start := time.Now()
+	c := &packetCapture{viewers: make(map[string]int)}
+	var err error
+	c.writer, err = capture.NewWriter(format, &c.buf, start)
+	if err != nil {
+		writeAPIError(w, r, http.StatusInternalServerError, "INTERNAL", err.Error(), nil)
+		return
+	}
+	if !s.activeCapture.CompareAndSwap(nil, c) {
+		writeAPIError(w, r, http.StatusConflict, "CAPTURE_RUNNING", "another capture is running", nil)
+		return
+	}
+	if withViewers {
+		s.viewerSessions.OnPacketSent(c.writeSent)
+	}
+
+	timer := time.NewTimer(duration)
+	select {
+	case <-timer.C:
+	case <-r.Context().Done():
+		timer.Stop()
+	}
+	if withViewers {
+		s.viewerSessions.OnPacketSent(nil)
+	}
+	s.activeCapture.Store(nil)
+	c.stop()
+	if r.Context().Err() != nil {
+		return
+	}
+
+	if c.dropped > 0 {
+		w.Header().Set("X-Capture-Dropped", strconv.Itoa(c.dropped))
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.%s"`, s.cameraID, start.UTC().Format("20060102T150405Z"), format))
+	w.Header().Set("Content-Length", strconv.Itoa(c.buf.Len()))
+	w.Write(c.buf.Bytes())
+}
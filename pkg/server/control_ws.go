@@ -0,0 +1,436 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/audit"
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+	"github.com/nisarg-dave/camera-viewer/pkg/viewers"
+
+	"github.com/gorilla/websocket"
+)
+
+// controlMessage is every message on the control WebSocket, in both directions. A request's ID is
+// copied to its reply so the two can be matched up; pushed messages (event, stats) have none.
+type controlMessage struct {
+	Type  string          `json:"type"`
+	ID    string          `json:"id,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error *apiError       `json:"error,omitempty"`
+}
+
+// controlOffer is the data of an offer message
+type controlOffer struct {
+	Camera string `json:"camera"`
+	// Only connect through TURN, like ?relay=1
+	Relay bool `json:"relay"`
+}
+
+// controlAnswer is the data of an answer message
+type controlAnswer struct {
+	answerRequest
+	Camera string `json:"camera"`
+	// Reply once the connection is up or has failed, like ?wait=1
+	Wait bool `json:"wait"`
+}
+
+// controlCloseSession is the data of a close_session message
+type controlCloseSession struct {
+	SessionID string `json:"session_id"`
+}
+
+// controlSubscribe is the data of a subscribe or unsubscribe message
+type controlSubscribe struct {
+	// "events" or "stats"
+	Channel string `json:"channel"`
+	// For events: only this camera's, and only these types. Empty means all.
+	Camera string   `json:"camera,omitempty"`
+	Types  []string `json:"types,omitempty"`
+	// For stats: how often a snapshot is sent, e.g. "2s". Defaults to 2s, at least 500ms.
+	Interval string `json:"interval,omitempty"`
+}
+
+// controlCommand is the data of a command message
+type controlCommand struct {
+	Camera  string `json:"camera"`
+	Command string `json:"command"`
+	Arg     string `json:"arg,omitempty"`
+}
+
+// controlCommands are the camera commands a command message can run, like MQTT's. PTZ commands
+// will be added here once cameras can be moved.
+var controlCommands = map[string]struct {
+	action audit.Action
+	run    func(s *Server, camera, arg string) error
+}{
+	"enable":  {audit.ActionCameraEnabled, (*Server).enableCamera},
+	"disable": {audit.ActionCameraDisabled, (*Server).disableCamera},
+}
+
+// controlConn is one control WebSocket. Requests are handled concurrently, since an answer that
+// waits for the connection can take a while, so writes go through send.
+type controlConn struct {
+	server *Server
+	conn   *websocket.Conn
+	// The upgrade request, which says who is connected
+	r *http.Request
+	// Answers the offer and answer messages
+	signaling *signaling
+
+	writeMu sync.Mutex
+
+	mu sync.Mutex
+	// Stops each subscribed channel's pushes, by channel
+	subscriptions map[string]context.CancelFunc
+}
+
+// controlSocket serves one WebSocket that carries everything a viewer page needs, instead of
+// a request per offer and answer, an event stream and a stats socket. See the README for the messages.
+// GET /api/ws
+//
+// In the browser: ws.send(JSON.stringify({type: "offer", id: "1", data: {camera: "driveway"}}))
+func (s *Server) controlSocket(sig *signaling) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.handleControlSocket(w, r, sig)
+	}
+}
+
+func (s *Server) handleControlSocket(w http.ResponseWriter, r *http.Request, sig *signaling) {
+	conn, err := s.statsUpgrader().Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written an error response
+		log.Printf("Failed to upgrade control WebSocket: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// Requests and subscriptions stop with ctx, which is cancelled before waiting for them
+	var requests sync.WaitGroup
+	defer requests.Wait()
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	c := &controlConn{server: s, conn: conn, r: r, signaling: sig, subscriptions: make(map[string]context.CancelFunc)}
+
+	go func() {
+		<-ctx.Done()
+		if r.Context().Err() != nil {
+			// The server is shutting down
+			c.writeMu.Lock()
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(time.Second))
+			c.writeMu.Unlock()
+			conn.Close()
+		}
+	}()
+
+	for {
+		var message controlMessage
+		err := conn.ReadJSON(&message)
+		if err != nil {
+			return
+		}
+		requests.Go(func() {
+			c.handle(ctx, message)
+		})
+	}
+}
+
+// send writes a message, one at a time as gorilla/websocket requires
+func (c *controlConn) send(message controlMessage) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return c.conn.WriteJSON(message)
+}
+
+// reply answers a request with data, sent as JSON
+func (c *controlConn) reply(request controlMessage, data any) {
+	message := controlMessage{Type: request.Type, ID: request.ID}
+	if data != nil {
+		message.Data, _ = json.Marshal(data)
+	}
+	c.send(message)
+}
+
+// replyError answers a request with an error
+func (c *controlConn) replyError(request controlMessage, code, text string, details map[string]any) {
+	c.send(controlMessage{Type: "error", ID: request.ID, Error: &apiError{Code: code, Message: text, Details: details}})
+}
+
+// handle does what a message from the client asks
+func (c *controlConn) handle(ctx context.Context, message controlMessage) {
+	switch message.Type {
+	case "ping":
+		c.reply(message, nil)
+
+	case "offer":
+		var data controlOffer
+		if !c.decode(message, &data) {
+			return
+		}
+		query := url.Values{"camera": {data.Camera}}
+		if data.Relay {
+			query.Set("relay", "1")
+		}
+		c.callHandler(ctx, message, c.server.rateLimited(c.server.signalingLimiter, c.signaling.handleOffer), http.MethodPost, "/offer?"+query.Encode(), nil, nil)
+
+	case "answer":
+		var data controlAnswer
+		if !c.decode(message, &data) {
+			return
+		}
+		query := url.Values{"camera": {data.Camera}}
+		if data.Wait {
+			query.Set("wait", "1")
+		}
+		c.callHandler(ctx, message, c.server.rateLimited(c.server.signalingLimiter, c.signaling.handleAnswer), http.MethodPost, "/answer?"+query.Encode(), data.answerRequest, nil)
+
+	case "close_session":
+		var data controlCloseSession
+		if !c.decode(message, &data) {
+			return
+		}
+		c.callHandler(ctx, message, c.server.handleSession, http.MethodDelete, "/sessions/"+url.PathEscape(data.SessionID), nil,
+			map[string]string{"id": data.SessionID})
+
+	case "subscribe":
+		var data controlSubscribe
+		if !c.decode(message, &data) {
+			return
+		}
+		c.subscribe(ctx, message, data)
+
+	case "unsubscribe":
+		var data controlSubscribe
+		if !c.decode(message, &data) {
+			return
+		}
+		c.mu.Lock()
+		if stop, ok := c.subscriptions[data.Channel]; ok {
+			stop()
+			delete(c.subscriptions, data.Channel)
+		}
+		c.mu.Unlock()
+		c.reply(message, nil)
+
+	case "command":
+		var data controlCommand
+		if !c.decode(message, &data) {
+			return
+		}
+		c.command(message, data)
+
+	default:
+		c.replyError(message, "UNKNOWN_MESSAGE_TYPE", "unknown message type "+message.Type, nil)
+	}
+}
+
+// decode reads a message's data, answering with an error when it doesn't fit
+func (c *controlConn) decode(message controlMessage, data any) bool {
+	if len(message.Data) == 0 {
+		return true
+	}
+	err := json.Unmarshal(message.Data, data)
+	if err != nil {
+		c.replyError(message, "INVALID_REQUEST", "the message's data doesn't fit its type: "+err.Error(), nil)
+		return false
+	}
+	return true
+}
+
+// callHandler runs one of the HTTP API's handlers as if the request had been made to /api/v1, as
+// the connected user, and replies with its response. That way a message behaves exactly like the
+// request it stands for, rate limits and error codes included.
+func (c *controlConn) callHandler(ctx context.Context, message controlMessage, handler http.HandlerFunc, method, target string, body any, pathValues map[string]string) {
+	var reader bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader.Reset(data)
+	}
+
+	r, err := http.NewRequestWithContext(context.WithValue(ctx, apiVersionContextKey, 1), method, "/api/v1"+target, &reader)
+	if err != nil {
+		c.replyError(message, "INVALID_REQUEST", err.Error(), nil)
+		return
+	}
+	r.Header = c.r.Header.Clone()
+	r.Header.Set("Content-Type", "application/json")
+	r.RemoteAddr = c.r.RemoteAddr
+	r.Host = c.r.Host
+	for name, value := range pathValues {
+		r.SetPathValue(name, value)
+	}
+
+	w := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+	handler(w, r)
+
+	if w.status < 400 {
+		c.send(controlMessage{Type: message.Type, ID: message.ID, Data: bytes.TrimSpace(w.body.Bytes())})
+		return
+	}
+
+	// writeAPIError's errors are already in shape, plain text ones from http.Error aren't
+	var shaped struct {
+		Error *apiError `json:"error"`
+	}
+	if strings.HasPrefix(w.header.Get("Content-Type"), "application/json") && json.Unmarshal(w.body.Bytes(), &shaped) == nil && shaped.Error != nil {
+		c.send(controlMessage{Type: "error", ID: message.ID, Error: shaped.Error})
+		return
+	}
+	c.replyError(message, errorCode(w.status), strings.TrimSpace(w.body.String()), nil)
+}
+
+// subscribe starts pushing a channel's messages until it is unsubscribed or the socket closes
+func (c *controlConn) subscribe(ctx context.Context, message controlMessage, data controlSubscribe) {
+	var push func(ctx context.Context)
+	switch data.Channel {
+	case "events":
+		// Like /api/events/stream, events aren't for share links
+		if _, ok := c.r.Context().Value(shareContextKey).(string); ok {
+			c.replyError(message, "FORBIDDEN", "events need a logged in user", nil)
+			return
+		}
+		filter := events.Filter{Camera: data.Camera, Cameras: c.server.requestUser(c.r).VisibleCameras()}
+		for _, t := range data.Types {
+			filter.Types = append(filter.Types, events.Type(t))
+		}
+		sub := c.server.eventBus.SubscribeWithUpdates(32, filter.Match)
+		push = func(ctx context.Context) {
+			defer sub.Close()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case event, ok := <-sub.C:
+					if !ok {
+						return
+					}
+					payload, _ := json.Marshal(event)
+					if c.send(controlMessage{Type: "event", Data: payload}) != nil {
+						return
+					}
+				}
+			}
+		}
+
+	case "stats":
+		interval := defaultStatsInterval
+		if data.Interval != "" {
+			parsed, err := time.ParseDuration(data.Interval)
+			if err != nil || parsed < minStatsInterval {
+				c.replyError(message, "INVALID_REQUEST", "interval must be a duration of at least "+minStatsInterval.String(), nil)
+				return
+			}
+			interval = parsed
+		}
+		admin := c.server.requestUser(c.r).IsAdmin()
+		user := currentUser(c.r)
+		tracker := c.server.newStatsTracker(c.server.canViewCamera(c.r, c.server.cameraID), func(s *viewers.Session) bool {
+			return admin || s.User == user
+		})
+		push = func(ctx context.Context) {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				payload, _ := json.Marshal(tracker.snapshot())
+				if c.send(controlMessage{Type: "stats", Data: payload}) != nil {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}
+
+	default:
+		c.replyError(message, "INVALID_REQUEST", `channel must be "events" or "stats"`, nil)
+		return
+	}
+
+	pushCtx, stop := context.WithCancel(ctx)
+	c.mu.Lock()
+	// Subscribing again replaces the previous subscription, e.g. to change the filter
+	if previous, ok := c.subscriptions[data.Channel]; ok {
+		previous()
+	}
+	c.subscriptions[data.Channel] = stop
+	c.mu.Unlock()
+
+	c.reply(message, nil)
+	push(pushCtx)
+}
+
+// command runs a camera command, like the MQTT command topic. Admin only.
+func (c *controlConn) command(message controlMessage, data controlCommand) {
+	if !c.server.requestUser(c.r).IsAdmin() {
+		c.replyError(message, "FORBIDDEN", "camera commands are for admins", nil)
+		return
+	}
+	if data.Camera == "" {
+		data.Camera = c.server.cameraID
+	}
+	if data.Camera != c.server.cameraID {
+		c.replyError(message, "CAMERA_NOT_FOUND", "camera not found", nil)
+		return
+	}
+	command, ok := controlCommands[data.Command]
+	if !ok {
+		names := make([]string, 0, len(controlCommands))
+		for name := range controlCommands {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		c.replyError(message, "UNKNOWN_COMMAND", "unknown camera command "+data.Command, map[string]any{"commands": names})
+		return
+	}
+
+	run := func(camera, arg string) error {
+		return command.run(c.server, camera, arg)
+	}
+	err := c.server.auditedCameraCommand(currentUser(c.r), command.action, run)(data.Camera, data.Arg)
+	if err != nil {
+		var details map[string]any
+		// Enabling a camera fails the way connecting to it does
+		if code := cameraErrorCode(err); code != "CONNECT_FAILED" {
+			details = map[string]any{"reason": code}
+		}
+		c.replyError(message, "COMMAND_FAILED", err.Error(), details)
+		return
+	}
+	c.reply(message, nil)
+}
+
+// bufferedResponse collects a handler's response in memory, for callHandler
+type bufferedResponse struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if !b.wroteHeader {
+		b.wroteHeader = true
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	b.wroteHeader = true
+	return b.body.Write(data)
+}
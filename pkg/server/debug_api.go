@@ -0,0 +1,50 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+)
+
+// goroutineCounts is what GET /api/debug/goroutines returns.
+// Apart from a fixed number for the server itself, goroutines should grow with viewers (one writer
+// each, plus the WebRTC library's own per connection) and with open HTTP and WebSocket connections,
+// never with packets or events.
+type goroutineCounts struct {
+	Total          int `json:"total"`
+	ViewerSessions int `json:"viewer_sessions"`
+	ViewerWriters  int `json:"viewer_writers"`
+	Subsystems     int `json:"subsystems"`
+}
+
+// handleDebugGoroutines shows how many goroutines are running, next to the counts they should
+// scale with, to check for leaks. With ?stacks=1 it returns every goroutine's stack instead,
+// grouped by stack, as plain text. Admins only.
+// GET /api/debug/goroutines
+func (s *Server) handleDebugGoroutines(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Query().Get("stacks") == "1" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		pprof.Lookup("goroutine").WriteTo(w, 1)
+		return
+	}
+
+	counts := goroutineCounts{
+		Total:          runtime.NumGoroutine(),
+		ViewerSessions: len(s.viewerSessions.List()),
+		ViewerWriters:  s.viewerSessions.Writers(),
+	}
+	for _, status := range s.subsystems.Status() {
+		if status.Running {
+			counts.Subsystems++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counts)
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+)
+
+// eventsResponse is one page of recent events. Total counts every matching event, not just this page's.
+type eventsResponse struct {
+	Events []events.Event `json:"events"`
+	Total  int            `json:"total"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+}
+
+// eventFilterFromQuery builds a filter from ?camera=...&type=motion,connection_lost
+// type can be repeated or comma separated. Cameras the user hasn't been granted are always excluded.
+func (s *Server) eventFilterFromQuery(r *http.Request) events.Filter {
+	filter := events.Filter{
+		Camera:  r.URL.Query().Get("camera"),
+		Cameras: s.requestUser(r).VisibleCameras(),
+	}
+
+	for _, t := range queryValues(r, "type") {
+		filter.Types = append(filter.Types, events.Type(t))
+	}
+
+	return filter
+}
+
+// handleEvents returns recent events, newest first unless ?sort=time.
+// GET /api/events?camera=camera1&type=motion&since=2024-01-01T00:00:00Z&until=...&limit=50&offset=0
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, err := parseListQuery(r, []string{"time"}, "-time")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := s.eventFilterFromQuery(r)
+	filter.Since, filter.Until, err = parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results, total := s.eventHistory.Query(filter, list.Offset, list.Limit, !list.Descending)
+
+	setTotalCount(w, total)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(eventsResponse{Events: results, Total: total, Limit: list.Limit, Offset: list.Offset})
+}
+
+// handleEventStream pushes events to the browser as they happen using Server-Sent Events.
+// GET /api/events/stream?camera=camera1&type=motion
+//
+// In the browser: new EventSource("/api/events/stream").addEventListener("motion", ...)
+// An event merged by a cooldown rule is sent again with the same id and an updated end_time.
+func (s *Server) handleEventStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// SSE needs to push bytes out immediately rather than waiting for the handler to return
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	filter := s.eventFilterFromQuery(r)
+	sub := s.eventBus.SubscribeWithUpdates(32, filter.Match)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	log.Printf("Event stream opened by %s", s.clientIP(r))
+
+	// Proxies tend to close connections that are idle for too long, so send a comment now and then
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Printf("Event stream closed by %s", s.clientIP(r))
+			return
+
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+
+		case event, ok := <-sub.C:
+			if !ok {
+				return
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Failed to encode event: %v", err)
+				continue
+			}
+
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+			flusher.Flush()
+		}
+	}
+}
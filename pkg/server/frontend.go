@@ -0,0 +1,97 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// frontendMaxAge is how long browsers may use the UI's files other than its pages without asking
+// again. Their names don't change between versions, so this is short.
+const frontendMaxAge = time.Hour
+
+// serveFrontend serves the web UI at /. A path that isn't a file and has no extension is one of
+// the page's own routes, e.g. /cameras/driveway, and gets index.html, so a reload or a link to it
+// works. Pages are checked with the server on every load, so a new version shows up straight away;
+// the rest is cached for frontendMaxAge. Every file gets an ETag of its content, since the files
+// built into the binary have no modification time.
+// GET /
+func serveFrontend(frontend http.FileSystem) http.HandlerFunc {
+	// Content hashes, by name, size and modification time
+	var etags sync.Map
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := path.Clean("/" + r.URL.Path)
+		// An API route that doesn't exist is an error, not a page
+		if name == "/api" || strings.HasPrefix(name, "/api/") {
+			writeAPIError(w, r, http.StatusNotFound, "NOT_FOUND", "no such API route", nil)
+			return
+		}
+
+		file, info, err := openFrontendFile(frontend, name)
+		if errors.Is(err, fs.ErrNotExist) && path.Ext(name) == "" {
+			file, info, err = openFrontendFile(frontend, "/index.html")
+		}
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer file.Close()
+
+		key := fmt.Sprintf("%s %d %d", info.Name(), info.Size(), info.ModTime().UnixNano())
+		etag, ok := etags.Load(key)
+		if !ok {
+			hash := sha256.New()
+			_, err = io.Copy(hash, file)
+			if err == nil {
+				_, err = file.Seek(0, io.SeekStart)
+			}
+			if err != nil {
+				http.Error(w, "Failed to read file", http.StatusInternalServerError)
+				return
+			}
+			etag = `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+			etags.Store(key, etag)
+		}
+
+		w.Header().Set("ETag", etag.(string))
+		if path.Ext(info.Name()) == ".html" {
+			w.Header().Set("Cache-Control", "no-cache")
+		} else {
+			w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(frontendMaxAge.Seconds())))
+		}
+		// Handles If-None-Match and ranges, and sets Content-Type from the extension
+		http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+	}
+}
+
+// openFrontendFile opens a file of the UI, or a directory's index.html. Directories aren't listed.
+func openFrontendFile(frontend http.FileSystem, name string) (http.File, fs.FileInfo, error) {
+	file, err := frontend.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return openFrontendFile(frontend, path.Join(name, "index.html"))
+	}
+	return file, info, nil
+}
@@ -0,0 +1,355 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/audit"
+	"github.com/nisarg-dave/camera-viewer/internal/monitor"
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+	"github.com/nisarg-dave/camera-viewer/pkg/managementpb"
+	"github.com/nisarg-dave/camera-viewer/pkg/viewers"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcClientContextKey holds who a gRPC call came from, "cert:<common name>" like on the admin listener
+const grpcClientContextKey contextKey = "grpc_client"
+
+// startGRPCServer serves the management service on its own address, requiring client certificates.
+// Like the admin listener, anyone with a valid certificate is treated as an admin.
+// The caller stops the returned server once the HTTP servers have shut down.
+func (s *Server) startGRPCServer(ctx context.Context, cfg config.GRPC) (*grpc.Server, error) {
+	if cfg.Addr == "" || cfg.CertFile == "" || cfg.KeyFile == "" || cfg.ClientCAFile == "" {
+		return nil, fmt.Errorf("grpc needs addr, cert_file, key_file and client_ca_file")
+	}
+
+	clientCAs, err := loadClientCAs(cfg.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load gRPC certificate: %w", err)
+	}
+
+	// Listen here rather than in the goroutine so a port that is taken fails at startup
+	listener, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", cfg.Addr, err)
+	}
+
+	server := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{cert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    clientCAs,
+			MinVersion:   tls.VersionTLS12,
+		})),
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			ctx, err := authorizeGRPC(ctx, cfg.AllowedNames)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := authorizeGRPC(stream.Context(), cfg.AllowedNames)
+			if err != nil {
+				return err
+			}
+			return handler(srv, authorizedStream{ServerStream: stream, ctx: ctx})
+		}),
+	)
+	managementpb.RegisterManagementServer(server, &managementServer{server: s, ctx: ctx})
+
+	go func() {
+		log.Printf("Starting gRPC management service with client certificate authentication on %s", cfg.Addr)
+		// Serve only returns nil once the server has been stopped
+		err := server.Serve(listener)
+		if err != nil {
+			s.listenerErrs <- fmt.Errorf("gRPC service: %w", err)
+		}
+	}()
+	return server, nil
+}
+
+// authorizeGRPC lets a call through if its verified client certificate has an allowed common name,
+// returning its context with the client recorded for grpcClient. The TLS handshake has already
+// checked the certificate against the client CA.
+func authorizeGRPC(ctx context.Context, allowedNames []string) (context.Context, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "client certificate required")
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "client certificate required")
+	}
+
+	name := tlsInfo.State.VerifiedChains[0][0].Subject.CommonName
+	if len(allowedNames) > 0 && !slices.Contains(allowedNames, name) {
+		log.Printf("Rejected gRPC client certificate %q from %s", name, p.Addr)
+		return nil, status.Error(codes.PermissionDenied, "client certificate not allowed")
+	}
+	return context.WithValue(ctx, grpcClientContextKey, "cert:"+name), nil
+}
+
+// grpcClient returns who made a gRPC call, for logs and the audit log
+func grpcClient(ctx context.Context) string {
+	client, _ := ctx.Value(grpcClientContextKey).(string)
+	return client
+}
+
+// grpcClientIP returns the address a gRPC call came from, without the port
+func grpcClientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// authorizedStream is a server stream with the context authorizeGRPC returned
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+// managementServer implements the gRPC management service on top of the same state as the HTTP API
+type managementServer struct {
+	managementpb.UnimplementedManagementServer
+	server *Server
+	// Cancelled when shutdown starts, which ends the streams
+	ctx context.Context
+}
+
+func (m *managementServer) ListCameras(ctx context.Context, req *managementpb.ListCamerasRequest) (*managementpb.ListCamerasResponse, error) {
+	health := m.server.checkCameraHealth(m.server.cameraID, m.server.streamMonitor.StallTimeout())
+	camera := &managementpb.Camera{
+		Id:      m.server.cameraID,
+		State:   health.State,
+		Healthy: health.Healthy,
+		Ingest:  ingestStatsProto(m.server.streamMonitor.Ingest()),
+		Viewers: int32(m.server.cameraViewers(m.server.cameraID)),
+	}
+	if !health.LastPacket.IsZero() {
+		camera.LastPacket = timestamppb.New(health.LastPacket)
+	}
+	if health.Video != nil {
+		camera.Video = &managementpb.VideoInfo{
+			Codec:  health.Video.Codec,
+			Width:  int32(health.Video.Width),
+			Height: int32(health.Video.Height),
+			Fps:    health.Video.FPS,
+		}
+	}
+
+	return &managementpb.ListCamerasResponse{Cameras: []*managementpb.Camera{camera}}, nil
+}
+
+func (m *managementServer) ListSessions(ctx context.Context, req *managementpb.ListSessionsRequest) (*managementpb.ListSessionsResponse, error) {
+	list := &managementpb.ListSessionsResponse{}
+	for _, s := range m.server.viewerSessions.List() {
+		list.Sessions = append(list.Sessions, sessionProto(newSessionResponse(s)))
+	}
+	return list, nil
+}
+
+func (m *managementServer) GetSessionStats(ctx context.Context, req *managementpb.GetSessionStatsRequest) (*managementpb.SessionStats, error) {
+	session := m.server.viewerSessions.Get(req.GetId())
+	if session == nil {
+		return nil, status.Error(codes.NotFound, "session not found")
+	}
+
+	stats := session.Peer.Stats()
+	response := &managementpb.SessionStats{
+		Session:              sessionProto(newSessionResponse(session)),
+		Bitrate:              session.Bitrate(),
+		PacketsSent:          stats.PacketsSent,
+		NackCount:            stats.NACKCount,
+		PliCount:             stats.PLICount,
+		PacketsLost:          stats.PacketsLost,
+		FractionLost:         stats.FractionLost,
+		JitterSeconds:        stats.JitterSec,
+		RoundTripTimeSeconds: stats.RTTSec,
+	}
+	if stats.CandidatePair != nil {
+		response.CandidateType = stats.CandidatePair.Remote.Type
+	}
+	return response, nil
+}
+
+func (m *managementServer) CloseSession(ctx context.Context, req *managementpb.CloseSessionRequest) (*managementpb.CloseSessionResponse, error) {
+	session := m.server.viewerSessions.Get(req.GetId())
+	if session == nil {
+		return nil, status.Error(codes.NotFound, "session not found")
+	}
+
+	client := grpcClient(ctx)
+	session.Logf("closed by %s", client)
+	m.server.viewerSessions.Remove(session.ID)
+	m.server.recordAuditEntry(audit.Entry{
+		User:   client,
+		Action: audit.ActionSessionClosed,
+		Camera: session.Camera,
+		Target: session.User,
+		Detail: session.ID,
+		IP:     grpcClientIP(ctx),
+	})
+	return &managementpb.CloseSessionResponse{}, nil
+}
+
+func (m *managementServer) StreamEvents(req *managementpb.StreamEventsRequest, stream grpc.ServerStreamingServer[managementpb.Event]) error {
+	filter := events.Filter{Camera: req.GetCamera()}
+	for _, t := range req.GetTypes() {
+		filter.Types = append(filter.Types, events.Type(t))
+	}
+	sub := m.server.eventBus.SubscribeWithUpdates(32, filter.Match)
+	defer sub.Close()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-m.ctx.Done():
+			return status.Error(codes.Unavailable, "server shutting down")
+		case event, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+
+			message, err := eventProto(event)
+			if err != nil {
+				log.Printf("Failed to encode event: %v", err)
+				continue
+			}
+			err = stream.Send(message)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (m *managementServer) StreamStats(req *managementpb.StreamStatsRequest, stream grpc.ServerStreamingServer[managementpb.StatsSnapshot]) error {
+	interval := defaultStatsInterval
+	if req.GetInterval() != nil {
+		interval = req.GetInterval().AsDuration()
+		if interval < minStatsInterval {
+			return status.Error(codes.InvalidArgument, "interval must be at least "+minStatsInterval.String())
+		}
+	}
+
+	tracker := m.server.newStatsTracker(true, func(*viewers.Session) bool { return true })
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := stream.Send(statsSnapshotProto(tracker.snapshot()))
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-m.ctx.Done():
+			return status.Error(codes.Unavailable, "server shutting down")
+		case <-ticker.C:
+		}
+	}
+}
+
+func sessionProto(s sessionResponse) *managementpb.Session {
+	return &managementpb.Session{
+		Id:        s.ID,
+		User:      s.User,
+		Camera:    s.Camera,
+		StartedAt: timestamppb.New(s.StartedAt),
+		Connected: s.Connected,
+		BytesSent: s.BytesSent,
+	}
+}
+
+func ingestStatsProto(stats monitor.IngestStats) *managementpb.IngestStats {
+	return &managementpb.IngestStats{
+		PacketsReceived:  stats.PacketsReceived,
+		BytesReceived:    stats.BytesReceived,
+		FramesReceived:   stats.FramesReceived,
+		PacketsLost:      stats.PacketsLost,
+		PacketsReordered: stats.PacketsReordered,
+		LossRatio:        stats.LossRatio,
+		JitterMs:         stats.JitterMs,
+		CaptureDelayMs:   stats.CaptureDelayMs,
+		BitrateBps:       stats.BitrateBps,
+		Fps:              stats.FPS,
+	}
+}
+
+func statsSnapshotProto(snapshot statsSnapshot) *managementpb.StatsSnapshot {
+	message := &managementpb.StatsSnapshot{Time: timestamppb.New(snapshot.Time)}
+	for _, camera := range slices.Sorted(maps.Keys(snapshot.Cameras)) {
+		message.Cameras = append(message.Cameras, &managementpb.CameraStats{
+			Camera: camera,
+			Ingest: ingestStatsProto(snapshot.Cameras[camera]),
+		})
+	}
+	for _, s := range snapshot.Sessions {
+		message.Sessions = append(message.Sessions, &managementpb.SessionSnapshot{
+			Session: sessionProto(s.sessionResponse),
+			Bitrate: s.Bitrate,
+		})
+	}
+	return message
+}
+
+func eventProto(e events.Event) (*managementpb.Event, error) {
+	message := &managementpb.Event{
+		Id:      e.ID,
+		Type:    string(e.Type),
+		Camera:  e.Camera,
+		Time:    timestamppb.New(e.Time),
+		Message: e.Message,
+		Count:   int32(e.Count),
+	}
+	if !e.EndTime.IsZero() {
+		message.EndTime = timestamppb.New(e.EndTime)
+	}
+	if len(e.Data) > 0 {
+		// Through JSON, since structpb only takes the types JSON decodes to and Data can hold others
+		data, err := json.Marshal(e.Data)
+		if err != nil {
+			return nil, err
+		}
+		message.Data = &structpb.Struct{}
+		err = protojson.Unmarshal(data, message.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return message, nil
+}
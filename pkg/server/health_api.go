@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/monitor"
+	"github.com/nisarg-dave/camera-viewer/pkg/stream"
+)
+
+// cameraHealth is whether a camera has sent video recently
+type cameraHealth struct {
+	Camera  string `json:"camera"`
+	Healthy bool   `json:"healthy"`
+	// connected, connecting or disabled, see supervisor.Camera.State
+	State string `json:"state"`
+	// Why the last connect failed, see cameraErrorCode. Empty once it has connected.
+	LastError  string    `json:"last_error,omitempty"`
+	LastPacket time.Time `json:"last_packet,omitzero"`
+	// How long without packets before the camera counts as unhealthy
+	ThresholdSeconds float64 `json:"threshold_seconds"`
+	// Resolution and frame rate from the camera's SPS, nil until it has sent one
+	Video *stream.VideoInfo `json:"video,omitempty"`
+	// Free space where data is written. There is no recorder yet, so this is the data directory.
+	Storage monitor.DiskUsage `json:"storage"`
+}
+
+// checkCameraHealth reports whether camera has sent a packet within the threshold.
+// A lastPacket of zero means the camera is disabled or disconnected.
+func (s *Server) checkCameraHealth(camera string, threshold time.Duration) cameraHealth {
+	lastPacket := s.streamMonitor.LastPacket()
+	health := cameraHealth{
+		Camera:           camera,
+		Healthy:          !lastPacket.IsZero() && time.Since(lastPacket) < threshold,
+		State:            s.cameraSupervisor.State(),
+		LastError:        cameraErrorCode(s.cameraSupervisor.LastError()),
+		LastPacket:       lastPacket,
+		ThresholdSeconds: threshold.Seconds(),
+		Storage:          s.diskMonitor.Usage(),
+	}
+	if video, ok := s.videoSource.VideoInfo(); ok {
+		health.Video = &video
+	}
+	return health
+}
+
+// handleHealthz answers as long as the process is up and serving HTTP, for liveness probes.
+// GET /healthz
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok\n"))
+}
+
+// handleReadyz answers 200 when at least one camera is sending video and 503 otherwise,
+// for readiness probes and load balancers. No camera details are given since it needs no login.
+// GET /readyz
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	if !s.checkCameraHealth(s.cameraID, s.streamMonitor.StallTimeout()).Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("no camera is receiving video\n"))
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+// handleCameraHealth reports whether a camera has sent video within the stall timeout (or ?within=),
+// answering 503 when it hasn't so it can be used as a health check on its own.
+// GET /api/cameras/{id}/health?within=10s
+func (s *Server) handleCameraHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	camera := r.PathValue("id")
+	if camera != s.cameraID || !s.canViewCamera(r, camera) {
+		http.Error(w, "Camera not found", http.StatusNotFound)
+		return
+	}
+
+	threshold := s.streamMonitor.StallTimeout()
+	if value := r.URL.Query().Get("within"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "within must be a duration like \"10s\"", http.StatusBadRequest)
+			return
+		}
+		threshold = parsed
+	}
+
+	health := s.checkCameraHealth(camera, threshold)
+
+	w.Header().Set("Content-Type", "application/json")
+	if !health.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(health)
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/metrics"
+	"github.com/nisarg-dave/camera-viewer/internal/monitor"
+)
+
+const (
+	// historyInterval is the resolution of the metrics history
+	historyInterval = time.Minute
+	// historySize keeps a day of samples
+	historySize = 24 * 60
+)
+
+// historyResponse is a camera's samples, oldest first, one every IntervalSeconds
+type historyResponse struct {
+	Camera          string           `json:"camera"`
+	IntervalSeconds float64          `json:"interval_seconds"`
+	Samples         []metrics.Sample `json:"samples"`
+}
+
+// recordHistory adds a sample for the camera every historyInterval until stop is closed.
+// The bitrate, frame rate and loss are averages over the minute, worked out from the ingest totals.
+// This blocks, so call it in a goroutine.
+func (s *Server) recordHistory(stop <-chan struct{}) {
+	ticker := time.NewTicker(historyInterval)
+	defer ticker.Stop()
+
+	previous := s.streamMonitor.Ingest()
+	previousTime := time.Now()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			current := s.streamMonitor.Ingest()
+			s.metricsHistory.Add(s.cameraID, s.historySample(previous, current, now.Sub(previousTime), now))
+			previous, previousTime = current, now
+		}
+	}
+}
+
+// historySample works out the averages between two ingest snapshots
+func (s *Server) historySample(previous, current monitor.IngestStats, elapsed time.Duration, now time.Time) metrics.Sample {
+	sample := metrics.Sample{
+		Time:     now,
+		JitterMs: current.JitterMs,
+	}
+
+	for _, session := range s.viewerSessions.List() {
+		if session.Camera == s.cameraID && session.Connected() {
+			sample.Viewers++
+		}
+	}
+
+	seconds := elapsed.Seconds()
+	if seconds <= 0 {
+		return sample
+	}
+	sample.BitrateBps = float64(current.BytesReceived-previous.BytesReceived) * 8 / seconds
+	sample.FPS = float64(current.FramesReceived-previous.FramesReceived) / seconds
+
+	received := current.PacketsReceived - previous.PacketsReceived
+	lost := current.PacketsLost - previous.PacketsLost
+	// Late packets can take the lost count back down, which would underflow
+	if current.PacketsLost < previous.PacketsLost {
+		lost = 0
+	}
+	if received+lost > 0 {
+		sample.LossRatio = float64(lost) / float64(received+lost)
+	}
+	return sample
+}
+
+// handleCameraHistory returns a camera's one minute samples, oldest first, for graphs in the UI.
+// Up to the last 24 hours are kept, in memory only, so the history starts again after a restart.
+// GET /api/cameras/{id}/history?since=1h
+func (s *Server) handleCameraHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	camera := r.PathValue("id")
+	if camera != s.cameraID || !s.canViewCamera(r, camera) {
+		http.Error(w, "Camera not found", http.StatusNotFound)
+		return
+	}
+
+	// since is either how far back to go, or a time
+	since := time.Now().Add(-24 * time.Hour)
+	if value := r.URL.Query().Get("since"); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			since = time.Now().Add(-duration)
+		} else if t, err := time.Parse(time.RFC3339, value); err == nil {
+			since = t
+		} else {
+			http.Error(w, "since must be a duration like \"1h\" or an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(historyResponse{
+		Camera:          camera,
+		IntervalSeconds: historyInterval.Seconds(),
+		Samples:         s.metricsHistory.Since(camera, since),
+	})
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+	"github.com/nisarg-dave/camera-viewer/pkg/viewers"
+)
+
+// Hooks let a program that embeds the server act on what happens without changing the server.
+// Each runs on a goroutine of its own, fed from the event bus like the webhooks: a hook that falls
+// behind misses events rather than holding up the camera, and one that panics is started again.
+// Register them between New and Run so they don't miss the camera's first connect.
+
+// OnEvent calls hook with every event the server publishes, e.g. motion, the camera coming and going
+// and viewers joining and leaving
+func (s *Server) OnEvent(hook func(events.Event)) {
+	s.runHook("hook:event", nil, hook)
+}
+
+// OnCameraConnected calls hook every time the camera connects, with the codec of its video
+func (s *Server) OnCameraConnected(hook func(camera, codec string)) {
+	s.runHook("hook:camera_connected", events.OfType(events.TypeCameraConnected), func(event events.Event) {
+		codec, _ := event.Data["codec"].(string)
+		hook(event.Camera, codec)
+	})
+}
+
+// OnViewerJoined calls hook with every viewer session once its connection is up. A session that
+// has already ended by the time the hook runs is skipped.
+func (s *Server) OnViewerJoined(hook func(*viewers.Session)) {
+	s.runHook("hook:viewer_joined", events.OfType(events.TypeViewerJoined), func(event events.Event) {
+		id, _ := event.Data["session"].(string)
+		session := s.viewerSessions.Get(id)
+		if session == nil {
+			return
+		}
+		hook(session)
+	})
+}
+
+// runHook calls hook with the events that match filter, under the subsystem tree
+func (s *Server) runHook(name string, filter func(events.Event) bool, hook func(events.Event)) {
+	s.subsystems.Go(name, func(stop <-chan struct{}) {
+		sub := s.eventBus.Subscribe(64, filter)
+		defer sub.Close()
+		for {
+			select {
+			case <-stop:
+				return
+			case event := <-sub.C:
+				hook(event)
+			}
+		}
+	})
+}
+
+// OnReady calls hook once Run is serving, with every listener up, e.g. to tell a service manager
+// the server has started. Unlike the other hooks it runs on Run's goroutine, and only once. With
+// Options.NoListeners it is called as soon as Run starts.
+func (s *Server) OnReady(hook func()) {
+	s.ready = append(s.ready, hook)
+}
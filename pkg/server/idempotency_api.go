@@ -0,0 +1,122 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/idempotency"
+)
+
+// idempotencyKeyTTL is how long a response is kept for retries with the same Idempotency-Key
+const idempotencyKeyTTL = 24 * time.Hour
+
+// maxIdempotentBody is the largest request body idempotent reads to tell requests apart
+const maxIdempotentBody = 1 << 20
+
+// maxIdempotencyEntries and maxIdempotencyBytes bound how many responses are kept for retries,
+// and how much memory they take; past either, the oldest are forgotten
+const (
+	maxIdempotencyEntries = 10000
+	maxIdempotencyBytes   = 64 << 20
+)
+
+// idempotent lets a client retry a POST that creates something, e.g. after a mobile connection
+// dropped before the response arrived, without creating it twice. A request sent again with the same
+// Idempotency-Key header gets the first response back, marked with Idempotent-Replayed: true.
+// Keys belong to a user and a route. Only successful responses are kept: after an error nothing was
+// created, so the retry runs again. Requests without the header are handled as usual.
+func (s *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || r.Method != http.MethodPost {
+			next(w, r)
+			return
+		}
+		if len(key) > 255 {
+			writeAPIError(w, r, http.StatusBadRequest, "INVALID_IDEMPOTENCY_KEY", "Idempotency-Key must be at most 255 characters", nil)
+			return
+		}
+
+		// The body is read up front to fingerprint the request, then handed on as if it hadn't been
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBody+1))
+		if err != nil {
+			writeAPIError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "failed to read the request body", nil)
+			return
+		}
+		if len(body) > maxIdempotentBody {
+			writeAPIError(w, r, http.StatusRequestEntityTooLarge, "REQUEST_TOO_LARGE", "the request body is too large", nil)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		scopedKey := currentUser(r) + " " + r.URL.Path + " " + key
+		sum := sha256.Sum256(append([]byte(r.URL.RawQuery+"\n"), body...))
+
+		response, err := s.idempotencyStore.Begin(scopedKey, hex.EncodeToString(sum[:]))
+		switch {
+		case errors.Is(err, idempotency.ErrInProgress):
+			writeAPIError(w, r, http.StatusConflict, "IDEMPOTENCY_KEY_IN_USE", err.Error(), nil)
+			return
+		case errors.Is(err, idempotency.ErrKeyReused):
+			writeAPIError(w, r, http.StatusUnprocessableEntity, "IDEMPOTENCY_KEY_REUSED", err.Error(), nil)
+			return
+		case response != nil:
+			for name, values := range response.Header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(response.Status)
+			w.Write(response.Body)
+			return
+		}
+
+		recorder := &idempotencyRecorder{ResponseWriter: w, status: http.StatusOK}
+		// A panicking handler mustn't leave the key claimed forever
+		var kept *idempotency.Response
+		defer func() { s.idempotencyStore.Finish(scopedKey, kept) }()
+
+		next(recorder, r)
+
+		if recorder.status < 400 {
+			header := http.Header{}
+			for _, name := range []string{"Content-Type", "Location"} {
+				if value := w.Header().Get(name); value != "" {
+					header.Set(name, value)
+				}
+			}
+			kept = &idempotency.Response{Status: recorder.status, Header: header, Body: recorder.body.Bytes()}
+		}
+	}
+}
+
+// idempotencyRecorder keeps a copy of the response as it is sent
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (i *idempotencyRecorder) WriteHeader(status int) {
+	if !i.wroteHeader {
+		i.wroteHeader = true
+		i.status = status
+	}
+	i.ResponseWriter.WriteHeader(status)
+}
+
+func (i *idempotencyRecorder) Write(data []byte) (int, error) {
+	i.wroteHeader = true
+	i.body.Write(data)
+	return i.ResponseWriter.Write(data)
+}
+
+// Unwrap lets writeAPIError and http.ResponseController reach the underlying ResponseWriter
+func (i *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return i.ResponseWriter
+}
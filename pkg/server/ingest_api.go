@@ -0,0 +1,27 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/nisarg-dave/camera-viewer/internal/monitor"
+)
+
+// handleIngest returns statistics about the video arriving from each camera the user can view:
+// sequence number gaps, jitter, bitrate and frame rate. Compare them with /api/sessions/{id}/stats
+// to tell a bad camera link apart from a bad viewer connection.
+// GET /api/ingest
+func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cameras := map[string]monitor.IngestStats{}
+	if s.canViewCamera(r, s.cameraID) {
+		cameras[s.cameraID] = s.streamMonitor.Ingest()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cameras)
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/jobs"
+	"github.com/nisarg-dave/camera-viewer/internal/logging"
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+)
+
+const (
+	// maxRunningJobs is how many jobs run at once; the rest wait their turn
+	maxRunningJobs = 2
+	// jobRetention is how long a finished job's result can still be fetched
+	jobRetention = time.Hour
+	// probeTimeout bounds each stream URL's DESCRIBE in a camera probe
+	probeTimeout = 15 * time.Second
+)
+
+// jobSortFields are what GET /api/jobs can be sorted by
+var jobSortFields = []string{"created_at", "type", "state"}
+
+// probeResult is the result of a probe_camera job
+type probeResult struct {
+	Streams []probedStream `json:"streams"`
+}
+
+// probedStream is how one of a camera's stream URLs answered
+type probedStream struct {
+	// "primary", or "failover" for RTSP_FAILOVER_URL
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	// What kind of failure it was, see cameraErrorCode
+	ErrorCode string `json:"error_code,omitempty"`
+	// How long the camera took to answer DESCRIBE
+	ResponseMs float64       `json:"response_ms"`
+	Medias     []probedMedia `json:"medias,omitempty"`
+}
+
+// probedMedia is one media the camera offers, e.g. video with H264
+type probedMedia struct {
+	Type   string   `json:"type"`
+	Codecs []string `json:"codecs"`
+}
+
+// startJobManager sets up jobManager under ctx, publishing an event whenever a job finishes
+func (s *Server) startJobManager(ctx context.Context) {
+	s.jobManager = jobs.NewManager(ctx, maxRunningJobs, jobRetention)
+	s.jobManager.OnFinish(func(job jobs.Job) {
+		message := fmt.Sprintf("%s job %s", job.Type, job.State)
+		if job.Error != "" {
+			message += ": " + job.Error
+		}
+		s.eventBus.Publish(events.Event{
+			Type:    events.TypeJobFinished,
+			Camera:  job.Camera,
+			Message: message,
+			Data:    map[string]any{"job_id": job.ID, "job_type": job.Type, "state": string(job.State), "user": job.User},
+		})
+	})
+}
+
+// writeJobAccepted answers a request that started a job with the job and where to follow it
+func writeJobAccepted(w http.ResponseWriter, r *http.Request, job jobs.Job) {
+	location := "/api/jobs/" + job.ID
+	if apiVersion(r) >= 1 {
+		location = "/api/v1/jobs/" + job.ID
+	}
+	w.Header().Set("Location", location)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleCameraProbe starts a job that asks each of the camera's stream URLs which media it offers,
+// without disturbing the running connection. Admin only.
+// POST /api/cameras/{id}/probe
+func (s *Server) handleCameraProbe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	camera := r.PathValue("id")
+	if camera != s.cameraID {
+		http.Error(w, "Camera not found", http.StatusNotFound)
+		return
+	}
+
+	job := s.jobManager.Start("probe_camera", currentUser(r), camera, s.probeCamera)
+	writeJobAccepted(w, r, job)
+}
+
+// probeCamera sends DESCRIBE to the camera's primary and failover URLs in turn
+func (s *Server) probeCamera(ctx context.Context, report func(progress float64, message string)) (any, error) {
+	primary, failover := s.cameraSupervisor.URLs()
+	urls := [][2]string{{"primary", primary}}
+	if failover != "" {
+		urls = append(urls, [2]string{"failover", failover})
+	}
+
+	result := probeResult{Streams: []probedStream{}}
+	for i, url := range urls {
+		report(float64(i)/float64(len(urls)), "probing the "+url[0]+" stream")
+
+		probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+		start := time.Now()
+		session, err := s.rtspStream.Describe(probeCtx, url[1])
+		cancel()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		stream := probedStream{Name: url[0], OK: err == nil, ResponseMs: float64(time.Since(start).Microseconds()) / 1000}
+		if err != nil {
+			// The error can quote the URL, password and all
+			stream.Error = logging.Redact(err.Error())
+			stream.ErrorCode = cameraErrorCode(err)
+		} else {
+			for _, media := range session.Medias {
+				probed := probedMedia{Type: string(media.Type), Codecs: []string{}}
+				for _, forma := range media.Formats {
+					probed.Codecs = append(probed.Codecs, forma.Codec())
+				}
+				stream.Medias = append(stream.Medias, probed)
+			}
+		}
+		result.Streams = append(result.Streams, stream)
+	}
+	return result, nil
+}
+
+// canSeeJob reports whether the user may see a job: their own, or any for admins
+func (s *Server) canSeeJob(r *http.Request, job jobs.Job) bool {
+	return job.User == currentUser(r) || s.requestUser(r).IsAdmin()
+}
+
+// handleJobs lists background jobs, your own or (admins) everyone's, newest first.
+// GET /api/jobs?type=probe_camera&state=running
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, err := parseListQuery(r, jobSortFields, "-created_at")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	types := queryValues(r, "type")
+	states := queryValues(r, "state")
+
+	matching := []jobs.Job{}
+	for _, job := range s.jobManager.List() {
+		if !s.canSeeJob(r, job) ||
+			len(types) > 0 && !slices.Contains(types, job.Type) ||
+			len(states) > 0 && !slices.Contains(states, string(job.State)) {
+			continue
+		}
+		matching = append(matching, job)
+	}
+
+	slices.SortStableFunc(matching, func(a, b jobs.Job) int {
+		var order int
+		switch list.Sort {
+		case "type":
+			order = strings.Compare(a.Type, b.Type)
+		case "state":
+			order = strings.Compare(string(a.State), string(b.State))
+		default:
+			order = a.CreatedAt.Compare(b.CreatedAt)
+		}
+		if list.Descending {
+			return -order
+		}
+		return order
+	})
+
+	setTotalCount(w, len(matching))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(paginate(matching, list))
+}
+
+// handleJob returns a job's progress, and once it has finished its result, or cancels it.
+// Other users' jobs are reported as not found.
+// GET    /api/jobs/{id}
+// DELETE /api/jobs/{id}
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	job, err := s.jobManager.Get(r.PathValue("id"))
+	if err != nil || !s.canSeeJob(r, job) {
+		writeAPIError(w, r, http.StatusNotFound, "JOB_NOT_FOUND", "job not found", nil)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		job, err = s.jobManager.Cancel(job.ID)
+		if errors.Is(err, jobs.ErrFinished) {
+			writeAPIError(w, r, http.StatusConflict, "JOB_FINISHED", err.Error(), map[string]any{"state": string(job.State)})
+			return
+		}
+		if err != nil {
+			writeAPIError(w, r, http.StatusNotFound, "JOB_NOT_FOUND", "job not found", nil)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Every list endpoint pages, filters and sorts the same way:
+//   - ?limit= (1 to maxListLimit, default defaultListLimit) and ?offset= page through the results,
+//     and the X-Total-Count header says how many there are in all
+//   - ?sort= names a field to sort by, with a leading - for descending, e.g. sort=-time
+//   - ?since= and ?until= are RFC 3339 times, for lists of things that happened
+//   - other filters are named after the field they match, and take comma separated values
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+// listQuery is the paging and sorting of a list request
+type listQuery struct {
+	Limit  int
+	Offset int
+	// The field to sort by, and whether to sort descending
+	Sort       string
+	Descending bool
+}
+
+// parseListQuery reads ?limit=, ?offset= and ?sort= from a list request. sortFields are the fields
+// it can be sorted by; defaultSort is used without ?sort=, e.g. "-time".
+func parseListQuery(r *http.Request, sortFields []string, defaultSort string) (listQuery, error) {
+	query := r.URL.Query()
+	list := listQuery{Limit: defaultListLimit}
+
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxListLimit {
+			return list, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+		}
+		list.Limit = parsed
+	}
+
+	if value := query.Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return list, fmt.Errorf("offset must be a positive number")
+		}
+		list.Offset = parsed
+	}
+
+	sort := query.Get("sort")
+	if sort == "" {
+		sort = defaultSort
+	}
+	list.Sort, list.Descending = strings.CutPrefix(sort, "-")
+	if !slices.Contains(sortFields, list.Sort) {
+		return list, fmt.Errorf("sort must be one of %s, with a leading - for descending", strings.Join(sortFields, ", "))
+	}
+	return list, nil
+}
+
+// parseTimeRange reads ?since= and ?until=, leaving either zero when it isn't given
+func parseTimeRange(r *http.Request) (since, until time.Time, err error) {
+	if value := r.URL.Query().Get("since"); value != "" {
+		since, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return since, until, fmt.Errorf("since must be an RFC 3339 time")
+		}
+	}
+	if value := r.URL.Query().Get("until"); value != "" {
+		until, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return since, until, fmt.Errorf("until must be an RFC 3339 time")
+		}
+	}
+	return since, until, nil
+}
+
+// queryValues returns a filter's values from the query, which can be repeated or comma separated
+func queryValues(r *http.Request, name string) []string {
+	var values []string
+	for _, value := range r.URL.Query()[name] {
+		for _, v := range strings.Split(value, ",") {
+			if v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// setTotalCount tells the client how many results a paged list has in all
+func setTotalCount(w http.ResponseWriter, total int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+}
+
+// paginate returns the page of items the list query asks for
+func paginate[T any](items []T, list listQuery) []T {
+	if list.Offset >= len(items) {
+		return items[:0]
+	}
+	return items[list.Offset:min(list.Offset+list.Limit, len(items))]
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// httpAddr is where plain HTTP is served
+const httpAddr = ":8080"
+
+// shutdownTimeout is how long in-flight requests get to finish when shutting down
+const shutdownTimeout = 10 * time.Second
+
+// serve runs the HTTP server, and the HTTPS server when TLS is configured, until ctx is cancelled.
+// Then it shuts them down gracefully along with the extra servers (e.g. the admin listener),
+// which the caller has already started. It returns early if a server fails. ready is called once
+// every server is listening.
+func (s *Server) serve(ctx context.Context, handler http.Handler, tlsConfig *config.TLS, http2Config config.HTTP2, ready func(), extra ...*http.Server) error {
+	if http2Config.H2C && len(s.trustedProxies) == 0 {
+		return fmt.Errorf("http2.h2c needs trusted_proxies, the only clients allowed to use it")
+	}
+
+	// Requests get a context that is cancelled when shutdown starts, so long-lived
+	// responses like the event stream and the stats WebSocket end instead of holding up the shutdown
+	baseContext := func(net.Listener) context.Context { return ctx }
+
+	// HTTPS always offers HTTP/2; plain HTTP only with h2c, and then only to trusted proxies
+	http2Settings := &http.HTTP2Config{MaxConcurrentStreams: http2Config.MaxConcurrentStreams}
+	tlsProtocols := new(http.Protocols)
+	tlsProtocols.SetHTTP1(true)
+	tlsProtocols.SetHTTP2(true)
+	plainProtocols := new(http.Protocols)
+	plainProtocols.SetHTTP1(true)
+	plainProtocols.SetUnencryptedHTTP2(http2Config.H2C)
+	newPlainServer := func(addr string, handler http.Handler) *http.Server {
+		if http2Config.H2C {
+			handler = s.onlyTrustedH2C(handler)
+		}
+		return &http.Server{Addr: addr, Handler: handler, BaseContext: baseContext, Protocols: plainProtocols, HTTP2: http2Settings}
+	}
+
+	servers := slices.Clone(extra)
+	// Each server listens straight away, so a port that is taken fails here and ready means ready
+	start := func(server *http.Server, run func(net.Listener) error) error {
+		listener, err := net.Listen("tcp", server.Addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", server.Addr, err)
+		}
+		servers = append(servers, server)
+		go func() {
+			err := run(listener)
+			if !errors.Is(err, http.ErrServerClosed) {
+				s.listenerErrs <- err
+			}
+		}()
+		return nil
+	}
+	// failed shuts down what has started, after a server couldn't
+	failed := func(err error) error {
+		shutdownServers(servers)
+		return err
+	}
+
+	if tlsConfig == nil {
+		server := newPlainServer(httpAddr, handler)
+		fmt.Printf("Starting server on port %s...\n", httpAddr)
+		err := start(server, server.Serve)
+		if err != nil {
+			return failed(err)
+		}
+		ready()
+		return waitAndShutdown(ctx, s.listenerErrs, servers)
+	}
+
+	server := &http.Server{Addr: tlsConfig.Addr, Handler: handler, BaseContext: baseContext, Protocols: tlsProtocols, HTTP2: http2Settings}
+
+	// Plain HTTP either keeps working as before, or sends everyone to HTTPS
+	plain := handler
+	if tlsConfig.RedirectHTTP {
+		plain = s.keepHealthChecks(redirectToHTTPS(tlsConfig.Addr))
+	}
+
+	switch {
+	case tlsConfig.Autocert != nil:
+		manager, err := newAutocertManager(*tlsConfig.Autocert)
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = manager.TLSConfig()
+
+		if tlsConfig.Autocert.HTTPChallengeAddr != "" {
+			// The challenge server answers Let's Encrypt's HTTP-01 requests and redirects everything else
+			log.Printf("Answering ACME HTTP challenges on %s", tlsConfig.Autocert.HTTPChallengeAddr)
+			challenge := &http.Server{
+				Addr:    tlsConfig.Autocert.HTTPChallengeAddr,
+				Handler: manager.HTTPHandler(redirectToHTTPS(tlsConfig.Addr)),
+			}
+			err = start(challenge, challenge.Serve)
+			if err != nil {
+				return failed(err)
+			}
+		}
+		log.Printf("Using Let's Encrypt certificates for %v", tlsConfig.Autocert.Domains)
+
+	case tlsConfig.CertFile != "" && tlsConfig.KeyFile != "":
+		// Load once up front so a bad certificate fails at startup rather than on the first request
+		_, err := tls.LoadX509KeyPair(tlsConfig.CertFile, tlsConfig.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+
+	default:
+		return fmt.Errorf("tls needs either cert_file and key_file, or autocert")
+	}
+
+	fmt.Printf("Starting HTTPS server on %s...\n", tlsConfig.Addr)
+	// With autocert the certificates come from TLSConfig, so the file names are empty
+	err := start(server, func(listener net.Listener) error {
+		return server.ServeTLS(listener, tlsConfig.CertFile, tlsConfig.KeyFile)
+	})
+	if err != nil {
+		return failed(err)
+	}
+
+	fmt.Printf("Starting server on port %s...\n", httpAddr)
+	plainServer := newPlainServer(httpAddr, plain)
+	err = start(plainServer, plainServer.Serve)
+	if err != nil {
+		return failed(err)
+	}
+
+	ready()
+	return waitAndShutdown(ctx, s.listenerErrs, servers)
+}
+
+// waitAndShutdown waits for ctx to be cancelled or a server to fail, then shuts down every server.
+// Shutdown stops accepting connections and waits up to shutdownTimeout for requests in flight.
+func waitAndShutdown(ctx context.Context, errs <-chan error, servers []*http.Server) error {
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-errs:
+	}
+
+	shutdownServers(servers)
+	return err
+}
+
+// shutdownServers shuts servers down, giving requests in flight up to shutdownTimeout
+func shutdownServers(servers []*http.Server) {
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		shutdownErr := server.Shutdown(shutdownCtx)
+		if shutdownErr != nil {
+			log.Printf("Failed to shut down server on %s cleanly: %v", server.Addr, shutdownErr)
+		}
+	}
+}
+
+// newAutocertManager sets up automatic certificates from Let's Encrypt
+func newAutocertManager(cfg config.Autocert) (*autocert.Manager, error) {
+	if len(cfg.Domains) == 0 {
+		return nil, fmt.Errorf("autocert needs at least one domain")
+	}
+
+	manager := &autocert.Manager{
+		Prompt: autocert.AcceptTOS,
+		// Only ever ask for certificates for our own domains, otherwise anyone could make us request
+		// certificates for arbitrary names by sending a different SNI
+		HostPolicy: autocert.HostWhitelist(cfg.Domains...),
+		Cache:      autocert.DirCache(cfg.CacheDir),
+		Email:      cfg.Email,
+	}
+	if cfg.Staging {
+		manager.Client = &acme.Client{DirectoryURL: "https://acme-staging-v02.api.letsencrypt.org/directory"}
+	}
+	return manager, nil
+}
+
+// keepHealthChecks answers /healthz and /readyz itself and passes everything else on,
+// so container health checks against the plain HTTP port keep working when it redirects to HTTPS
+func (s *Server) keepHealthChecks(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			handleHealthz(w, r)
+		case "/readyz":
+			s.handleReadyz(w, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// onlyTrustedH2C turns away HTTP/2 requests without TLS from anyone but the trusted proxies. h2c is
+// for the proxy's hop to us; browsers never use it, so anyone else speaking it is probing.
+func (s *Server) onlyTrustedH2C(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && r.TLS == nil && !s.isTrustedProxy(remoteIP(r)) {
+			http.Error(w, "HTTP/2 without TLS is only accepted from trusted proxies", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same path on the HTTPS server
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// requireMetricsToken protects /metrics with a bearer token, if one is configured.
+// Prometheus sends it with `authorization: {credentials: ...}` in the scrape config.
+func requireMetricsToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// negotiate picks the media type to answer with from offers, which are in the server's order of
+// preference, by the request's Accept header: the one the client gives the highest q, the earliest
+// offer among equals. Without an Accept header, or with an empty one, it is the first offer. It
+// returns "" when the client accepts none of them, which should be answered with 406.
+func negotiate(r *http.Request, offers []string) string {
+	accept := r.Header.Values("Accept")
+	if strings.TrimSpace(strings.Join(accept, "")) == "" {
+		return offers[0]
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q := acceptQuality(accept, offer)
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// acceptQuality is the q the Accept header gives a media type, taken from its most specific matching
+// range: image/webp over image/* over */*. 0 when nothing matches.
+func acceptQuality(accept []string, mediaType string) float64 {
+	kind, _, _ := strings.Cut(mediaType, "/")
+	q, specificity := 0.0, -1
+	for _, header := range accept {
+		for _, item := range strings.Split(header, ",") {
+			params := strings.Split(item, ";")
+			mediaRange := strings.ToLower(strings.TrimSpace(params[0]))
+
+			var matched int
+			switch {
+			case mediaRange == mediaType:
+				matched = 2
+			case mediaRange == kind+"/*":
+				matched = 1
+			case mediaRange == "*/*":
+				matched = 0
+			default:
+				continue
+			}
+			if matched <= specificity {
+				continue
+			}
+
+			specificity, q = matched, 1
+			for _, param := range params[1:] {
+				name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.EqualFold(name, "q") {
+					parsed, err := strconv.ParseFloat(value, 64)
+					if err == nil {
+						q = min(max(parsed, 0), 1)
+					}
+				}
+			}
+		}
+	}
+	return q
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/audit"
+	"github.com/nisarg-dave/camera-viewer/internal/auth"
+)
+
+// oidcStateCookieName holds the state and nonce between sending the browser to the provider and the callback
+const oidcStateCookieName = "camera_viewer_oidc"
+
+// handleOIDCLogin sends the browser to the identity provider's login page.
+// GET /api/oidc/login
+func (s *Server) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if s.oidcProvider == nil {
+		http.Error(w, "Single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+
+	state, err := auth.RandomPassword()
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := auth.RandomPassword()
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	// The provider sends the browser back with ?state=, which has to match this cookie.
+	// That stops another site from starting a login that ends up in our session.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    state + "." + nonce,
+		Path:     "/api/oidc/",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   s.isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, s.oidcProvider.AuthCodeURL(state, nonce), http.StatusFound)
+}
+
+// handleOIDCCallback is where the provider sends the browser back after logging in.
+// It maps the user's groups to a role, creates or updates their account and starts a session.
+// GET /api/oidc/callback?code=...&state=...
+func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if s.oidcProvider == nil {
+		http.Error(w, "Single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+
+	if providerError := r.URL.Query().Get("error"); providerError != "" {
+		log.Printf("OIDC login failed at the provider: %s %s", providerError, r.URL.Query().Get("error_description"))
+		http.Error(w, "Login failed at the identity provider", http.StatusUnauthorized)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookieName)
+	if err != nil {
+		http.Error(w, "Login expired, please try again", http.StatusBadRequest)
+		return
+	}
+	state, nonce, ok := strings.Cut(cookie.Value, ".")
+	if !ok || state != r.URL.Query().Get("state") {
+		http.Error(w, "Login state does not match, please try again", http.StatusBadRequest)
+		return
+	}
+
+	// The state cookie is single use
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    "",
+		Path:     "/api/oidc/",
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	identity, err := s.oidcProvider.Exchange(ctx, r.URL.Query().Get("code"), nonce)
+	if errors.Is(err, auth.ErrNoRole) {
+		log.Printf("OIDC user %s (groups %v) is not in any configured group", identity.Username, identity.Groups)
+		http.Error(w, "Your account does not have access to the cameras", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Printf("OIDC login failed: %v", err)
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.users.SyncExternal("oidc", identity.Username, identity.Role, identity.Cameras)
+	if errors.Is(err, auth.ErrLocalUser) {
+		log.Printf("OIDC user %s clashes with a local account", identity.Username)
+		http.Error(w, "A local account with this username already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to save OIDC user %s: %v", identity.Username, err)
+		http.Error(w, "Login failed", http.StatusInternalServerError)
+		return
+	}
+
+	err = s.startSession(w, r, user.Username)
+	if err != nil {
+		log.Printf("Failed to create session: %v", err)
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %s logged in through %s from %s (%s)", user.Username, s.oidcProvider.Name(), s.clientIP(r), user.Role)
+	s.recordAudit(r, audit.Entry{User: user.Username, Action: audit.ActionLogin, Detail: "oidc"})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
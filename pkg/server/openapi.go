@@ -0,0 +1,480 @@
+package server
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/backup"
+	"github.com/nisarg-dave/camera-viewer/internal/jobs"
+	"github.com/nisarg-dave/camera-viewer/internal/monitor"
+	"github.com/nisarg-dave/camera-viewer/internal/supervisor"
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+)
+
+// apiRoutes are the API routes in the order handleAPI registered them, for the OpenAPI document
+var (
+	apiRoutesMu sync.Mutex
+	apiRoutes   []string
+)
+
+// addAPIRoute remembers a route for the OpenAPI document. The admin listener registers some again.
+func addAPIRoute(pattern string) {
+	apiRoutesMu.Lock()
+	defer apiRoutesMu.Unlock()
+	if !slices.Contains(apiRoutes, pattern) {
+		apiRoutes = append(apiRoutes, pattern)
+	}
+}
+
+// apiOperation documents one method of an API route. Request and Response are zero values of the
+// types the handler decodes and encodes, so the schemas can't drift from what is actually sent.
+type apiOperation struct {
+	Summary string
+	// Who may call it: "public", "user" (logged in), "viewer" (logged in or a share link) or "admin"
+	Access string
+	// Query parameters and what they do
+	Query [][2]string
+	// The JSON body, nil for none
+	Request any
+	// The JSON response, or for a stream each message. nil for none.
+	Response any
+	// 200 when not set
+	Status int
+	// For responses that aren't a JSON document: "text/event-stream" or "websocket"
+	Stream string
+	// Whether it takes an Idempotency-Key header, see idempotent
+	Idempotent bool
+	// For responses that aren't JSON at all, e.g. images: the media types the Accept header picks from
+	Media []string
+}
+
+// apiDocs documents the API routes by pattern and method. A route handleAPI registers without an
+// entry here still shows up in the document, as undocumented.
+var apiDocs = map[string]map[string]apiOperation{
+	"/login": {
+		"POST": {Summary: "Log in and set the session cookie", Access: "public", Request: loginRequest{}, Response: loginResponse{}},
+	},
+	"/login/options": {
+		"GET": {Summary: "Which login methods are available", Access: "public", Response: loginOptionsResponse{}},
+	},
+	"/logout": {
+		"POST": {Summary: "End the session", Access: "user", Status: http.StatusNoContent},
+	},
+	"/me": {
+		"GET": {Summary: "The logged in user", Access: "viewer", Response: meResponse{}},
+	},
+	"/password": {
+		"POST": {Summary: "Change your password", Access: "user", Request: changePasswordRequest{}, Status: http.StatusNoContent},
+	},
+	"/totp/enroll": {
+		"POST": {Summary: "Start setting up two-factor authentication", Access: "user", Response: totpEnrollResponse{}, Idempotent: true},
+	},
+	"/totp/confirm": {
+		"POST": {Summary: "Turn on two-factor authentication with a code from the app", Access: "user", Request: totpCodeRequest{}, Status: http.StatusNoContent},
+	},
+	"/totp/disable": {
+		"POST": {Summary: "Turn off two-factor authentication", Access: "user", Request: totpCodeRequest{}, Status: http.StatusNoContent},
+	},
+	"/users": {
+		"GET":  {Summary: "List users", Access: "admin", Response: []userResponse{}},
+		"POST": {Summary: "Create a user", Access: "admin", Request: createUserRequest{}, Response: userResponse{}, Status: http.StatusCreated, Idempotent: true},
+	},
+	"/users/{username}": {
+		"PUT":    {Summary: "Change a user's role, cameras or password", Access: "admin", Request: updateUserRequest{}, Response: userResponse{}},
+		"DELETE": {Summary: "Delete a user", Access: "admin", Status: http.StatusNoContent},
+	},
+	"/share": {
+		"POST": {Summary: "Create a share link for one camera", Access: "admin", Request: shareRequest{}, Response: shareResponse{}, Idempotent: true},
+	},
+	"/offer": {
+		"POST": {Summary: "Start a viewer session and get the server's SDP offer", Access: "viewer", Response: offerResponse{}, Idempotent: true,
+			Query: [][2]string{{"camera", "The camera to watch"}, {"relay", "1 to only connect through TURN"}}},
+	},
+	"/answer": {
+		"POST": {Summary: "Complete a viewer session with the browser's SDP answer", Access: "viewer", Request: answerRequest{}, Response: answerResponse{},
+			Query: [][2]string{{"camera", "The camera being watched"}, {"wait", "1 to answer once the connection is up or has failed"}}},
+	},
+	"/sessions": {
+		"GET": {Summary: "Open viewer sessions, your own or (admins) everyone's", Access: "viewer", Response: []sessionResponse{},
+			Query: [][2]string{{"user", "Comma separated users"}, {"camera", "Comma separated cameras"},
+				{"connected", "true or false"}, {"sort", "started_at (default), bytes_sent or user, - for descending"},
+				{"limit", "1 to 500, default 50"}, {"offset", "Sessions to skip"}}},
+	},
+	"/whep": {
+		"POST": {Summary: "Start a viewer session for a WHEP player; the server offers, so the body is empty and the response is the SDP offer",
+			Access: "viewer", Status: http.StatusCreated, Media: []string{"application/sdp"},
+			Query: [][2]string{{"camera", "The camera to watch"}, {"relay", "1 to only connect through a TURN server"}}},
+	},
+	"/whep/{id}": {
+		"PATCH": {Summary: "Send a WHEP player's SDP answer (application/sdp) or its ICE candidates (application/trickle-ice-sdpfrag)",
+			Access: "viewer", Status: http.StatusNoContent},
+		"DELETE": {Summary: "End a WHEP session, like DELETE /sessions/{id}", Access: "viewer", Status: http.StatusNoContent},
+	},
+	"/sessions/{id}": {
+		"DELETE": {Summary: "End a viewer session, your own or (admins) anyone's", Access: "viewer", Status: http.StatusNoContent},
+	},
+	"/sessions/{id}/stats": {
+		"GET": {Summary: "WebRTC stats for a session", Access: "viewer", Response: sessionStatsResponse{}},
+	},
+	"/stats/ws": {
+		"GET": {Summary: "WebSocket pushing camera ingest stats and viewer bitrates", Access: "viewer", Response: statsSnapshot{}, Stream: "websocket",
+			Query: [][2]string{{"interval", "How often to push, e.g. 2s"}}},
+	},
+	"/ws": {
+		"GET": {Summary: "One WebSocket for signaling, events, stats and camera commands as typed messages", Access: "viewer",
+			Response: controlMessage{}, Stream: "websocket"},
+	},
+	"/version": {
+		"GET": {Summary: "Version, build and enabled features", Access: "user", Response: versionResponse{}},
+	},
+	"/cameras": {
+		"GET": {Summary: "Cameras with their state, codec, resolution, bitrate and viewer count", Access: "viewer", Response: []cameraStatus{}},
+	},
+	"/cameras/{id}/health": {
+		"GET": {Summary: "Whether the camera has sent video recently, 503 when it hasn't", Access: "viewer", Response: cameraHealth{},
+			Query: [][2]string{{"within", "How recently, e.g. 10s. Defaults to the stall timeout."}}},
+	},
+	"/cameras/{id}/history": {
+		"GET": {Summary: "One minute samples of the camera's stats", Access: "viewer", Response: historyResponse{},
+			Query: [][2]string{{"since", "How far back, e.g. 1h, or an RFC 3339 time. At most 24h."}}},
+	},
+	"/cameras/{id}/snapshot": {
+		"GET": {Summary: "A still image from the camera's next keyframe, as JPEG, WebP or PNG by the Accept header", Access: "viewer",
+			Media: snapshotTypes},
+	},
+	"/cameras/{id}/probe": {
+		"POST": {Summary: "Start a job that asks the camera's stream URLs which media they offer", Access: "admin",
+			Response: jobs.Job{}, Status: http.StatusAccepted, Idempotent: true},
+	},
+	"/ingest": {
+		"GET": {Summary: "Statistics for the video arriving from each camera", Access: "user", Response: map[string]monitor.IngestStats{}},
+	},
+	"/usage": {
+		"GET": {Summary: "Bandwidth sent this month", Access: "user", Response: usageMonthResponse{}},
+	},
+	"/summary": {
+		"GET": {Summary: "Totals for status bars: cameras online, viewers, bandwidth, disk and recent events", Access: "admin", Response: summaryResponse{}},
+	},
+	"/audit": {
+		"GET": {Summary: "Audit log, newest first", Access: "admin", Response: auditResponse{},
+			Query: [][2]string{{"user", "Only this user's actions"}, {"camera", "Only actions on this camera"},
+				{"action", "Comma separated actions"}, {"since", "RFC 3339 time"}, {"until", "RFC 3339 time"},
+				{"sort", "-time (default) or time"}, {"limit", "1 to 500, default 50"}, {"offset", "Entries to skip"}}},
+	},
+	"/config/export": {
+		"GET":  {Summary: "Back up the config and users, with secrets redacted", Access: "admin", Response: backup.Document{}},
+		"POST": {Summary: "Back up the config and users, with secrets encrypted", Access: "admin", Request: exportRequest{}, Response: backup.Document{}},
+	},
+	"/config/import": {
+		"POST": {Summary: "Restore a backup; the config takes effect on restart", Access: "admin", Request: importRequest{}, Response: importResponse{}},
+	},
+	"/jobs": {
+		"GET": {Summary: "Background jobs, your own or (admins) everyone's", Access: "user", Response: []jobs.Job{},
+			Query: [][2]string{{"type", "Comma separated job types, e.g. probe_camera"}, {"state", "queued, running, succeeded, failed or cancelled"},
+				{"sort", "-created_at (default), type or state"}, {"limit", "1 to 500, default 50"}, {"offset", "Jobs to skip"}}},
+	},
+	"/jobs/{id}": {
+		"GET":    {Summary: "A job's progress, and once it has finished its result or error", Access: "user", Response: jobs.Job{}},
+		"DELETE": {Summary: "Cancel a queued or running job", Access: "user", Response: jobs.Job{}},
+	},
+	"/subsystems": {
+		"GET": {Summary: "Background subsystems and their restarts", Access: "admin", Response: []supervisor.SubsystemStatus{}},
+	},
+	"/debug/goroutines": {
+		"GET": {Summary: "Goroutine counts, or every stack as text with stacks=1", Access: "admin", Response: goroutineCounts{},
+			Query: [][2]string{{"stacks", "1 for every goroutine's stack"}}},
+	},
+	"/debug/capture": {
+		"GET": {Summary: "The camera's RTP for a while, as a pcap or rtpdump file", Access: "admin",
+			Query: [][2]string{{"duration", "How long to capture, up to 1m, default 10s"}, {"format", "pcap (default) or rtpdump"},
+				{"viewers", "1 to add the packets sent to viewers, pcap only"}},
+			Media: []string{"application/octet-stream"}},
+	},
+	"/ratelimit": {
+		"GET": {Summary: "Requests rejected by rate limits and lockouts", Access: "admin", Response: map[string]uint64{}},
+	},
+	"/events": {
+		"GET": {Summary: "Recent events, newest first", Access: "user", Response: eventsResponse{},
+			Query: [][2]string{{"camera", "Only this camera's events"}, {"type", "Comma separated event types"},
+				{"since", "RFC 3339 time"}, {"until", "RFC 3339 time"}, {"sort", "-time (default) or time"},
+				{"limit", "1 to 500, default 50"}, {"offset", "Events to skip"}}},
+	},
+	"/events/stream": {
+		"GET": {Summary: "Live events as Server-Sent Events", Access: "user", Response: events.Event{}, Stream: "text/event-stream",
+			Query: [][2]string{{"camera", "Only this camera's events"}, {"type", "Comma separated event types"}}},
+	},
+}
+
+// pathParameter finds the {name} parts of a route pattern
+var pathParameter = regexp.MustCompile(`\{([^}.]+)\}`)
+
+// openAPIDocument builds the OpenAPI 3.1 document for /api/v1 from the registered routes.
+// The server builds it once, after the routes are registered, on the first request for it.
+func (s *Server) openAPIDocument() []byte {
+	errorSchema := jsonSchema(reflect.TypeOf(struct {
+		Error apiError `json:"error"`
+	}{}))
+	paths := map[string]any{}
+
+	apiRoutesMu.Lock()
+	routes := slices.Clone(apiRoutes)
+	apiRoutesMu.Unlock()
+
+	for _, pattern := range routes {
+		var parameters []map[string]any
+		for _, match := range pathParameter.FindAllStringSubmatch(pattern, -1) {
+			parameters = append(parameters, map[string]any{
+				"name": match[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+			})
+		}
+
+		operations, ok := apiDocs[pattern]
+		if !ok {
+			operations = map[string]apiOperation{"GET": {Summary: "Not documented yet", Access: "user"}}
+		}
+		item := map[string]any{}
+		if len(parameters) > 0 {
+			item["parameters"] = parameters
+		}
+		for method, op := range operations {
+			item[strings.ToLower(method)] = openAPIOperation(op, errorSchema)
+		}
+		paths[pattern] = item
+	}
+
+	document := map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":   "Camera Viewer API",
+			"version": s.version,
+			"description": "Successful JSON responses are wrapped in {\"data\": ...} and errors are " +
+				"{\"error\": {\"code\", \"message\", \"details\"}}.",
+		},
+		"servers": []map[string]any{{"url": "/api/v1"}},
+		"paths":   paths,
+		"components": map[string]any{
+			"securitySchemes": map[string]any{
+				"session": map[string]any{"type": "apiKey", "in": "cookie", "name": sessionCookieName},
+				"share":   map[string]any{"type": "apiKey", "in": "query", "name": "share"},
+			},
+		},
+	}
+	data, _ := json.MarshalIndent(document, "", "  ")
+	return data
+}
+
+// openAPIOperation describes one operation, with its success response and the error every one can return
+func openAPIOperation(op apiOperation, errorSchema map[string]any) map[string]any {
+	operation := map[string]any{
+		"summary":  op.Summary,
+		"x-access": op.Access,
+	}
+	switch op.Access {
+	case "public":
+		operation["security"] = []map[string]any{}
+	case "viewer":
+		operation["security"] = []map[string]any{{"session": []string{}}, {"share": []string{}}}
+	default:
+		operation["security"] = []map[string]any{{"session": []string{}}}
+	}
+
+	var parameters []map[string]any
+	for _, query := range op.Query {
+		parameters = append(parameters, map[string]any{
+			"name": query[0], "in": "query", "description": query[1], "schema": map[string]any{"type": "string"},
+		})
+	}
+	if op.Idempotent {
+		parameters = append(parameters, map[string]any{
+			"name": "Idempotency-Key", "in": "header",
+			"description": "Any unique value, up to 255 characters. Retrying with the same key returns the first response instead of doing it again.",
+			"schema":      map[string]any{"type": "string", "maxLength": 255},
+		})
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+
+	if op.Request != nil {
+		operation["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": jsonSchema(reflect.TypeOf(op.Request))}},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]any{"description": http.StatusText(status)}
+	switch {
+	case op.Stream == "websocket":
+		success["description"] = "Switches to a WebSocket whose messages are JSON like this"
+		success["content"] = map[string]any{"application/json": map[string]any{"schema": jsonSchema(reflect.TypeOf(op.Response))}}
+	case len(op.Media) > 0:
+		success["description"] = "In the type the Accept header prefers, 406 when it accepts none of these"
+		content := map[string]any{}
+		for _, mediaType := range op.Media {
+			content[mediaType] = map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}
+		}
+		success["content"] = content
+	case op.Stream != "":
+		success["description"] = "A stream where each message's data is JSON like this"
+		success["content"] = map[string]any{op.Stream: map[string]any{"schema": jsonSchema(reflect.TypeOf(op.Response))}}
+	case op.Response != nil:
+		data := map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"data": jsonSchema(reflect.TypeOf(op.Response))},
+		}
+		success["content"] = map[string]any{"application/json": map[string]any{"schema": data}}
+	}
+
+	operation["responses"] = map[string]any{
+		jsonStatus(status): success,
+		"default": map[string]any{
+			"description": "An error",
+			"content":     map[string]any{"application/json": map[string]any{"schema": errorSchema}},
+		},
+	}
+	return operation
+}
+
+// jsonStatus is a status code as an OpenAPI responses key
+func jsonStatus(status int) string {
+	data, _ := json.Marshal(status)
+	return string(data)
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(config.Duration(0))
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// jsonSchema describes how encoding/json writes a value of type t
+func jsonSchema(t reflect.Type) map[string]any {
+	return jsonSchemaSeen(t, map[reflect.Type]bool{})
+}
+
+func jsonSchemaSeen(t reflect.Type, seen map[reflect.Type]bool) map[string]any {
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]any{"type": "string", "description": "A duration like \"10s\""}
+	}
+	if t.Kind() == reflect.Pointer {
+		return jsonSchemaSeen(t.Elem(), seen)
+	}
+	if t.Implements(jsonMarshalerType) {
+		return map[string]any{}
+	}
+	if t.Implements(textMarshalerType) {
+		return map[string]any{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": jsonSchemaSeen(t.Elem(), seen)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchemaSeen(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			return map[string]any{"type": "object"}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		properties := map[string]any{}
+		addStructFields(t, properties, seen)
+		return map[string]any{"type": "object", "properties": properties}
+	}
+	// Interfaces can hold anything
+	return map[string]any{}
+}
+
+// addStructFields adds a struct's JSON fields to properties, including those of embedded structs
+func addStructFields(t reflect.Type, properties map[string]any, seen map[reflect.Type]bool) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				addStructFields(embedded, properties, seen)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = jsonSchemaSeen(field.Type, seen)
+	}
+}
+
+// handleOpenAPI serves the OpenAPI document describing /api/v1, for generating clients.
+// It needs no login, since it says nothing the README doesn't.
+// GET /api/openapi.json
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(s.openAPI())
+}
+
+// swaggerUIPage shows the OpenAPI document with Swagger UI, loaded from a CDN
+const swaggerUIPage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Camera Viewer API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>SwaggerUIBundle({url: "/api/openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+// handleAPIDocs serves Swagger UI for trying the API out in the browser, when api_docs.swagger_ui is on.
+// GET /api/docs
+func handleAPIDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUIPage))
+}
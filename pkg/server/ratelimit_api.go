@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/ratelimit"
+)
+
+// rateLimited turns away requests from IPs that are over the limiter's rate with 429 Too Many Requests
+func (s *Server) rateLimited(limiter *ratelimit.Limiter, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Preflight requests don't do anything, so don't count them
+		if r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+
+		ok, retryAfter := limiter.Allow(s.clientIP(r))
+		if !ok {
+			tooManyRequests(w, retryAfter)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// checkLockout writes a 429 response and returns false if the client's IP, or the username, is locked out
+func (s *Server) checkLockout(w http.ResponseWriter, r *http.Request, username string) bool {
+	for _, key := range s.lockoutKeys(r, username) {
+		locked, remaining := key.lockout.Locked(key.key)
+		if locked {
+			log.Printf("Rejected login for %q from %s: %s locked out for another %s", username, s.clientIP(r), key.key, remaining.Round(time.Second))
+			tooManyRequests(w, remaining)
+			return false
+		}
+	}
+	return true
+}
+
+// recordLoginFailure counts a failed login against the IP and against the username
+func (s *Server) recordLoginFailure(r *http.Request, username string) {
+	for _, key := range s.lockoutKeys(r, username) {
+		lock := key.lockout.Failure(key.key)
+		if lock > 0 {
+			log.Printf("Locked out %s for %s after repeated failed logins", key.key, lock)
+		}
+	}
+}
+
+// recordLoginSuccess clears the failures for the IP and the username
+func (s *Server) recordLoginSuccess(r *http.Request, username string) {
+	for _, key := range s.lockoutKeys(r, username) {
+		key.lockout.Success(key.key)
+	}
+}
+
+// lockoutKey is what a login attempt counts against in one of the lockouts
+type lockoutKey struct {
+	lockout *ratelimit.Lockout
+	key     string
+}
+
+// lockoutKeys returns what a login attempt counts against: the IP, which stops one client guessing,
+// and the username from any IP, which stops many clients spraying guesses at one account. The
+// username's lockout has a higher threshold and never grows past lockout_base, so failing to log in
+// as someone only slows guesses at their password down instead of locking them out for long.
+func (s *Server) lockoutKeys(r *http.Request, username string) []lockoutKey {
+	keys := []lockoutKey{{lockout: s.loginLockout, key: "ip:" + s.clientIP(r)}}
+	if username != "" {
+		keys = append(keys, lockoutKey{lockout: s.accountLockout, key: "user:" + username})
+	}
+	return keys
+}
+
+func tooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	// Round up so clients don't retry a moment too early
+	seconds := int((retryAfter + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, "Too many requests, try again later", http.StatusTooManyRequests)
+}
+
+// handleRateLimitStats returns how many requests have been rejected by the rate limits and lockouts.
+// Admin only.
+// GET /api/ratelimit
+func (s *Server) handleRateLimitStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]uint64{
+		"login_rate_limited":     s.loginLimiter.Rejected(),
+		"signaling_rate_limited": s.signalingLimiter.Rejected(),
+		"locked_out":             s.loginLockout.Rejected() + s.accountLockout.Rejected(),
+	})
+}
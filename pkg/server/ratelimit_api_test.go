@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+)
+
+// TestAccountLockoutAcrossIPs spreads failed logins for one account over many IPs, none of which
+// fails often enough to be locked out itself, and checks the account is locked out anyway, for no
+// longer than lockout_base, while other accounts can still be logged in to
+func TestAccountLockoutAcrossIPs(t *testing.T) {
+	cfg, err := config.Load(filepath.Join(t.TempDir(), "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DataDir = t.TempDir()
+
+	srv, err := New(Options{
+		Config:        cfg,
+		Camera:        Camera{ID: "front", URL: "rtsp://127.0.0.1:1/stream"},
+		NoListeners:   true,
+		AdminPassword: "correct horse battery staple",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.abort()
+
+	login := func(ip int, username, password string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"username": %q, "password": %q}`, username, password)
+		r := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(body))
+		r.RemoteAddr = fmt.Sprintf("198.51.100.%d:40000", ip)
+		w := httptest.NewRecorder()
+		srv.handleLogin(w, r)
+		return w
+	}
+
+	// One failure per IP, well under lockout_threshold for any of them
+	for ip := range cfg.RateLimit.AccountLockoutThreshold {
+		w := login(ip, "admin", "wrong password")
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("failed login %d: got %d, want %d", ip+1, w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// Even the right password from an IP that hasn't failed yet is turned away while the account is locked
+	w := login(200, "admin", "correct horse battery staple")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("login to the sprayed account: got %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	retryAfter, _ := strconv.Atoi(w.Header().Get("Retry-After"))
+	if base := time.Duration(cfg.RateLimit.LockoutBase); time.Duration(retryAfter)*time.Second > base {
+		t.Errorf("the account is locked for %ds, want at most lockout_base (%s)", retryAfter, base)
+	}
+
+	// The IPs themselves aren't locked out, so another account can still be tried from them
+	w = login(0, "someone-else", "wrong password")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("login to another account: got %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// requestIDContextKey stores the request's correlation ID on the request context
+const requestIDContextKey contextKey = "request_id"
+
+// requestIDHeader carries the correlation ID. It is sent back on every response, and accepted
+// from trusted proxies so a proxy's access log lines up with ours.
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID keeps IDs from proxies to something that is safe to put in log lines
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestID returns the request's correlation ID, or "" outside logRequests
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+// requestLogf logs a line prefixed with the request's correlation ID,
+// so everything a request led to can be found with one grep
+func requestLogf(r *http.Request, format string, args ...any) {
+	log.Printf("[%s] %s", requestID(r), fmt.Sprintf(format, args...))
+}
+
+// logRequests gives every request a correlation ID and writes an access log line once it is done
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || !validRequestID.MatchString(id) || !s.isTrustedProxy(remoteIP(r)) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDContextKey, id))
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		log.Printf("[%s] %s %s %d %dB %s %s", id, r.Method, r.URL.Path, recorder.status, recorder.bytes,
+			time.Since(start).Round(time.Millisecond), s.clientIP(r))
+	})
+}
+
+// statusRecorder remembers the status code and size of a response for the access log.
+// It passes Flush and Hijack through so Server-Sent Events and WebSockets keep working.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if !s.wroteHeader {
+		s.status = status
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(data []byte) (int, error) {
+	s.wroteHeader = true
+	n, err := s.ResponseWriter.Write(data)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response does not support hijacking")
+	}
+	// A hijacked connection is a WebSocket upgrade
+	s.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
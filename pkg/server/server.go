@@ -0,0 +1,879 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/atomicfile"
+	"github.com/nisarg-dave/camera-viewer/internal/audio"
+	"github.com/nisarg-dave/camera-viewer/internal/audit"
+	"github.com/nisarg-dave/camera-viewer/internal/auth"
+	"github.com/nisarg-dave/camera-viewer/internal/backup"
+	"github.com/nisarg-dave/camera-viewer/internal/idempotency"
+	"github.com/nisarg-dave/camera-viewer/internal/jobs"
+	"github.com/nisarg-dave/camera-viewer/internal/logging"
+	"github.com/nisarg-dave/camera-viewer/internal/metrics"
+	"github.com/nisarg-dave/camera-viewer/internal/monitor"
+	"github.com/nisarg-dave/camera-viewer/internal/mqtt"
+	"github.com/nisarg-dave/camera-viewer/internal/notify"
+	"github.com/nisarg-dave/camera-viewer/internal/ratelimit"
+	"github.com/nisarg-dave/camera-viewer/internal/supervisor"
+	"github.com/nisarg-dave/camera-viewer/internal/tracing"
+	"github.com/nisarg-dave/camera-viewer/internal/transcode"
+	"github.com/nisarg-dave/camera-viewer/internal/web"
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+	"github.com/nisarg-dave/camera-viewer/pkg/stream"
+	"github.com/nisarg-dave/camera-viewer/pkg/viewers"
+
+	"github.com/pion/ice/v4"
+	"github.com/pion/rtp"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc"
+)
+
+// Camera is how the server reaches its camera
+type Camera struct {
+	// How events, and anything consuming them, refer to the camera. Defaults to "camera1".
+	ID string
+	// The RTSP URL with the credentials in it, rtsp:// or rtsps:// for cameras that only offer RTSP over TLS
+	URL string
+	// An optional backup stream, e.g. the camera's sub-stream or an NVR relay, for when the main stream keeps failing
+	FailoverURL string
+	// Where the camera is and who to log in as, for backups and keyframe requests. The password is
+	// never exported.
+	Host     string
+	Port     string
+	Username string
+	Password string
+	// How the camera's certificate is checked for rtsps://
+	TLS stream.TLSOptions
+}
+
+// Options configures a Server
+type Options struct {
+	Config *config.Config
+	// Where Config was loaded from. Imported backups are written there.
+	ConfigPath string
+	Camera     Camera
+	// Password for the admin account created when there are no users yet
+	AdminPassword string
+	// The web UI, served at /. Defaults to the one built into the binary, see the web package.
+	Frontend http.FileSystem
+	// Leaves the HTTP listeners (and the admin listener) to the caller, who serves Handler on a
+	// server of their own. Run still runs the camera and viewers, and shuts them down with its context.
+	NoListeners bool
+	// Shown by GET /api/version; when empty they are taken from the build information Go embeds
+	Version   string
+	Commit    string
+	BuildDate string
+}
+
+// Server is the RTSP to WebRTC gateway: the camera's connection, its viewers and the HTTP API
+type Server struct {
+	opts    Options
+	handler http.Handler
+	// Cancelled when Run's context is, or when New fails. The camera connection, viewers' peer
+	// connections and HTTP requests all hang off it, so cancelling it reaches everything.
+	ctx    context.Context
+	cancel context.CancelFunc
+	usage  *viewers.Usage
+	// Sets up viewer sessions, for the API and Watch
+	signaling *signaling
+	// Undo what New set up, run in reverse order once Run has shut everything down
+	closers []func()
+	// Called by Run once the listeners are up, see OnReady
+	ready []func()
+
+	rtspStream   *stream.RTSPStream
+	// The camera's video as everything but the RTSP set up sees it, which is rtspStream
+	videoSource stream.VideoSource
+	// Everyone currently watching, each with their own WebRTC peer connection
+	viewerSessions *viewers.Manager
+	// The camera's video codec (H264, H265, AV1 or MPEG4), empty until it has connected for the first time
+	videoCodec atomic.Value
+	eventBus     *events.Bus
+	eventHistory *events.History
+	cameraID     string
+	// Watches the camera's packets for dropped connections, stalls and tampering
+	streamMonitor *monitor.StreamMonitor
+	// Set when the server starts shutting down, so no new viewers are accepted
+	shuttingDown atomic.Bool
+	// Keeps the camera connected, reconnecting when it drops or stops sending packets
+	cameraSupervisor *supervisor.Camera
+	// Runs the background jobs (event consumers, monitors) and restarts them when they fail
+	subsystems *supervisor.Tree
+	// The one UDP port every viewer connects to when batch_writes is on, nil otherwise
+	udpMux ice.UDPMux
+	// Watches the free space where the data directory is
+	diskMonitor *monitor.DiskMonitor
+	// Makes H264 from an H265 camera's video for browsers that can't play H265, nil when transcode isn't configured
+	transcoder *transcode.Transcoder
+	// Asks the camera for a keyframe when a viewer's picture breaks, nil when keyframe_request isn't configured
+	cameraKeyframeRequests *cameraKeyframes
+	// Takes the images for GET /api/cameras/{id}/snapshot and the chat notifiers
+	snapshotter *transcode.Snapshotter
+	// The capture running for GET /api/debug/capture, nil when there is none
+	activeCapture atomic.Pointer[packetCapture]
+	// The in-memory history behind /api/cameras/{id}/history
+	metricsHistory *metrics.History
+	// The bits per second sent to all viewers over the last outboundInterval, as math.Float64bits
+	outboundBps atomic.Uint64
+	// Runs the long operations started through the API, see GET /api/jobs/{id}
+	jobManager *jobs.Manager
+
+	users        *auth.UserStore
+	sessions     *auth.SessionStore
+	authDisabled bool
+	// Single sign-on provider, nil when OIDC isn't configured
+	oidcProvider *auth.OIDCProvider
+	// Signs and checks the tokens in share links
+	shareSigner *auth.ShareSigner
+	// Which other origins may call the API
+	corsPolicy config.CORS
+	// The reverse proxies whose X-Forwarded-* headers we believe
+	trustedProxies []netip.Prefix
+	// Per-IP limits for the login and signaling endpoints
+	loginLimiter     *ratelimit.Limiter
+	signalingLimiter *ratelimit.Limiter
+	// Locks out IPs, and usernames from one IP, after repeated failed logins
+	loginLockout *ratelimit.Lockout
+	// Failed logins per username from any IP, see lockoutKeys
+	accountLockout *ratelimit.Lockout
+	// Records who did what, see GET /api/audit
+	auditLog *audit.Log
+	// Remembers the responses sent for Idempotency-Keys
+	idempotencyStore *idempotency.Store
+	// Where servers started outside serve, like the admin listener and the gRPC service, report
+	// that they have failed, so serve returns and everything shuts down
+	listenerErrs chan error
+
+	// The config file, and the config loaded from it, that backups are made from and restored to
+	configPath   string
+	loadedConfig *config.Config
+	// How the camera is reached, for backups. Its password is never exported.
+	backupCamera backup.Camera
+
+	// From Options, which the camera-viewer command sets at build time (see its main.go). When they
+	// aren't set, the commit and date are taken from the VCS information Go embeds in the binary.
+	version   string
+	commit    string
+	buildDate string
+	// The optional features turned on in the config, worked out once at startup
+	enabledFeatures []string
+	// The OpenAPI document for /api/v1, see openAPIDocument
+	openAPI func() []byte
+}
+
+// New sets up the server from opts and starts its background work (event consumers, monitors and
+// the like). The camera is connected to and the API served once Run is called.
+func New(opts Options) (*Server, error) {
+	cfg := opts.Config
+	if cfg == nil {
+		return nil, fmt.Errorf("a config is required")
+	}
+	if opts.Camera.ID == "" {
+		opts.Camera.ID = "camera1"
+	}
+	if opts.Frontend == nil {
+		opts.Frontend = http.FS(web.FS())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		opts:             opts,
+		ctx:              ctx,
+		cancel:           cancel,
+		metricsHistory:   metrics.NewHistory(historySize),
+		idempotencyStore: idempotency.NewStore(idempotencyKeyTTL, maxIdempotencyEntries, maxIdempotencyBytes),
+		listenerErrs:     make(chan error, 8),
+		version:          "dev",
+		commit:           opts.Commit,
+		buildDate:        opts.BuildDate,
+	}
+	if opts.Version != "" {
+		s.version = opts.Version
+	}
+	s.openAPI = sync.OnceValue(s.openAPIDocument)
+	fail := func(err error) (*Server, error) {
+		s.abort()
+		return nil, err
+	}
+
+	username, password := opts.Camera.Username, opts.Camera.Password
+	logging.AddSecret(password)
+
+	s.cameraID = opts.Camera.ID
+	s.backupCamera = backup.Camera{ID: s.cameraID, Host: opts.Camera.Host, Port: opts.Camera.Port, Username: username}
+
+	s.configPath = opts.ConfigPath
+	redactConfigSecrets(cfg)
+	s.loadedConfig = cfg
+	s.enabledFeatures = configFeatures(cfg)
+	log.Printf("Camera viewer %s (%s), features: %v", s.version, runtime.Version(), s.enabledFeatures)
+
+	// With many viewers on one camera, sending their packets in batches saves a system call per packet
+	var err error
+	if cfg.WebRTC.BatchWrites != nil {
+		s.udpMux, err = stream.NewBatchedUDPMux(stream.BatchConfig{
+			Port:     cfg.WebRTC.BatchWrites.Port,
+			Size:     cfg.WebRTC.BatchWrites.Size,
+			Interval: time.Duration(cfg.WebRTC.BatchWrites.Interval),
+		})
+		if err != nil {
+			return fail(fmt.Errorf("failed to set up batched UDP writes: %w", err))
+		}
+		s.closers = append(s.closers, func() { s.udpMux.Close() })
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return fail(fmt.Errorf("failed to set up tracing: %w", err))
+	}
+	s.closers = append(s.closers, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownTracing(ctx)
+	})
+
+	// A file being replaced when the server last stopped, e.g. in a crash, leaves a temporary one next to it
+	removed, err := atomicfile.RemoveStale(filepath.Join(cfg.DataDir, "users.json"), filepath.Join(cfg.DataDir, "usage.json"), s.configPath)
+	for _, path := range removed {
+		log.Printf("Removed %s, left over from before the last restart", path)
+	}
+	if err != nil {
+		log.Printf("Failed to remove leftover temporary files: %v", err)
+	}
+
+	s.users, err = auth.LoadUserStore(filepath.Join(cfg.DataDir, "users.json"))
+	if err != nil {
+		return fail(fmt.Errorf("failed to load users: %w", err))
+	}
+	err = bootstrapAdmin(s.users, opts.AdminPassword)
+	if err != nil {
+		return fail(fmt.Errorf("failed to create admin user: %w", err))
+	}
+	s.sessions = auth.NewSessionStore(time.Duration(cfg.Auth.SessionTTL))
+	s.trustedProxies, err = parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return fail(fmt.Errorf("invalid config: %w", err))
+	}
+
+	s.corsPolicy = cfg.CORS
+	if slices.Contains(s.corsPolicy.AllowedOrigins, "*") && s.corsPolicy.AllowCredentials {
+		return fail(fmt.Errorf("invalid CORS config: allowed_origins \"*\" can't be combined with allow_credentials"))
+	}
+
+	s.auditLog, err = audit.Open(filepath.Join(cfg.DataDir, "audit.log"))
+	if err != nil {
+		return fail(fmt.Errorf("failed to open audit log: %w", err))
+	}
+	s.closers = append(s.closers, func() { s.auditLog.Close() })
+
+	s.loginLimiter = ratelimit.NewLimiter(cfg.RateLimit.Login.PerMinute, cfg.RateLimit.Login.Burst)
+	s.signalingLimiter = ratelimit.NewLimiter(cfg.RateLimit.Signaling.PerMinute, cfg.RateLimit.Signaling.Burst)
+	s.loginLockout = ratelimit.NewLockout(cfg.RateLimit.LockoutThreshold, time.Duration(cfg.RateLimit.LockoutBase), time.Duration(cfg.RateLimit.LockoutMax))
+	s.accountLockout = ratelimit.NewLockout(cfg.RateLimit.AccountLockoutThreshold, time.Duration(cfg.RateLimit.LockoutBase), time.Duration(cfg.RateLimit.LockoutBase))
+
+	// The limiters keep their own counts; expose them as metrics too. With more than one server in
+	// a program the metrics are their totals.
+	s.closers = append(s.closers,
+		metrics.CounterFunc("rate_limited_requests_total", "Requests rejected by a per-IP rate limit.", map[string]string{"limit": "login"},
+			func() float64 { return float64(s.loginLimiter.Rejected()) }),
+		metrics.CounterFunc("rate_limited_requests_total", "Requests rejected by a per-IP rate limit.", map[string]string{"limit": "signaling"},
+			func() float64 { return float64(s.signalingLimiter.Rejected()) }),
+		metrics.CounterFunc("login_lockout_rejections_total", "Login attempts refused because the user or IP was locked out.", nil,
+			func() float64 { return float64(s.loginLockout.Rejected() + s.accountLockout.Rejected()) }))
+
+	s.shareSigner, err = auth.LoadShareSigner(filepath.Join(cfg.DataDir, "share.key"))
+	if err != nil {
+		return fail(fmt.Errorf("failed to load share key: %w", err))
+	}
+	s.authDisabled = cfg.Auth.Disabled
+	if s.authDisabled {
+		log.Println("WARNING: authentication is disabled, anyone who can reach this server can view the cameras")
+	}
+	if cfg.Auth.OIDC != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		s.oidcProvider, err = auth.NewOIDCProvider(ctx, *cfg.Auth.OIDC)
+		cancel()
+		if err != nil {
+			return fail(fmt.Errorf("failed to set up single sign-on: %w", err))
+		}
+		log.Printf("Single sign-on enabled through %s", cfg.Auth.OIDC.Issuer)
+	}
+
+	// New offers are refused from the moment shutdown starts
+	context.AfterFunc(ctx, func() {
+		log.Println("Shutting down...")
+		s.shuttingDown.Store(true)
+	})
+
+	// Background jobs run under the supervisor tree, which restarts any that fail.
+	// It is stopped last in shutdown, so event consumers see everything that happens while shutting down.
+	s.subsystems = supervisor.NewTree()
+
+	s.eventBus = events.NewBus()
+	// Long operations started through the API, like camera probes, run here and are polled for
+	s.startJobManager(ctx)
+	s.eventBus.SetCooldowns(cooldownRules(cfg.Cooldowns))
+	s.subsystems.Go("event_log", func(stop <-chan struct{}) { logEvents(s.eventBus, stop) })
+	s.subsystems.Go("event_metrics", func(stop <-chan struct{}) { metrics.CountEvents(s.eventBus, stop) })
+
+	// Keep the last 1000 events around for GET /api/events
+	s.eventHistory = events.NewHistory(1000)
+	s.subsystems.Go("event_history", func(stop <-chan struct{}) { s.eventHistory.Run(s.eventBus, stop) })
+
+	// Webhooks and notifiers are kept by name so rules can refer to them
+	webhooks := make(map[string]*notify.Webhook)
+	for _, webhookConfig := range cfg.Webhooks {
+		webhook, err := notify.NewWebhook(webhookConfig)
+		if err != nil {
+			return fail(fmt.Errorf("invalid webhook config: %w", err))
+		}
+		webhooks[webhookConfig.Name] = webhook
+		if !webhookConfig.OnlyRules {
+			s.subsystems.Go("webhook:"+webhookConfig.Name, func(stop <-chan struct{}) { webhook.Run(s.eventBus, stop) })
+		}
+	}
+	log.Printf("Loaded %d webhook(s)", len(cfg.Webhooks))
+
+	// Snapshots are made with the transcoder's ffmpeg, or the one on the PATH without it
+	snapshotFFmpeg := ""
+	if cfg.Transcode != nil {
+		snapshotFFmpeg = cfg.Transcode.FFmpeg
+	}
+	s.snapshotter = transcode.NewSnapshotter(snapshotFFmpeg, func() [][]byte { return s.videoSource.VideoParameterSets() })
+
+	notifiers := make(map[string]*notify.ChatNotifier)
+	for _, notifierConfig := range cfg.Notifiers {
+		notifier, err := notify.NewChatNotifier(notifierConfig, s.notifierSnapshot)
+		if err != nil {
+			return fail(fmt.Errorf("invalid notifier config: %w", err))
+		}
+		notifiers[notifierConfig.Name] = notifier
+		s.subsystems.Go("notifier:"+notifierConfig.Name, func(stop <-chan struct{}) { notifier.Run(s.eventBus, stop) })
+	}
+
+	ruleEngine, err := s.newRuleEngine(cfg.Rules, webhooks, notifiers)
+	if err != nil {
+		return fail(fmt.Errorf("invalid rules config: %w", err))
+	}
+	s.subsystems.Go("rules", func(stop <-chan struct{}) { ruleEngine.Run(s.eventBus, stop) })
+
+	if cfg.MQTT != nil {
+		bridge, err := mqtt.NewBridge(*cfg.MQTT, []string{s.cameraID})
+		if err != nil {
+			return fail(fmt.Errorf("invalid MQTT config: %w", err))
+		}
+		bridge.Handle("enable", s.auditedCameraCommand("mqtt", audit.ActionCameraEnabled, s.enableCamera))
+		bridge.Handle("disable", s.auditedCameraCommand("mqtt", audit.ActionCameraDisabled, s.disableCamera))
+
+		err = bridge.Start(s.eventBus)
+		if err != nil {
+			return fail(fmt.Errorf("failed to start MQTT bridge: %w", err))
+		}
+		s.closers = append(s.closers, bridge.Close)
+	}
+
+	s.rtspStream = stream.NewRTSPStream(opts.Camera.URL)
+	s.videoSource = s.rtspStream
+	s.rtspStream.SetTimeouts(stream.Timeouts{
+		Read:      time.Duration(cfg.RTSP.ReadTimeout),
+		Write:     time.Duration(cfg.RTSP.WriteTimeout),
+		Keepalive: time.Duration(cfg.RTSP.KeepalivePeriod),
+	})
+	if cfg.RTSP.JitterBuffer != nil {
+		s.rtspStream.SetJitterBuffer(cfg.RTSP.JitterBuffer.Packets, time.Duration(cfg.RTSP.JitterBuffer.Latency))
+	}
+
+	if strings.HasPrefix(opts.Camera.URL, "rtsps://") {
+		tlsConfig, err := stream.NewTLSConfig(opts.Camera.TLS)
+		if err != nil {
+			return fail(fmt.Errorf("invalid RTSP TLS settings: %w", err))
+		}
+		s.rtspStream.SetTLSConfig(tlsConfig)
+	}
+
+	// Audio has to be requested before connecting, so the detector is set up first
+	if cfg.Audio != nil {
+		var classifier audio.Classifier
+		if len(cfg.Audio.ClassifierCommand) > 0 {
+			classifier, err = audio.NewExecClassifier(cfg.Audio.ClassifierCommand)
+			if err != nil {
+				return fail(fmt.Errorf("invalid audio classifier: %w", err))
+			}
+		}
+
+		detector := audio.NewDetector(s.cameraID, s.eventBus, *cfg.Audio, classifier)
+		s.rtspStream.SetAudioHandler(detector.Process)
+	}
+
+	alertConfig := config.StreamAlerts{}
+	if cfg.StreamAlerts != nil {
+		alertConfig = *cfg.StreamAlerts
+	}
+	s.streamMonitor = monitor.NewStreamMonitor(s.cameraID, s.eventBus, alertConfig)
+
+	// The supervisor reconnects the camera when the connection drops or stops delivering packets
+	s.cameraSupervisor = supervisor.NewCamera(ctx, s.cameraID, s.rtspStream, s.streamMonitor, s.eventBus, cfg.Reconnect)
+	s.rtspStream.SetDisconnectHandler(s.cameraSupervisor.Disconnected)
+	if opts.Camera.FailoverURL != "" {
+		s.cameraSupervisor.SetFailoverURL(opts.Camera.FailoverURL)
+	}
+
+	s.subsystems.Go("stream_monitor", s.streamMonitor.Run)
+
+	s.diskMonitor = monitor.NewDiskMonitor(cfg.DataDir, uint64(cfg.Storage.MinFreeGB*1e9), s.eventBus)
+	s.subsystems.Go("disk_monitor", s.diskMonitor.Run)
+
+	s.cameraSupervisor.OnConnected(s.publishCameraConnected)
+	s.subsystems.Go("camera_supervisor", s.cameraSupervisor.Run)
+
+	// The RTSP stream is closed once everything else has shut down
+	s.closers = append(s.closers, func() { s.rtspStream.Close() })
+
+	s.usage, err = viewers.LoadUsage(filepath.Join(cfg.DataDir, "usage.json"))
+	if err != nil {
+		return fail(fmt.Errorf("failed to load bandwidth usage: %w", err))
+	}
+	s.subsystems.Go("usage", s.usage.Run)
+
+	s.viewerSessions = viewers.NewManager(s.eventBus, s.usage, cfg.Bandwidth)
+	if cfg.WebRTC.GOPCache != nil {
+		s.viewerSessions.SetGOPCache(cfg.WebRTC.GOPCache.MaxBytes)
+	}
+	// For cameras that only send their SPS and PPS once, when the stream starts
+	s.viewerSessions.SetParameterSets(func(string) (string, [][]byte) {
+		return s.currentCodec(), s.videoSource.VideoParameterSets()
+	})
+
+	if cfg.Transcode != nil {
+		s.transcoder, err = transcode.New(transcode.Options{
+			FFmpeg:      cfg.Transcode.FFmpeg,
+			BitrateKbps: cfg.Transcode.BitrateKbps,
+			Preset:      cfg.Transcode.Preset,
+			Encoder:     cfg.Transcode.Encoder,
+			Device:      cfg.Transcode.Device,
+		}, s.videoSource.VideoParameterSets, func(packet *rtp.Packet) {
+			s.viewerSessions.WriteTranscodedPacket(s.cameraID, packet, stream.IsKeyframe("H264", packet.Payload), stream.IsDisposable("H264", packet.Payload))
+		})
+		if err != nil {
+			return fail(fmt.Errorf("invalid transcode config: %w", err))
+		}
+		s.subsystems.Go("transcoder", s.transcoder.Run)
+	}
+
+	if cfg.KeyframeRequest != nil {
+		s.cameraKeyframeRequests, err = newCameraKeyframes(*cfg.KeyframeRequest, username, password)
+		if err != nil {
+			return fail(fmt.Errorf("invalid keyframe_request config: %w", err))
+		}
+	}
+
+	// Viewers are told when the camera goes offline so they don't sit looking at a frozen frame
+	s.subsystems.Go("camera_status", s.viewerSessions.NotifyCameraStatus)
+
+	s.subsystems.Go("metrics_history", s.recordHistory)
+	s.subsystems.Go("outbound_bitrate", s.measureOutbound)
+
+	// Set up packet handler
+	// This handler will be called automatically for each RTP packet received from the camera.
+	// The supervisor's wrapper recovers from panics so one bad packet can't crash the server.
+	cameraMetrics := metrics.ForCamera(s.cameraID)
+	s.rtspStream.SetPacketHandler(s.cameraSupervisor.PacketHandler(func(packet *rtp.Packet) {
+		cameraMetrics.PacketsReceived.Inc()
+		cameraMetrics.BytesReceived.Add(float64(packet.MarshalSize()))
+		s.streamMonitor.Packet(packet)
+		s.capturePacket(packet)
+		// Once per frame is plenty for the capture delay
+		if packet.Marker {
+			if captured, ok := s.rtspStream.PacketNTP(packet); ok {
+				s.streamMonitor.CaptureDelay(time.Since(captured))
+			}
+		}
+
+		// Forward the packet to every viewer watching this camera
+		codec := s.currentCodec()
+		s.viewerSessions.WritePacket(s.cameraID, packet, stream.IsKeyframe(codec, packet.Payload), stream.IsDisposable(codec, packet.Payload))
+		// and to the transcoder while anyone is watching its H264
+		if s.canTranscode(codec) && s.viewerSessions.Transcoding(s.cameraID) {
+			s.transcoder.WritePacket(codec, packet)
+		}
+		// and to any snapshot waiting for a keyframe
+		s.snapshotter.WritePacket(codec, packet)
+	}))
+
+	log.Println("Packets will be automatically forwarded from RTSP to each viewer's WebRTC peer via callback")
+
+	// Every request gets a correlation ID and an access log line
+	s.signaling = s.newSignaling(cfg.WebRTC)
+	s.handler = s.logRequests(s.newMux(cfg, opts.Frontend, s.signaling))
+	return s, nil
+}
+
+// newMux routes the API, the metrics and the web UI.
+// Every API route is served under /api/v1 and, as before, under /api (see handleAPI). The single
+// sign-on redirects aren't an API and stay where identity providers were told they are.
+func (s *Server) newMux(cfg *config.Config, frontend http.FileSystem, sig *signaling) *http.ServeMux {
+	mux := http.NewServeMux()
+	handleAPI(mux, "/login", s.corsMiddleware(s.rateLimited(s.loginLimiter, s.handleLogin)))
+	handleAPI(mux, "/login/options", s.corsMiddleware(s.handleLoginOptions))
+	mux.HandleFunc("/api/oidc/login", s.rateLimited(s.loginLimiter, s.handleOIDCLogin))
+	mux.HandleFunc("/api/oidc/callback", s.rateLimited(s.loginLimiter, s.handleOIDCCallback))
+	handleAPI(mux, "/logout", s.corsMiddleware(s.handleLogout))
+	handleAPI(mux, "/me", s.corsMiddleware(s.requireAuthOrShare(s.handleMe)))
+	handleAPI(mux, "/password", s.corsMiddleware(s.rateLimited(s.loginLimiter, s.requireAuth(s.handleChangePassword))))
+	handleAPI(mux, "/totp/enroll", s.corsMiddleware(s.requireAuth(s.idempotent(s.handleTOTPEnroll))))
+	handleAPI(mux, "/totp/confirm", s.corsMiddleware(s.requireAuth(s.handleTOTPConfirm)))
+	handleAPI(mux, "/totp/disable", s.corsMiddleware(s.rateLimited(s.loginLimiter, s.requireAuth(s.handleTOTPDisable))))
+	handleAPI(mux, "/users", s.corsMiddleware(s.requireAuth(s.requireAdmin(s.idempotent(s.handleUsers)))))
+	handleAPI(mux, "/users/{username}", s.corsMiddleware(s.requireAuth(s.requireAdmin(s.handleUser))))
+	handleAPI(mux, "/share", s.corsMiddleware(s.requireAuth(s.requireAdmin(s.idempotent(s.handleShare)))))
+	handleAPI(mux, "/offer", s.corsMiddleware(s.rateLimited(s.signalingLimiter, s.requireAuthOrShare(s.idempotent(sig.handleOffer)))))
+	handleAPI(mux, "/answer", s.corsMiddleware(s.rateLimited(s.signalingLimiter, s.requireAuthOrShare(sig.handleAnswer))))
+	handleAPI(mux, "/whep", s.corsMiddleware(s.rateLimited(s.signalingLimiter, s.requireAuthOrShare(sig.handleWHEP))))
+	handleAPI(mux, "/whep/{id}", s.corsMiddleware(s.rateLimited(s.signalingLimiter, s.requireAuthOrShare(sig.handleWHEPSession))))
+	handleAPI(mux, "/sessions", s.corsMiddleware(s.requireAuthOrShare(s.handleSessions)))
+	handleAPI(mux, "/sessions/{id}", s.corsMiddleware(s.requireAuthOrShare(s.handleSession)))
+	handleAPI(mux, "/sessions/{id}/stats", s.corsMiddleware(s.requireAuthOrShare(s.handleSessionStats)))
+	handleAPI(mux, "/stats/ws", s.requireAuthOrShare(s.handleStatsSocket))
+	handleAPI(mux, "/ws", s.requireAuthOrShare(s.controlSocket(sig)))
+	handleAPI(mux, "/version", s.corsMiddleware(s.requireAuth(s.handleVersion)))
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	handleAPI(mux, "/cameras", s.corsMiddleware(s.requireAuthOrShare(s.handleCameras)))
+	handleAPI(mux, "/cameras/{id}/health", s.corsMiddleware(s.requireAuthOrShare(s.handleCameraHealth)))
+	handleAPI(mux, "/cameras/{id}/history", s.corsMiddleware(s.requireAuthOrShare(s.handleCameraHistory)))
+	handleAPI(mux, "/cameras/{id}/snapshot", s.corsMiddleware(s.requireAuthOrShare(s.handleCameraSnapshot)))
+	handleAPI(mux, "/cameras/{id}/probe", s.corsMiddleware(s.requireAuth(s.requireAdmin(s.idempotent(s.handleCameraProbe)))))
+	handleAPI(mux, "/jobs", s.corsMiddleware(s.requireAuth(s.handleJobs)))
+	handleAPI(mux, "/jobs/{id}", s.corsMiddleware(s.requireAuth(s.handleJob)))
+	handleAPI(mux, "/ingest", s.corsMiddleware(s.requireAuth(s.handleIngest)))
+	handleAPI(mux, "/usage", s.corsMiddleware(s.requireAuth(s.handleUsage)))
+	handleAPI(mux, "/summary", s.corsMiddleware(s.requireAuth(s.requireAdmin(s.handleSummary))))
+	handleAPI(mux, "/audit", s.corsMiddleware(s.requireAuth(s.requireAdmin(s.handleAudit))))
+	handleAPI(mux, "/config/export", s.corsMiddleware(s.requireAuth(s.requireAdmin(s.handleConfigExport))))
+	handleAPI(mux, "/config/import", s.corsMiddleware(s.requireAuth(s.requireAdmin(s.handleConfigImport))))
+	handleAPI(mux, "/subsystems", s.corsMiddleware(s.requireAuth(s.requireAdmin(s.handleSubsystems))))
+	handleAPI(mux, "/debug/goroutines", s.corsMiddleware(s.requireAuth(s.requireAdmin(s.handleDebugGoroutines))))
+	handleAPI(mux, "/debug/capture", s.corsMiddleware(s.requireAuth(s.requireAdmin(s.handleDebugCapture))))
+	handleAPI(mux, "/ratelimit", s.corsMiddleware(s.requireAuth(s.requireAdmin(s.handleRateLimitStats))))
+	handleAPI(mux, "/events", s.corsMiddleware(s.requireAuth(s.handleEvents)))
+	handleAPI(mux, "/events/stream", s.corsMiddleware(s.requireAuth(s.handleEventStream)))
+	// Rather than the web UI's 404 page
+	mux.Handle("/api/v1/", apiV1(http.NotFoundHandler()))
+	mux.HandleFunc("/api/openapi.json", s.corsMiddleware(s.handleOpenAPI))
+	if cfg.APIDocs.SwaggerUI {
+		mux.HandleFunc("/api/docs", handleAPIDocs)
+	}
+
+	if !cfg.Metrics.Disabled {
+		mux.Handle("/metrics", requireMetricsToken(cfg.Metrics.BearerToken, metrics.Handler()))
+	}
+
+	// Serve the web UI from the same origin as the API so the session cookie is sent with API calls
+	mux.Handle("/", serveFrontend(frontend))
+	return mux
+}
+
+// Handler serves the API, the metrics and the web UI, for programs that mount it on a server of
+// their own (see Options.NoListeners) or under a prefix with http.StripPrefix
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Run connects to the camera and serves HTTP, and HTTPS when TLS is configured, until ctx is
+// cancelled or a listener fails. Then it shuts everything down gracefully.
+func (s *Server) Run(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, s.cancel)
+	defer stop()
+	ctx = s.ctx
+	cfg := s.opts.Config
+
+	// Cameras connect in the background, each with its own timeout, so an unreachable one doesn't hold up
+	// the others or the HTTP server. The server starts even when the camera can't be reached, e.g. when it
+	// boots faster than the camera after a power cut, and the supervisor keeps trying.
+	go connectCamera(s.cameraID, s.cameraSupervisor)
+
+	var extraServers []*http.Server
+	if cfg.AdminListener != nil && !s.opts.NoListeners {
+		adminServer, err := s.startAdminListener(ctx, *cfg.AdminListener)
+		if err != nil {
+			s.abort()
+			return fmt.Errorf("failed to start admin listener: %w", err)
+		}
+		extraServers = append(extraServers, adminServer)
+	}
+	var grpcServer *grpc.Server
+	if cfg.GRPC != nil {
+		var err error
+		grpcServer, err = s.startGRPCServer(ctx, *cfg.GRPC)
+		if err != nil {
+			s.abort()
+			return fmt.Errorf("failed to start gRPC service: %w", err)
+		}
+	}
+
+	var err error
+	if s.opts.NoListeners {
+		s.markReady()
+		select {
+		case <-ctx.Done():
+		case err = <-s.listenerErrs:
+		}
+	} else {
+		err = s.serve(ctx, s.handler, cfg.TLS, cfg.HTTP2, s.markReady, extraServers...)
+	}
+	s.cancel()
+	if grpcServer != nil {
+		// The streams have ended with ctx, so this only waits for calls in flight
+		grpcServer.GracefulStop()
+	}
+	s.shutdown()
+	s.close()
+	return err
+}
+
+// markReady calls the OnReady hooks
+func (s *Server) markReady() {
+	for _, hook := range s.ready {
+		hook()
+	}
+}
+
+// abort undoes what New and Run have started, when they fail
+func (s *Server) abort() {
+	s.cancel()
+	if s.subsystems != nil {
+		s.subsystems.Stop()
+	}
+	s.close()
+}
+
+// close runs the closers, last first
+func (s *Server) close() {
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		s.closers[i]()
+	}
+	s.closers = nil
+}
+
+// shutdown closes everything down in order once the HTTP servers have stopped.
+// Cancelling s.ctx has already started closing the camera and the peer connections;
+// this waits for each layer to finish before moving on to the next:
+//   - the camera, so no packet callback is still running (or starts) while viewers close
+//   - viewers, so browsers see their connection close properly
+//   - the background jobs, once nothing is left to publish events
+//   - bandwidth usage, once no more bytes can be counted
+//
+// Run then closes the audit log and flushes traces, see Server.close.
+func (s *Server) shutdown() {
+	s.cameraSupervisor.Disable()
+	s.viewerSessions.CloseAll()
+	s.subsystems.Stop()
+
+	err := s.usage.Save()
+	if err != nil {
+		log.Printf("Failed to save bandwidth usage: %v", err)
+	}
+	log.Println("Shutdown complete")
+}
+
+// redactConfigSecrets registers the secrets in the config file with the log redactor.
+// Some of them, like Telegram bot tokens and Discord webhook URLs, end up in URL paths that
+// the automatic URL redaction can't recognise.
+func redactConfigSecrets(cfg *config.Config) {
+	if cfg.Auth.OIDC != nil {
+		logging.AddSecret(cfg.Auth.OIDC.ClientSecret)
+	}
+	if cfg.MQTT != nil {
+		logging.AddSecret(cfg.MQTT.Password)
+	}
+	logging.AddSecret(cfg.Metrics.BearerToken)
+	for _, webhook := range cfg.Webhooks {
+		logging.AddSecret(webhook.Secret)
+		for name, value := range webhook.Headers {
+			if strings.EqualFold(name, "Authorization") {
+				logging.AddSecret(value)
+			}
+		}
+	}
+	for _, notifier := range cfg.Notifiers {
+		logging.AddSecret(notifier.BotToken, notifier.WebhookURL)
+	}
+	if cfg.Tracing != nil {
+		for _, value := range cfg.Tracing.Headers {
+			logging.AddSecret(value)
+		}
+	}
+	for _, server := range cfg.WebRTC.ICEServers {
+		logging.AddSecret(server.Credential)
+	}
+}
+
+func (s *Server) publishCameraConnected() {
+	codec := s.videoSource.GetCodec()
+	s.videoCodec.Store(codec)
+	s.eventBus.Publish(events.Event{
+		Type:    events.TypeCameraConnected,
+		Camera:  s.cameraID,
+		Message: fmt.Sprintf("connected to RTSP stream using codec %s", codec),
+		Data:    map[string]any{"codec": codec},
+	})
+}
+
+// connectCamera makes the first connect to a camera, under its own trace span
+func connectCamera(id string, camera *supervisor.Camera) {
+	ctx, span := tracing.Start(context.Background(), "camera.connect", attribute.String("camera", id))
+	defer span.End()
+
+	err := camera.Connect(ctx)
+	if err != nil {
+		tracing.Fail(span, err)
+		log.Printf("Camera %s is not available yet, retrying in the background: %v", id, err)
+	}
+}
+
+// currentCodec returns the camera's video codec, or an empty string if it hasn't connected yet
+func (s *Server) currentCodec() string {
+	codec, _ := s.videoCodec.Load().(string)
+	return codec
+}
+
+// canTranscode reports whether the transcoder is on and can make H264 from codec
+func (s *Server) canTranscode(codec string) bool {
+	return s.transcoder != nil && transcode.CanTranscode(codec)
+}
+
+// enableCamera reconnects a camera that was switched off with disableCamera
+func (s *Server) enableCamera(camera string, _ string) error {
+	if camera != s.cameraID {
+		return fmt.Errorf("unknown camera %s", camera)
+	}
+
+	ctx, span := tracing.Start(context.Background(), "camera.enable", attribute.String("camera", camera))
+	defer span.End()
+
+	// The supervisor publishes camera_connected
+	err := s.cameraSupervisor.Connect(ctx)
+	if err != nil {
+		return tracing.Fail(span, fmt.Errorf("failed to connect to RTSP stream: %w", err))
+	}
+	metrics.ForCamera(camera).Reconnects.Inc()
+	return nil
+}
+
+// disableCamera closes the RTSP connection so the camera stops streaming until it is enabled again
+func (s *Server) disableCamera(camera string, _ string) error {
+	if camera != s.cameraID {
+		return fmt.Errorf("unknown camera %s", camera)
+	}
+
+	// The supervisor won't reconnect it until it is enabled again
+	err := s.cameraSupervisor.Disable()
+	if err != nil {
+		return err
+	}
+	s.eventBus.Publish(events.Event{
+		Type:    events.TypeCameraDisabled,
+		Camera:  s.cameraID,
+		Message: "camera disabled",
+	})
+	return nil
+}
+
+// cooldownRules converts the config file's cooldowns into event bus rules
+func cooldownRules(cooldowns []config.Cooldown) []events.CooldownRule {
+	rules := make([]events.CooldownRule, 0, len(cooldowns))
+	for _, cooldown := range cooldowns {
+		rule := events.CooldownRule{
+			Camera: cooldown.Camera,
+			Window: time.Duration(cooldown.Window),
+		}
+		for _, t := range cooldown.Events {
+			rule.Types = append(rule.Types, events.Type(t))
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// logEvents writes every event published on the bus to the log until stop is closed.
+// This is what used to be scattered log.Printf calls for connects/disconnects.
+func logEvents(bus *events.Bus, stop <-chan struct{}) {
+	sub := bus.Subscribe(64, nil)
+	defer sub.Close()
+	for {
+		select {
+		case <-stop:
+			return
+		case event := <-sub.C:
+			log.Printf("Event: %s", event)
+		}
+	}
+}
+
+// corsMiddleware lets the origins on the allowlist, cors.allowed_origins in the config file, call the
+// API from a browser. Other origins get no CORS headers, so browsers block their calls; "*" allows any
+// origin. With cors.allow_credentials allowed origins may send the session cookie, and
+// cors.max_age sets how long browsers cache a preflight.
+func (s *Server) corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Only answer with CORS headers for origins on the allowlist.
+		// Browsers block cross-origin calls from anywhere else.
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		allowed := origin != "" && s.corsOriginAllowed(origin)
+		if allowed {
+			if slices.Contains(s.corsPolicy.AllowedOrigins, "*") && !s.corsPolicy.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if s.corsPolicy.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		// WHEP players read the session's URL and the ICE servers from these
+		if allowed {
+			w.Header().Set("Access-Control-Expose-Headers", "Location, Link")
+		}
+
+		// Handle preflight OPTIONS request
+		if r.Method == "OPTIONS" {
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Methods", "POST, GET, PUT, PATCH, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key")
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(time.Duration(s.corsPolicy.MaxAge).Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		// Call the actual handler
+		next(w, r)
+	}
+}
+
+// corsOriginAllowed reports whether the CORS allowlist includes origin
+func (s *Server) corsOriginAllowed(origin string) bool {
+	for _, allowed := range s.corsPolicy.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
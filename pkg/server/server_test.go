@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+)
+
+// TestTwoServers runs two servers in one program, each with its own camera and data directory,
+// and checks they keep their state apart and both shut down without leaving goroutines behind
+func TestTwoServers(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var servers []*Server
+	for _, id := range []string{"front", "back"} {
+		cfg, err := config.Load(filepath.Join(t.TempDir(), "config.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.DataDir = t.TempDir()
+		cfg.Auth.Disabled = true
+
+		srv, err := New(Options{
+			Config: cfg,
+			// Nothing listens there, so the camera never connects
+			Camera:      Camera{ID: id, URL: "rtsp://127.0.0.1:1/stream"},
+			NoListeners: true,
+			Version:     "1.0.0-" + id,
+		})
+		if err != nil {
+			t.Fatalf("failed to create server %s: %v", id, err)
+		}
+		servers = append(servers, srv)
+	}
+
+	done := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func() {
+			done <- srv.Run(ctx)
+		}()
+	}
+
+	for i, id := range []string{"front", "back"} {
+		w := httptest.NewRecorder()
+		servers[i].Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/version", nil))
+		var version struct {
+			Version string `json:"version"`
+		}
+		json.NewDecoder(w.Body).Decode(&version)
+		if w.Code != http.StatusOK || version.Version != "1.0.0-"+id {
+			t.Errorf("server %s: got %d with version %q, want its own version", id, w.Code, version.Version)
+		}
+	}
+
+	cancel()
+	for range servers {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Run failed: %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("a server didn't shut down")
+		}
+	}
+
+	checkGoroutines(t, goroutines)
+}
+
+// checkGoroutines fails the test if more than want goroutines are still running once the
+// ones that are shutting down have had a moment to return
+func checkGoroutines(t *testing.T, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > want {
+		if time.Now().After(deadline) {
+			stacks := make([]byte, 1<<20)
+			stacks = stacks[:runtime.Stack(stacks, true)]
+			t.Fatalf("%d goroutines still running after shutdown, want at most %d:\n%s", runtime.NumGoroutine(), want, stacks)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestRemovesStaleTempFiles checks the temporary file a crash left next to the users file is gone
+// once the server has started
+func TestRemovesStaleTempFiles(t *testing.T) {
+	cfg, err := config.Load(filepath.Join(t.TempDir(), "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DataDir = t.TempDir()
+	cfg.Auth.Disabled = true
+	stale := filepath.Join(cfg.DataDir, "users.json.tmp")
+	err = os.WriteFile(stale, []byte("[{"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := New(Options{
+		Config:      cfg,
+		Camera:      Camera{ID: "front", URL: "rtsp://127.0.0.1:1/stream"},
+		NoListeners: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.abort()
+
+	_, err = os.Stat(stale)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("%s is still there (%v)", stale, err)
+	}
+}
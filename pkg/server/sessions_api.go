@@ -0,0 +1,190 @@
+package server
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/audit"
+	"github.com/nisarg-dave/camera-viewer/pkg/stream"
+	"github.com/nisarg-dave/camera-viewer/pkg/viewers"
+)
+
+// sessionResponse is a viewer session as returned by the API
+type sessionResponse struct {
+	ID        string    `json:"id"`
+	User      string    `json:"user"`
+	Camera    string    `json:"camera"`
+	StartedAt time.Time `json:"started_at"`
+	Connected bool      `json:"connected"`
+	BytesSent uint64    `json:"bytes_sent"`
+}
+
+func newSessionResponse(s *viewers.Session) sessionResponse {
+	return sessionResponse{
+		ID:        s.ID,
+		User:      s.User,
+		Camera:    s.Camera,
+		StartedAt: s.StartedAt,
+		Connected: s.Connected(),
+		BytesSent: s.BytesSent(),
+	}
+}
+
+// sessionStatsResponse is a session together with its WebRTC stats
+type sessionStatsResponse struct {
+	sessionResponse
+	Stats stream.PeerStats `json:"stats"`
+	// Bits per second sent since the previous stats request
+	Bitrate float64 `json:"bitrate"`
+	// How long each phase of the viewer's startup took
+	Startup viewers.Startup `json:"startup"`
+	// nil until the browser has answered a latency ping
+	Latency *latencyEstimate `json:"latency_estimate,omitempty"`
+}
+
+// latencyEstimate adds up where the delay between the camera and the viewer's screen comes from.
+// The camera's encoding time and the browser's decoding time can't be measured from here,
+// so the real glass-to-glass latency is a little higher.
+type latencyEstimate struct {
+	// Camera to this server, only known for cameras with an NTP synced clock
+	CaptureMs float64 `json:"capture_ms,omitempty"`
+	// This server to the browser, half the ping round trip
+	NetworkMs float64 `json:"network_ms"`
+	// Time spent in the browser's jitter buffer
+	PlayoutMs      float64 `json:"playout_ms"`
+	GlassToGlassMs float64 `json:"glass_to_glass_ms"`
+}
+
+// estimateLatency puts the camera's capture delay together with a session's ping measurements
+func (s *Server) estimateLatency(stats stream.PeerStats) *latencyEstimate {
+	if stats.Latency == nil {
+		return nil
+	}
+
+	estimate := &latencyEstimate{
+		CaptureMs: s.streamMonitor.Ingest().CaptureDelayMs,
+		NetworkMs: stats.Latency.PingRTTMs / 2,
+		PlayoutMs: stats.Latency.PlayoutDelayMs,
+	}
+	estimate.GlassToGlassMs = estimate.CaptureMs + estimate.NetworkMs + estimate.PlayoutMs
+	return estimate
+}
+
+// sessionSortFields are what GET /api/sessions can be sorted by
+var sessionSortFields = []string{"started_at", "bytes_sent", "user"}
+
+// handleSessions lists the open viewer sessions, oldest first. Admins see everyone's, everyone else only their own.
+// The list stays a plain array for existing callers; X-Total-Count has the number of matching sessions.
+// GET /api/sessions?user=alice&camera=driveway&connected=true&sort=-bytes_sent&limit=50&offset=0
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, err := parseListQuery(r, sessionSortFields, "started_at")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	users := queryValues(r, "user")
+	cameras := queryValues(r, "camera")
+	connected := r.URL.Query().Get("connected")
+	if connected != "" && connected != "true" && connected != "false" {
+		http.Error(w, "connected must be true or false", http.StatusBadRequest)
+		return
+	}
+
+	admin := s.requestUser(r).IsAdmin()
+	user := currentUser(r)
+
+	sessions := []sessionResponse{}
+	for _, viewer := range s.viewerSessions.List() {
+		if !admin && viewer.User != user {
+			continue
+		}
+		session := newSessionResponse(viewer)
+		if len(users) > 0 && !slices.Contains(users, session.User) ||
+			len(cameras) > 0 && !slices.Contains(cameras, session.Camera) ||
+			connected != "" && strconv.FormatBool(session.Connected) != connected {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+
+	slices.SortStableFunc(sessions, func(a, b sessionResponse) int {
+		var order int
+		switch list.Sort {
+		case "bytes_sent":
+			order = cmp.Compare(a.BytesSent, b.BytesSent)
+		case "user":
+			order = strings.Compare(a.User, b.User)
+		default:
+			order = a.StartedAt.Compare(b.StartedAt)
+		}
+		if list.Descending {
+			return -order
+		}
+		return order
+	})
+
+	setTotalCount(w, len(sessions))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(paginate(sessions, list))
+}
+
+// handleSessionStats returns pion's stats for one session: bytes and packets sent, loss, RTT,
+// the current bitrate and the ICE candidate pair in use. Useful when a viewer complains about a choppy picture.
+// GET /api/sessions/{id}/stats
+func (s *Server) handleSessionStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Other users' sessions are reported as not found rather than forbidden, so IDs can't be probed
+	session := s.viewerSessions.Get(r.PathValue("id"))
+	if session == nil || (session.User != currentUser(r) && !s.requestUser(r).IsAdmin()) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	stats := session.Peer.Stats()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessionStatsResponse{
+		sessionResponse: newSessionResponse(session),
+		Stats:           stats,
+		Bitrate:         session.Bitrate(),
+		Startup:         session.Startup(),
+		Latency:         s.estimateLatency(stats),
+	})
+}
+
+// handleSession ends a viewer session, closing its peer connection on the server right away instead
+// of waiting for ICE to notice the browser has gone. Like a WHEP resource, the session's URL is sent
+// in the offer's Location header. Users can end their own sessions, admins anyone's.
+// DELETE /api/sessions/{id}
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session := s.viewerSessions.Get(r.PathValue("id"))
+	if session == nil || (session.User != currentUser(r) && !s.requestUser(r).IsAdmin()) {
+		writeAPIError(w, r, http.StatusNotFound, "SESSION_NOT_FOUND", "viewer session not found", nil)
+		return
+	}
+
+	session.Logf("ended by %s", currentUser(r))
+	s.viewerSessions.Remove(session.ID)
+	s.recordAudit(r, audit.Entry{Action: audit.ActionSessionClosed, Camera: session.Camera, Target: session.User, Detail: session.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
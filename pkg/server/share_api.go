@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/audit"
+)
+
+const (
+	// defaultShareTTL is how long a share link lasts when no ttl is given
+	defaultShareTTL = 24 * time.Hour
+	// maxShareTTL stops links from being handed out that effectively never expire
+	maxShareTTL = 30 * 24 * time.Hour
+)
+
+// shareRequest is the body of POST /api/share
+type shareRequest struct {
+	Camera string `json:"camera"`
+	// How long the link works for, e.g. "24h". Defaults to 24h, at most 30 days.
+	TTL string `json:"ttl"`
+}
+
+// shareResponse is a new share link. URL is relative to the server.
+type shareResponse struct {
+	// ID is who the link's viewers are, as "share:<id>", in sessions, usage and bandwidth limits
+	ID        string    `json:"id"`
+	Camera    string    `json:"camera"`
+	Token     string    `json:"token"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// handleShare creates a signed link that lets anyone with it watch one camera until it expires.
+// Admin only.
+// POST /api/share {"camera": "driveway", "ttl": "24h"}
+func (s *Server) handleShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body shareRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, "Failed to decode share request", http.StatusBadRequest)
+		return
+	}
+	if body.Camera == "" {
+		body.Camera = s.cameraID
+	}
+	if body.Camera != s.cameraID {
+		http.Error(w, "Camera not found", http.StatusNotFound)
+		return
+	}
+
+	ttl := defaultShareTTL
+	if body.TTL != "" {
+		ttl, err = time.ParseDuration(body.TTL)
+		if err != nil || ttl <= 0 {
+			http.Error(w, "ttl must be a duration like \"24h\"", http.StatusBadRequest)
+			return
+		}
+	}
+	if ttl > maxShareTTL {
+		http.Error(w, "ttl can be at most "+maxShareTTL.String(), http.StatusBadRequest)
+		return
+	}
+
+	expires := time.Now().Add(ttl)
+	token, id := s.shareSigner.Sign(body.Camera, expires)
+
+	log.Printf("User %s shared camera %s as link %s until %s", currentUser(r), body.Camera, id, expires.Format(time.RFC3339))
+	s.recordAudit(r, audit.Entry{
+		Action: audit.ActionShareCreated,
+		Camera: body.Camera,
+		Target: "share:" + id,
+		Detail: "expires " + expires.Format(time.RFC3339),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shareResponse{
+		ID:        id,
+		Camera:    body.Camera,
+		Token:     token,
+		URL:       "/?share=" + url.QueryEscape(token),
+		ExpiresAt: expires,
+	})
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nisarg-dave/camera-viewer/internal/audit"
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+	"github.com/nisarg-dave/camera-viewer/pkg/viewers"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Signaler carries one viewer session's offer, answer and ICE candidates between the server and
+// the viewer, for embedding programs that bring their own signaling, e.g. over MQTT or their own
+// backend. The server makes the offer. HTTPSignaler, WebSocketSignaler and the WHEP endpoint
+// (POST /api/whep) are the ones the server comes with.
+type Signaler interface {
+	// SendOffer hands the server's offer to the viewer. The session is dropped if it fails.
+	SendOffer(ctx context.Context, offer Offer) error
+	// OnAnswer sets the function the viewer's answer is handed to. Its error, if any, is why the
+	// answer wasn't taken, for the viewer. It is set before SendOffer is called.
+	OnAnswer(handler func(Answer) error)
+	// OnCandidate sets the function the viewer's trickled ICE candidates are handed to, like OnAnswer
+	OnCandidate(handler func(Candidate) error)
+	// Close is called once the session has ended, however it ended
+	Close() error
+}
+
+// Offer is the server's side of a viewer session
+type Offer struct {
+	SessionID string
+	SDP       string
+	// The viewer needs the same STUN and TURN servers for its side of the connection
+	ICEServers []config.ICEServer
+}
+
+// Answer is the viewer's side of a session. SessionID may be left empty, since a Signaler only
+// carries one session.
+type Answer struct {
+	SessionID string `json:"session_id"`
+	SDP       string `json:"sdp"`
+}
+
+// Candidate is one of the viewer's ICE candidates, as its RTCPeerConnection reports it
+type Candidate struct {
+	SessionID string `json:"session_id"`
+	webrtc.ICECandidateInit
+}
+
+// watch starts a viewer session with sig carrying the offer and answer. It returns once the offer
+// has been sent; the session connects once sig hands over the answer, and sig is closed once it has ended.
+func (s *signaling) watch(ctx context.Context, req viewerRequest, sig Signaler) (*viewers.Session, *signalingError) {
+	session, offerSDP, failure := s.offer(ctx, req, func() { sig.Close() })
+	if failure != nil {
+		return nil, failure
+	}
+
+	sig.OnAnswer(func(answer Answer) error {
+		if answer.SessionID != "" && answer.SessionID != session.ID {
+			return &signalingError{status: http.StatusNotFound, code: "SESSION_NOT_FOUND", message: "viewer session not found, request a new offer"}
+		}
+		// The session may have ended already, e.g. the viewer took longer than answerTimeout
+		if s.sessions.Get(session.ID) == nil {
+			return &signalingError{status: http.StatusNotFound, code: "SESSION_NOT_FOUND", message: "viewer session not found, request a new offer"}
+		}
+		failure := s.answer(context.Background(), session, answer.SDP)
+		if failure != nil {
+			return failure
+		}
+		return nil
+	})
+	sig.OnCandidate(func(candidate Candidate) error {
+		if candidate.SessionID != "" && candidate.SessionID != session.ID {
+			return &signalingError{status: http.StatusNotFound, code: "SESSION_NOT_FOUND", message: "viewer session not found, request a new offer"}
+		}
+		err := session.Peer.AddICECandidate(candidate.ICECandidateInit)
+		if err != nil {
+			return &signalingError{status: http.StatusBadRequest, code: "INVALID_CANDIDATE", message: err.Error()}
+		}
+		return nil
+	})
+
+	err := sig.SendOffer(ctx, Offer{SessionID: session.ID, SDP: offerSDP, ICEServers: s.webrtc.ICEServers})
+	if err != nil {
+		session.Logf("failed to send offer: %v", err)
+		s.sessions.Remove(session.ID)
+		// An answer handed over during SendOffer that wasn't taken says why itself
+		var answerFailure *signalingError
+		if errors.As(err, &answerFailure) {
+			return nil, answerFailure
+		}
+		return nil, &signalingError{status: http.StatusBadGateway, code: "SIGNALING_FAILED", message: "failed to send the offer", err: err}
+	}
+	session.Logf("sent offer")
+	return session, nil
+}
+
+// Watch starts a viewer session on the server's camera, with sig carrying the offer and answer, and
+// returns its ID. It returns once the offer has been sent; the session connects once sig hands over
+// the viewer's answer, and sig is closed once it has ended. Whether user may watch is up to the
+// caller: it is only recorded, for the audit log, GET /api/sessions and bandwidth caps.
+func (s *Server) Watch(ctx context.Context, user string, sig Signaler) (string, error) {
+	session, failure := s.signaling.watch(ctx, viewerRequest{user: user}, sig)
+	if failure != nil {
+		return "", fmt.Errorf("failed to start viewer session: %w", failure)
+	}
+	s.recordAuditEntry(audit.Entry{User: user, Action: audit.ActionViewCamera, Camera: session.Camera, Detail: "session " + session.ID})
+	return session.ID, nil
+}
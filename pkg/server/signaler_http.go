@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// HTTPSignaler sends the offer in a POST to a URL of the embedding program's, e.g. its own backend,
+// and takes the viewer's answer from the response. The request's body is like POST /api/offer's
+// response and the response's like POST /api/answer's request. Candidates can't be trickled over it,
+// so the offer has all of the server's and the answer should have all of the viewer's.
+type HTTPSignaler struct {
+	url    string
+	client *http.Client
+
+	mu       sync.Mutex
+	onAnswer func(Answer) error
+}
+
+// NewHTTPSignaler creates a signaler that POSTs the offer to url with client, http.DefaultClient when nil
+func NewHTTPSignaler(url string, client *http.Client) *HTTPSignaler {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPSignaler{url: url, client: client}
+}
+
+// SendOffer POSTs the offer and hands the answer in the response to OnAnswer's handler
+func (h *HTTPSignaler) SendOffer(ctx context.Context, offer Offer) error {
+	body, err := json.Marshal(offerResponse{
+		Type:       "offer",
+		SDP:        offer.SDP,
+		SessionID:  offer.SessionID,
+		ICEServers: offer.ICEServers,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode offer: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create offer request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send offer: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to send offer: %s", resp.Status)
+	}
+
+	var answer answerRequest
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&answer)
+	if err != nil {
+		return fmt.Errorf("failed to decode answer: %w", err)
+	}
+
+	h.mu.Lock()
+	onAnswer := h.onAnswer
+	h.mu.Unlock()
+	if onAnswer == nil {
+		return errors.New("no answer handler set")
+	}
+	return onAnswer(Answer{SessionID: answer.SessionID, SDP: answer.SDP})
+}
+
+func (h *HTTPSignaler) OnAnswer(handler func(Answer) error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onAnswer = handler
+}
+
+// OnCandidate does nothing, since the viewer's candidates come in its answer
+func (h *HTTPSignaler) OnCandidate(handler func(Candidate) error) {}
+
+// Close does nothing, since there's no connection to close
+func (h *HTTPSignaler) Close() error {
+	return nil
+}
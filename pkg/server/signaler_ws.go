@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocketSignaler carries a session over a WebSocket the embedding program has opened, with
+// /api/ws's messages: it sends an offer message, like /api/ws's reply to one, and takes answer
+// messages, like the ones sent to /api/ws, and candidate messages with a Candidate as their data.
+// Each answer or candidate is replied to, with an error message if it wasn't taken. The WebSocket
+// is closed once the session has ended.
+type WebSocketSignaler struct {
+	conn *websocket.Conn
+
+	writeMu  sync.Mutex
+	readOnce sync.Once
+
+	mu          sync.Mutex
+	onAnswer    func(Answer) error
+	onCandidate func(Candidate) error
+}
+
+// NewWebSocketSignaler creates a signaler on conn. It reads from conn once the offer has been sent,
+// so nothing else may.
+func NewWebSocketSignaler(conn *websocket.Conn) *WebSocketSignaler {
+	return &WebSocketSignaler{conn: conn}
+}
+
+// SendOffer sends the offer message and starts reading the viewer's answer and candidates
+func (ws *WebSocketSignaler) SendOffer(ctx context.Context, offer Offer) error {
+	data, err := json.Marshal(offerResponse{
+		Type:       "offer",
+		SDP:        offer.SDP,
+		SessionID:  offer.SessionID,
+		ICEServers: offer.ICEServers,
+	})
+	if err != nil {
+		return err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(10 * time.Second)
+	}
+	err = ws.send(controlMessage{Type: "offer", Data: data}, deadline)
+	if err != nil {
+		return err
+	}
+	ws.readOnce.Do(func() {
+		go ws.read()
+	})
+	return nil
+}
+
+// read hands the viewer's messages to the handlers until the WebSocket is closed
+func (ws *WebSocketSignaler) read() {
+	for {
+		var message controlMessage
+		err := ws.conn.ReadJSON(&message)
+		if err != nil {
+			return
+		}
+
+		ws.mu.Lock()
+		onAnswer, onCandidate := ws.onAnswer, ws.onCandidate
+		ws.mu.Unlock()
+
+		switch message.Type {
+		case "answer":
+			var answer answerRequest
+			err = json.Unmarshal(message.Data, &answer)
+			if err == nil && onAnswer != nil {
+				err = onAnswer(Answer{SessionID: answer.SessionID, SDP: answer.SDP})
+			}
+			ws.reply(message, answerResponse{Status: "success"}, err)
+		case "candidate":
+			var candidate Candidate
+			err = json.Unmarshal(message.Data, &candidate)
+			if err == nil && onCandidate != nil {
+				err = onCandidate(candidate)
+			}
+			ws.reply(message, nil, err)
+		default:
+			ws.reply(message, nil, &signalingError{status: http.StatusBadRequest, code: "UNKNOWN_MESSAGE_TYPE", message: "unknown message type " + message.Type})
+		}
+	}
+}
+
+// reply answers a message with data, or with an error message if err isn't nil
+func (ws *WebSocketSignaler) reply(request controlMessage, data any, err error) {
+	deadline := time.Now().Add(10 * time.Second)
+	if err != nil {
+		failure := &signalingError{code: "INVALID_REQUEST", message: err.Error()}
+		errors.As(err, &failure)
+		ws.send(controlMessage{Type: "error", ID: request.ID, Error: &apiError{Code: failure.code, Message: failure.message, Details: failure.details}}, deadline)
+		return
+	}
+	message := controlMessage{Type: request.Type, ID: request.ID}
+	if data != nil {
+		message.Data, _ = json.Marshal(data)
+	}
+	ws.send(message, deadline)
+}
+
+// send writes a message, one at a time as gorilla/websocket requires
+func (ws *WebSocketSignaler) send(message controlMessage, deadline time.Time) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	ws.conn.SetWriteDeadline(deadline)
+	return ws.conn.WriteJSON(message)
+}
+
+func (ws *WebSocketSignaler) OnAnswer(handler func(Answer) error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.onAnswer = handler
+}
+
+func (ws *WebSocketSignaler) OnCandidate(handler func(Candidate) error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.onCandidate = handler
+}
+
+// Close closes the WebSocket
+func (ws *WebSocketSignaler) Close() error {
+	return ws.conn.Close()
+}
@@ -0,0 +1,581 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/audit"
+	"github.com/nisarg-dave/camera-viewer/internal/metrics"
+	"github.com/nisarg-dave/camera-viewer/internal/recovery"
+	"github.com/nisarg-dave/camera-viewer/internal/tracing"
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+	"github.com/nisarg-dave/camera-viewer/pkg/stream"
+	"github.com/nisarg-dave/camera-viewer/pkg/viewers"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// viewerManager is what signaling needs of the viewers, a *viewers.Manager outside tests
+type viewerManager interface {
+	Add(session *viewers.Session)
+	Get(id string) *viewers.Session
+	Remove(id string)
+	OverMonthlyCap(user string) bool
+	RequestKeyframe(session *viewers.Session) bool
+	UseTranscoded(session *viewers.Session)
+	ExpectICE(session *viewers.Session, timeout time.Duration)
+}
+
+// signaling sets up viewers' WebRTC sessions: POST /api/offer creates a peer connection for a
+// viewer and POST /api/answer connects it. It is handed everything it uses instead of reaching
+// into the Server, so the handlers can be run against fakes without a camera.
+type signaling struct {
+	camera string
+	// The camera's video codec (H264, H265, AV1 or MPEG4), empty until it has connected for the first time
+	codec func() string
+	// The camera's connection state and why its last connect failed, for the error when it hasn't connected yet
+	cameraState func() string
+	cameraError func() error
+	// Whether the transcoder is on and can make H264 from a codec
+	canTranscode func(codec string) bool
+	// Creates a viewer's connection, a WebRTC peer connection outside tests
+	newPeer func(stream.PeerConfig) (stream.Viewer, error)
+	// Whether the server is shutting down, when no new viewers are accepted
+	closing func() bool
+	// Asks the camera for a keyframe, nil when it can't be asked
+	requestKeyframe func()
+	// Whether the request's user may watch a camera
+	canView func(r *http.Request, camera string) bool
+	// Records that someone started watching
+	audit func(r *http.Request, entry audit.Entry)
+	// Ends a viewer session, like DELETE /api/sessions/{id}
+	closeSession http.HandlerFunc
+
+	sessions viewerManager
+	bus      *events.Bus
+	// STUN and TURN servers for viewers, and how long ICE gets to connect
+	webrtc config.WebRTC
+	// The WHEP sessions waiting for or taking PATCHes, by session ID
+	whepSessions sync.Map
+}
+
+// newSignaling sets up signaling for the server's camera, its viewers and the webrtc config
+func (s *Server) newSignaling(cfg config.WebRTC) *signaling {
+	sig := &signaling{
+		camera:       s.cameraID,
+		codec:        s.currentCodec,
+		cameraState:  func() string { return s.cameraSupervisor.State() },
+		cameraError:  func() error { return s.cameraSupervisor.LastError() },
+		canTranscode: s.canTranscode,
+		newPeer: func(peerConfig stream.PeerConfig) (stream.Viewer, error) {
+			// Peers outlive the offer request, so they hang off the server's context instead
+			peerConfig.Context = s.ctx
+			peerConfig.UDPMux = s.udpMux
+			// So browsers set their decoder up for the camera's profile and level, e.g. High for 4K
+			peerConfig.H264Fmtp = s.videoSource.H264Fmtp()
+			peer, err := stream.NewWebRTCPeerWithConfig(peerConfig)
+			if err != nil {
+				// Not a nil *WebRTCPeer in a Viewer, which isn't a nil Viewer
+				return nil, err
+			}
+			return peer, nil
+		},
+		closing:      s.shuttingDown.Load,
+		canView:      s.canViewCamera,
+		audit:        s.recordAudit,
+		closeSession: s.handleSession,
+		sessions:     s.viewerSessions,
+		bus:          s.eventBus,
+		webrtc:       cfg,
+	}
+	if s.cameraKeyframeRequests != nil {
+		sig.requestKeyframe = s.cameraKeyframeRequests.Request
+	}
+	return sig
+}
+
+// checkCameraAccess looks at the ?camera= query parameter (defaulting to our camera) and writes
+// an error response if the camera doesn't exist or the user hasn't been granted access to it.
+func (s *signaling) checkCameraAccess(w http.ResponseWriter, r *http.Request) bool {
+	camera := r.URL.Query().Get("camera")
+	if camera == "" {
+		camera = s.camera
+	}
+
+	if camera != s.camera {
+		writeAPIError(w, r, http.StatusNotFound, "CAMERA_NOT_FOUND", "camera not found", nil)
+		return false
+	}
+	if !s.canView(r, camera) {
+		log.Printf("User %s denied access to camera %s", currentUser(r), camera)
+		writeAPIError(w, r, http.StatusForbidden, "CAMERA_FORBIDDEN", "you don't have access to this camera", nil)
+		return false
+	}
+	return true
+}
+
+// videoMimeType is the WebRTC codec that matches the camera's video, or an empty string if it hasn't connected yet.
+// Each viewer gets a track with this codec. No browser plays MPEG-4, so for that it is the transcoder's H264.
+func (s *signaling) videoMimeType() string {
+	switch codec := s.codec(); codec {
+	case "H264":
+		return webrtc.MimeTypeH264
+	case "H265":
+		return webrtc.MimeTypeH265
+	case "AV1":
+		return webrtc.MimeTypeAV1
+	case "MPEG4":
+		if s.canTranscode(codec) {
+			return webrtc.MimeTypeH264
+		}
+	}
+	return ""
+}
+
+// offerResponse is the server's side of a new viewer session, for POST /api/offer
+type offerResponse struct {
+	Type string `json:"type"`
+	SDP  string `json:"sdp"`
+	// The browser sends this back with its answer so we know which peer connection it belongs to
+	SessionID string `json:"session_id"`
+	// The browser needs the same STUN and TURN servers for its side of the connection
+	ICEServers []config.ICEServer `json:"ice_servers"`
+}
+
+// answerRequest is the browser's side of the session, for POST /api/answer
+type answerRequest struct {
+	Type      string `json:"type"`
+	SDP       string `json:"sdp"`
+	SessionID string `json:"session_id"`
+}
+
+// answerResponse says the answer was taken
+type answerResponse struct {
+	Status string `json:"status"`
+}
+
+// signalingError is why a viewer session couldn't be set up or answered, with the status and code
+// the API responds with
+type signalingError struct {
+	status  int
+	code    string
+	message string
+	details map[string]any
+	// What went wrong underneath, for the log and the trace. Nil when the message says it all.
+	err error
+}
+
+func (e *signalingError) Error() string {
+	if e.err != nil {
+		return e.message + ": " + e.err.Error()
+	}
+	return e.message
+}
+
+func (e *signalingError) Unwrap() error {
+	return e.err
+}
+
+// write responds to a request with the error
+func (e *signalingError) write(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, r, e.status, e.code, e.message, e.details)
+}
+
+// offerFailed is the error for anything on the server's side that stopped an offer being made
+func offerFailed(err error) *signalingError {
+	return &signalingError{status: http.StatusInternalServerError, code: "OFFER_FAILED", message: "failed to create offer", err: err}
+}
+
+// viewerRequest is who wants to watch the camera, however they asked for the offer
+type viewerRequest struct {
+	user string
+	// Only connect through a TURN relay
+	relayOnly bool
+	// The correlation ID of the HTTP request that asked, if one did
+	requestID string
+}
+
+// offer starts a viewer session: it creates the viewer's peer connection and the server's offer, and
+// adds the session to the viewers. onEnd, when not nil, is called once the session's connection has
+// failed or been closed. Checking that the viewer may watch the camera is up to the caller.
+func (s *signaling) offer(ctx context.Context, req viewerRequest, onEnd func()) (*viewers.Session, string, *signalingError) {
+	if s.closing() {
+		return nil, "", &signalingError{status: http.StatusServiceUnavailable, code: "SHUTTING_DOWN", message: "the server is shutting down"}
+	}
+
+	// An MPEG-4 camera can only be watched through the transcoder
+	if s.codec() == "MPEG4" && !s.canTranscode("MPEG4") {
+		return nil, "", &signalingError{status: http.StatusUnsupportedMediaType, code: "CODEC_UNSUPPORTED",
+			message: "browsers can't play the camera's MPEG-4 video, it needs transcode in the config"}
+	}
+
+	// Until the camera has connected once there's no codec to set up the video track with
+	mimeType := s.videoMimeType()
+	if mimeType == "" {
+		return nil, "", &signalingError{status: http.StatusServiceUnavailable, code: "CAMERA_OFFLINE",
+			message: "the camera is not available yet, try again shortly",
+			details: cameraOfflineDetails(s.cameraState(), s.cameraError())}
+	}
+
+	if s.sessions.OverMonthlyCap(req.user) {
+		return nil, "", &signalingError{status: http.StatusForbidden, code: "BANDWIDTH_CAP_REACHED", message: "your monthly bandwidth cap has been reached"}
+	}
+
+	if req.relayOnly && !s.webrtc.HasTURN() {
+		return nil, "", &signalingError{status: http.StatusBadRequest, code: "RELAY_UNAVAILABLE",
+			message: "relay-only connections need a TURN server in webrtc.ice_servers"}
+	}
+
+	// Every viewer gets their own peer connection and video track, so they can come and go independently
+	peer, err := s.newPeer(stream.PeerConfig{
+		ICEServers: s.iceServers(),
+		RelayOnly:  req.relayOnly,
+	})
+	if err != nil {
+		return nil, "", offerFailed(fmt.Errorf("failed to create WebRTC peer: %w", err))
+	}
+
+	// With the transcoder, browsers that can't play H265 are offered H264 as well
+	var fallbacks []string
+	if s.canTranscode(s.codec()) && mimeType == webrtc.MimeTypeH265 {
+		fallbacks = append(fallbacks, webrtc.MimeTypeH264)
+	}
+	err = peer.CreateVideoTrack("video", mimeType, fallbacks...)
+	if err != nil {
+		peer.Close()
+		return nil, "", offerFailed(fmt.Errorf("failed to create video track: %w", err))
+	}
+
+	err = peer.CreateLatencyChannel()
+	if err != nil {
+		peer.Close()
+		return nil, "", offerFailed(fmt.Errorf("failed to create latency channel: %w", err))
+	}
+
+	err = peer.CreateStatusChannel()
+	if err != nil {
+		peer.Close()
+		return nil, "", offerFailed(fmt.Errorf("failed to create status channel: %w", err))
+	}
+
+	session := &viewers.Session{
+		ID:        uuid.NewString(),
+		User:      req.user,
+		Camera:    s.camera,
+		Peer:      peer,
+		RequestID: req.requestID,
+	}
+	s.watchSession(ctx, session, onEnd)
+
+	// The offer waits a little for the server's ICE candidates, so the browser has them straight away
+	gatherCtx, cancel := context.WithTimeout(ctx, offerGatherTimeout)
+	offerSDP, err := peer.CreateOffer(gatherCtx)
+	cancel()
+	if err != nil {
+		peer.Close()
+		return nil, "", offerFailed(fmt.Errorf("failed to create offer: %w", err))
+	}
+	s.sessions.Add(session)
+	return session, offerSDP, nil
+}
+
+// Passing a pointer to the http.Request type since it is a complex object and therefore should be a pointer.
+// So the second param is a pointer of http.Request type.
+// ResponseWriter is an interface and by default interface are passed by reference and therefore we don't need to pass a pointer.
+// All HTTP handlers in Go MUST have this exact signature (http.ResponseWriter, *http.Request) - it's not your choice
+// r is a pointer: Yes, r points to the same http.Request object that the HTTP server created when the request came in
+func (s *signaling) handleOffer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "method not allowed", nil)
+		return
+	}
+
+	requestLogf(r, "Received offer request")
+
+	ctx, span := tracing.StartRequest(r, "webrtc.offer", attribute.String("camera", s.camera))
+	defer span.End()
+
+	if !s.checkCameraAccess(w, r) {
+		return
+	}
+
+	session, offerSDP, failure := s.offer(ctx, viewerRequest{
+		user: currentUser(r),
+		// ?relay=1 is how the page retries through a TURN server after a direct connection got stuck
+		relayOnly: r.URL.Query().Get("relay") == "1",
+		requestID: requestID(r),
+	}, nil)
+	if failure != nil {
+		if failure.err != nil {
+			tracing.Fail(span, failure.err)
+			requestLogf(r, "%v", failure)
+		}
+		failure.write(w, r)
+		return
+	}
+	span.SetAttributes(attribute.String("session.id", session.ID))
+	s.audit(r, audit.Entry{Action: audit.ActionViewCamera, Camera: s.camera, Detail: "session " + session.ID})
+
+	response := offerResponse{
+		Type:       "offer",
+		SDP:        offerSDP,
+		SessionID:  session.ID,
+		ICEServers: s.webrtc.ICEServers,
+	}
+
+	// Where the session can be ended with DELETE, as WHEP clients expect
+	location := "/api/sessions/" + session.ID
+	if apiVersion(r) >= 1 {
+		location = "/api/v1/sessions/" + session.ID
+	}
+	w.Header().Set("Location", location)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	session.Logf("sent offer")
+}
+
+// answerTimeout is how long a viewer has to answer the offer and connect
+const answerTimeout = time.Minute
+
+// offerGatherTimeout is the longest an offer waits for ICE gathering. Host candidates are there at
+// once; a STUN server that doesn't answer would otherwise hold the offer up for seconds.
+const offerGatherTimeout = time.Second
+
+// watchSession publishes viewer events as the session's connection comes and goes,
+// and removes the session once its connection has failed or been closed. onEnd, when
+// not nil, is called then too, once.
+func (s *signaling) watchSession(ctx context.Context, session *viewers.Session, onEnd func()) {
+	var endOnce sync.Once
+	end := func() {
+		s.sessions.Remove(session.ID)
+		if onEnd != nil {
+			endOnce.Do(onEnd)
+		}
+	}
+	eventData := map[string]any{"session": session.ID, "user": session.User}
+
+	// The connect span follows the handshake from the offer until the peer connects or gives up,
+	// so it shows how long ICE and DTLS took and where a stalled connect stopped
+	_, connectSpan := tracing.Start(ctx, "webrtc.connect", attribute.String("session.id", session.ID))
+	var endConnectOnce sync.Once
+	endConnect := func(err error) {
+		session.ConnectFinished(err)
+		endConnectOnce.Do(func() {
+			if err != nil {
+				tracing.Fail(connectSpan, err)
+			}
+			connectSpan.End()
+		})
+	}
+
+	// A browser that asks for an offer but never connects would otherwise leave the session behind forever
+	var joined atomic.Bool
+	time.AfterFunc(answerTimeout, func() {
+		if !joined.Load() {
+			session.Logf("never connected, removing it")
+			endConnect(fmt.Errorf("viewer did not connect within %s", answerTimeout))
+			end()
+		}
+	})
+
+	// These callbacks run on the WebRTC library's goroutines, where a panic would take down every viewer
+	endAfterPanic := func(any) { end() }
+
+	session.Peer.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		defer recovery.Recover("viewer_session", endAfterPanic)
+		metrics.WebRTCConnectionState(state.String())
+		connectSpan.AddEvent("connection " + state.String())
+
+		switch state {
+		case webrtc.PeerConnectionStateConnected:
+			joined.Store(true)
+			endConnect(nil)
+			session.SetConnected(true)
+			s.bus.Publish(events.Event{
+				Type:    events.TypeViewerJoined,
+				Camera:  session.Camera,
+				Message: "viewer connected",
+				Data:    eventData,
+			})
+		case webrtc.PeerConnectionStateDisconnected:
+			// ICE can recover from this by itself, so keep the session around
+			session.SetConnected(false)
+			session.Logf("disconnected")
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			wasConnected := session.Connected()
+			session.SetConnected(false)
+			endConnect(fmt.Errorf("connection %s", state))
+			end()
+			if wasConnected {
+				s.bus.Publish(events.Event{
+					Type:    events.TypeViewerLeft,
+					Camera:  session.Camera,
+					Message: fmt.Sprintf("viewer connection %s", state),
+					Data:    eventData,
+				})
+			}
+		default:
+			session.Logf("connection state changed: %s", state)
+		}
+	})
+
+	// The browser asks for a keyframe when its picture breaks. The GOP cache can often mend it at once;
+	// the camera is asked too so the picture is whole again without waiting for the next scheduled one.
+	session.Peer.OnKeyframeRequest(func() {
+		defer recovery.Recover("viewer_session", endAfterPanic)
+		if s.sessions.RequestKeyframe(session) && s.requestKeyframe != nil {
+			s.requestKeyframe()
+		}
+	})
+
+	cameraMetrics := metrics.ForCamera(session.Camera)
+	session.Peer.OnNACK(func(lost int) {
+		cameraMetrics.NACKedPackets.Add(float64(lost))
+	})
+
+	session.Peer.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		defer recovery.Recover("viewer_session", endAfterPanic)
+		if state == webrtc.ICEConnectionStateConnected {
+			session.MarkICEConnected()
+		}
+	})
+
+	// Set up ICE candidate handling
+	// When we discover a new way someone can reach us, log it
+	session.Peer.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate != nil {
+			session.Logf("ICE candidate: %s", candidate.String())
+			connectSpan.AddEvent("ice candidate", trace.WithAttributes(
+				attribute.String("candidate.type", candidate.Typ.String()),
+				attribute.String("candidate.protocol", candidate.Protocol.String())))
+		}
+	})
+}
+
+// answer connects a session with the viewer's answer. A viewer that can't play any of the offered
+// codecs ends the session, since nothing would ever play.
+func (s *signaling) answer(ctx context.Context, session *viewers.Session, answerSDP string) *signalingError {
+	err := session.Peer.SetAnswer(ctx, answerSDP)
+	if errors.Is(err, stream.ErrNoCommonCodec) {
+		session.Logf("failed to set answer: %v", err)
+		s.sessions.Remove(session.ID)
+		return &signalingError{status: http.StatusUnsupportedMediaType, code: "CODEC_UNSUPPORTED",
+			message: fmt.Sprintf("this browser can't play the camera's %s video", s.codec()), err: err}
+	}
+	if errors.Is(err, stream.ErrInvalidAnswer) {
+		session.Logf("failed to set answer: %v", err)
+		return &signalingError{status: http.StatusBadRequest, code: "INVALID_ANSWER", message: err.Error()}
+	}
+	if err != nil {
+		session.Logf("failed to set answer: %v", err)
+		return &signalingError{status: http.StatusInternalServerError, code: "ANSWER_FAILED", message: "failed to set answer", err: err}
+	}
+	// The browser picked the H264 fallback, or the camera's codec is one only the transcoder's H264 plays
+	if codec := s.codec(); s.canTranscode(codec) && session.Peer.VideoCodec() == webrtc.MimeTypeH264 {
+		s.sessions.UseTranscoded(session)
+		session.Logf("sending transcoded H264 of the camera's %s", codec)
+	}
+	session.MarkAnswered()
+	session.Logf("SDP answer set - WebRTC connection is being established")
+
+	// Stuck in new or checking means no path to the browser works, e.g. UDP is blocked
+	s.sessions.ExpectICE(session, time.Duration(s.webrtc.ICETimeout))
+	return nil
+}
+
+func (s *signaling) handleAnswer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "method not allowed", nil)
+		return
+	}
+
+	requestLogf(r, "Received answer request")
+
+	_, span := tracing.StartRequest(r, "webrtc.answer", attribute.String("camera", s.camera))
+	defer span.End()
+
+	if !s.checkCameraAccess(w, r) {
+		return
+	}
+
+	var answer answerRequest
+
+	// Need to pass memory address so that the decoder can modify the original answer object
+	// Passing the struct by value will create a copy
+	err := json.NewDecoder(r.Body).Decode(&answer)
+	if err != nil {
+		requestLogf(r, "Failed to decode answer: %v", err)
+		writeAPIError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "the body must be JSON with type, sdp and session_id", nil)
+		return
+	}
+
+	// Only the user who asked for the offer can answer it. An expired session is gone too, so
+	// SESSION_NOT_FOUND tells the page to start again with a new offer.
+	session := s.sessions.Get(answer.SessionID)
+	if session == nil || session.User != currentUser(r) {
+		writeAPIError(w, r, http.StatusNotFound, "SESSION_NOT_FOUND", "viewer session not found, request a new offer", nil)
+		return
+	}
+
+	span.SetAttributes(attribute.String("session.id", session.ID))
+
+	failure := s.answer(r.Context(), session, answer.SDP)
+	if failure != nil {
+		tracing.Fail(span, failure)
+		failure.write(w, r)
+		return
+	}
+
+	// With ?wait=1 the response waits until the connection is up or has failed, so the page can
+	// tell a stuck ICE apart from other failures and retry through a TURN relay
+	if r.URL.Query().Get("wait") == "1" {
+		err = session.WaitConnect(r.Context())
+		if err != nil {
+			tracing.Fail(span, err)
+			s.writeConnectError(w, r, err, time.Duration(s.webrtc.ICETimeout))
+			return
+		}
+	}
+
+	requestLogf(r, "Sent answer response for viewer session %s", session.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(answerResponse{Status: "success"})
+}
+
+// writeConnectError tells the page why its connection failed, for POST /api/answer?wait=1.
+// "ice_timeout" says that no path to the browser was found, and whether retrying with ?relay=1 can help.
+func (s *signaling) writeConnectError(w http.ResponseWriter, r *http.Request, err error, iceTimeout time.Duration) {
+	if errors.Is(err, viewers.ErrICETimeout) {
+		writeAPIError(w, r, http.StatusGatewayTimeout, "ICE_TIMEOUT",
+			fmt.Sprintf("no network path to the server was found within %s", iceTimeout),
+			map[string]any{"relay_available": s.webrtc.HasTURN()})
+		return
+	}
+	writeAPIError(w, r, http.StatusBadGateway, "CONNECT_FAILED", err.Error(), nil)
+}
+
+// iceServers converts the configured STUN and TURN servers for pion
+func (s *signaling) iceServers() []webrtc.ICEServer {
+	servers := make([]webrtc.ICEServer, len(s.webrtc.ICEServers))
+	for i, server := range s.webrtc.ICEServers {
+		servers[i] = webrtc.ICEServer{
+			URLs:       server.URLs,
+			Username:   server.Username,
+			Credential: server.Credential,
+		}
+	}
+	return servers
+}
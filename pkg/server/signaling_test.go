@@ -0,0 +1,372 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/audit"
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+	"github.com/nisarg-dave/camera-viewer/pkg/stream"
+	"github.com/nisarg-dave/camera-viewer/pkg/viewers"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// fakePeer is a viewer's connection that makes up an offer and takes any answer, instead of
+// setting up WebRTC. Methods signaling doesn't use aren't implemented.
+type fakePeer struct {
+	stream.Viewer
+
+	mu        sync.Mutex
+	mimeType  string
+	fallbacks []string
+	answer    string
+	// What SetAnswer returns, and the codec the viewer then accepted
+	answerErr  error
+	videoCodec string
+}
+
+func (p *fakePeer) CreateVideoTrack(trackID, mimeType string, fallbacks ...string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mimeType, p.fallbacks = mimeType, fallbacks
+	return nil
+}
+
+func (p *fakePeer) CreateLatencyChannel() error                 { return nil }
+func (p *fakePeer) CreateStatusChannel() error                  { return nil }
+func (p *fakePeer) CreateOffer(context.Context) (string, error) { return "v=0 fake offer", nil }
+
+func (p *fakePeer) SetAnswer(ctx context.Context, answerSDP string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.answer = answerSDP
+	return p.answerErr
+}
+
+func (p *fakePeer) VideoCodec() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.videoCodec
+}
+
+func (p *fakePeer) OnConnectionStateChange(func(webrtc.PeerConnectionState))   {}
+func (p *fakePeer) OnICEConnectionStateChange(func(webrtc.ICEConnectionState)) {}
+func (p *fakePeer) OnICECandidate(func(*webrtc.ICECandidate))                  {}
+func (p *fakePeer) OnKeyframeRequest(func())                                   {}
+func (p *fakePeer) OnNACK(func(lost int))                                      {}
+
+func (p *fakePeer) Close() error { return nil }
+
+// fakeViewers keeps the sessions signaling adds and remembers what it was asked to do with them
+type fakeViewers struct {
+	mu       sync.Mutex
+	sessions map[string]*viewers.Session
+	overCap  bool
+	// Session IDs given the transcoder's H264, and those waited on for ICE
+	transcoded   []string
+	expectingICE []string
+}
+
+func (v *fakeViewers) Add(session *viewers.Session) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.sessions[session.ID] = session
+}
+
+func (v *fakeViewers) Get(id string) *viewers.Session {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.sessions[id]
+}
+
+func (v *fakeViewers) Remove(id string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.sessions, id)
+}
+
+func (v *fakeViewers) OverMonthlyCap(string) bool            { return v.overCap }
+func (v *fakeViewers) RequestKeyframe(*viewers.Session) bool { return false }
+
+func (v *fakeViewers) UseTranscoded(session *viewers.Session) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.transcoded = append(v.transcoded, session.ID)
+}
+
+func (v *fakeViewers) ExpectICE(session *viewers.Session, timeout time.Duration) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.expectingICE = append(v.expectingICE, session.ID)
+}
+
+// signalingTest is signaling for a camera called "driveway", with fakes for its viewers and
+// their connections. Change the fields to set the camera and server up before a request.
+type signalingTest struct {
+	*signaling
+	viewers *fakeViewers
+	// The connections made, in order
+	peers   []*fakePeer
+	audited []audit.Entry
+
+	cameraCodec string
+	transcodes  bool
+	shutdown    bool
+	// Users who may not watch the camera
+	forbidden []string
+}
+
+func newSignalingTest() *signalingTest {
+	st := &signalingTest{
+		viewers:     &fakeViewers{sessions: map[string]*viewers.Session{}},
+		cameraCodec: "H264",
+	}
+	st.signaling = &signaling{
+		camera:       "driveway",
+		codec:        func() string { return st.cameraCodec },
+		cameraState:  func() string { return "connecting" },
+		cameraError:  func() error { return nil },
+		canTranscode: func(codec string) bool { return st.transcodes && codec != "H264" },
+		newPeer: func(stream.PeerConfig) (stream.Viewer, error) {
+			peer := &fakePeer{videoCodec: webrtc.MimeTypeH264}
+			st.peers = append(st.peers, peer)
+			return peer, nil
+		},
+		closing: func() bool { return st.shutdown },
+		canView: func(r *http.Request, camera string) bool {
+			for _, user := range st.forbidden {
+				if user == currentUser(r) {
+					return false
+				}
+			}
+			return true
+		},
+		audit: func(r *http.Request, entry audit.Entry) {
+			st.audited = append(st.audited, entry)
+		},
+		sessions: st.viewers,
+		bus:      events.NewBus(),
+	}
+	return st
+}
+
+// post runs handler for a POST to target by user and returns the response
+func (st *signalingTest) post(handler http.HandlerFunc, target, user, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), userContextKey, user))
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+// offer asks for an offer as user and returns the session it started
+func (st *signalingTest) offer(t *testing.T, user string) offerResponse {
+	t.Helper()
+	w := st.post(st.handleOffer, "/api/offer", user, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("offer: got %d %s, want 200", w.Code, w.Body)
+	}
+	var offer offerResponse
+	err := json.NewDecoder(w.Body).Decode(&offer)
+	if err != nil {
+		t.Fatalf("offer: failed to decode response: %v", err)
+	}
+	return offer
+}
+
+// responseErrorCode is the code of an /api error response
+func responseErrorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body struct {
+		Code string `json:"code"`
+	}
+	err := json.NewDecoder(w.Body).Decode(&body)
+	if err != nil {
+		t.Fatalf("failed to decode error response %q: %v", w.Body, err)
+	}
+	return body.Code
+}
+
+func TestHandleOffer(t *testing.T) {
+	st := newSignalingTest()
+	offer := st.offer(t, "alice")
+
+	if offer.Type != "offer" || offer.SDP != "v=0 fake offer" || offer.SessionID == "" {
+		t.Errorf("got offer %+v, want the peer's offer and a session ID", offer)
+	}
+	session := st.viewers.Get(offer.SessionID)
+	if session == nil {
+		t.Fatal("the session wasn't added to the viewers")
+	}
+	if session.User != "alice" || session.Camera != "driveway" {
+		t.Errorf("session is %s watching %s, want alice watching driveway", session.User, session.Camera)
+	}
+	if len(st.peers) != 1 || st.peers[0].mimeType != webrtc.MimeTypeH264 {
+		t.Errorf("want one peer with an H264 track, got %d", len(st.peers))
+	}
+	if len(st.audited) != 1 || st.audited[0].Action != audit.ActionViewCamera {
+		t.Errorf("audited %+v, want one view_camera entry", st.audited)
+	}
+}
+
+func TestHandleOfferH265FallsBackToTranscodedH264(t *testing.T) {
+	st := newSignalingTest()
+	st.cameraCodec = "H265"
+	st.transcodes = true
+	st.offer(t, "alice")
+
+	peer := st.peers[0]
+	if peer.mimeType != webrtc.MimeTypeH265 || len(peer.fallbacks) != 1 || peer.fallbacks[0] != webrtc.MimeTypeH264 {
+		t.Errorf("track is %s with fallbacks %v, want H265 with H264 to fall back to", peer.mimeType, peer.fallbacks)
+	}
+}
+
+func TestHandleOfferFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		setup  func(st *signalingTest)
+		status int
+		code   string
+	}{
+		{"camera not connected yet", "/api/offer", func(st *signalingTest) { st.cameraCodec = "" },
+			http.StatusServiceUnavailable, "CAMERA_OFFLINE"},
+		{"MPEG-4 without the transcoder", "/api/offer", func(st *signalingTest) { st.cameraCodec = "MPEG4" },
+			http.StatusUnsupportedMediaType, "CODEC_UNSUPPORTED"},
+		{"shutting down", "/api/offer", func(st *signalingTest) { st.shutdown = true },
+			http.StatusServiceUnavailable, "SHUTTING_DOWN"},
+		{"bandwidth cap reached", "/api/offer", func(st *signalingTest) { st.viewers.overCap = true },
+			http.StatusForbidden, "BANDWIDTH_CAP_REACHED"},
+		{"relay without a TURN server", "/api/offer?relay=1", func(*signalingTest) {},
+			http.StatusBadRequest, "RELAY_UNAVAILABLE"},
+		{"another camera", "/api/offer?camera=garage", func(*signalingTest) {},
+			http.StatusNotFound, "CAMERA_NOT_FOUND"},
+		{"camera not granted", "/api/offer", func(st *signalingTest) { st.forbidden = []string{"alice"} },
+			http.StatusForbidden, "CAMERA_FORBIDDEN"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			st := newSignalingTest()
+			test.setup(st)
+
+			w := st.post(st.handleOffer, test.target, "alice", "")
+			if w.Code != test.status {
+				t.Errorf("got status %d, want %d", w.Code, test.status)
+			}
+			if code := responseErrorCode(t, w); code != test.code {
+				t.Errorf("got code %s, want %s", code, test.code)
+			}
+			if len(st.peers) != 0 || len(st.viewers.sessions) != 0 {
+				t.Errorf("made %d peers and %d sessions, want none", len(st.peers), len(st.viewers.sessions))
+			}
+		})
+	}
+}
+
+func TestHandleAnswer(t *testing.T) {
+	st := newSignalingTest()
+	offer := st.offer(t, "alice")
+
+	body, _ := json.Marshal(answerRequest{Type: "answer", SDP: "v=0 fake answer", SessionID: offer.SessionID})
+	w := st.post(st.handleAnswer, "/api/answer", "alice", string(body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d %s, want 200", w.Code, w.Body)
+	}
+	var response answerResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Status != "success" {
+		t.Errorf("got status %q, want success", response.Status)
+	}
+	if st.peers[0].answer != "v=0 fake answer" {
+		t.Errorf("the peer got answer %q", st.peers[0].answer)
+	}
+	if len(st.viewers.expectingICE) != 1 || st.viewers.expectingICE[0] != offer.SessionID {
+		t.Errorf("waiting on ICE for %v, want the session", st.viewers.expectingICE)
+	}
+	if len(st.viewers.transcoded) != 0 {
+		t.Errorf("an H264 camera's viewer was given the transcoder's video")
+	}
+}
+
+func TestHandleAnswerTranscodedH264(t *testing.T) {
+	st := newSignalingTest()
+	st.cameraCodec = "H265"
+	st.transcodes = true
+	offer := st.offer(t, "alice")
+
+	body, _ := json.Marshal(answerRequest{Type: "answer", SDP: "v=0 fake answer", SessionID: offer.SessionID})
+	w := st.post(st.handleAnswer, "/api/answer", "alice", string(body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d %s, want 200", w.Code, w.Body)
+	}
+	if len(st.viewers.transcoded) != 1 || st.viewers.transcoded[0] != offer.SessionID {
+		t.Errorf("transcoded sessions are %v, want the one that picked H264", st.viewers.transcoded)
+	}
+}
+
+func TestHandleAnswerFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		// Changes the answer to the offer alice asked for
+		answer    func(answer *answerRequest)
+		user      string
+		answerErr error
+		status    int
+		code      string
+		// Whether the session is gone afterwards
+		removed bool
+	}{
+		{"unknown session", func(answer *answerRequest) { answer.SessionID = "nope" }, "alice", nil,
+			http.StatusNotFound, "SESSION_NOT_FOUND", false},
+		{"someone else's session", func(*answerRequest) {}, "bob", nil,
+			http.StatusNotFound, "SESSION_NOT_FOUND", false},
+		{"no codec in common", func(*answerRequest) {}, "alice", stream.ErrNoCommonCodec,
+			http.StatusUnsupportedMediaType, "CODEC_UNSUPPORTED", true},
+		{"answer that doesn't fit the offer", func(*answerRequest) {}, "alice", stream.ErrInvalidAnswer,
+			http.StatusBadRequest, "INVALID_ANSWER", false},
+		{"peer connection failure", func(*answerRequest) {}, "alice", errors.New("dtls broke"),
+			http.StatusInternalServerError, "ANSWER_FAILED", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			st := newSignalingTest()
+			offer := st.offer(t, "alice")
+			st.peers[0].answerErr = test.answerErr
+
+			answer := answerRequest{Type: "answer", SDP: "v=0 fake answer", SessionID: offer.SessionID}
+			test.answer(&answer)
+			body, _ := json.Marshal(answer)
+			w := st.post(st.handleAnswer, "/api/answer", test.user, string(body))
+			if w.Code != test.status {
+				t.Errorf("got status %d, want %d", w.Code, test.status)
+			}
+			if code := responseErrorCode(t, w); code != test.code {
+				t.Errorf("got code %s, want %s", code, test.code)
+			}
+			if removed := st.viewers.Get(offer.SessionID) == nil; removed != test.removed {
+				t.Errorf("session removed: %v, want %v", removed, test.removed)
+			}
+		})
+	}
+}
+
+func TestHandleAnswerInvalidBody(t *testing.T) {
+	st := newSignalingTest()
+	w := st.post(st.handleAnswer, "/api/answer", "alice", "not json")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, want 400", w.Code)
+	}
+	if code := responseErrorCode(t, w); code != "INVALID_REQUEST" {
+		t.Errorf("got code %s, want INVALID_REQUEST", code)
+	}
+}
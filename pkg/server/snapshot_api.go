@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/transcode"
+)
+
+// snapshotTimeout bounds waiting for the camera's next keyframe and encoding it
+const snapshotTimeout = 10 * time.Second
+
+// snapshotTypes are the image types a snapshot can be, in the order they are preferred when the
+// Accept header doesn't choose: JPEG first, since everything shows it
+var snapshotTypes = []string{"image/jpeg", "image/webp", "image/png"}
+
+// snapshotFormats maps snapshotTypes to what the snapshotter calls them
+var snapshotFormats = map[string]string{
+	"image/jpeg": transcode.FormatJPEG,
+	"image/webp": transcode.FormatWebP,
+	"image/png":  transcode.FormatPNG,
+}
+
+// handleCameraSnapshot sends a still image of the camera's picture, in the type the Accept header
+// asks for: JPEG, WebP or PNG. It is made from the camera's next keyframe, so it can take up to a
+// keyframe interval.
+// GET /api/cameras/{id}/snapshot
+func (s *Server) handleCameraSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	camera := r.PathValue("id")
+	if camera != s.cameraID || !s.canViewCamera(r, camera) {
+		http.Error(w, "Camera not found", http.StatusNotFound)
+		return
+	}
+
+	// Caches have to keep each type apart
+	w.Header().Set("Vary", "Accept")
+	mediaType := negotiate(r, snapshotTypes)
+	if mediaType == "" {
+		writeAPIError(w, r, http.StatusNotAcceptable, "NOT_ACCEPTABLE",
+			"a snapshot can only be image/jpeg, image/webp or image/png", map[string]any{"available": snapshotTypes})
+		return
+	}
+
+	if s.cameraSupervisor.State() != "connected" {
+		writeAPIError(w, r, http.StatusServiceUnavailable, "CAMERA_OFFLINE",
+			"the camera is not connected, try again shortly", cameraOfflineDetails(s.cameraSupervisor.State(), s.cameraSupervisor.LastError()))
+		return
+	}
+	codec := s.currentCodec()
+	if !transcode.CanSnapshot(codec) {
+		writeAPIError(w, r, http.StatusUnsupportedMediaType, "CODEC_UNSUPPORTED",
+			fmt.Sprintf("snapshots can't be taken of the camera's %s video", codec), nil)
+		return
+	}
+
+	image, err := s.grabSnapshot(r.Context(), snapshotFormats[mediaType])
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeAPIError(w, r, http.StatusGatewayTimeout, "SNAPSHOT_TIMEOUT",
+			fmt.Sprintf("the camera sent no keyframe within %s", snapshotTimeout), nil)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to take a snapshot of %s: %v", camera, err)
+		writeAPIError(w, r, http.StatusInternalServerError, "SNAPSHOT_FAILED", "failed to take a snapshot", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	// It is out of date by the next keyframe
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(image)
+}
+
+// grabSnapshot takes a snapshot in format, asking the camera for a keyframe straight away when it
+// can be asked, so there's no waiting for its next scheduled one
+func (s *Server) grabSnapshot(ctx context.Context, format string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, snapshotTimeout)
+	defer cancel()
+
+	if s.cameraKeyframeRequests != nil {
+		s.cameraKeyframeRequests.Request()
+	}
+	return s.snapshotter.Grab(ctx, format)
+}
+
+// notifierSnapshot is the chat notifiers' notify.SnapshotFunc
+func (s *Server) notifierSnapshot(camera string) ([]byte, error) {
+	if camera != s.cameraID {
+		return nil, fmt.Errorf("unknown camera %q", camera)
+	}
+	if !transcode.CanSnapshot(s.currentCodec()) {
+		return nil, fmt.Errorf("snapshots can't be taken of %s video", s.currentCodec())
+	}
+	return s.grabSnapshot(context.Background(), transcode.FormatJPEG)
+}
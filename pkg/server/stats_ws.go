@@ -0,0 +1,171 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/monitor"
+	"github.com/nisarg-dave/camera-viewer/pkg/viewers"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// defaultStatsInterval is how often a stats snapshot is pushed when no interval is given
+	defaultStatsInterval = 2 * time.Second
+	// minStatsInterval stops a dashboard from asking for snapshots many times a second
+	minStatsInterval = 500 * time.Millisecond
+)
+
+// statsUpgrader upgrades the stats and control WebSockets
+func (s *Server) statsUpgrader() *websocket.Upgrader {
+	return &websocket.Upgrader{
+		// Browsers send an Origin header on WebSocket connections but CORS doesn't apply to them,
+		// so other sites are checked against the same allowlist here
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || sameOrigin(r, origin) || s.corsOriginAllowed(origin)
+		},
+	}
+}
+
+// sameOrigin reports whether origin is the site the request was made to, i.e. our own frontend
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// statsSnapshot is one message on the stats WebSocket
+type statsSnapshot struct {
+	Time     time.Time                      `json:"time"`
+	Cameras  map[string]monitor.IngestStats `json:"cameras"`
+	Sessions []sessionSnapshot              `json:"sessions"`
+}
+
+// sessionSnapshot is a session's entry in a stats snapshot
+type sessionSnapshot struct {
+	sessionResponse
+	// Bits per second sent since the previous snapshot
+	Bitrate float64 `json:"bitrate"`
+}
+
+// statsTracker takes stats snapshots, working out each session's bitrate since the previous one
+type statsTracker struct {
+	server     *Server
+	showCamera bool
+	include    func(*viewers.Session) bool
+	// Bytes sent to each session at the last snapshot
+	lastBytes map[string]uint64
+	lastTime  time.Time
+}
+
+// newStatsTracker returns a tracker whose snapshots have the camera's ingest stats if showCamera is set,
+// and the sessions include returns true for
+func (s *Server) newStatsTracker(showCamera bool, include func(*viewers.Session) bool) *statsTracker {
+	return &statsTracker{
+		server:     s,
+		showCamera: showCamera,
+		include:    include,
+		lastBytes:  make(map[string]uint64),
+		lastTime:   time.Now(),
+	}
+}
+
+func (t *statsTracker) snapshot() statsSnapshot {
+	now := time.Now()
+	elapsed := now.Sub(t.lastTime).Seconds()
+	t.lastTime = now
+
+	snapshot := statsSnapshot{
+		Time:     now,
+		Cameras:  map[string]monitor.IngestStats{},
+		Sessions: []sessionSnapshot{},
+	}
+	if t.showCamera {
+		snapshot.Cameras[t.server.cameraID] = t.server.streamMonitor.Ingest()
+	}
+
+	seen := make(map[string]uint64)
+	for _, s := range t.server.viewerSessions.List() {
+		if !t.include(s) {
+			continue
+		}
+		entry := sessionSnapshot{sessionResponse: newSessionResponse(s)}
+		if previous, ok := t.lastBytes[s.ID]; ok && elapsed > 0 {
+			entry.Bitrate = float64(entry.BytesSent-previous) * 8 / elapsed
+		}
+		seen[s.ID] = entry.BytesSent
+		snapshot.Sessions = append(snapshot.Sessions, entry)
+	}
+	t.lastBytes = seen
+	return snapshot
+}
+
+// handleStatsSocket pushes a snapshot of camera ingest stats and viewer session stats every interval
+// over a WebSocket, for live bitrate and frame rate graphs. Admins see every session, everyone else only their own.
+// GET /api/stats/ws?interval=2s
+//
+// In the browser: new WebSocket("wss://host/api/stats/ws").onmessage = (m) => JSON.parse(m.data)
+func (s *Server) handleStatsSocket(w http.ResponseWriter, r *http.Request) {
+	interval := defaultStatsInterval
+	if value := r.URL.Query().Get("interval"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < minStatsInterval {
+			http.Error(w, "interval must be a duration of at least "+minStatsInterval.String(), http.StatusBadRequest)
+			return
+		}
+		interval = parsed
+	}
+
+	conn, err := s.statsUpgrader().Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written an error response
+		log.Printf("Failed to upgrade stats WebSocket: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// Nothing is expected from the client, but reading is how a closed connection is noticed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			_, _, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	admin := s.requestUser(r).IsAdmin()
+	user := currentUser(r)
+	tracker := s.newStatsTracker(s.canViewCamera(r, s.cameraID), func(session *viewers.Session) bool {
+		return admin || session.User == user
+	})
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		snapshot := tracker.snapshot()
+
+		conn.SetWriteDeadline(snapshot.Time.Add(10 * time.Second))
+		err = conn.WriteJSON(snapshot)
+		if err != nil {
+			return
+		}
+
+		select {
+		case <-closed:
+			return
+		case <-r.Context().Done():
+			// The server is shutting down
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(time.Second))
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// handleSubsystems shows the background subsystems, whether they are running and how often they
+// have failed and been restarted, see supervisor.Tree. Admins only.
+// GET /api/subsystems
+func (s *Server) handleSubsystems(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.subsystems.Status())
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+	"github.com/nisarg-dave/camera-viewer/pkg/viewers"
+)
+
+// outboundInterval is how often the bitrate sent to viewers is measured for GET /api/summary
+const outboundInterval = 5 * time.Second
+
+// summaryResponse is the totals GET /api/summary returns
+type summaryResponse struct {
+	Time time.Time `json:"time"`
+	// Cameras that are connected, and the ones that are connecting or disabled
+	CamerasOnline  int `json:"cameras_online"`
+	CamerasOffline int `json:"cameras_offline"`
+	// Viewer sessions whose video is flowing
+	Viewers int `json:"viewers"`
+	// Video arriving from the cameras and sent to viewers
+	BandwidthInBps  float64 `json:"bandwidth_in_bps"`
+	BandwidthOutBps float64 `json:"bandwidth_out_bps"`
+	// The disk the data directory is on
+	DiskUsedBytes  uint64 `json:"disk_used_bytes"`
+	DiskTotalBytes uint64 `json:"disk_total_bytes"`
+	DiskLow        bool   `json:"disk_low"`
+	// Events in the last 24 hours, out of the most recent 1000 kept in memory
+	Events24h int `json:"events_24h"`
+}
+
+// measureOutbound keeps outboundBps up to date until stop is closed.
+// This blocks, so call it in a goroutine.
+func (s *Server) measureOutbound(stop <-chan struct{}) {
+	tracker := s.newStatsTracker(false, func(*viewers.Session) bool { return true })
+	tracker.snapshot()
+
+	ticker := time.NewTicker(outboundInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			total := 0.0
+			for _, session := range tracker.snapshot().Sessions {
+				total += session.Bitrate
+			}
+			s.outboundBps.Store(math.Float64bits(total))
+		}
+	}
+}
+
+// handleSummary returns the server's totals in one small response, for status bars and dashboard
+// widgets that would otherwise poll several endpoints. Admin only.
+// GET /api/summary
+func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := time.Now()
+	summary := summaryResponse{Time: now}
+
+	camera := s.currentCameraStatus(s.cameraID)
+	if camera.State == "connected" {
+		summary.CamerasOnline++
+	} else {
+		summary.CamerasOffline++
+	}
+	summary.BandwidthInBps = camera.BitrateBps
+	summary.BandwidthOutBps = math.Float64frombits(s.outboundBps.Load())
+
+	for _, session := range s.viewerSessions.List() {
+		if session.Connected() {
+			summary.Viewers++
+		}
+	}
+
+	disk := s.diskMonitor.Usage()
+	summary.DiskUsedBytes = disk.TotalBytes - disk.FreeBytes
+	summary.DiskTotalBytes = disk.TotalBytes
+	summary.DiskLow = disk.Low
+
+	_, summary.Events24h = s.eventHistory.Query(events.Filter{Since: now.Add(-24 * time.Hour)}, 0, 0, false)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
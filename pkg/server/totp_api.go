@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/nisarg-dave/camera-viewer/internal/audit"
+	"github.com/nisarg-dave/camera-viewer/internal/auth"
+)
+
+// totpIssuer is the name authenticator apps show next to the code
+const totpIssuer = "Camera Viewer"
+
+// totpEnrollResponse is a new two-factor secret, and the otpauth:// URL to show as a QR code
+type totpEnrollResponse struct {
+	Secret string `json:"secret"`
+	URL    string `json:"url"`
+}
+
+// totpCodeRequest is a code from the user's authenticator app
+type totpCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// handleTOTPEnroll starts setting up two-factor authentication for the logged in user.
+// It returns a new secret and an otpauth:// URL to show as a QR code. Nothing changes
+// until the user proves their app works with POST /api/totp/confirm.
+// POST /api/totp/enroll
+func (s *Server) handleTOTPEnroll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := s.requestUser(r)
+	if user.Source != "" {
+		http.Error(w, "Single sign-on users set up two-factor authentication with their identity provider", http.StatusBadRequest)
+		return
+	}
+	if user.HasTOTP() {
+		http.Error(w, "Two-factor authentication is already on", http.StatusConflict)
+		return
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+		return
+	}
+	err = s.users.StartTOTP(user.Username, secret)
+	if err != nil {
+		log.Printf("Failed to save TOTP secret for %s: %v", user.Username, err)
+		http.Error(w, "Failed to start two-factor setup", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(totpEnrollResponse{Secret: secret, URL: auth.TOTPURL(totpIssuer, user.Username, secret)})
+}
+
+// handleTOTPConfirm turns on two-factor authentication once the user enters a code from their app.
+// POST /api/totp/confirm {"code": "123456"}
+func (s *Server) handleTOTPConfirm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body totpCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, "Failed to decode request", http.StatusBadRequest)
+		return
+	}
+
+	username := currentUser(r)
+	err = s.users.ConfirmTOTP(username, body.Code)
+	if errors.Is(err, auth.ErrTOTPNotEnrolled) {
+		http.Error(w, "Start with POST /api/totp/enroll", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, auth.ErrInvalidTOTP) {
+		http.Error(w, "Invalid two-factor code", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to turn on TOTP for %s: %v", username, err)
+		http.Error(w, "Failed to turn on two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %s turned on two-factor authentication", username)
+	s.recordAudit(r, audit.Entry{Action: audit.ActionTOTPEnabled, Target: username})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTOTPDisable turns off two-factor authentication for the logged in user.
+// A current code is required so a hijacked session can't quietly remove it.
+// POST /api/totp/disable {"code": "123456"}
+func (s *Server) handleTOTPDisable(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body totpCodeRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, "Failed to decode request", http.StatusBadRequest)
+		return
+	}
+
+	username := currentUser(r)
+	if !s.checkLockout(w, r, username) {
+		return
+	}
+	if !s.requestUser(r).HasTOTP() {
+		http.Error(w, "Two-factor authentication is not on", http.StatusBadRequest)
+		return
+	}
+
+	err = s.users.CheckTOTP(username, body.Code)
+	if err != nil {
+		s.recordLoginFailure(r, username)
+		http.Error(w, "Invalid two-factor code", http.StatusForbidden)
+		return
+	}
+
+	err = s.users.DisableTOTP(username)
+	if err != nil {
+		log.Printf("Failed to turn off TOTP for %s: %v", username, err)
+		http.Error(w, "Failed to turn off two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %s turned off two-factor authentication", username)
+	s.recordAudit(r, audit.Entry{Action: audit.ActionTOTPDisabled, Target: username})
+	w.WriteHeader(http.StatusNoContent)
+}
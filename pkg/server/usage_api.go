@@ -0,0 +1,46 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// usageResponse is one user's bandwidth use this month and their limits
+type usageResponse struct {
+	User      string  `json:"user"`
+	Bytes     uint64  `json:"bytes"`
+	MonthlyGB float64 `json:"monthly_gb,omitempty"`
+	MaxKbps   int     `json:"max_kbps,omitempty"`
+}
+
+// usageMonthResponse is the bandwidth used so far this month, e.g. "2024-06"
+type usageMonthResponse struct {
+	Month string          `json:"month"`
+	Users []usageResponse `json:"users"`
+}
+
+// handleUsage returns how much video has been sent this month. Admins see every user, everyone else only themselves.
+// GET /api/usage
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	month, all := s.viewerSessions.Usage().All()
+
+	list := []usageResponse{}
+	if s.requestUser(r).IsAdmin() {
+		for user, bytes := range all {
+			limit := s.viewerSessions.Limit(user)
+			list = append(list, usageResponse{User: user, Bytes: bytes, MonthlyGB: limit.MonthlyGB, MaxKbps: limit.MaxKbps})
+		}
+	} else {
+		user := currentUser(r)
+		limit := s.viewerSessions.Limit(user)
+		list = append(list, usageResponse{User: user, Bytes: all[user], MonthlyGB: limit.MonthlyGB, MaxKbps: limit.MaxKbps})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usageMonthResponse{Month: month, Users: list})
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/audit"
+	"github.com/nisarg-dave/camera-viewer/internal/auth"
+)
+
+// userResponse is what the API returns for a user - never the password hash
+type userResponse struct {
+	Username  string    `json:"username"`
+	Role      auth.Role `json:"role"`
+	Cameras   []string  `json:"cameras"`
+	CreatedAt time.Time `json:"created_at"`
+	Source    string    `json:"source,omitempty"`
+	TOTP      bool      `json:"totp_enabled"`
+}
+
+// createUserRequest is the body of POST /api/users
+type createUserRequest struct {
+	Username string    `json:"username"`
+	Password string    `json:"password"`
+	Role     auth.Role `json:"role"`
+	Cameras  []string  `json:"cameras"`
+}
+
+// updateUserRequest is the body of PUT /api/users/{username}. An empty password leaves it unchanged.
+type updateUserRequest struct {
+	Role        auth.Role `json:"role"`
+	Cameras     []string  `json:"cameras"`
+	Password    string    `json:"password"`
+	DisableTOTP bool      `json:"disable_totp"`
+}
+
+func toUserResponse(user auth.User) userResponse {
+	return userResponse{
+		Username:  user.Username,
+		Role:      user.Role,
+		Cameras:   user.Cameras,
+		CreatedAt: user.CreatedAt,
+		Source:    user.Source,
+		TOTP:      user.HasTOTP(),
+	}
+}
+
+// handleUsers lists or creates users. Admin only.
+// GET  /api/users
+// POST /api/users {"username": "...", "password": "...", "role": "viewer", "cameras": ["doorbell"]}
+func (s *Server) handleUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list := []userResponse{}
+		for _, user := range s.users.List() {
+			list = append(list, toUserResponse(user))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+
+	case http.MethodPost:
+		var body createUserRequest
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			http.Error(w, "Failed to decode user", http.StatusBadRequest)
+			return
+		}
+		if body.Role == "" {
+			body.Role = auth.RoleViewer
+		}
+
+		err = s.users.Add(body.Username, body.Password, body.Role, body.Cameras)
+		if errors.Is(err, auth.ErrUserExists) {
+			http.Error(w, "User already exists", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.Printf("User %s created user %s (%s)", currentUser(r), body.Username, body.Role)
+		s.recordAudit(r, audit.Entry{
+			Action: audit.ActionUserCreated,
+			Target: body.Username,
+			Detail: fmt.Sprintf("role %s, cameras %v", body.Role, body.Cameras),
+		})
+
+		user, _ := s.users.Get(body.Username)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(toUserResponse(user))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleUser updates or deletes one user. Admin only.
+// PUT    /api/users/{username} {"role": "viewer", "cameras": ["doorbell"], "password": "optional", "disable_totp": false}
+// disable_totp is for users who have lost their authenticator app.
+// DELETE /api/users/{username}
+func (s *Server) handleUser(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+
+	switch r.Method {
+	case http.MethodPut:
+		var body updateUserRequest
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			http.Error(w, "Failed to decode user", http.StatusBadRequest)
+			return
+		}
+
+		// Don't let the last admin lock everyone out by demoting themselves
+		if body.Role != auth.RoleAdmin && username == currentUser(r) {
+			http.Error(w, "You can't remove your own admin role", http.StatusBadRequest)
+			return
+		}
+
+		existing, err := s.users.Get(username)
+		if err == nil && existing.Source != "" && body.Password != "" {
+			http.Error(w, "Single sign-on users can't have a password", http.StatusBadRequest)
+			return
+		}
+
+		err = s.users.SetAccess(username, body.Role, body.Cameras)
+		if errors.Is(err, auth.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if body.Password != "" {
+			err = s.users.SetPassword(username, body.Password)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if body.DisableTOTP {
+			err = s.users.DisableTOTP(username)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		log.Printf("User %s updated user %s (%s, cameras %v)", currentUser(r), username, body.Role, body.Cameras)
+		detail := fmt.Sprintf("role %s, cameras %v", body.Role, body.Cameras)
+		if body.Password != "" {
+			detail += ", password reset"
+		}
+		if body.DisableTOTP {
+			detail += ", two-factor turned off"
+		}
+		s.recordAudit(r, audit.Entry{Action: audit.ActionUserUpdated, Target: username, Detail: detail})
+
+		user, _ := s.users.Get(username)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(toUserResponse(user))
+
+	case http.MethodDelete:
+		if username == currentUser(r) {
+			http.Error(w, "You can't delete yourself", http.StatusBadRequest)
+			return
+		}
+
+		err := s.users.Delete(username)
+		if errors.Is(err, auth.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to delete user %s: %v", username, err)
+			http.Error(w, "Failed to delete user", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("User %s deleted user %s", currentUser(r), username)
+		s.recordAudit(r, audit.Entry{Action: audit.ActionUserDeleted, Target: username})
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
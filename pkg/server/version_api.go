@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+)
+
+// startedAt is when the process started, so the version response also shows the uptime
+var startedAt = time.Now()
+
+// buildInfo fills in the commit and build date from the Go build info when they weren't set with -ldflags
+func (s *Server) buildInfo() (string, string, bool) {
+	revision, date, modified := s.commit, s.buildDate, false
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return revision, date, modified
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if revision == "" {
+				revision = setting.Value
+			}
+		case "vcs.time":
+			if date == "" {
+				date = setting.Value
+			}
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	return revision, date, modified
+}
+
+// configFeatures lists which optional features cfg turns on
+func configFeatures(cfg *config.Config) []string {
+	features := []string{}
+	add := func(name string, enabled bool) {
+		if enabled {
+			features = append(features, name)
+		}
+	}
+
+	add("auth", !cfg.Auth.Disabled)
+	add("oidc", cfg.Auth.OIDC != nil)
+	add("tls", cfg.TLS != nil)
+	add("autocert", cfg.TLS != nil && cfg.TLS.Autocert != nil)
+	add("admin_listener", cfg.AdminListener != nil)
+	add("grpc", cfg.GRPC != nil)
+	add("metrics", !cfg.Metrics.Disabled)
+	add("swagger_ui", cfg.APIDocs.SwaggerUI)
+	add("tracing", cfg.Tracing != nil)
+	add("mqtt", cfg.MQTT != nil)
+	add("webhooks", len(cfg.Webhooks) > 0)
+	add("notifiers", len(cfg.Notifiers) > 0)
+	add("rules", len(cfg.Rules) > 0)
+	add("audio_detection", cfg.Audio != nil)
+	add("tamper_detection", cfg.StreamAlerts != nil && cfg.StreamAlerts.Tamper)
+	add("jitter_buffer", cfg.RTSP.JitterBuffer != nil)
+	add("batch_writes", cfg.WebRTC.BatchWrites != nil)
+	add("gop_cache", cfg.WebRTC.GOPCache != nil)
+	add("transcode", cfg.Transcode != nil)
+	add("keyframe_request", cfg.KeyframeRequest != nil)
+	add("bandwidth_limits", cfg.Bandwidth.Default != (config.BandwidthLimit{}) || len(cfg.Bandwidth.Users) > 0)
+	return features
+}
+
+// versionResponse is what build is running and which optional features are turned on
+type versionResponse struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	// Whether the binary was built from a checkout with uncommitted changes
+	Modified  bool      `json:"modified"`
+	BuildDate string    `json:"build_date"`
+	GoVersion string    `json:"go_version"`
+	Platform  string    `json:"platform"`
+	Features  []string  `json:"features"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// handleVersion returns what build is running and which optional features are turned on,
+// for bug reports and keeping track of a fleet of servers.
+// GET /api/version
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	revision, date, modified := s.buildInfo()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versionResponse{
+		Version:   s.version,
+		Commit:    revision,
+		Modified:  modified,
+		BuildDate: date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Features:  s.enabledFeatures,
+		StartedAt: startedAt,
+	})
+}
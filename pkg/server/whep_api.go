@@ -0,0 +1,203 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/nisarg-dave/camera-viewer/internal/audit"
+	"github.com/nisarg-dave/camera-viewer/internal/tracing"
+
+	"github.com/pion/webrtc/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// whepSignaler is the Signaler of a session started with POST /api/whep: the offer is the POST's
+// response, and the answer and candidates come in PATCHes to the session's URL
+type whepSignaler struct {
+	w http.ResponseWriter
+	r *http.Request
+	// The signaling's WHEP sessions, where it waits for PATCHes
+	sessions *sync.Map
+	// Set by SendOffer
+	id string
+
+	mu          sync.Mutex
+	onAnswer    func(Answer) error
+	onCandidate func(Candidate) error
+}
+
+// SendOffer responds to the POST with the offer, the session's URL and the ICE servers
+func (ws *whepSignaler) SendOffer(ctx context.Context, offer Offer) error {
+	ws.id = offer.SessionID
+	// Before the response, so a PATCH that comes straight back finds the session
+	ws.sessions.Store(offer.SessionID, ws)
+
+	location := "/api/whep/" + offer.SessionID
+	if apiVersion(ws.r) >= 1 {
+		location = "/api/v1/whep/" + offer.SessionID
+	}
+	header := ws.w.Header()
+	header.Set("Location", location)
+	header.Set("Content-Type", "application/sdp")
+	// WHEP players take the STUN and TURN servers from Link headers
+	for _, server := range offer.ICEServers {
+		for _, url := range server.URLs {
+			link := fmt.Sprintf(`<%s>; rel="ice-server"`, url)
+			if server.Username != "" {
+				link += fmt.Sprintf(`; username=%q; credential=%q; credential-type="password"`, server.Username, server.Credential)
+			}
+			header.Add("Link", link)
+		}
+	}
+	ws.w.WriteHeader(http.StatusCreated)
+	_, err := io.WriteString(ws.w, offer.SDP)
+	return err
+}
+
+func (ws *whepSignaler) OnAnswer(handler func(Answer) error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.onAnswer = handler
+}
+
+func (ws *whepSignaler) OnCandidate(handler func(Candidate) error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.onCandidate = handler
+}
+
+// Close forgets the session, so PATCHes to it are answered with SESSION_NOT_FOUND
+func (ws *whepSignaler) Close() error {
+	ws.sessions.Delete(ws.id)
+	return nil
+}
+
+// handleWHEP starts a viewer session for WHEP players, e.g. OBS or GStreamer's whepsrc. The server
+// makes the offer: an empty POST is answered with 201 Created, the offer as application/sdp and the
+// session's URL in Location, where the player PATCHes its answer and trickles its candidates.
+// Players that send an offer of their own are turned away, since the server always offers.
+// POST /api/whep?camera=
+func (s *signaling) handleWHEP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "method not allowed", nil)
+		return
+	}
+
+	requestLogf(r, "Received WHEP request")
+
+	if r.ContentLength != 0 {
+		writeAPIError(w, r, http.StatusNotAcceptable, "CLIENT_OFFER_UNSUPPORTED",
+			"the server makes the offer, POST without a body and PATCH the answer to the session's URL", nil)
+		return
+	}
+
+	ctx, span := tracing.StartRequest(r, "webrtc.offer", attribute.String("camera", s.camera))
+	defer span.End()
+
+	if !s.checkCameraAccess(w, r) {
+		return
+	}
+
+	session, failure := s.watch(ctx, viewerRequest{
+		user:      currentUser(r),
+		relayOnly: r.URL.Query().Get("relay") == "1",
+		requestID: requestID(r),
+	}, &whepSignaler{w: w, r: r, sessions: &s.whepSessions})
+	if failure != nil {
+		if failure.err != nil {
+			tracing.Fail(span, failure.err)
+			requestLogf(r, "%v", failure)
+		}
+		failure.write(w, r)
+		return
+	}
+	span.SetAttributes(attribute.String("session.id", session.ID))
+	s.audit(r, audit.Entry{Action: audit.ActionViewCamera, Camera: s.camera, Detail: "session " + session.ID})
+}
+
+// handleWHEPSession takes a WHEP player's answer (application/sdp) or its trickled candidates
+// (application/trickle-ice-sdpfrag), or ends the session like DELETE /api/sessions/{id}.
+// PATCH, DELETE /api/whep/{id}
+func (s *signaling) handleWHEPSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		s.closeSession(w, r)
+		return
+	}
+	if r.Method != http.MethodPatch {
+		writeAPIError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "method not allowed", nil)
+		return
+	}
+
+	// Only the user who asked for the offer can answer it
+	session := s.sessions.Get(r.PathValue("id"))
+	value, ok := s.whepSessions.Load(r.PathValue("id"))
+	if session == nil || !ok || session.User != currentUser(r) {
+		writeAPIError(w, r, http.StatusNotFound, "SESSION_NOT_FOUND", "viewer session not found, request a new offer", nil)
+		return
+	}
+	sig := value.(*whepSignaler)
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		writeAPIError(w, r, http.StatusBadRequest, "INVALID_REQUEST", "failed to read the body", nil)
+		return
+	}
+
+	sig.mu.Lock()
+	onAnswer, onCandidate := sig.onAnswer, sig.onCandidate
+	sig.mu.Unlock()
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/sdp":
+		err = onAnswer(Answer{SessionID: session.ID, SDP: string(body)})
+	case "application/trickle-ice-sdpfrag":
+		for _, candidate := range sdpFragCandidates(string(body)) {
+			candidate.SessionID = session.ID
+			err = onCandidate(candidate)
+			if err != nil {
+				break
+			}
+		}
+	default:
+		writeAPIError(w, r, http.StatusUnsupportedMediaType, "UNSUPPORTED_MEDIA_TYPE",
+			"the body must be application/sdp or application/trickle-ice-sdpfrag", nil)
+		return
+	}
+	if err != nil {
+		failure, ok := err.(*signalingError)
+		if !ok {
+			failure = &signalingError{status: http.StatusBadRequest, code: "INVALID_REQUEST", message: err.Error()}
+		}
+		failure.write(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sdpFragCandidates reads the candidates out of a trickle-ice-sdpfrag body (RFC 8840). Each
+// belongs to the media section of the a=mid line before it.
+func sdpFragCandidates(frag string) []Candidate {
+	var candidates []Candidate
+	var mid *string
+	scanner := bufio.NewScanner(strings.NewReader(frag))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if value, ok := strings.CutPrefix(line, "a=mid:"); ok {
+			mid = &value
+		}
+		if value, ok := strings.CutPrefix(line, "a=candidate:"); ok {
+			candidates = append(candidates, Candidate{ICECandidateInit: webrtc.ICECandidateInit{
+				Candidate: "candidate:" + value,
+				SDPMid:    mid,
+			}})
+		}
+	}
+	return candidates
+}
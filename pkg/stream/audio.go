@@ -0,0 +1,101 @@
+package stream
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+
+	"github.com/nisarg-dave/camera-viewer/internal/recovery"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/g711"
+	"github.com/pion/rtp"
+)
+
+// AudioHandler receives decoded audio from the camera as signed 16-bit mono samples
+type AudioHandler func(samples []int16, sampleRate int)
+
+// SetAudioHandler sets the callback that receives the camera's audio.
+// Unlike video, audio is only requested from the camera when a handler is set,
+// so this must be called before Connect.
+// Only uncompressed formats are supported: G711 (mu-law/A-law) and 16-bit LPCM.
+func (s *RTSPStream) SetAudioHandler(handler AudioHandler) {
+	s.packetsMu.Lock()
+	defer s.packetsMu.Unlock()
+	s.onAudioHandler = handler
+}
+
+// setupAudio sets up the media track if forma is an audio format we can decode.
+// It returns false (and no error) if the format isn't one we understand.
+func (s *RTSPStream) setupAudio(client *gortsplib.Client, baseURL *base.URL, media *description.Media, forma format.Format) (bool, error) {
+	var decode func(payload []byte) []int16
+	var sampleRate int
+
+	switch f := forma.(type) {
+	case *format.G711:
+		sampleRate = f.SampleRate
+		channels := f.ChannelCount
+		mulaw := f.MULaw
+		decode = func(payload []byte) []int16 {
+			// G711 is one byte per sample, the decoders expand it to 16-bit big-endian PCM
+			var pcm []byte
+			if mulaw {
+				pcm = g711.DecodeMulaw(payload)
+			} else {
+				pcm = g711.DecodeAlaw(payload)
+			}
+			return pcm16ToMono(pcm, channels)
+		}
+
+	case *format.LPCM:
+		if f.BitDepth != 16 {
+			log.Printf("Skipping %d-bit LPCM audio, only 16-bit is supported", f.BitDepth)
+			return false, nil
+		}
+		sampleRate = f.SampleRate
+		channels := f.ChannelCount
+		decode = func(payload []byte) []int16 {
+			return pcm16ToMono(payload, channels)
+		}
+
+	default:
+		return false, nil
+	}
+
+	log.Printf("Found %s audio format (%d Hz) - setting up...", forma.Codec(), sampleRate)
+
+	_, err := client.Setup(baseURL, media, 0, 0)
+	if err != nil {
+		return false, fmt.Errorf("failed to setup audio media: %w", err)
+	}
+
+	client.OnPacketRTP(media, forma, func(pkt *rtp.Packet) {
+		s.handlePacket(client, func() {
+			// A bad audio packet shouldn't take the video down with it
+			defer recovery.Recover("audio_handler", nil)
+			if s.onAudioHandler != nil {
+				s.onAudioHandler(decode(pkt.Payload), sampleRate)
+			}
+		})
+	})
+
+	return true, nil
+}
+
+// pcm16ToMono converts big-endian 16-bit PCM (the RTP byte order) to samples,
+// keeping only the first channel when there are several.
+func pcm16ToMono(pcm []byte, channels int) []int16 {
+	if channels < 1 {
+		channels = 1
+	}
+
+	frameSize := 2 * channels
+	samples := make([]int16, 0, len(pcm)/frameSize)
+	for i := 0; i+1 < len(pcm); i += frameSize {
+		samples = append(samples, int16(binary.BigEndian.Uint16(pcm[i:])))
+	}
+	return samples
+}
@@ -0,0 +1,107 @@
+package stream
+
+import (
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// jitterBuffer puts video packets that arrived out of order, e.g. over a camera's flaky Wi-Fi,
+// back in sequence order before they are handed on.
+// A missing packet is waited for until the packet that has been held the longest is latency old,
+// and at most size packets are held while waiting. Whichever limit is hit first, the missing
+// packet is given up on and the held ones go out.
+// There is no timer, the buffer only moves when packets arrive, so if the camera stops sending
+// the last few held packets wait for the next one. It is not safe for concurrent use.
+type jitterBuffer struct {
+	latency time.Duration
+	slots   []jitterSlot // Indexed by sequence number modulo size
+	held    int
+	started bool
+	next    uint16 // The sequence number to hand on next
+}
+
+type jitterSlot struct {
+	pkt     *rtp.Packet
+	arrived time.Time
+}
+
+// newJitterBuffer creates a buffer holding up to size packets, rounded up to a power of two so
+// sequence numbers still map to distinct slots when they wrap around
+func newJitterBuffer(size int, latency time.Duration) *jitterBuffer {
+	slots := 1
+	for slots < size && slots < 1<<15 {
+		slots *= 2
+	}
+	return &jitterBuffer{
+		latency: latency,
+		slots:   make([]jitterSlot, slots),
+	}
+}
+
+// push adds a packet and calls output for every packet that is now ready, in sequence order
+func (b *jitterBuffer) push(pkt *rtp.Packet, now time.Time, output func(*rtp.Packet)) {
+	if !b.started {
+		b.started = true
+		b.next = pkt.SequenceNumber
+	}
+
+	// Most of the time the packet is the one we were waiting for and nothing is held
+	if b.held == 0 && pkt.SequenceNumber == b.next {
+		b.next++
+		output(pkt)
+		return
+	}
+
+	ahead := int16(pkt.SequenceNumber - b.next)
+	switch {
+	case ahead < 0:
+		// A duplicate, or it arrived after we gave up waiting for it. Sending it now would be worse than dropping it.
+		return
+	case int(ahead) >= len(b.slots):
+		// Too far ahead to hold on to: give up on everything missing before it
+		b.release(now, true, output)
+		b.next = pkt.SequenceNumber
+	}
+
+	slot := &b.slots[int(pkt.SequenceNumber)%len(b.slots)]
+	if slot.pkt != nil {
+		return
+	}
+	// The packet's memory may be reused by the RTSP client once the callback returns, so held packets are copied
+	*slot = jitterSlot{pkt: pkt.Clone(), arrived: now}
+	b.held++
+	b.release(now, false, output)
+}
+
+// release hands on held packets in order. A missing packet is skipped once the oldest held packet
+// has waited latency, or straight away with force.
+func (b *jitterBuffer) release(now time.Time, force bool, output func(*rtp.Packet)) {
+	for b.held > 0 {
+		slot := &b.slots[int(b.next)%len(b.slots)]
+		if slot.pkt == nil {
+			if !force && now.Sub(b.oldest()) < b.latency {
+				return
+			}
+			b.next++
+			continue
+		}
+
+		pkt := slot.pkt
+		*slot = jitterSlot{}
+		b.held--
+		b.next++
+		output(pkt)
+	}
+}
+
+// oldest returns when the packet that has been held the longest arrived
+func (b *jitterBuffer) oldest() time.Time {
+	var oldest time.Time
+	for _, slot := range b.slots {
+		if slot.pkt != nil && (oldest.IsZero() || slot.arrived.Before(oldest)) {
+			oldest = slot.arrived
+		}
+	}
+	return oldest
+}
@@ -0,0 +1,171 @@
+package stream
+
+// IsKeyframe reports whether an RTP payload carries the start of a keyframe (an IDR picture for H.264,
+// an IRAP picture for H.265, a new coded video sequence for AV1), or the parameter sets that are sent
+// right before one.
+// Only the NAL unit headers are looked at, so this is cheap enough to run on every packet.
+func IsKeyframe(codec string, payload []byte) bool {
+	switch codec {
+	case "H264":
+		return isH264Keyframe(payload)
+	case "H265":
+		return isH265Keyframe(payload)
+	case "AV1":
+		return isAV1Keyframe(payload)
+	}
+	return false
+}
+
+// IsDisposable reports whether an RTP payload belongs to a picture no other picture is predicted from,
+// so it can be dropped, e.g. for a viewer who can't keep up, without corrupting anything after it.
+// Like IsKeyframe it only looks at NAL unit headers.
+func IsDisposable(codec string, payload []byte) bool {
+	switch codec {
+	case "H264":
+		return isH264Disposable(payload)
+	case "H265":
+		return isH265Disposable(payload)
+	}
+	return false
+}
+
+// H.264 NAL unit types, RFC 6184
+const (
+	h264NALIDR    = 5
+	h264NALSPS    = 7
+	h264NALSTAPA  = 24 // STAP-A, several NAL units in one packet
+	h264NALSTAPB  = 25 // STAP-B, the same with a decoding order number first
+	h264NALMTAP16 = 26 // MTAP16 and MTAP24, several NAL units with their own timestamps
+	h264NALMTAP24 = 27
+	h264NALFUA    = 28 // FU-A, one NAL unit split over several packets
+	h264NALFUB    = 29 // FU-B, the first fragment of an FU-A with a decoding order number
+)
+
+func isH264Keyframe(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+
+	switch nalType := payload[0] & 0x1f; nalType {
+	case h264NALIDR, h264NALSPS:
+		return true
+	case h264NALSTAPA:
+		return h264AggregateHasKeyframe(payload[1:], 0)
+	case h264NALSTAPB:
+		// The 2 byte decoding order number comes before the units
+		return len(payload) > 3 && h264AggregateHasKeyframe(payload[3:], 0)
+	case h264NALMTAP16:
+		// Each unit also has a 1 byte DON difference and a 2 byte timestamp offset
+		return len(payload) > 3 && h264AggregateHasKeyframe(payload[3:], 3)
+	case h264NALMTAP24:
+		return len(payload) > 3 && h264AggregateHasKeyframe(payload[3:], 4)
+	case h264NALFUA, h264NALFUB:
+		// Only the first fragment counts, it has the start bit set in the FU header
+		if len(payload) < 2 {
+			return false
+		}
+		start := payload[1]&0x80 != 0
+		return start && isH264KeyframeType(payload[1]&0x1f)
+	}
+	return false
+}
+
+// h264AggregateHasKeyframe walks the units of an aggregation packet. Each unit is a 2 byte size,
+// extra bytes of per-unit fields, then the NAL unit. The size counts the extra bytes too.
+func h264AggregateHasKeyframe(units []byte, extra int) bool {
+	for i := 0; i+2+extra < len(units); {
+		size := int(units[i])<<8 | int(units[i+1])
+		if isH264KeyframeType(units[i+2+extra] & 0x1f) {
+			return true
+		}
+		i += 2 + size
+	}
+	return false
+}
+
+func isH264KeyframeType(nalType byte) bool {
+	return nalType == h264NALIDR || nalType == h264NALSPS
+}
+
+// isH264Disposable checks nal_ref_idc, which is 0 for pictures nothing refers to.
+// Packetization headers copy it from the NAL units they carry: for aggregation packets it is the
+// highest of them, so one is only disposable when everything in it is.
+func isH264Disposable(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+	nalType := payload[0] & 0x1f
+	// Parameter sets and the like always matter, whatever the camera puts in nal_ref_idc
+	if nalType == 0 || (nalType > 5 && nalType < h264NALSTAPA) {
+		return false
+	}
+	return payload[0]&0x60 == 0
+}
+
+// H.265 NAL unit types, RFC 7798
+const (
+	h265NALIRAPFirst = 16 // BLA, IDR and CRA pictures are 16 to 21
+	h265NALIRAPLast  = 21
+	h265NALVPS       = 32
+	h265NALAP        = 48 // aggregation packet
+	h265NALFU        = 49 // fragmentation unit
+)
+
+func isH265Keyframe(payload []byte) bool {
+	// H.265 NAL unit headers are 2 bytes
+	if len(payload) < 2 {
+		return false
+	}
+
+	switch nalType := (payload[0] >> 1) & 0x3f; nalType {
+	case h265NALAP:
+		for i := 2; i+3 < len(payload); {
+			size := int(payload[i])<<8 | int(payload[i+1])
+			if isH265KeyframeType((payload[i+2] >> 1) & 0x3f) {
+				return true
+			}
+			i += 2 + size
+		}
+		return false
+	case h265NALFU:
+		if len(payload) < 3 {
+			return false
+		}
+		start := payload[2]&0x80 != 0
+		return start && isH265KeyframeType(payload[2]&0x3f)
+	default:
+		return isH265KeyframeType(nalType)
+	}
+}
+
+func isH265KeyframeType(nalType byte) bool {
+	return (nalType >= h265NALIRAPFirst && nalType <= h265NALIRAPLast) || nalType == h265NALVPS
+}
+
+// isH265Disposable checks for sub-layer non-reference pictures: the even VCL NAL unit types below 16,
+// e.g. TRAIL_N. Aggregation packets are never treated as disposable, they are rare and mostly parameter sets.
+func isH265Disposable(payload []byte) bool {
+	if len(payload) < 2 {
+		return false
+	}
+
+	nalType := (payload[0] >> 1) & 0x3f
+	if nalType == h265NALFU {
+		if len(payload) < 3 {
+			return false
+		}
+		nalType = payload[2] & 0x3f
+	}
+	return nalType < h265NALIRAPFirst && nalType%2 == 0
+}
+
+// av1AggregationN is the N bit of the AV1 RTP aggregation header, set on the first packet of a coded
+// video sequence, which starts with a sequence header and a keyframe
+const av1AggregationN = 0x08
+
+// isAV1Keyframe checks the aggregation header every AV1 RTP payload starts with.
+// AV1 pictures are never treated as disposable: that needs the OBUs' headers, and those can be
+// split across packets.
+func isAV1Keyframe(payload []byte) bool {
+	return len(payload) > 0 && payload[0]&av1AggregationN != 0
+}
@@ -0,0 +1,36 @@
+package stream
+
+import "testing"
+
+// BenchmarkIsKeyframe measures keyframe detection, which runs on every packet the camera sends,
+// for the kinds of packet cameras send most
+func BenchmarkIsKeyframe(b *testing.B) {
+	fragment := make([]byte, 1200)
+	payloads := []struct {
+		name    string
+		codec   string
+		payload []byte
+	}{
+		// FU-A fragment of an ordinary picture, most of an H264 stream
+		{"H264/FU-A", "H264", append([]byte{0x7c, 0x81}, fragment...)},
+		// FU-A fragment starting an IDR picture
+		{"H264/FU-A-IDR", "H264", append([]byte{0x7c, 0x85}, fragment...)},
+		// STAP-A with the SPS and PPS, sent right before a keyframe
+		{"H264/STAP-A", "H264", []byte{0x78, 0x00, 0x04, 0x67, 0x42, 0xc0, 0x1f, 0x00, 0x03, 0x68, 0xce, 0x3c}},
+		// FU fragment of an ordinary H265 picture
+		{"H265/FU", "H265", append([]byte{0x62, 0x01, 0x01}, fragment...)},
+		// FU fragment starting an IDR_W_RADL picture
+		{"H265/FU-IDR", "H265", append([]byte{0x62, 0x01, 0x93}, fragment...)},
+		// AV1 packet starting a new coded video sequence
+		{"AV1/new-sequence", "AV1", append([]byte{0x18}, fragment...)},
+	}
+
+	for _, p := range payloads {
+		b.Run(p.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				IsKeyframe(p.codec, p.payload)
+			}
+		})
+	}
+}
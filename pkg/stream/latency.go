@@ -0,0 +1,152 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/recovery"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// latencyChannelLabel is the data channel the browser answers pings on
+const latencyChannelLabel = "latency"
+
+// pingInterval is how often a ping is sent to the browser
+const pingInterval = 2 * time.Second
+
+// latencyMessage is sent both ways on the latency channel.
+// We send {"type":"ping","id":1} and the browser echoes {"type":"pong","id":1,"playout_delay_ms":85}
+// straight away, along with how long it is holding video in its jitter buffer before showing it.
+type latencyMessage struct {
+	Type           string  `json:"type"`
+	ID             uint32  `json:"id"`
+	PlayoutDelayMs float64 `json:"playout_delay_ms,omitempty"`
+}
+
+// LatencyStats is what the pings over the latency data channel measured
+type LatencyStats struct {
+	// Round trip from here to the browser and back, averaged
+	PingRTTMs float64 `json:"ping_rtt_ms"`
+	// How long the browser holds video before showing it, as last reported
+	PlayoutDelayMs float64 `json:"playout_delay_ms"`
+	Samples        int     `json:"samples"`
+}
+
+// latencyProbe keeps track of pings sent on one peer's latency channel
+type latencyProbe struct {
+	mu      sync.Mutex
+	nextID  uint32
+	pending map[uint32]time.Time
+	rtt     time.Duration
+	playout float64
+	samples int
+}
+
+// CreateLatencyChannel adds a data channel that pings the browser to measure latency, see Stats.
+// Like CreateVideoTrack it has to be called before CreateOffer.
+func (p *WebRTCPeer) CreateLatencyChannel() error {
+	// Retransmitting a late ping would only make the measurement wrong
+	ordered := false
+	maxRetransmits := uint16(0)
+	channel, err := p.peerConnection.CreateDataChannel(latencyChannelLabel, &webrtc.DataChannelInit{
+		Ordered:        &ordered,
+		MaxRetransmits: &maxRetransmits,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create latency data channel: %w", err)
+	}
+
+	probe := &latencyProbe{pending: make(map[uint32]time.Time)}
+	p.latency = probe
+	done := make(chan struct{})
+	var closeOnce sync.Once
+
+	channel.OnOpen(func() {
+		go probe.run(channel, done)
+	})
+	channel.OnClose(func() {
+		closeOnce.Do(func() { close(done) })
+	})
+	channel.OnMessage(func(msg webrtc.DataChannelMessage) {
+		var reply latencyMessage
+		if json.Unmarshal(msg.Data, &reply) != nil || reply.Type != "pong" {
+			return
+		}
+		probe.pong(reply, time.Now())
+	})
+	return nil
+}
+
+// run sends a ping every pingInterval until done is closed
+func (l *latencyProbe) run(channel *webrtc.DataChannel, done <-chan struct{}) {
+	defer recovery.Recover("latency_probe", nil)
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			l.mu.Lock()
+			l.nextID++
+			id := l.nextID
+			l.pending[id] = now
+			// Pings that were never answered are forgotten after a few intervals
+			for pendingID, sent := range l.pending {
+				if now.Sub(sent) > 5*pingInterval {
+					delete(l.pending, pendingID)
+				}
+			}
+			l.mu.Unlock()
+
+			data, _ := json.Marshal(latencyMessage{Type: "ping", ID: id})
+			err := channel.Send(data)
+			if err != nil {
+				log.Printf("Failed to send latency ping: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// pong records the browser's reply to a ping
+func (l *latencyProbe) pong(reply latencyMessage, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sent, ok := l.pending[reply.ID]
+	if !ok {
+		return
+	}
+	delete(l.pending, reply.ID)
+
+	rtt := now.Sub(sent)
+	if l.samples == 0 {
+		l.rtt = rtt
+	} else {
+		// Smooth it the same way TCP does so one slow ping doesn't jump the number around
+		l.rtt += (rtt - l.rtt) / 8
+	}
+	l.samples++
+	l.playout = reply.PlayoutDelayMs
+}
+
+func (l *latencyProbe) stats() *LatencyStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.samples == 0 {
+		return nil
+	}
+	return &LatencyStats{
+		PingRTTMs:      float64(l.rtt) / float64(time.Millisecond),
+		PlayoutDelayMs: l.playout,
+		Samples:        l.samples,
+	}
+}
@@ -0,0 +1,106 @@
+package stream
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/rtp"
+)
+
+// packetPool holds the packets handed out by ClonePacket, and sharedPool those from CopyPacket.
+// Every packet from a camera is copied once and its header cloned once per viewer, so reusing them
+// keeps the packet path free of heap allocations once the pools have warmed up
+// (see BenchmarkManagerWritePacket in pkg/viewers).
+var (
+	packetPool = sync.Pool{
+		New: func() any { return &rtp.Packet{} },
+	}
+	sharedPool = sync.Pool{
+		New: func() any { return &SharedPacket{} },
+	}
+)
+
+// SharedPacket is a copy of a packet, payload and all, that several owners hold on to at once,
+// e.g. a camera's GOP cache and the queues of its viewers. Nobody writes to it once it is shared;
+// each owner that needs its own header takes one with ClonePacket.
+// It goes back to the pool when the last owner calls Release.
+type SharedPacket struct {
+	rtp.Packet
+
+	payload []byte // Kept between uses for the payload to be copied into
+	refs    atomic.Int32
+}
+
+// CopyPacket copies pkt into a SharedPacket from the pool, for keeping after the memory pkt is in has
+// been reused. The caller holds the one reference to it.
+func CopyPacket(pkt *rtp.Packet) *SharedPacket {
+	shared := sharedPool.Get().(*SharedPacket)
+	shared.refs.Store(1)
+	shared.payload = append(shared.payload[:0], pkt.Payload...)
+
+	if len(pkt.Extensions) == 0 {
+		csrc := append(shared.CSRC[:0], pkt.CSRC...)
+		shared.Header = pkt.Header
+		shared.CSRC = csrc
+		shared.Extensions = shared.Extensions[:0]
+	} else {
+		// The extensions' payloads are in pkt's memory too. Cameras rarely send any, so this isn't
+		// worth keeping buffers for.
+		shared.Header = pkt.Header.Clone()
+	}
+	shared.Payload = shared.payload
+	shared.PaddingSize = pkt.PaddingSize
+	return shared
+}
+
+// Retain adds a reference for another owner, who must call Release once done with it
+func (p *SharedPacket) Retain() {
+	p.refs.Add(1)
+}
+
+// Release drops a reference. The last one returns the packet to the pool, after which it must not be used.
+func (p *SharedPacket) Release() {
+	refs := p.refs.Add(-1)
+	if refs > 0 {
+		return
+	}
+	if refs < 0 {
+		panic("stream: SharedPacket released more often than retained")
+	}
+	p.Packet = rtp.Packet{
+		Header: rtp.Header{
+			CSRC:       p.CSRC[:0],
+			Extensions: p.Extensions[:0],
+		},
+	}
+	sharedPool.Put(p)
+}
+
+// ClonePacket copies pkt into a packet from the pool, for handing to one viewer.
+// The header, including its CSRC list and extensions, is copied into slices the pooled packet keeps
+// between uses, so setting SSRCs or extensions on the clone can't change pkt or another viewer's clone.
+// The payload is shared with pkt since nothing writes to it.
+// Give it back with ReleasePacket once it has been written.
+func ClonePacket(pkt *rtp.Packet) *rtp.Packet {
+	clone := packetPool.Get().(*rtp.Packet)
+	csrc := append(clone.CSRC[:0], pkt.CSRC...)
+	extensions := append(clone.Extensions[:0], pkt.Extensions...)
+
+	clone.Header = pkt.Header
+	clone.CSRC = csrc
+	clone.Extensions = extensions
+	clone.Payload = pkt.Payload
+	clone.PaddingSize = pkt.PaddingSize
+	return clone
+}
+
+// ReleasePacket returns a packet from ClonePacket to the pool. It must not be used afterwards.
+func ReleasePacket(pkt *rtp.Packet) {
+	*pkt = rtp.Packet{
+		Header: rtp.Header{
+			CSRC:       pkt.CSRC[:0],
+			Extensions: pkt.Extensions[:0],
+		},
+	}
+	packetPool.Put(pkt)
+}
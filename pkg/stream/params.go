@@ -0,0 +1,172 @@
+package stream
+
+import (
+	"bytes"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+)
+
+// More NAL unit types for parameter sets
+const (
+	h264NALPPS = 8
+	h265NALSPS = 33
+	h265NALPPS = 34
+)
+
+// captureParameterSets keeps the format's parameter sets up to date with the ones the camera sends in
+// the stream, which win over the SDP's: some cameras announce none there, or stale ones after their
+// settings change. Only parameter sets in a packet of their own or in an aggregation packet are seen,
+// which is how cameras send them since they are small.
+func captureParameterSets(f format.Format, payload []byte) {
+	switch f := f.(type) {
+	case *format.H264:
+		var found [2][]byte // SPS, PPS
+		forEachNALUnit("H264", payload, func(nalu []byte) {
+			switch nalu[0] & 0x1f {
+			case h264NALSPS:
+				found[0] = nalu
+			case h264NALPPS:
+				found[1] = nalu
+			}
+		})
+		// Most packets are pictures, which don't need the format's lock
+		if found[0] == nil && found[1] == nil {
+			return
+		}
+		sps, pps := f.SafeParams()
+		params := updatedParams([][]byte{sps, pps}, found[:])
+		if params != nil {
+			f.SafeSetParams(params[0], params[1])
+		}
+	case *format.H265:
+		var found [3][]byte // VPS, SPS, PPS
+		forEachNALUnit("H265", payload, func(nalu []byte) {
+			switch (nalu[0] >> 1) & 0x3f {
+			case h265NALVPS:
+				found[0] = nalu
+			case h265NALSPS:
+				found[1] = nalu
+			case h265NALPPS:
+				found[2] = nalu
+			}
+		})
+		if found[0] == nil && found[1] == nil && found[2] == nil {
+			return
+		}
+		vps, sps, pps := f.SafeParams()
+		params := updatedParams([][]byte{vps, sps, pps}, found[:])
+		if params != nil {
+			f.SafeSetParams(params[0], params[1], params[2])
+		}
+	}
+}
+
+// updatedParams replaces the current parameter sets with the ones found in a packet, copied since the
+// packet's memory may be reused. Nil if nothing changed.
+func updatedParams(current, found [][]byte) [][]byte {
+	changed := false
+	for i, p := range found {
+		if p != nil && !bytes.Equal(p, current[i]) {
+			current[i] = bytes.Clone(p)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return current
+}
+
+// forEachNALUnit calls fn with the whole NAL units in a payload: the payload itself, or each unit of
+// a STAP-A or AP aggregation packet. Fragments are skipped.
+func forEachNALUnit(codec string, payload []byte, fn func(nalu []byte)) {
+	var units []byte
+	switch codec {
+	case "H264":
+		if len(payload) < 1 {
+			return
+		}
+		switch payload[0] & 0x1f {
+		case h264NALSTAPA:
+			units = payload[1:]
+		case h264NALSTAPB, h264NALMTAP16, h264NALMTAP24, h264NALFUA, h264NALFUB:
+			return
+		default:
+			fn(payload)
+			return
+		}
+	case "H265":
+		if len(payload) < 2 {
+			return
+		}
+		switch (payload[0] >> 1) & 0x3f {
+		case h265NALAP:
+			units = payload[2:]
+		case h265NALFU:
+			return
+		default:
+			fn(payload)
+			return
+		}
+	default:
+		return
+	}
+
+	for len(units) > 2 {
+		size := int(units[0])<<8 | int(units[1])
+		if size == 0 || 2+size > len(units) {
+			return
+		}
+		fn(units[2 : 2+size])
+		units = units[2+size:]
+	}
+}
+
+// HasParameterSets reports whether an RTP payload starts with a parameter set (an SPS for H.264, a VPS
+// for H.265), as cameras that repeat them send before every keyframe
+func HasParameterSets(codec string, payload []byte) bool {
+	found := false
+	first := true
+	forEachNALUnit(codec, payload, func(nalu []byte) {
+		if first {
+			switch codec {
+			case "H264":
+				found = nalu[0]&0x1f == h264NALSPS
+			case "H265":
+				found = len(nalu) > 1 && (nalu[0]>>1)&0x3f == h265NALVPS
+			}
+		}
+		first = false
+	})
+	return found
+}
+
+// ParameterSetsPayload puts parameter sets (see RTSPStream.VideoParameterSets) in one STAP-A or AP
+// aggregation packet's payload, to send to a viewer ahead of a keyframe. Nil if there are none.
+func ParameterSetsPayload(codec string, params [][]byte) []byte {
+	if len(params) == 0 {
+		return nil
+	}
+
+	var payload []byte
+	switch codec {
+	case "H264":
+		// The aggregation header's nal_ref_idc is the highest of its units'
+		var nri byte
+		for _, p := range params {
+			nri = max(nri, p[0]&0x60)
+		}
+		payload = []byte{nri | h264NALSTAPA}
+	case "H265":
+		// Layer 0, temporal ID 1, like the parameter sets themselves
+		payload = []byte{h265NALAP << 1, 1}
+	default:
+		return nil
+	}
+
+	for _, p := range params {
+		payload = append(payload, byte(len(p)>>8), byte(len(p)))
+		payload = append(payload, p...)
+	}
+	return payload
+}
@@ -0,0 +1,78 @@
+package stream
+
+import (
+	"strings"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// PeerOption changes how NewWebRTCPeer and NewWebRTCPeerWithConfig set up a peer connection,
+// for pion settings that PeerConfig doesn't cover
+type PeerOption func(*peerOptions)
+
+type peerOptions struct {
+	iceServers    []webrtc.ICEServer
+	setICEServers bool
+	settingEngine *webrtc.SettingEngine
+	// Video codecs most preferred first, nil for no preference
+	codecPreferences []string
+	dataChannels     []dataChannel
+}
+
+// dataChannel is a data channel of the caller's own, see WithDataChannel
+type dataChannel struct {
+	label string
+	init  *webrtc.DataChannelInit
+	setup func(*webrtc.DataChannel)
+}
+
+// WithICEServers sets the STUN and TURN servers, instead of PeerConfig.ICEServers or
+// NewWebRTCPeer's public STUN server. With none, only direct connections are tried.
+func WithICEServers(servers ...webrtc.ICEServer) PeerOption {
+	return func(o *peerOptions) {
+		o.iceServers = servers
+		o.setICEServers = true
+	}
+}
+
+// WithSettingEngine starts from engine instead of pion's default settings, e.g. for NAT 1:1 IPs,
+// network types or port ranges. PeerConfig.UDPMux is still set on it when there is one.
+func WithSettingEngine(engine webrtc.SettingEngine) PeerOption {
+	return func(o *peerOptions) {
+		o.settingEngine = &engine
+	}
+}
+
+// WithCodecPreferences orders the video codecs CreateVideoTrack offers, most preferred first, by
+// MIME type like webrtc.MimeTypeH264. The track's codec and fallbacks that aren't listed aren't offered.
+func WithCodecPreferences(mimeTypes ...string) PeerOption {
+	return func(o *peerOptions) {
+		o.codecPreferences = mimeTypes
+	}
+}
+
+// WithDataChannel adds a data channel of the caller's own to the offer. init may be nil for
+// pion's defaults. setup is called with the channel as soon as it is created, to set its handlers.
+func WithDataChannel(label string, init *webrtc.DataChannelInit, setup func(*webrtc.DataChannel)) PeerOption {
+	return func(o *peerOptions) {
+		o.dataChannels = append(o.dataChannels, dataChannel{label: label, init: init, setup: setup})
+	}
+}
+
+// orderCodecs puts codecs in the order of preferences, leaving out any that aren't in it.
+// Without preferences codecs stay as they are.
+func orderCodecs(codecs, preferences []string) []string {
+	if preferences == nil {
+		return codecs
+	}
+	var ordered []string
+	for _, preferred := range preferences {
+		for _, codec := range codecs {
+			if strings.EqualFold(codec, preferred) {
+				ordered = append(ordered, codec)
+				break
+			}
+		}
+	}
+	return ordered
+}
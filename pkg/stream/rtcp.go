@@ -0,0 +1,49 @@
+package stream
+
+import (
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v4"
+)
+
+// readRTCP reads what the browser sends back about the video until the peer is closed. Reading is
+// also what lets pion's interceptors see the browser's reports, so it has to happen even when
+// nothing here is interested in them.
+func (p *WebRTCPeer) readRTCP(sender *webrtc.RTPSender) {
+	for {
+		packets, _, err := sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		for _, packet := range packets {
+			switch packet := packet.(type) {
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				if handler := p.onKeyframeRequest.Load(); handler != nil {
+					(*handler)()
+				}
+			case *rtcp.TransportLayerNack:
+				if handler := p.onNACK.Load(); handler != nil {
+					lost := 0
+					for _, pair := range packet.Nacks {
+						lost += len(pair.PacketList())
+					}
+					(*handler)(lost)
+				}
+			}
+		}
+	}
+}
+
+// OnKeyframeRequest sets a function that is called when the browser asks for a keyframe with a PLI
+// or FIR, because its decoder lost the picture, e.g. after packet loss. Browsers repeat the request
+// every few hundred milliseconds until a keyframe arrives.
+// It is called from the peer's RTCP goroutine, so it must not block.
+func (p *WebRTCPeer) OnKeyframeRequest(handler func()) {
+	p.onKeyframeRequest.Store(&handler)
+}
+
+// OnNACK sets a function that is called with how many packets the browser reported lost in a NACK.
+// pion sends them again by itself, from its last 1024 packets, see CreateVideoTrack; this is only
+// for counting. It is called from the peer's RTCP goroutine, so it must not block.
+func (p *WebRTCPeer) OnNACK(handler func(lost int)) {
+	p.onNACK.Store(&handler)
+}
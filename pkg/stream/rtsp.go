@@ -0,0 +1,668 @@
+package stream
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/tracing"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/gortsplib/v4/pkg/headers"
+	"github.com/bluenviron/gortsplib/v4/pkg/liberrors"
+	"github.com/pion/rtp"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// RTSPStream is one camera's RTSP connection.
+// Its methods are safe to call from any goroutine and in any order: the Set methods can be called
+// while connected (settings used while connecting take effect on the next Connect), and Close
+// can be called while Connect is still running.
+type RTSPStream struct {
+	// The stream's address. Connect reads it, so only change it while no Connect is running;
+	// the supervisor does so under the same lock it connects with.
+	URL string
+	client atomic.Pointer[gortsplib.Client] // The RTSP client that packets are delivered for, nil once closed. Atomic since packet callbacks read it.
+	connectMu sync.Mutex // Held for the whole of Connect, so two connects can't set up clients over each other
+	closes atomic.Uint64 // Counts calls to Close, so a connect that was starting at the time can tell
+
+	// packetsMu is held for reading while a packet callback runs, so Close can wait for the ones in flight.
+	// It also guards the handlers the callbacks call.
+	packetsMu sync.RWMutex
+	onPacketHandler func(*rtp.Packet) // Callback function to handle incoming RTP packets
+	onAudioHandler AudioHandler // Optional callback for decoded audio, see SetAudioHandler
+
+	// mu guards everything else, which Connect, the client's goroutines and the Set and Get methods share
+	mu sync.Mutex
+	detectedCodec string // The codec type detected from the stream (H264 or H265)
+	onDisconnectHandler func(error) // Called when the connection drops without Close() being called
+	tlsConfig *tls.Config // Used for rtsps:// URLs, see SetTLSConfig
+	videoMedia *description.Media // The video track that was set up, needed to look up packet times
+	videoFormat format.Format // Its format, which holds the parameter sets from the SDP
+	timeouts Timeouts // See SetTimeouts
+	jitterSize int // Most video packets held back for reordering, 0 without a jitter buffer. See SetJitterBuffer
+	jitterLatency time.Duration // Longest a missing video packet is waited for
+}
+
+// Timeouts are the RTSP connection's timeouts. Zero values keep gortsplib's defaults.
+type Timeouts struct {
+	Read time.Duration // How long to wait for the camera, 10s by default
+	Write time.Duration // How long a request can take to send, 10s by default
+	// Send a keepalive this often while playing, instead of at 80% of the session timeout the camera asks for.
+	// Some consumer cameras drop the session unless keepalives come at specific intervals.
+	Keepalive time.Duration
+}
+
+// ErrUnsupportedCodec is returned by Connect when the camera has no H264, H265, AV1 or MPEG-4 video
+var ErrUnsupportedCodec = errors.New("unsupported codec")
+
+// ErrCameraUnreachable is returned by Connect and Describe when the camera can't be reached
+// or doesn't answer in time
+var ErrCameraUnreachable = errors.New("camera unreachable")
+
+// ErrAuthFailed is returned by Connect and Describe when the camera answers 401 Unauthorized,
+// i.e. it turned the username and password down or needs some and got none
+var ErrAuthFailed = errors.New("camera authentication failed")
+
+// classifyError marks err with whichever of the errors above says what went wrong, if any does,
+// so callers can use errors.Is instead of reading the message
+func classifyError(err error) error {
+	var status liberrors.ErrClientBadStatusCode
+	var netErr net.Error
+	switch {
+	case err == nil, errors.Is(err, ErrUnsupportedCodec), errors.Is(err, ErrCameraUnreachable), errors.Is(err, ErrAuthFailed):
+		return err
+	case errors.As(err, &status) && status.Code == base.StatusUnauthorized:
+		return fmt.Errorf("%w: %w", ErrAuthFailed, err)
+	// Refused, no route, a DNS failure or a read timeout, or ctx's deadline passing while it was waiting
+	case errors.As(err, &netErr), errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w: %w", ErrCameraUnreachable, err)
+	}
+	return err
+}
+
+// All these methods need to be exported so they are pascal case and therefore public.
+
+// NewRTSPStream creates a new RTSP stream connection
+// This returns a pointer to the RTSPStream object. I.e., pointer to the same object in memory.
+func NewRTSPStream(rtspURL string) *RTSPStream {
+	// & means "address of" - it's a memory address of the RTSPStream object.
+	return &RTSPStream{
+		URL: rtspURL,
+	}
+}
+
+// Connect establishes connection to the RTSP camera and sets up packet handlers
+// This function is called a receiver function - it's a function that is called when the object is used.
+// You call it like this: stream.Connect(ctx)
+// The s is the receiver of the function. It's a pointer to the RTSPStream type.
+// The error is the return value of the function. It's a error object.
+// It is a pointer to that type so that the original object is modified.
+//
+// ctx bounds the connect, like it does a dial: cancelling it or reaching its deadline while the camera
+// is still answering DESCRIBE, SETUP or PLAY closes the half set up connection and fails the connect.
+// Once the stream is playing ctx no longer matters, and the connection lasts until Close is called.
+// The connect is recorded as a trace span under ctx, and each RTSP step gets its own child span,
+// so a camera that is slow to answer DESCRIBE shows up straight away.
+func (s *RTSPStream) Connect(ctx context.Context) error {
+	// parse the URL
+	parsedURL, err := base.ParseURL(s.URL)
+	if err != nil {
+		return fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	// The host only, the URL can have the camera's password in it
+	ctx, span := tracing.Start(ctx, "rtsp.connect",
+		attribute.String("rtsp.scheme", parsedURL.Scheme),
+		attribute.String("rtsp.host", parsedURL.Host))
+	defer span.End()
+
+	s.connectMu.Lock()
+	defer s.connectMu.Unlock()
+
+	err = s.connect(ctx, parsedURL)
+	if err != nil {
+		return tracing.Fail(span, classifyError(err))
+	}
+	span.SetAttributes(attribute.String("rtsp.codec", s.GetCodec()))
+	return nil
+}
+
+// connect does the work of Connect
+func (s *RTSPStream) connect(ctx context.Context, parsedURL *base.URL) (err error) {
+	if ctx.Err() != nil {
+		return fmt.Errorf("failed to connect: %w", ctx.Err())
+	}
+
+	// Take a copy of the settings so they can't change halfway through
+	s.mu.Lock()
+	tlsConfig, timeouts := s.tlsConfig, s.timeouts
+	jitterSize, jitterLatency := s.jitterSize, s.jitterLatency
+	s.mu.Unlock()
+	s.packetsMu.RLock()
+	wantAudio := s.onAudioHandler != nil
+	s.packetsMu.RUnlock()
+
+	// create a new RTSP client
+	// We use the & to get the address of the RTSPStream object.
+	// Therefore, we are creating a pointer
+	// TLSConfig is only used for rtsps:// URLs
+	client := &gortsplib.Client{
+		TLSConfig: tlsConfig,
+		ReadTimeout: timeouts.Read,
+		WriteTimeout: timeouts.Write,
+	}
+	if timeouts.Keepalive > 0 {
+		client.OnResponse = keepaliveHook(timeouts.Keepalive)
+	}
+	// Connect to the camera using Start(scheme, host) for v4
+	// A client can't be closed while it is starting, so Close only gets to see it once it has started.
+	// closes tells us whether Close was called in the meantime.
+	closes := s.closes.Load()
+	_, span := tracing.Start(ctx, "rtsp.start")
+	err = client.Start(parsedURL.Scheme, parsedURL.Host)
+	span.End()
+	if err != nil {
+		return fmt.Errorf("failed to start client: %w", err)
+	}
+	s.client.Store(client)
+
+	// Cancelling ctx closes the connection while it is being set up, which makes the step in progress fail
+	stopWatching := context.AfterFunc(ctx, func() {
+		s.closeClient(client)
+	})
+	defer func() {
+		// ctx may have been done just before the stream started playing, closing it after all
+		if !stopWatching() && err == nil {
+			err = fmt.Errorf("failed to connect: %w", ctx.Err())
+		}
+		// So callers can tell a timeout from a camera that refused
+		if err != nil && ctx.Err() != nil && !errors.Is(err, ctx.Err()) {
+			err = fmt.Errorf("%w: %w", ctx.Err(), err)
+		}
+		// A half set up connection is closed straight away rather than left for the next Connect to replace
+		if err != nil {
+			s.closeClient(client)
+		}
+	}()
+	if s.closes.Load() != closes {
+		return fmt.Errorf("closed while connecting")
+	}
+
+	// Read the stream description (what formats are available)
+	// session is a pointer but Go automatically dereferences it for us.
+	_, span = tracing.Start(ctx, "rtsp.describe")
+	session, _, err := client.Describe(parsedURL)
+	span.End()
+	if err != nil {
+		return fmt.Errorf("failed to describe stream: %w", err)
+	}
+
+	log.Printf("Connected to camera, found %d tracks", len(session.Medias))
+
+	// Setup packet handlers for each media track
+	// This is the new callback-based approach in gortsplib v4
+	// Iterates through each media track in the session.
+	// _ is a blank identifier. It is used to ignore the index of the loop.
+	var setupCount int
+	var audioSetup bool
+	var codec string
+	var videoMedia *description.Media
+	var videoFormat format.Format
+
+	// Video packets go through the jitter buffer first, if there is one.
+	// It needs no locking since the client calls the video callback from one goroutine.
+	deliverVideo := func(pkt *rtp.Packet) {
+		if s.onPacketHandler != nil {
+			s.onPacketHandler(pkt)
+		}
+	}
+	if jitterSize > 0 {
+		jitter := newJitterBuffer(jitterSize, jitterLatency)
+		output := deliverVideo
+		deliverVideo = func(pkt *rtp.Packet) {
+			jitter.push(pkt, time.Now(), output)
+		}
+	}
+	for _, media := range session.Medias {
+		log.Printf("Processing media track with %d formats", len(media.Formats))
+		
+		// Find video format (H264, H265, AV1 or MPEG-4)
+		for _, forma := range media.Formats {
+			// Debug: log what format type we're checking
+			log.Printf("Checking format type: %T", forma)
+			// Type assertion to check if this is an H264 format
+            // forma is an interface type (could be any format)
+            // (*format.H264) - we're asking "is this specifically an H264 format?
+            // h264Format, ok := - this returns TWO values:
+            // h264Format - the value converted to *format.H264 type (if successful)
+            // ok - a boolean: true if the conversion worked, false if not
+            // ; ok - only enters the if block if ok is true
+			// Try H264 format first
+			if h264Format, ok := forma.(*format.H264); ok {
+				log.Printf("Found H264 video format - setting up...")
+				
+				// Setup this media track (port 0, 0 means auto-select)
+				_, span = tracing.Start(ctx, "rtsp.setup", attribute.String("rtsp.media", "video"))
+				_, err = client.Setup(session.BaseURL, media, 0, 0)
+				span.End()
+				if err != nil {
+					return fmt.Errorf("failed to setup media: %w", err)
+				}
+				
+				log.Printf("Successfully set up H264 media track")
+				codec = "H264"
+				videoMedia = media
+				videoFormat = h264Format
+				setupCount++
+				
+				// Set up the OnPacketRTP handler for this media
+				// This callback is called automatically when packets arrive
+				client.OnPacketRTP(media, h264Format, func(pkt *rtp.Packet) {
+					// Call our custom handler if it's set
+					s.handlePacket(client, func() {
+						captureParameterSets(h264Format, pkt.Payload)
+						deliverVideo(pkt)
+					})
+				})
+				
+				// Break after setting up the first video track
+				break
+			}
+			
+			// Try H265 format if H264 wasn't found
+			if h265Format, ok := forma.(*format.H265); ok {
+				log.Printf("Found H265 video format - setting up...")
+				
+				// Setup this media track (port 0, 0 means auto-select)
+				_, span = tracing.Start(ctx, "rtsp.setup", attribute.String("rtsp.media", "video"))
+				_, err = client.Setup(session.BaseURL, media, 0, 0)
+				span.End()
+				if err != nil {
+					return fmt.Errorf("failed to setup media: %w", err)
+				}
+				
+				log.Printf("Successfully set up H265 media track")
+				codec = "H265"
+				videoMedia = media
+				videoFormat = h265Format
+				setupCount++
+				
+				// Set up the OnPacketRTP handler for this media
+				// This callback is called automatically when packets arrive
+				client.OnPacketRTP(media, h265Format, func(pkt *rtp.Packet) {
+					// Call our custom handler if it's set
+					s.handlePacket(client, func() {
+						captureParameterSets(h265Format, pkt.Payload)
+						deliverVideo(pkt)
+					})
+				})
+				
+				// Break after setting up the first video track
+				break
+			}
+
+			// AV1 from newer cameras, which browsers that support it play as it is
+			if av1Format, ok := forma.(*format.AV1); ok {
+				log.Printf("Found AV1 video format - setting up...")
+
+				_, span = tracing.Start(ctx, "rtsp.setup", attribute.String("rtsp.media", "video"))
+				_, err = client.Setup(session.BaseURL, media, 0, 0)
+				span.End()
+				if err != nil {
+					return fmt.Errorf("failed to setup media: %w", err)
+				}
+
+				log.Printf("Successfully set up AV1 media track")
+				codec = "AV1"
+				videoMedia = media
+				videoFormat = av1Format
+				setupCount++
+
+				client.OnPacketRTP(media, av1Format, func(pkt *rtp.Packet) {
+					s.handlePacket(client, func() {
+						deliverVideo(pkt)
+					})
+				})
+
+				break
+			}
+
+			// MPEG-4 Part 2 from older cameras, which no browser plays, only when there's nothing better.
+			// It can only be watched through the transcoder.
+			if mpeg4Format, ok := forma.(*format.MPEG4Video); ok && !hasPlayableVideo(session.Medias) {
+				log.Printf("Found MPEG-4 video format - setting up...")
+
+				_, span = tracing.Start(ctx, "rtsp.setup", attribute.String("rtsp.media", "video"))
+				_, err = client.Setup(session.BaseURL, media, 0, 0)
+				span.End()
+				if err != nil {
+					return fmt.Errorf("failed to setup media: %w", err)
+				}
+
+				log.Printf("Successfully set up MPEG-4 media track")
+				codec = "MPEG4"
+				videoMedia = media
+				videoFormat = mpeg4Format
+				setupCount++
+
+				client.OnPacketRTP(media, mpeg4Format, func(pkt *rtp.Packet) {
+					s.handlePacket(client, func() {
+						deliverVideo(pkt)
+					})
+				})
+
+				break
+			}
+
+			// Audio is only set up when someone wants it (e.g. loud noise detection),
+			// otherwise we'd be pulling a stream nobody listens to
+			if wantAudio && !audioSetup && media.Type == description.MediaTypeAudio {
+				audioSetup, err = s.setupAudio(client, session.BaseURL, media, forma)
+				if err != nil {
+					return err
+				}
+				if audioSetup {
+					break
+				}
+			}
+		}
+	}
+
+	if wantAudio && !audioSetup {
+		log.Println("No supported audio track found (G711 or 16-bit LPCM) - audio detection disabled")
+	}
+	
+	if setupCount == 0 {
+		return fmt.Errorf("%w: no H264, H265, AV1 or MPEG-4 video format found in stream - check camera codec settings", ErrUnsupportedCodec)
+	}
+	
+	log.Printf("Set up %d media track(s)", setupCount)
+
+	// Packet callbacks look the video track up as soon as packets start arriving after PLAY
+	s.mu.Lock()
+	s.detectedCodec = codec
+	s.videoMedia = videoMedia
+	s.videoFormat = videoFormat
+	s.mu.Unlock()
+
+	// Start playing the stream
+	// After this, packets will start arriving via the OnPacketRTP callbacks
+	_, span = tracing.Start(ctx, "rtsp.play")
+	_, err = client.Play(nil)
+	span.End()
+	if err != nil {
+		return fmt.Errorf("failed to play: %w", err)
+	}
+
+	log.Println("RTSP stream is now playing!")
+
+	// Wait blocks until the client stops, either because we closed it or because the
+	// connection to the camera died. Only the second case is reported to the handler.
+	go func() {
+		err := client.Wait()
+		if s.client.Load() != client {
+			return
+		}
+		log.Printf("RTSP connection lost: %v", err)
+		s.mu.Lock()
+		handler := s.onDisconnectHandler
+		s.mu.Unlock()
+		if handler != nil {
+			handler(err)
+		}
+	}()
+
+	// Go doesn't have exception handling, so we return an error if something goes wrong.
+	return nil
+
+}
+
+// Probe checks that a camera answers DESCRIBE at url without setting up or playing anything.
+// It uses the same TLS settings as the stream, and is used to see whether a failed camera is back.
+func (s *RTSPStream) Probe(ctx context.Context, url string) error {
+	_, err := s.Describe(ctx, url)
+	return err
+}
+
+// Describe asks the camera at url which media it offers, without setting up or playing anything.
+// It uses the same TLS settings as the stream. Cancelling ctx or reaching its deadline stops it waiting for the camera.
+func (s *RTSPStream) Describe(ctx context.Context, url string) (*description.Session, error) {
+	parsedURL, err := base.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	ctx, span := tracing.Start(ctx, "rtsp.probe",
+		attribute.String("rtsp.scheme", parsedURL.Scheme),
+		attribute.String("rtsp.host", parsedURL.Host))
+	defer span.End()
+
+	s.mu.Lock()
+	client := &gortsplib.Client{
+		TLSConfig: s.tlsConfig,
+		ReadTimeout: s.timeouts.Read,
+		WriteTimeout: s.timeouts.Write,
+	}
+	s.mu.Unlock()
+	err = client.Start(parsedURL.Scheme, parsedURL.Host)
+	if err != nil {
+		return nil, tracing.Fail(span, classifyError(fmt.Errorf("failed to start client: %w", err)))
+	}
+	defer client.Close()
+	// Closing the client is the only way to stop a DESCRIBE that is waiting for the camera
+	stopWatching := context.AfterFunc(ctx, client.Close)
+	defer stopWatching()
+
+	session, _, err := client.Describe(parsedURL)
+	if err != nil && ctx.Err() != nil {
+		return nil, tracing.Fail(span, classifyError(fmt.Errorf("failed to describe stream: %w: %w", ctx.Err(), err)))
+	}
+	if err != nil {
+		return nil, tracing.Fail(span, classifyError(fmt.Errorf("failed to describe stream: %w", err)))
+	}
+	return session, nil
+}
+
+// keepaliveHook makes gortsplib send its keepalive every period. gortsplib sends one (OPTIONS, or
+// GET_PARAMETER for servers that advertise it) at 80% of the session timeout the camera gives in its
+// SETUP response, or every 30s without one, and has no setting for it. So this rewrites the timeout
+// in the response before gortsplib reads it.
+func keepaliveHook(period time.Duration) gortsplib.ClientOnResponseFunc {
+	timeout := max(uint(period.Seconds()/0.8), 1)
+
+	return func(res *base.Response) {
+		value, ok := res.Header["Session"]
+		if !ok {
+			return
+		}
+		var session headers.Session
+		if session.Unmarshal(value) != nil {
+			return
+		}
+		session.Timeout = &timeout
+		res.Header["Session"] = session.Marshal()
+	}
+}
+
+// SetTimeouts sets the connection's timeouts and keepalive period. It must be called before Connect.
+func (s *RTSPStream) SetTimeouts(timeouts Timeouts) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timeouts = timeouts
+}
+
+// SetJitterBuffer puts video packets that arrive out of order back in order before they reach the
+// packet handler, holding up to size packets and waiting up to latency for a missing one.
+// It adds up to latency of delay while packets are missing, and none otherwise. It must be called before Connect.
+func (s *RTSPStream) SetJitterBuffer(size int, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jitterSize = size
+	s.jitterLatency = latency
+}
+
+// SetPacketHandler sets the callback function that will be called for each RTP packet
+// This must be called before Connect to receive packets. Setting it while playing is safe too,
+// it waits for the packet being handled (if any) and the next packet goes to the new handler.
+func (s *RTSPStream) SetPacketHandler(handler func(*rtp.Packet)) {
+	s.packetsMu.Lock()
+	defer s.packetsMu.Unlock()
+	s.onPacketHandler = handler
+}
+
+// SetTLSConfig sets how the camera's certificate is checked for rtsps:// URLs, see NewTLSConfig.
+// It must be called before Connect.
+func (s *RTSPStream) SetTLSConfig(config *tls.Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tlsConfig = config
+}
+
+// SetDisconnectHandler sets the callback for when the camera connection drops unexpectedly.
+// It is not called for a deliberate Close().
+func (s *RTSPStream) SetDisconnectHandler(handler func(error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onDisconnectHandler = handler
+}
+
+// hasPlayableVideo reports whether the camera offers H264, H265 or AV1 video, which is always preferred to MPEG-4
+func hasPlayableVideo(medias []*description.Media) bool {
+	for _, media := range medias {
+		for _, forma := range media.Formats {
+			switch forma.(type) {
+			case *format.H264, *format.H265, *format.AV1:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetCodec returns the detected video codec (H264, H265, AV1 or MPEG4)
+// This should be called after Connect to get the actual codec used
+func (s *RTSPStream) GetCodec() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.detectedCodec
+}
+
+// PacketNTP returns the wall clock time the camera says a video packet was captured.
+// The camera's RTCP sender reports map RTP timestamps to wall clock time, so this is only known
+// once the first report has arrived (usually within a few seconds), and ok is false until then.
+func (s *RTSPStream) PacketNTP(pkt *rtp.Packet) (time.Time, bool) {
+	s.mu.Lock()
+	videoMedia := s.videoMedia
+	s.mu.Unlock()
+
+	client := s.client.Load()
+	if client == nil || videoMedia == nil {
+		return time.Time{}, false
+	}
+	return client.PacketNTP(videoMedia, pkt)
+}
+
+// VideoParameterSets returns the camera's latest parameter sets, from its SDP or from the stream if
+// it has sent any since: SPS and PPS for H264, with the VPS first for H265. For MPEG-4 it is the one
+// configuration from the SDP instead. Decoders need them before the first keyframe, and some cameras
+// only send them once. Nil before the first connect or if there are none yet.
+func (s *RTSPStream) VideoParameterSets() [][]byte {
+	s.mu.Lock()
+	videoFormat := s.videoFormat
+	s.mu.Unlock()
+
+	var params [][]byte
+	switch f := videoFormat.(type) {
+	case *format.H264:
+		sps, pps := f.SafeParams()
+		params = [][]byte{sps, pps}
+	case *format.H265:
+		vps, sps, pps := f.SafeParams()
+		params = [][]byte{vps, sps, pps}
+	case *format.MPEG4Video:
+		params = [][]byte{f.SafeParams()}
+	}
+	for _, p := range params {
+		if len(p) == 0 {
+			return nil
+		}
+	}
+	return params
+}
+
+// H264Fmtp returns the fmtp line to offer viewers for the camera's H264, with its real profile and
+// level so browsers set their decoder up for it instead of for pion's generic constrained baseline.
+// The profile-level-id comes from the SPS, falling back to the SDP's. Empty for H265, before the
+// first connect, or when neither says.
+func (s *RTSPStream) H264Fmtp() string {
+	s.mu.Lock()
+	h264Format, ok := s.videoFormat.(*format.H264)
+	s.mu.Unlock()
+	if !ok {
+		return ""
+	}
+
+	var profileLevelID string
+	sps, _ := h264Format.SafeParams()
+	if len(sps) >= 4 {
+		// profile_idc, the constraint flags and level_idc follow the NAL unit header
+		profileLevelID = hex.EncodeToString(sps[1:4])
+	} else {
+		profileLevelID = h264Format.FMTP()["profile-level-id"]
+	}
+	if profileLevelID == "" {
+		return ""
+	}
+
+	// Always packetization mode 1: a receiver for it also takes the single NAL unit packets of mode 0,
+	// and the parameter sets sent ahead of keyframes are aggregated (see viewers.Manager.SetParameterSets).
+	// Browsers don't support the interleaved mode 2 at all.
+	return "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=" + profileLevelID
+}
+
+// Close closes the RTSP client connection.
+// Once it returns no more packets reach the packet or audio handler: callbacks that were already
+// running have finished and later ones are dropped. That also means it must not be called from
+// inside the packet handler, which would wait for itself.
+func (s *RTSPStream) Close() error {
+	s.closes.Add(1)
+	client := s.client.Load()
+	if client != nil {
+		s.closeClient(client)
+	}
+	return nil
+}
+
+// closeClient closes client if it is still the current connection
+func (s *RTSPStream) closeClient(client *gortsplib.Client) {
+	// Clear the field first so the Wait goroutine knows this was deliberate,
+	// and callbacks that haven't started yet drop their packets
+	if !s.client.CompareAndSwap(client, nil) {
+		return
+	}
+	// Taking the write lock waits for callbacks that are already running
+	s.packetsMu.Lock()
+	s.packetsMu.Unlock()
+	client.Close()
+}
+
+// handlePacket runs handle for a packet from client, unless client has been closed in the meantime
+func (s *RTSPStream) handlePacket(client *gortsplib.Client, handle func()) {
+	s.packetsMu.RLock()
+	defer s.packetsMu.RUnlock()
+	if s.client.Load() != client {
+		return
+	}
+	handle()
+}
\ No newline at end of file
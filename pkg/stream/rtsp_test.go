@@ -0,0 +1,230 @@
+package stream
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/pion/rtp"
+)
+
+// testSPS and testPPS are a 1280x720 H264 camera's parameter sets
+var (
+	testSPS = []byte{0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40, 0x50, 0x05, 0xbb, 0x01, 0x10, 0x00, 0x00, 0x03, 0x00, 0x10, 0x00, 0x00, 0x03, 0x03, 0xc0, 0xf1, 0x83, 0x19, 0x60}
+	testPPS = []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+)
+
+// testCamera is an RTSP server on localhost that plays H264 to anyone who connects, like a camera
+type testCamera struct {
+	server *gortsplib.Server
+	stream *gortsplib.ServerStream
+	url    string
+}
+
+func (c *testCamera) OnDescribe(*gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
+	return &base.Response{StatusCode: base.StatusOK}, c.stream, nil
+}
+
+func (c *testCamera) OnSetup(*gortsplib.ServerHandlerOnSetupCtx) (*base.Response, *gortsplib.ServerStream, error) {
+	return &base.Response{StatusCode: base.StatusOK}, c.stream, nil
+}
+
+func (c *testCamera) OnPlay(*gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+	return &base.Response{StatusCode: base.StatusOK}, nil
+}
+
+// startTestCamera starts a testCamera that sends a packet every millisecond until the test ends
+func startTestCamera(t *testing.T) *testCamera {
+	t.Helper()
+
+	// gortsplib doesn't say which port it got, so find a free one first
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	camera := &testCamera{url: "rtsp://" + address + "/stream"}
+	camera.server = &gortsplib.Server{Handler: camera, RTSPAddress: address}
+	err = camera.server.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(camera.server.Close)
+
+	media := &description.Media{
+		Type:    description.MediaTypeVideo,
+		Formats: []format.Format{&format.H264{PayloadTyp: 96, PacketizationMode: 1, SPS: testSPS, PPS: testPPS}},
+	}
+	camera.stream = &gortsplib.ServerStream{Server: camera.server, Desc: &description.Session{Medias: []*description.Media{media}}}
+	err = camera.stream.Initialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(camera.stream.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(time.Millisecond)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			// A keyframe now and then, and otherwise a slice of an ordinary picture
+			payload := []byte{0x41, 0x9a, byte(i)}
+			if i%30 == 0 {
+				payload = []byte{0x65, 0x88, 0x84, byte(i)}
+			}
+			camera.stream.WritePacketRTP(media, &rtp.Packet{
+				Header:  rtp.Header{Version: 2, PayloadType: 96, SequenceNumber: uint16(i), Timestamp: uint32(i * 3000), Marker: true},
+				Payload: payload,
+			})
+		}
+	}()
+	return camera
+}
+
+// TestRTSPStreamConcurrentUse runs the stream's methods at the same time as each other and as the
+// packets arriving, which is how the supervisor, the viewers and the API use them. Run it with -race.
+func TestRTSPStreamConcurrentUse(t *testing.T) {
+	camera := startTestCamera(t)
+	rtspStream := NewRTSPStream(camera.url)
+
+	var packets, connects atomic.Int64
+	handler := func(*rtp.Packet) {
+		packets.Add(1)
+	}
+	rtspStream.SetPacketHandler(handler)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+
+	// Reconnecting, like the supervisor after the camera drops. A Close while it is connecting
+	// makes it fail, which is fine.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for ctx.Err() == nil {
+			if rtspStream.Connect(ctx) == nil {
+				connects.Add(1)
+			}
+			time.Sleep(50 * time.Millisecond)
+			rtspStream.Close()
+		}
+	}()
+
+	// Closing at any time, including while connecting
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for ctx.Err() == nil {
+			time.Sleep(70 * time.Millisecond)
+			rtspStream.Close()
+		}
+	}()
+
+	// Swapping the handler while packets are being handled
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for ctx.Err() == nil {
+			rtspStream.SetPacketHandler(handler)
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	// Reading what was found out about the stream, like viewers joining
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				codec := rtspStream.GetCodec()
+				if codec != "" && codec != "H264" {
+					t.Errorf("codec is %q, want H264", codec)
+					return
+				}
+				params := rtspStream.VideoParameterSets()
+				if params != nil && len(params) != 2 {
+					t.Errorf("got %d parameter sets, want SPS and PPS", len(params))
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+
+	wg.Wait()
+	rtspStream.Close()
+	if connects.Load() == 0 {
+		t.Error("never connected")
+	}
+	if packets.Load() == 0 {
+		t.Error("no packets reached the handler")
+	}
+}
+
+// TestRTSPStreamCloseWaitsForHandler checks that once Close returns, the packet handler isn't running
+// and isn't called again, even though packets keep arriving
+func TestRTSPStreamCloseWaitsForHandler(t *testing.T) {
+	camera := startTestCamera(t)
+	rtspStream := NewRTSPStream(camera.url)
+
+	var closed, calledAfterClose atomic.Bool
+	received := make(chan struct{}, 1)
+	rtspStream.SetPacketHandler(func(*rtp.Packet) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+		// Long enough for Close to be called while a packet is being handled
+		time.Sleep(5 * time.Millisecond)
+		if closed.Load() {
+			calledAfterClose.Store(true)
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := rtspStream.Connect(ctx)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	if codec := rtspStream.GetCodec(); codec != "H264" {
+		t.Errorf("codec is %q, want H264", codec)
+	}
+	if params := rtspStream.VideoParameterSets(); len(params) != 2 || string(params[0]) != string(testSPS) {
+		t.Errorf("parameter sets are %x, want the SDP's SPS and PPS", params)
+	}
+
+	select {
+	case <-received:
+	case <-ctx.Done():
+		t.Fatal("no packets reached the handler")
+	}
+	rtspStream.Close()
+	closed.Store(true)
+
+	time.Sleep(50 * time.Millisecond)
+	if calledAfterClose.Load() {
+		t.Error("the packet handler ran after Close returned")
+	}
+}
@@ -0,0 +1,30 @@
+package stream
+
+import (
+	"context"
+
+	"github.com/pion/rtp"
+)
+
+// VideoSource is where a camera's video comes from, as RTP packets. RTSPStream is the one there is;
+// a file or a test pattern can stand in for it wherever a VideoSource is taken.
+type VideoSource interface {
+	// Connect starts the video. ctx bounds starting it, not how long it lasts.
+	Connect(ctx context.Context) error
+	// Close stops the video. No packets reach the packet handler once it has returned.
+	Close() error
+	// SetPacketHandler sets the function every video packet is given to
+	SetPacketHandler(handler func(*rtp.Packet))
+	// SetDisconnectHandler sets the function that is told when the video stops by itself
+	SetDisconnectHandler(handler func(error))
+	// GetCodec returns H264, H265, AV1 or MPEG4 once connected
+	GetCodec() string
+	// VideoParameterSets returns the latest parameter sets decoders need before the first keyframe
+	VideoParameterSets() [][]byte
+	// H264Fmtp returns the fmtp line browsers need to decode the H264 video, or "" to use the defaults
+	H264Fmtp() string
+	// VideoInfo returns the resolution and frame rate, once they are known
+	VideoInfo() (VideoInfo, bool)
+}
+
+var _ VideoSource = (*RTSPStream)(nil)
@@ -0,0 +1,43 @@
+package stream
+
+import (
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
+)
+
+// VideoInfo is what the camera's SPS says about its video
+type VideoInfo struct {
+	Codec  string `json:"codec"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	// Frames per second, from the SPS's timing information. Zero when the camera leaves it out,
+	// which is allowed and common.
+	FPS float64 `json:"fps,omitempty"`
+}
+
+// VideoInfo returns the resolution and frame rate from the camera's latest SPS, see VideoParameterSets.
+// ok is false before the first connect, or when there is no SPS yet or it can't be parsed.
+func (s *RTSPStream) VideoInfo() (info VideoInfo, ok bool) {
+	s.mu.Lock()
+	videoFormat := s.videoFormat
+	s.mu.Unlock()
+
+	switch f := videoFormat.(type) {
+	case *format.H264:
+		buf, _ := f.SafeParams()
+		var sps h264.SPS
+		if len(buf) == 0 || sps.Unmarshal(buf) != nil {
+			return VideoInfo{}, false
+		}
+		return VideoInfo{Codec: "H264", Width: sps.Width(), Height: sps.Height(), FPS: sps.FPS()}, true
+	case *format.H265:
+		_, buf, _ := f.SafeParams()
+		var sps h265.SPS
+		if len(buf) == 0 || sps.Unmarshal(buf) != nil {
+			return VideoInfo{}, false
+		}
+		return VideoInfo{Codec: "H265", Width: sps.Width(), Height: sps.Height(), FPS: sps.FPS()}, true
+	}
+	return VideoInfo{}, false
+}
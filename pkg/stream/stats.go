@@ -0,0 +1,109 @@
+package stream
+
+import (
+	"github.com/pion/webrtc/v4"
+)
+
+// PeerStats is a summary of pion's WebRTC stats for a viewer's connection.
+// The Remote* values come from the browser's RTCP receiver reports, so they describe
+// what actually arrived at the viewer.
+type PeerStats struct {
+	BytesSent   uint64 `json:"bytes_sent"`
+	PacketsSent uint32 `json:"packets_sent"`
+	// Requests from the browser for retransmits (NACK) and new keyframes (PLI/FIR)
+	NACKCount uint32 `json:"nack_count"`
+	PLICount  uint32 `json:"pli_count"`
+	FIRCount  uint32 `json:"fir_count"`
+
+	PacketsLost  int32   `json:"packets_lost"`
+	FractionLost float64 `json:"fraction_lost"`
+	JitterSec    float64 `json:"jitter_seconds"`
+	RTTSec       float64 `json:"round_trip_time_seconds"`
+
+	// The network path ICE picked, nil until connected
+	CandidatePair *CandidatePairStats `json:"candidate_pair,omitempty"`
+
+	// Measured over the latency data channel, nil until the browser has answered a ping
+	Latency *LatencyStats `json:"latency,omitempty"`
+}
+
+// CandidatePairStats describes the selected ICE candidate pair
+type CandidatePairStats struct {
+	Local  CandidateStats `json:"local"`
+	Remote CandidateStats `json:"remote"`
+	// ICE keepalive round trip, measured even when no RTCP has arrived yet
+	CurrentRTTSec float64 `json:"current_round_trip_time_seconds"`
+	// Bandwidth estimate for this path, when available
+	AvailableOutgoingBitrate float64 `json:"available_outgoing_bitrate,omitempty"`
+}
+
+// CandidateStats is one end of a candidate pair.
+// Type tells you a lot: "host" is a direct LAN connection, "srflx" goes through NAT, "relay" through TURN.
+type CandidateStats struct {
+	Type     string `json:"type"`
+	Protocol string `json:"protocol"`
+	Address  string `json:"address"`
+	Port     int32  `json:"port"`
+}
+
+// Stats collects the current stats for the peer connection
+func (p *WebRTCPeer) Stats() PeerStats {
+	report := p.peerConnection.GetStats()
+
+	var stats PeerStats
+	candidates := make(map[string]webrtc.ICECandidateStats)
+
+	for _, s := range report {
+		switch s := s.(type) {
+		case webrtc.OutboundRTPStreamStats:
+			if s.Kind != "video" {
+				continue
+			}
+			stats.BytesSent += s.BytesSent
+			stats.PacketsSent += s.PacketsSent
+			stats.NACKCount += s.NACKCount
+			stats.PLICount += s.PLICount
+			stats.FIRCount += s.FIRCount
+		case webrtc.RemoteInboundRTPStreamStats:
+			if s.Kind != "video" {
+				continue
+			}
+			stats.PacketsLost += s.PacketsLost
+			stats.FractionLost = s.FractionLost
+			stats.JitterSec = s.Jitter
+			stats.RTTSec = s.RoundTripTime
+		case webrtc.ICECandidateStats:
+			candidates[s.ID] = s
+		}
+	}
+
+	// Look the pair's candidates up after the loop, since the report is a map in no particular order
+	for _, s := range report {
+		pair, ok := s.(webrtc.ICECandidatePairStats)
+		if !ok || !pair.Nominated || pair.State != webrtc.StatsICECandidatePairStateSucceeded {
+			continue
+		}
+		stats.CandidatePair = &CandidatePairStats{
+			Local:                    candidateStats(candidates[pair.LocalCandidateID]),
+			Remote:                   candidateStats(candidates[pair.RemoteCandidateID]),
+			CurrentRTTSec:            pair.CurrentRoundTripTime,
+			AvailableOutgoingBitrate: pair.AvailableOutgoingBitrate,
+		}
+		break
+	}
+
+	if p.latency != nil {
+		stats.Latency = p.latency.stats()
+	}
+
+	return stats
+}
+
+func candidateStats(c webrtc.ICECandidateStats) CandidateStats {
+	return CandidateStats{
+		Type:     c.CandidateType.String(),
+		Protocol: c.Protocol,
+		Address:  c.IP,
+		Port:     c.Port,
+	}
+}
@@ -0,0 +1,55 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// statusChannelLabel is the data channel the browser is told about the camera on
+const statusChannelLabel = "status"
+
+// CameraStatus is sent to the browser on the status channel when the camera goes offline, stalls or
+// comes back, e.g. {"type":"camera","state":"offline","message":"RTSP connection lost: EOF"},
+// so it can say so instead of showing the last frame frozen
+type CameraStatus struct {
+	// online, offline or stalled
+	State   string `json:"state"`
+	Message string `json:"message,omitempty"`
+}
+
+// CreateStatusChannel adds a data channel for telling the browser about the camera, see SendStatus.
+// Like CreateVideoTrack it has to be called before CreateOffer.
+func (p *WebRTCPeer) CreateStatusChannel() error {
+	channel, err := p.peerConnection.CreateDataChannel(statusChannelLabel, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create status data channel: %w", err)
+	}
+	p.status = channel
+	return nil
+}
+
+// OnStatusChannelOpen sets a function that is called once the browser has opened the status channel,
+// or straight away if it already has. Use it to send the current status.
+func (p *WebRTCPeer) OnStatusChannelOpen(handler func()) {
+	if p.status != nil {
+		p.status.OnOpen(handler)
+	}
+}
+
+// SendStatus tells the browser about the camera. It does nothing if the status channel isn't open yet.
+func (p *WebRTCPeer) SendStatus(status CameraStatus) error {
+	if p.status == nil || p.status.ReadyState() != webrtc.DataChannelStateOpen {
+		return nil
+	}
+
+	data, err := json.Marshal(struct {
+		Type string `json:"type"`
+		CameraStatus
+	}{"camera", status})
+	if err != nil {
+		return err
+	}
+	return p.status.SendText(string(data))
+}
@@ -0,0 +1,63 @@
+package stream
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TLSOptions says how to check a camera's certificate for rtsps:// connections.
+// With neither option set the system CA bundle is used, which self-signed camera certificates won't pass.
+type TLSOptions struct {
+	// PEM file with the CA(s) that signed the camera's certificate
+	CAFile string
+	// SHA-256 fingerprint of the camera's certificate, in hex with or without colons.
+	// When set, only that exact certificate is accepted, whoever signed it.
+	Fingerprint string
+}
+
+// NewTLSConfig builds the TLS settings for connecting to a camera
+func NewTLSConfig(options TLSOptions) (*tls.Config, error) {
+	config := &tls.Config{}
+
+	if options.CAFile != "" {
+		pem, err := os.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", options.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if options.Fingerprint != "" {
+		expected, err := hex.DecodeString(strings.ReplaceAll(options.Fingerprint, ":", ""))
+		if err != nil || len(expected) != sha256.Size {
+			return nil, fmt.Errorf("fingerprint must be a SHA-256 hash in hex")
+		}
+
+		// Pinning replaces the normal chain and hostname checks: cameras usually have self-signed
+		// certificates for names that don't match how we reach them, so those checks would always fail.
+		// Comparing the exact certificate is a stronger check anyway.
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("camera sent no certificate")
+			}
+			actual := sha256.Sum256(rawCerts[0])
+			if subtle.ConstantTimeCompare(actual[:], expected) != 1 {
+				return fmt.Errorf("camera certificate fingerprint %s does not match the pinned fingerprint", hex.EncodeToString(actual[:]))
+			}
+			return nil
+		}
+	}
+
+	return config, nil
+}
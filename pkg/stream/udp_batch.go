@@ -0,0 +1,134 @@
+package stream
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/ice/v4"
+	"golang.org/x/net/ipv4"
+)
+
+// batchBufferSize fits any packet we send. The rare bigger one gets a buffer of its own.
+const batchBufferSize = 1500
+
+// BatchConfig configures NewBatchedUDPMux
+type BatchConfig struct {
+	Port     int           // The UDP port every viewer connects to
+	Size     int           // Most packets sent in one batch
+	Interval time.Duration // Longest a packet waits for the batch to fill up
+}
+
+// NewBatchedUDPMux listens on one UDP port for every viewer's connection and sends their packets in
+// batches: on Linux each batch is a single sendmmsg call instead of one sendto per packet.
+// Pass it to viewers' peers with PeerConfig.UDPMux and close it at shutdown.
+// It is IPv4 only, since the batches are built as IPv4 messages.
+func NewBatchedUDPMux(cfg BatchConfig) (ice.UDPMux, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: cfg.Port})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on UDP port %d: %w", cfg.Port, err)
+	}
+
+	batched := newBatchConn(conn, cfg.Size, cfg.Interval)
+	log.Printf("Sending viewers' video through UDP port %d in batches of up to %d packets", cfg.Port, cfg.Size)
+	return ice.NewUDPMuxDefault(ice.UDPMuxParams{UDPConn: batched}), nil
+}
+
+// batchConn is a UDP socket whose writes are queued and sent in batches.
+// Reads and everything else go straight to the socket.
+type batchConn struct {
+	*net.UDPConn
+	batch *ipv4.PacketConn
+
+	mu      sync.Mutex
+	pending []ipv4.Message // The first count are queued, each with one buffer of batchBufferSize
+	count   int
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newBatchConn(conn *net.UDPConn, size int, interval time.Duration) *batchConn {
+	c := &batchConn{
+		UDPConn: conn,
+		batch:   ipv4.NewPacketConn(conn),
+		pending: make([]ipv4.Message, size),
+		done:    make(chan struct{}),
+	}
+	for i := range c.pending {
+		c.pending[i].Buffers = [][]byte{make([]byte, 0, batchBufferSize)}
+	}
+	go c.flushEvery(interval)
+	return c
+}
+
+// WriteTo queues a packet for the next batch. The caller can reuse b as soon as it returns.
+func (c *batchConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	msg := &c.pending[c.count]
+	buf := msg.Buffers[0][:0]
+	if len(b) > cap(buf) {
+		buf = make([]byte, 0, len(b))
+	}
+	msg.Buffers[0] = append(buf, b...)
+	msg.Addr = addr
+	c.count++
+
+	if c.count == len(c.pending) {
+		c.flushLocked()
+	}
+	return len(b), nil
+}
+
+// flushEvery sends whatever is queued every interval, so a packet never waits longer than that
+func (c *batchConn) flushEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			c.flushLocked()
+			c.mu.Unlock()
+		}
+	}
+}
+
+// flushLocked sends the queued packets. Must be called with mu held.
+// Like any UDP send, packets that fail are dropped and left to the retransmission and loss handling.
+func (c *batchConn) flushLocked() {
+	sent := 0
+	for sent < c.count {
+		n, err := c.batch.WriteBatch(c.pending[sent:c.count], 0)
+		if err != nil {
+			// Skip the packet that failed, e.g. a viewer whose address became unreachable
+			n++
+		}
+		sent += n
+	}
+	c.count = 0
+}
+
+// Close sends what is still queued and closes the socket
+func (c *batchConn) Close() error {
+	c.stopOnce.Do(func() {
+		c.mu.Lock()
+		close(c.done)
+		c.flushLocked()
+		c.mu.Unlock()
+	})
+	return c.UDPConn.Close()
+}
@@ -0,0 +1,42 @@
+package stream
+
+import (
+	"context"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+// Viewer is one viewer's connection, which the camera's packets are sent down. WebRTCPeer is the one
+// there is; an SFU backend, or a fake in a test, can stand in for it wherever a Viewer is taken.
+type Viewer interface {
+	// Setting up, before CreateOffer
+	CreateVideoTrack(trackID string, codecMimeType string, fallbacks ...string) error
+	CreateLatencyChannel() error
+	CreateStatusChannel() error
+
+	// Signaling
+	CreateOffer(ctx context.Context) (string, error)
+	SetAnswer(ctx context.Context, answerSDP string) error
+	AddICECandidate(candidate webrtc.ICECandidateInit) error
+	// VideoCodec is the codec the viewer accepted, known once SetAnswer has returned
+	VideoCodec() string
+
+	// Sending
+	WriteRTPPacket(packet *rtp.Packet) error
+	SendStatus(status CameraStatus) error
+
+	// Watching the connection
+	OnConnectionStateChange(handler func(webrtc.PeerConnectionState))
+	OnICEConnectionStateChange(handler func(webrtc.ICEConnectionState))
+	OnICECandidate(handler func(*webrtc.ICECandidate))
+	OnKeyframeRequest(handler func())
+	OnNACK(handler func(lost int))
+	OnStatusChannelOpen(handler func())
+	ICEConnectionState() webrtc.ICEConnectionState
+	Stats() PeerStats
+
+	Close() error
+}
+
+var _ Viewer = (*WebRTCPeer)(nil)
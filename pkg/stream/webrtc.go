@@ -0,0 +1,493 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/ice/v4"
+	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+)
+
+// WebRTCPeer is one viewer's peer connection.
+// The Create methods set it up and must be called before CreateOffer, before the peer is shared with
+// other goroutines. After that WriteRTPPacket, SendStatus, Stats and Close are safe to call from any
+// goroutine, including at the same time: Close waits for a write in flight and later writes fail.
+type WebRTCPeer struct{
+	peerConnection *webrtc.PeerConnection
+	videoSender *webrtc.RTPSender // Sends videoTrack, its track is replaced if the browser picks a fallback codec
+	videoCodecs []string // Codecs offered for video, most preferred first, see CreateVideoTrack
+	codecPreferences []string // See WithCodecPreferences
+	h264Fmtp string // PeerConfig.H264Fmtp
+	videoTrack *webrtc.TrackLocalStaticRTP // Video channel we will send packets through to the browser. I.e., this is what is used to send the video stream using RTP (Real-time Transport Protocol) packets coming from the camera.
+	latency *latencyProbe // Pings sent over the latency data channel, nil unless CreateLatencyChannel was called
+	status *webrtc.DataChannel // Tells the browser when the camera goes offline, nil unless CreateStatusChannel was called
+	writeMu sync.RWMutex // Held for reading while a packet is written, so Close can wait for writes in flight
+	closed bool // Set by Close under writeMu, after which packets are dropped
+	stopWatching func() bool // Stops watching PeerConfig.Context once the peer is closed
+	onKeyframeRequest atomic.Pointer[func()] // See OnKeyframeRequest
+	onNACK atomic.Pointer[func(int)] // See OnNACK
+}
+
+// ErrPeerClosed is returned when writing a packet to a peer that has been closed
+var ErrPeerClosed = errors.New("peer connection closed")
+
+// ErrNoCommonCodec is returned by SetAnswer when the browser can't decode any of the offered video codecs,
+// e.g. H265 on most browsers
+var ErrNoCommonCodec = errors.New("the browser can't decode any of the offered video codecs")
+
+// ErrInvalidAnswer is returned by SetAnswer when the answer can't be parsed or doesn't fit the offer
+var ErrInvalidAnswer = errors.New("invalid answer")
+
+// PeerConfig configures a viewer's peer connection
+type PeerConfig struct {
+	// STUN and TURN servers. TURN servers relay the video when there is no direct path to the browser.
+	ICEServers []webrtc.ICEServer
+	// Only connect through a TURN relay, for when direct connections get stuck
+	RelayOnly bool
+	// The peer is closed when Context is cancelled, e.g. the server's context at shutdown. Optional.
+	Context context.Context
+	// Share one UDP port with every other viewer, see NewBatchedUDPMux. Optional.
+	UDPMux ice.UDPMux
+	// The camera's H264 fmtp line, see RTSPStream.H264Fmtp. When set it is the only H264 offered,
+	// instead of pion's generic ones. Optional.
+	H264Fmtp string
+}
+
+// h264FmtpPayloadType is the payload type of the camera's own H264 entry, and h264FmtpRTXPayloadType
+// the one its retransmissions are sent with. Neither is used by pion's defaults.
+const (
+	h264FmtpPayloadType = 122
+	h264FmtpRTXPayloadType = 123
+)
+
+// videoRTCPFeedback is what pion's default video codecs ask the browser for
+var videoRTCPFeedback = []webrtc.RTCPFeedback{
+	{Type: "goog-remb"},
+	{Type: "ccm", Parameter: "fir"},
+	{Type: "nack"},
+	{Type: "nack", Parameter: "pli"},
+}
+
+// NewWebRTCPeer creates a peer connection with Google's public STUN server, changed by any options
+func NewWebRTCPeer(options ...PeerOption) (*WebRTCPeer, error) {
+	// Configure the WebRTC peer connection
+	// ICE (Interactive Connectivity Establishment) is the process of establishing a connection between two peers.
+	// We use a STUN server to get the public IP address of the peer.
+	// STUN servers are useful when peer is behind a router with a NAT (Network Address Translation).
+	// We are using Google's free stun server to get the public IP address of the peer.
+	return NewWebRTCPeerWithConfig(PeerConfig{
+		ICEServers: []webrtc.ICEServer{
+			{
+				URLs: []string{"stun:stun.l.google.com:19302"},
+			},
+		},
+	}, options...)
+}
+
+// NewWebRTCPeerWithConfig is NewWebRTCPeer with your own ICE servers and settings, changed by any options
+func NewWebRTCPeerWithConfig(peerConfig PeerConfig, options ...PeerOption) (*WebRTCPeer, error) {
+	var opts peerOptions
+	for _, option := range options {
+		option(&opts)
+	}
+	if opts.setICEServers {
+		peerConfig.ICEServers = opts.iceServers
+	}
+
+	config := webrtc.Configuration{
+		ICEServers: peerConfig.ICEServers,
+	}
+	if peerConfig.RelayOnly {
+		config.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+	}
+
+	// Without a mux every peer connection gets UDP ports of its own
+	settingEngine := webrtc.SettingEngine{}
+	if opts.settingEngine != nil {
+		settingEngine = *opts.settingEngine
+	}
+	if peerConfig.UDPMux != nil {
+		settingEngine.SetICEUDPMux(peerConfig.UDPMux)
+	}
+	apiOptions := []func(*webrtc.API){webrtc.WithSettingEngine(settingEngine)}
+	if peerConfig.H264Fmtp != "" {
+		mediaEngine := &webrtc.MediaEngine{}
+		err := mediaEngine.RegisterDefaultCodecs()
+		if err != nil {
+			return nil, fmt.Errorf("failed to register codecs: %w", err)
+		}
+		err = mediaEngine.RegisterCodec(webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType: webrtc.MimeTypeH264,
+				ClockRate: 90000,
+				SDPFmtpLine: peerConfig.H264Fmtp,
+				RTCPFeedback: videoRTCPFeedback,
+			},
+			PayloadType: h264FmtpPayloadType,
+		}, webrtc.RTPCodecTypeVideo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to register the camera's H264 codec: %w", err)
+		}
+		err = mediaEngine.RegisterCodec(webrtc.RTPCodecParameters{
+			RTPCodecCapability: webrtc.RTPCodecCapability{
+				MimeType: webrtc.MimeTypeRTX,
+				ClockRate: 90000,
+				SDPFmtpLine: fmt.Sprintf("apt=%d", h264FmtpPayloadType),
+			},
+			PayloadType: h264FmtpRTXPayloadType,
+		}, webrtc.RTPCodecTypeVideo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to register the camera's H264 retransmissions: %w", err)
+		}
+		apiOptions = append(apiOptions, webrtc.WithMediaEngine(mediaEngine))
+	}
+	api := webrtc.NewAPI(apiOptions...)
+
+	peerConnection, err := api.NewPeerConnection(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create peer connection: %w", err)
+	}
+
+	peer := &WebRTCPeer{
+		peerConnection: peerConnection,
+		h264Fmtp: peerConfig.H264Fmtp,
+		codecPreferences: opts.codecPreferences,
+	}
+	for _, channel := range opts.dataChannels {
+		dataChannel, err := peerConnection.CreateDataChannel(channel.label, channel.init)
+		if err != nil {
+			peerConnection.Close()
+			return nil, fmt.Errorf("failed to create data channel %s: %w", channel.label, err)
+		}
+		if channel.setup != nil {
+			channel.setup(dataChannel)
+		}
+	}
+	if peerConfig.Context != nil {
+		peer.stopWatching = context.AfterFunc(peerConfig.Context, func() {
+			peer.Close()
+		})
+	}
+	return peer, nil
+}
+
+// CreateVideoTrack creates a video track for sending video to the browser
+// codecMimeType is the camera's codec, e.g. webrtc.MimeTypeH264, webrtc.MimeTypeH265 or webrtc.MimeTypeAV1
+// Only that codec is offered, followed by any fallbacks the caller can also send, in order of preference.
+// WithCodecPreferences reorders them and leaves out the ones it doesn't list.
+// Which one the browser accepted is known after SetAnswer, see VideoCodec.
+func (p *WebRTCPeer) CreateVideoTrack(trackID string, codecMimeType string, fallbacks ...string) error {
+	offered := append([]string{codecMimeType}, fallbacks...)
+	p.videoCodecs = orderCodecs(offered, p.codecPreferences)
+	if len(p.videoCodecs) == 0 {
+		return fmt.Errorf("none of %s is in the codec preferences", strings.Join(offered, ", "))
+	}
+
+	// Create a video track with the most preferred codec
+	// 90000 is the standard clock rate for video
+	// This sends RTP packets over the track to the browser.
+	fmtp := ""
+	if p.videoCodecs[0] == webrtc.MimeTypeH264 {
+		fmtp = p.h264Fmtp
+	}
+	videoTrack, err := newVideoTrack(p.videoCodecs[0], fmtp)
+	if err != nil {
+		return err
+	}
+
+	p.writeMu.Lock()
+	p.videoTrack = videoTrack
+	p.writeMu.Unlock()
+	
+	// Add the video track to the peer connection
+	sender, err := p.peerConnection.AddTrack(videoTrack)
+	if err != nil {
+		return fmt.Errorf("failed to add video track to peer connection: %w", err)
+	}
+	p.videoSender = sender
+	go p.readRTCP(sender)
+
+	// Without this every codec pion knows would be offered, and a browser that can't decode the camera's
+	// codec would pick one we can't send, leaving the viewer with a black picture
+	var preferences []webrtc.RTPCodecParameters
+	for i, mimeType := range p.videoCodecs {
+		for _, codec := range sender.GetParameters().Codecs {
+			if !strings.EqualFold(codec.MimeType, mimeType) {
+				continue
+			}
+			// With the camera's own fmtp line, the generic entries for its codec aren't offered
+			if i == 0 && fmtp != "" && codec.SDPFmtpLine != fmtp {
+				continue
+			}
+			preferences = append(preferences, codec)
+		}
+	}
+	// Each codec's RTX entry goes with it. Browsers that accept it have packets they NACK sent again on
+	// a stream of their own, from pion's history of the last 1024 packets, which keeps a viewer on lossy
+	// Wi-Fi from freezing until the next keyframe. Without RTX pion resends them on the video stream itself.
+	for _, codec := range preferences {
+		for _, rtx := range sender.GetParameters().Codecs {
+			if strings.EqualFold(rtx.MimeType, webrtc.MimeTypeRTX) && rtx.SDPFmtpLine == fmt.Sprintf("apt=%d", codec.PayloadType) {
+				preferences = append(preferences, rtx)
+			}
+		}
+	}
+	for _, transceiver := range p.peerConnection.GetTransceivers() {
+		if transceiver.Sender() != sender {
+			continue
+		}
+		err = transceiver.SetCodecPreferences(preferences)
+		if err != nil {
+			return fmt.Errorf("failed to set video codecs: %w", err)
+		}
+	}
+
+	log.Printf("Video track created with codec %s and added to peer connection", p.videoCodecs[0])
+	return nil
+}
+
+// newVideoTrack creates a track that sends RTP packets of one codec, with an fmtp line if it has one
+func newVideoTrack(codecMimeType string, fmtp string) (*webrtc.TrackLocalStaticRTP, error) {
+	videoTrack, err := webrtc.NewTrackLocalStaticRTP(
+		webrtc.RTPCodecCapability{MimeType: codecMimeType, SDPFmtpLine: fmtp},
+		"video", // The track ID is the name of the track
+		"camera-stream", // The track label is the name of the track
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create video track: %w", err)
+	}
+	return videoTrack, nil
+}
+
+// CreateOffer generates an SDP offer to send to the browser.
+// It waits for ICE gathering to finish so the offer carries the server's candidates, until ctx is done at
+// the latest; then the offer has the candidates gathered so far and the browser finds the rest by itself.
+// A ctx that is already done when it is called makes it fail instead.
+func (p *WebRTCPeer) CreateOffer(ctx context.Context) (string, error){
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("failed to create offer: %w", ctx.Err())
+	}
+
+	// Create an offer
+	offer, err := p.peerConnection.CreateOffer(nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create offer: %w", err)
+	}
+
+	// Set the offer to the peer connection, which starts gathering candidates
+	gathered := webrtc.GatheringCompletePromise(p.peerConnection)
+	err = p.peerConnection.SetLocalDescription(offer)
+	if err != nil {
+		return "", fmt.Errorf("failed to set local description: %w", err)
+	}
+
+	select {
+	case <-gathered:
+	case <-ctx.Done():
+	}
+	// The local description has the candidates gathered by now, the offer itself has none
+	local := p.peerConnection.LocalDescription()
+	if local == nil {
+		return offer.SDP, nil
+	}
+	return local.SDP, nil
+}
+
+// SetAnswer processes the SDP answer from the browser. A ctx that is already done makes it fail
+// without touching the connection.
+func (p *WebRTCPeer) SetAnswer(ctx context.Context, answerSDP string) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("failed to set answer: %w", ctx.Err())
+	}
+
+	// Create an answer object from the SDP string
+	answer := webrtc.SessionDescription{
+		Type: webrtc.SDPTypeAnswer,
+		SDP: answerSDP,
+	}
+
+	// The track has to match the codec the browser picked before the answer is applied,
+	// since that is when the track is bound to the connection
+	err := p.chooseVideoCodec(answerSDP)
+	if err != nil {
+		return err
+	}
+
+	// Set the answer to the peer connection
+	err = p.peerConnection.SetRemoteDescription(answer)
+	if err != nil {
+		return fmt.Errorf("%w: failed to set remote description: %w", ErrInvalidAnswer, err)
+	}
+
+	log.Println("Answer set to peer connection")
+	return nil
+}
+
+// chooseVideoCodec picks the first offered video codec the browser's answer accepts,
+// and switches the track to it if it isn't the one the track was created with
+func (p *WebRTCPeer) chooseVideoCodec(answerSDP string) error {
+	if p.videoSender == nil {
+		return nil
+	}
+
+	var parsed sdp.SessionDescription
+	err := parsed.UnmarshalString(answerSDP)
+	if err != nil {
+		return fmt.Errorf("%w: failed to parse answer: %w", ErrInvalidAnswer, err)
+	}
+	accepted := videoCodecs(&parsed)
+
+	chosen := ""
+	for _, mimeType := range p.videoCodecs {
+		if accepted[strings.ToLower(mimeType)] {
+			chosen = mimeType
+			break
+		}
+	}
+	if chosen == "" {
+		return fmt.Errorf("%w (offered %s)", ErrNoCommonCodec, strings.Join(p.videoCodecs, ", "))
+	}
+
+	p.writeMu.RLock()
+	current := p.videoTrack.Codec().MimeType
+	p.writeMu.RUnlock()
+	if strings.EqualFold(current, chosen) {
+		return nil
+	}
+
+	videoTrack, err := newVideoTrack(chosen, "")
+	if err != nil {
+		return err
+	}
+	err = p.videoSender.ReplaceTrack(videoTrack)
+	if err != nil {
+		return fmt.Errorf("failed to switch video track to %s: %w", chosen, err)
+	}
+	p.writeMu.Lock()
+	p.videoTrack = videoTrack
+	p.writeMu.Unlock()
+
+	log.Printf("Browser can't decode %s, sending %s instead", current, chosen)
+	return nil
+}
+
+// videoCodecs returns the lower case MIME types of the codecs an SDP accepts for video.
+// A rejected video section has port 0 and accepts nothing.
+func videoCodecs(description *sdp.SessionDescription) map[string]bool {
+	accepted := make(map[string]bool)
+	for _, media := range description.MediaDescriptions {
+		if media.MediaName.Media != "video" || media.MediaName.Port.Value == 0 {
+			continue
+		}
+		for _, attribute := range media.Attributes {
+			if attribute.Key != "rtpmap" {
+				continue
+			}
+			// e.g. "102 H264/90000"
+			_, encoding, ok := strings.Cut(attribute.Value, " ")
+			if !ok {
+				continue
+			}
+			name, _, _ := strings.Cut(encoding, "/")
+			accepted[strings.ToLower("video/"+name)] = true
+		}
+	}
+	return accepted
+}
+
+// VideoCodec returns the MIME type of the codec the video track sends, which after SetAnswer is
+// the one the browser accepted
+func (p *WebRTCPeer) VideoCodec() string {
+	p.writeMu.RLock()
+	defer p.writeMu.RUnlock()
+	if p.videoTrack == nil {
+		return ""
+	}
+	return p.videoTrack.Codec().MimeType
+}
+
+// AddICECandidate adds a candidate the browser found after its answer was sent, for browsers that
+// trickle them instead of waiting until they have them all. It must be called after SetAnswer.
+func (p *WebRTCPeer) AddICECandidate(candidate webrtc.ICECandidateInit) error {
+	err := p.peerConnection.AddICECandidate(candidate)
+	if err != nil {
+		return fmt.Errorf("failed to add ICE candidate: %w", err)
+	}
+	return nil
+}
+
+// OnICECandidate sets up a handler for when ICE candidates are found
+// Called when we find a network path (send to browser)
+// Parameter is like a callback function. It is a function that is called when the event happens.
+func (p *WebRTCPeer) OnICECandidate(handler func(*webrtc.ICECandidate)) {
+	p.peerConnection.OnICECandidate(handler)
+}
+
+// OnConnectionStateChange sets up a handler for connection state changes
+func (p *WebRTCPeer) OnConnectionStateChange(handler func(webrtc.PeerConnectionState)) {
+	p.peerConnection.OnConnectionStateChange(handler)
+}
+
+// OnICEConnectionStateChange sets up a handler for ICE connection state changes.
+// ICE connecting is the step before the DTLS handshake, which has to finish before the peer connection is connected.
+func (p *WebRTCPeer) OnICEConnectionStateChange(handler func(webrtc.ICEConnectionState)) {
+	p.peerConnection.OnICEConnectionStateChange(handler)
+}
+
+// ICEConnectionState returns how far ICE has got finding a path to the browser
+func (p *WebRTCPeer) ICEConnectionState() webrtc.ICEConnectionState {
+	return p.peerConnection.ICEConnectionState()
+}
+
+// Close closes the peer connection.
+// It waits for a packet that is being written to finish, and packets written after it get ErrPeerClosed.
+func (p *WebRTCPeer) Close() error {
+	p.writeMu.Lock()
+	p.closed = true
+	p.writeMu.Unlock()
+
+	if p.stopWatching != nil {
+		p.stopWatching()
+	}
+	if p.peerConnection != nil {
+		return p.peerConnection.Close()
+	}
+	return nil
+}
+
+// WriteRTPPacket writes an RTP packet object to the video track
+// This is used when you have an *rtp.Packet from the RTSP stream.
+// Header extensions can be added to the packet on the way out, so with several viewers each should
+// get its own copy, see ClonePacket.
+func (p *WebRTCPeer) WriteRTPPacket(packet *rtp.Packet) error {
+	p.writeMu.RLock()
+	defer p.writeMu.RUnlock()
+	if p.closed {
+		return ErrPeerClosed
+	}
+	if p.videoTrack == nil {
+		return fmt.Errorf("video track not created")
+	}
+
+	// Write the packet object straight to the video track. Marshaling it to bytes first would
+	// allocate a new buffer for every packet and viewer, only for the track to parse it back again.
+	err := p.videoTrack.WriteRTP(packet)
+	if err != nil {
+		return fmt.Errorf("failed to write packet to video track: %w", err)
+	}
+	return nil
+}
+
+// GetVideoTrack returns the video track
+func (p *WebRTCPeer) GetVideoTrack() *webrtc.TrackLocalStaticRTP {
+	p.writeMu.RLock()
+	defer p.writeMu.RUnlock()
+	return p.videoTrack
+}
\ No newline at end of file
@@ -0,0 +1,68 @@
+package viewers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// ErrICETimeout is why a session was ended when ICE never found a working path to the browser, see Manager.ExpectICE
+var ErrICETimeout = errors.New("ICE did not connect in time")
+
+// ConnectFinished records how connecting ended: nil once the peer connection is up, or why it failed.
+// Only the first call counts. See WaitConnect.
+func (s *Session) ConnectFinished(err error) {
+	s.connectMu.Lock()
+	defer s.connectMu.Unlock()
+
+	if s.connectFinished {
+		return
+	}
+	s.connectFinished = true
+	s.connectErr = err
+	close(s.connectDoneChan())
+}
+
+// WaitConnect waits until the peer connection is up, returning nil, or has failed, returning why.
+// It gives up with ctx's error when ctx is done first.
+func (s *Session) WaitConnect(ctx context.Context) error {
+	s.connectMu.Lock()
+	done := s.connectDoneChan()
+	s.connectMu.Unlock()
+
+	select {
+	case <-done:
+		s.connectMu.Lock()
+		defer s.connectMu.Unlock()
+		return s.connectErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// connectDoneChan is closed by ConnectFinished. It is made on first use since sessions are
+// created as plain struct literals. Must be called with connectMu held.
+func (s *Session) connectDoneChan() chan struct{} {
+	if s.connectDone == nil {
+		s.connectDone = make(chan struct{})
+	}
+	return s.connectDone
+}
+
+// ExpectICE ends the session if ICE is still new or checking once timeout has passed. That happens
+// when no candidate pair works, e.g. behind a firewall that blocks UDP, and the browser would otherwise
+// sit there forever. Call it once the answer has been set.
+func (m *Manager) ExpectICE(s *Session, timeout time.Duration) {
+	time.AfterFunc(timeout, func() {
+		state := s.Peer.ICEConnectionState()
+		if state != webrtc.ICEConnectionStateNew && state != webrtc.ICEConnectionStateChecking {
+			return
+		}
+
+		s.Logf("ICE still %s after %s, ending it", state, timeout)
+		s.ConnectFinished(ErrICETimeout)
+		m.Remove(s.ID)
+	})
+}
@@ -0,0 +1,104 @@
+package viewers
+
+import (
+	"sync"
+
+	"github.com/nisarg-dave/camera-viewer/internal/metrics"
+	"github.com/nisarg-dave/camera-viewer/pkg/stream"
+)
+
+// gopCache holds a camera's packets since its last keyframe, so a viewer who joins mid-GOP is sent
+// them straight away instead of waiting up to a whole keyframe interval for the picture to start.
+// It holds at most maxBytes. A GOP that grows past that, e.g. from a high bitrate 4K camera with a
+// long keyframe interval, is thrown away and nothing more is cached until the next keyframe; viewers
+// joining in the meantime wait for that keyframe like they would without a cache.
+type gopCache struct {
+	maxBytes int
+	metrics  *metrics.Camera
+
+	// Added to by the camera's packet goroutine, reset when the camera goes offline
+	mu        sync.Mutex
+	packets   []cachedPacket
+	bytes     int
+	valid     bool   // Starts with a keyframe and is within budget
+	timestamp uint32 // RTP timestamp of the keyframe the GOP started with
+}
+
+// cachedPacket is a packet in the cache, which holds a reference to it until the GOP is thrown away
+type cachedPacket struct {
+	pkt      *stream.SharedPacket
+	size     uint64
+	keyframe bool
+}
+
+func newGOPCache(maxBytes int, cameraMetrics *metrics.Camera) *gopCache {
+	return &gopCache{maxBytes: maxBytes, metrics: cameraMetrics}
+}
+
+// add caches a packet. A keyframe with a new timestamp starts a new GOP; the parameter sets and
+// slices of one keyframe share its timestamp, so they all end up in the same one.
+func (g *gopCache) add(pkt *stream.SharedPacket, size uint64, keyframe bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if keyframe && (!g.valid || pkt.Timestamp != g.timestamp) {
+		g.resetLocked()
+		g.valid = true
+		g.timestamp = pkt.Timestamp
+	}
+	if !g.valid {
+		return
+	}
+
+	if g.bytes+int(size) > g.maxBytes {
+		g.resetLocked()
+		g.metrics.GOPCacheDrops.Inc()
+		return
+	}
+
+	// The packet is Manager.writePacket's own copy, which nothing writes to, so it is kept as it is
+	pkt.Retain()
+	g.packets = append(g.packets, cachedPacket{pkt: pkt, size: size, keyframe: keyframe})
+	g.bytes += int(size)
+	g.metrics.GOPCacheBytes.Set(float64(g.bytes))
+}
+
+// snapshot returns the cached packets, or false if there is no usable GOP.
+// The caller holds a reference to each of them, to hand back with release once it is done.
+func (g *gopCache) snapshot() ([]cachedPacket, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.valid || len(g.packets) == 0 {
+		return nil, false
+	}
+	for _, c := range g.packets {
+		c.pkt.Retain()
+	}
+	// add only ever appends or replaces the slice, so the caller can read this part of it without the lock
+	return g.packets[:len(g.packets):len(g.packets)], true
+}
+
+// release drops the references snapshot handed out
+func release(cached []cachedPacket) {
+	for _, c := range cached {
+		c.pkt.Release()
+	}
+}
+
+// reset throws the cached GOP away, e.g. when the camera goes offline and it is no longer what comes next
+func (g *gopCache) reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.resetLocked()
+}
+
+// resetLocked empties the cache until the next keyframe. Must be called with mu held.
+func (g *gopCache) resetLocked() {
+	release(g.packets)
+	// A new slice rather than truncating, since a snapshot may still be reading the old one
+	g.packets = nil
+	g.bytes = 0
+	g.valid = false
+	g.metrics.GOPCacheBytes.Set(0)
+}
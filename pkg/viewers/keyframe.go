@@ -0,0 +1,82 @@
+package viewers
+
+import (
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/metrics"
+	"github.com/nisarg-dave/camera-viewer/pkg/stream"
+
+	"github.com/pion/rtp"
+)
+
+// keyframeRequestInterval is how often a session's keyframe requests are acted on. Browsers repeat
+// theirs every few hundred milliseconds until a keyframe arrives, and a replay takes a moment to get there.
+const keyframeRequestInterval = time.Second
+
+// RequestKeyframe is called when a session's browser asks for a keyframe because its decoder lost the
+// picture. With the GOP cache on, the session is sent the GOP again from its keyframe at the start of
+// the camera's next picture, so it recovers without waiting for the camera's next keyframe.
+// It reports whether the request was taken, and not dropped as a repeat of a recent one.
+func (m *Manager) RequestKeyframe(s *Session) bool {
+	now := time.Now().UnixNano()
+	last := s.lastKeyframeRequest.Load()
+	if now-last < int64(keyframeRequestInterval) || !s.lastKeyframeRequest.CompareAndSwap(last, now) {
+		return false
+	}
+
+	metrics.ForCamera(s.Camera).KeyframeRequests.Inc()
+	if m.gopBudget > 0 {
+		s.keyframeRequested.Store(true)
+	}
+	return true
+}
+
+// replayGOP queues the cached GOP for a session again, ahead of packet, the camera's latest which is
+// the last one in the cache. It only happens at the start of a picture, so packet's picture isn't
+// split by the replay; it reports false otherwise, to try again with the next packet.
+//
+// The browser has already had these packets, so to be decoded again rather than dropped as duplicates
+// they are renumbered after the last packet the session was sent (see writeTo) and their pictures get
+// timestamps squeezed in between the last picture sent and packet's. The browser decodes them all and
+// carries on from packet's picture with nothing missing.
+func (m *Manager) replayGOP(s *Session, gop *gopCache, packet *rtp.Packet, cameraMetrics *metrics.Camera) bool {
+	cached, ok := gop.snapshot()
+	defer release(cached)
+	if !ok || len(cached) < 2 {
+		// Either nothing to replay, or packet is the keyframe itself
+		return !ok || len(cached) == 1
+	}
+	if !cached[len(cached)-2].pkt.Marker {
+		return false
+	}
+	cached = cached[:len(cached)-1]
+
+	// One timestamp step per replayed picture, all before packet's picture
+	pictures := 1
+	for i := 1; i < len(cached); i++ {
+		if cached[i].pkt.Timestamp != cached[i-1].pkt.Timestamp {
+			pictures++
+		}
+	}
+	last := cached[len(cached)-1].pkt.Timestamp
+	gap := packet.Timestamp - last
+	if gap <= uint32(pictures) {
+		// No room between the pictures, which a sane camera never does
+		return true
+	}
+	step := gap / uint32(pictures+1)
+
+	timestamp := last
+	for i, c := range cached {
+		if i == 0 || c.pkt.Timestamp != cached[i-1].pkt.Timestamp {
+			timestamp += step
+		}
+		pkt := stream.ClonePacket(&c.pkt.Packet)
+		pkt.Timestamp = timestamp
+		c.pkt.Retain()
+		// Nothing in the GOP is worth dropping on its own: the keyframe is what the session is waiting for
+		m.push(s, queuedPacket{pkt: pkt, shared: c.pkt, size: c.size, keyframe: c.keyframe, replay: true}, false, cameraMetrics)
+	}
+	s.Logf("browser asked for a keyframe, replaying %d packets from the GOP cache", len(cached))
+	return true
+}
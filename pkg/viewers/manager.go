@@ -0,0 +1,705 @@
+package viewers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/metrics"
+	"github.com/nisarg-dave/camera-viewer/internal/recovery"
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+	"github.com/nisarg-dave/camera-viewer/pkg/stream"
+
+	"github.com/pion/rtp"
+)
+
+// bitrateWindow is how long the bitrate is averaged over before comparing it to a session's ceiling.
+// Long enough that a single large keyframe doesn't count as going over.
+const bitrateWindow = 10 * time.Second
+
+// Session is one browser watching one camera over its own WebRTC peer connection
+type Session struct {
+	ID        string
+	User      string
+	Camera    string
+	StartedAt time.Time
+	Peer      stream.Viewer
+	// Correlation ID of the offer request that created the session, see Logf
+	RequestID string
+
+	bytesSent atomic.Uint64
+	connected atomic.Bool
+	closed    atomic.Bool
+	// Set while the camera is offline, so nothing is sent after it comes back until a keyframe
+	waitKeyframe atomic.Bool
+
+	// How connecting ended, see ConnectFinished
+	connectMu       sync.Mutex
+	connectDone     chan struct{}
+	connectErr      error
+	connectFinished bool
+
+	// Packets waiting for the session's writer goroutine, see writer
+	queue       chan queuedPacket
+	queuedBytes atomic.Int64
+	done        chan struct{} // Closed when the session is taken out of the manager
+	stopOnce    sync.Once
+
+	// Whether the session has been sent the GOP cache, only touched by the goroutine writing its feed's packets
+	caughtUp bool
+	// Set by UseTranscoded
+	transcoded atomic.Bool
+
+	// Whether the camera's parameter sets went out before the last keyframe, see sendParameterSets.
+	// The session's sequence numbers are its own: seqOffset is how far ahead of the camera's they are,
+	// for the packets that were added or replayed, lastSeq the last one sent and replaying set while a
+	// replayed GOP is going out. Only touched by the session's writer goroutine.
+	paramsSent bool
+	seqOffset  uint16
+	lastSeq    uint16
+	replaying  bool
+
+	// See RequestKeyframe. keyframeRequested is cleared by the goroutine writing the feed's packets once
+	// the GOP is replayed.
+	lastKeyframeRequest atomic.Int64
+	keyframeRequested   atomic.Bool
+
+	// Bitrate measurement, only touched by the session's writer goroutine
+	windowStart time.Time
+	windowBytes uint64
+
+	timeline    timeline
+	sawKeyframe atomic.Bool // saves taking the timeline lock for every packet once started
+
+	// Last bitrate sample, for the stats API
+	sampleMu    sync.Mutex
+	sampleAt    time.Time
+	sampleBytes uint64
+}
+
+// Logf logs a line about the session, prefixed with the correlation ID of the request that created it
+// so a viewer's whole lifecycle can be followed through the logs starting from the access log
+func (s *Session) Logf(format string, args ...any) {
+	log.Printf("[%s] Viewer session %s: %s", s.RequestID, s.ID, fmt.Sprintf(format, args...))
+}
+
+// BytesSent returns how many bytes of video this session has been sent
+func (s *Session) BytesSent() uint64 {
+	return s.bytesSent.Load()
+}
+
+// Bitrate returns the bits per second sent to this session since the last call,
+// or since the session started on the first call
+func (s *Session) Bitrate() float64 {
+	s.sampleMu.Lock()
+	defer s.sampleMu.Unlock()
+
+	now := time.Now()
+	bytes := s.BytesSent()
+	since := s.sampleAt
+	if since.IsZero() {
+		since = s.StartedAt
+	}
+
+	elapsed := now.Sub(since).Seconds()
+	sent := bytes - s.sampleBytes
+	s.sampleAt = now
+	s.sampleBytes = bytes
+
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(sent) * 8 / elapsed
+}
+
+// SetConnected marks whether the browser's peer connection is up.
+// Packets are only sent, and counted, while it is.
+func (s *Session) SetConnected(connected bool) {
+	if connected {
+		s.timeline.mark(&s.timeline.connected)
+	}
+	s.connected.Store(connected)
+}
+
+// Connected reports whether the browser's peer connection is up
+func (s *Session) Connected() bool {
+	return s.connected.Load()
+}
+
+// Manager keeps track of viewer sessions and fans camera packets out to them.
+// It also enforces bandwidth limits, ending sessions that go over them.
+type Manager struct {
+	bus       *events.Bus
+	usage     *Usage
+	bandwidth config.Bandwidth
+
+	mu       sync.RWMutex
+	sessions map[string]*Session
+	// Who is watching each feed (see feedKey), for WritePacket. Add and delete replace the whole map
+	// and the changed feed's slice under mu rather than changing them, so WritePacket can read
+	// them without locking and a viewer joining or leaving never holds up the packet path.
+	watching atomic.Pointer[map[string][]*Session]
+
+	// Last known status of each camera, sent to viewers as they join, see NotifyCameraStatus
+	statusMu sync.Mutex
+	status   map[string]stream.CameraStatus
+
+	// Byte budget of each camera's GOP cache, 0 when there is none. See SetGOPCache.
+	gopBudget int
+	gops      sync.Map // camera ID -> *gopCache
+
+	restampers sync.Map // feed -> *restamper
+
+	// The camera's codec and parameter sets, see SetParameterSets
+	params func(camera string) (codec string, params [][]byte)
+
+	// Sessions' writer goroutines currently running
+	writers atomic.Int64
+
+	// Called with every packet a session is sent, see OnPacketSent
+	sent atomic.Pointer[func(s *Session, pkt *rtp.Packet)]
+}
+
+// cameraStates is what viewers are told for the events about a camera's connection
+var cameraStates = map[events.Type]string{
+	events.TypeCameraConnected: "online",
+	events.TypeStreamResumed:   "online",
+	events.TypeConnectionLost:  "offline",
+	events.TypeCameraDisabled:  "offline",
+	events.TypeStreamStalled:   "stalled",
+}
+
+// NewManager creates a manager that counts usage in usage and enforces the bandwidth limits
+func NewManager(bus *events.Bus, usage *Usage, bandwidth config.Bandwidth) *Manager {
+	return &Manager{
+		bus:       bus,
+		usage:     usage,
+		bandwidth: bandwidth,
+		sessions:  make(map[string]*Session),
+		status:    make(map[string]stream.CameraStatus),
+	}
+}
+
+// SetGOPCache keeps up to maxBytes of each camera's latest GOP for new viewers, see gopCache.
+// Call it before packets start arriving.
+func (m *Manager) SetGOPCache(maxBytes int) {
+	m.gopBudget = maxBytes
+}
+
+// SetParameterSets has the camera's parameter sets sent to each session right before its first
+// keyframe, for cameras that only send them once at the start of the stream. params returns the
+// camera's codec and its parameter sets, see stream.RTSPStream.VideoParameterSets.
+// Call it before any sessions are added.
+func (m *Manager) SetParameterSets(params func(camera string) (codec string, params [][]byte)) {
+	m.params = params
+}
+
+// OnPacketSent calls fn with every packet sent to a session from now on, as it was handed to the
+// session's peer, until it is called again with nil. fn runs on the sessions' writers, so it has to
+// be quick and safe to call from several at once, and must not keep pkt.
+func (m *Manager) OnPacketSent(fn func(s *Session, pkt *rtp.Packet)) {
+	if fn == nil {
+		m.sent.Store(nil)
+		return
+	}
+	m.sent.Store(&fn)
+}
+
+// gopCache returns a feed's GOP cache, or nil when there is none
+func (m *Manager) gopCache(feed, camera string) *gopCache {
+	if m.gopBudget <= 0 {
+		return nil
+	}
+	if g, ok := m.gops.Load(feed); ok {
+		return g.(*gopCache)
+	}
+	g, _ := m.gops.LoadOrStore(feed, newGOPCache(m.gopBudget, metrics.ForCamera(camera)))
+	return g.(*gopCache)
+}
+
+// feedKey names the video a session is sent: the camera's own, or with transcoded set the H264
+// the transcoder makes from it for browsers that can't decode the camera's codec
+func feedKey(camera string, transcoded bool) string {
+	if transcoded {
+		return camera + "/transcoded"
+	}
+	return camera
+}
+
+// feed is the video the session is sent, see feedKey. Must be called with mu held.
+func (s *Session) feed() string {
+	return feedKey(s.Camera, s.transcoded.Load())
+}
+
+// UseTranscoded switches a session to its camera's transcoded video, for a browser that accepted
+// the H264 fallback instead of the camera's codec. Call it before the session connects.
+func (m *Manager) UseTranscoded(s *Session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sessions[s.ID]; !ok || s.transcoded.Swap(true) {
+		return
+	}
+	m.updateWatching(feedKey(s.Camera, false))
+	m.updateWatching(feedKey(s.Camera, true))
+}
+
+// Transcoding reports whether anyone is watching camera's transcoded video, so the transcoder
+// only gets packets, and only runs, while it is needed
+func (m *Manager) Transcoding(camera string) bool {
+	watching := m.watching.Load()
+	return watching != nil && len((*watching)[feedKey(camera, true)]) > 0
+}
+
+// Add starts sending a camera's packets to a session
+func (m *Manager) Add(s *Session) {
+	if s.StartedAt.IsZero() {
+		s.StartedAt = time.Now()
+	}
+
+	m.startWriter(s)
+
+	m.mu.Lock()
+	m.sessions[s.ID] = s
+	m.updateWatching(s.feed())
+	m.mu.Unlock()
+	metrics.ForCamera(s.Camera).ViewerSessions.Inc()
+
+	// Someone joining while the camera is offline is told so straight away
+	s.Peer.OnStatusChannelOpen(func() {
+		m.statusMu.Lock()
+		status, ok := m.status[s.Camera]
+		m.statusMu.Unlock()
+		if ok {
+			m.sendStatus(s, status)
+		}
+	})
+}
+
+// NotifyCameraStatus tells viewers over their status data channel when their camera goes offline,
+// stalls or comes back, so the browser can say so instead of showing a frozen frame.
+// It runs until stop is closed. This blocks, so call it in a goroutine.
+func (m *Manager) NotifyCameraStatus(stop <-chan struct{}) {
+	sub := m.bus.Subscribe(64, func(e events.Event) bool {
+		_, ok := cameraStates[e.Type]
+		return ok
+	})
+	defer sub.Close()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case e := <-sub.C:
+			status := stream.CameraStatus{State: cameraStates[e.Type], Message: e.Message}
+
+			m.statusMu.Lock()
+			m.status[e.Camera] = status
+			m.statusMu.Unlock()
+
+			// Whatever the camera sends after coming back doesn't follow on from the cached GOP
+			if status.State == "offline" {
+				for _, transcoded := range []bool{false, true} {
+					if gop := m.gopCache(feedKey(e.Camera, transcoded), e.Camera); gop != nil {
+						gop.reset()
+					}
+				}
+			}
+
+			for _, s := range m.List() {
+				if s.Camera != e.Camera {
+					continue
+				}
+				if status.State == "offline" {
+					s.waitKeyframe.Store(true)
+				}
+				m.sendStatus(s, status)
+			}
+		}
+	}
+}
+
+// sendStatus sends a camera status to one session
+func (m *Manager) sendStatus(s *Session, status stream.CameraStatus) {
+	err := s.Peer.SendStatus(status)
+	if err != nil {
+		s.Logf("failed to send camera status: %v", err)
+	}
+}
+
+// Get returns a session by ID, or nil
+func (m *Manager) Get(id string) *Session {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.sessions[id]
+}
+
+// List returns every session, oldest first
+func (m *Manager) List() []*Session {
+	m.mu.RLock()
+	list := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		list = append(list, s)
+	}
+	m.mu.RUnlock()
+
+	slices.SortFunc(list, func(a, b *Session) int {
+		return a.StartedAt.Compare(b.StartedAt)
+	})
+	return list
+}
+
+// Remove stops sending packets to a session and closes its peer connection
+func (m *Manager) Remove(id string) {
+	s, ok := m.delete(id)
+	if ok && s.closed.CompareAndSwap(false, true) {
+		s.Peer.Close()
+	}
+}
+
+// CloseAll ends every session, for shutting down
+func (m *Manager) CloseAll() {
+	for _, s := range m.List() {
+		s.Logf("closing for shutdown")
+		m.Remove(s.ID)
+	}
+}
+
+// delete takes a session out of the map, returning it if it was there
+func (m *Manager) delete(id string) (*Session, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[id]
+	if ok {
+		delete(m.sessions, id)
+		s.stop()
+		m.updateWatching(s.feed())
+		metrics.ForCamera(s.Camera).ViewerSessions.Dec()
+	}
+	return s, ok
+}
+
+// updateWatching rebuilds the list of sessions watching a feed for WritePacket. Must be called with mu held.
+// The old map and slices are left alone since WritePacket may still be reading them.
+func (m *Manager) updateWatching(feed string) {
+	var sessions []*Session
+	for _, s := range m.sessions {
+		if s.feed() == feed {
+			sessions = append(sessions, s)
+		}
+	}
+
+	var watching map[string][]*Session
+	if old := m.watching.Load(); old != nil {
+		watching = maps.Clone(*old)
+	} else {
+		watching = make(map[string][]*Session)
+	}
+	if len(sessions) == 0 {
+		delete(watching, feed)
+	} else {
+		watching[feed] = sessions
+	}
+	m.watching.Store(&watching)
+}
+
+// Usage returns the monthly usage counter
+func (m *Manager) Usage() *Usage {
+	return m.usage
+}
+
+// Limit returns the bandwidth limits that apply to user
+func (m *Manager) Limit(user string) config.BandwidthLimit {
+	if limit, ok := m.bandwidth.Users[user]; ok {
+		return limit
+	}
+	return m.bandwidth.Default
+}
+
+// OverMonthlyCap reports whether user has already used up this month's bandwidth,
+// so new sessions can be refused instead of being started and kicked straight away
+func (m *Manager) OverMonthlyCap(user string) bool {
+	limit := m.Limit(user)
+	return limit.MonthlyGB > 0 && float64(m.usage.Get(usageKey(user))) >= limit.MonthlyGB*1e9
+}
+
+// WritePacket queues a packet from camera for every session watching it, see writer.
+// keyframe says whether it starts a keyframe and disposable whether nothing depends on it
+// (see stream.IsKeyframe and stream.IsDisposable), for the GOP cache and for which packets a
+// session that falls behind can lose.
+// It is called for every RTP packet, so it must not block. It takes no locks either, apart from the
+// GOP cache's own which only contends with the camera going offline: a session removed while the
+// packet is being queued may still be in the list it is reading, which is harmless since closed
+// sessions are skipped.
+func (m *Manager) WritePacket(camera string, packet *rtp.Packet, keyframe, disposable bool) {
+	m.writePacket(feedKey(camera, false), camera, packet, keyframe, disposable)
+}
+
+// WriteTranscodedPacket is WritePacket for the H264 the transcoder makes from camera's video,
+// which goes to the sessions switched over with UseTranscoded
+func (m *Manager) WriteTranscodedPacket(camera string, packet *rtp.Packet, keyframe, disposable bool) {
+	m.writePacket(feedKey(camera, true), camera, packet, keyframe, disposable)
+}
+
+// writePacket queues a packet for every session watching feed, which is one of camera's
+func (m *Manager) writePacket(feed, camera string, packet *rtp.Packet, keyframe, disposable bool) {
+	size := uint64(packet.MarshalSize())
+
+	// Everything from here on, the GOP cache included, sees the continuous timestamps
+	timestamp, jump := m.restamper(feed).restamp(packet.Timestamp)
+	if jump != 0 {
+		metrics.ForCamera(camera).TimestampJumps.Inc()
+		log.Printf("Video timestamps of %s jumped by %s, carrying on from the last picture", feed, jump)
+	}
+
+	// The cache is kept up to date even with nobody watching, so the first viewer starts straight away too
+	gop := m.gopCache(feed, camera)
+	var sessions []*Session
+	if watching := m.watching.Load(); watching != nil {
+		sessions = (*watching)[feed]
+	}
+	if gop == nil && len(sessions) == 0 {
+		return
+	}
+
+	// The packet's memory may be reused by the RTSP client once the callback returns, and the GOP cache
+	// and the writers use it after that. This is the one copy made of it, from the pool: the cache and
+	// every session's queue hold a reference to it and every session gets its own header around the
+	// same payload (see enqueue), so nothing writes to it. It goes back to the pool once the last of
+	// them lets go.
+	shared := stream.CopyPacket(packet)
+	defer shared.Release()
+	shared.Timestamp = timestamp
+	if gop != nil {
+		gop.add(shared, size, keyframe)
+	}
+	if len(sessions) == 0 {
+		return
+	}
+
+	cameraMetrics := metrics.ForCamera(camera)
+	for _, s := range sessions {
+		if s.closed.Load() || !s.connected.Load() {
+			continue
+		}
+		if gop != nil && !s.caughtUp {
+			s.caughtUp = true
+			m.catchUp(s, gop, shared, size, keyframe, disposable, cameraMetrics)
+			continue
+		}
+		if gop != nil && s.keyframeRequested.Load() && m.replayGOP(s, gop, &shared.Packet, cameraMetrics) {
+			s.keyframeRequested.Store(false)
+		}
+		m.enqueue(s, shared, size, keyframe, disposable, cameraMetrics)
+	}
+}
+
+// catchUp queues a session's first packets: the cached GOP, which ends with this packet, so its
+// browser has a keyframe to decode from straight away. Without a usable GOP, e.g. after the cache
+// went over its budget, the session waits for the next keyframe instead.
+func (m *Manager) catchUp(s *Session, gop *gopCache, packet *stream.SharedPacket, size uint64, keyframe, disposable bool, cameraMetrics *metrics.Camera) {
+	cached, ok := gop.snapshot()
+	defer release(cached)
+	if !ok {
+		s.waitKeyframe.Store(true)
+		m.enqueue(s, packet, size, keyframe, disposable, cameraMetrics)
+		return
+	}
+
+	for _, c := range cached {
+		// Nothing in the GOP is worth dropping on its own: the keyframe is what the session is waiting for
+		m.enqueue(s, c.pkt, c.size, c.keyframe, false, cameraMetrics)
+	}
+}
+
+// writeTo sends a queued packet to one session, from the session's writer. A panic while doing so,
+// e.g. in the WebRTC library, ends that session only and the other viewers keep watching.
+func (m *Manager) writeTo(s *Session, q queuedPacket, cameraMetrics *metrics.Camera) {
+	defer recovery.Recover("viewer_session", func(any) { m.endAfterPanic(s) })
+
+	if s.closed.Load() {
+		return
+	}
+
+	// After the camera comes back, or the session fell behind, the browser's decoder needs a keyframe
+	// before anything else makes sense. Without waiting for one it would show a smeared picture until
+	// the next keyframe anyway.
+	if s.waitKeyframe.Load() {
+		if !q.keyframe {
+			return
+		}
+		s.waitKeyframe.Store(false)
+		// The camera may have come back with different parameter sets
+		s.paramsSent = false
+	}
+
+	if q.replay {
+		s.replaying = true
+		q.pkt.SequenceNumber = s.lastSeq + 1
+	} else {
+		if s.replaying {
+			// Carry on from the replayed packets
+			s.replaying = false
+			s.seqOffset = s.lastSeq + 1 - q.pkt.SequenceNumber
+		}
+		q.pkt.SequenceNumber += s.seqOffset
+	}
+	if q.keyframe && !s.paramsSent {
+		s.paramsSent = true
+		m.sendParameterSets(s, q.pkt)
+	}
+	s.lastSeq = q.pkt.SequenceNumber
+
+	err := s.Peer.WriteRTPPacket(q.pkt)
+	if errors.Is(err, stream.ErrPeerClosed) {
+		// The session is being torn down and Remove will take it out of the list
+		return
+	}
+	if err != nil {
+		cameraMetrics.WriteErrors.Inc()
+		s.Logf("failed to write packet: %v", err)
+		return
+	}
+	cameraMetrics.PacketsSent.Inc()
+	cameraMetrics.BytesSent.Add(float64(q.size))
+	if sent := m.sent.Load(); sent != nil {
+		(*sent)(s, q.pkt)
+	}
+
+	now := time.Now()
+	if !s.sawKeyframe.Load() && s.timeline.packetSent(q.keyframe, now) {
+		s.sawKeyframe.Store(true)
+		reportStartup(s)
+	}
+
+	s.bytesSent.Add(q.size)
+	total := m.usage.Add(usageKey(s.User), q.size)
+	m.checkLimits(s, total, q.size, now)
+}
+
+// sendParameterSets sends the camera's parameter sets in one packet right before a keyframe, unless
+// the keyframe already starts with them. The packet takes the keyframe's sequence number, so the
+// session's numbers from then on are one further ahead of the camera's.
+func (m *Manager) sendParameterSets(s *Session, keyframe *rtp.Packet) {
+	// The transcoder's H264 repeats its parameter sets before every keyframe
+	if m.params == nil || s.transcoded.Load() {
+		return
+	}
+	codec, params := m.params(s.Camera)
+	if stream.HasParameterSets(codec, keyframe.Payload) {
+		return
+	}
+	payload := stream.ParameterSetsPayload(codec, params)
+	if payload == nil {
+		return
+	}
+
+	pkt := &rtp.Packet{
+		Header: rtp.Header{
+			Version:        keyframe.Version,
+			PayloadType:    keyframe.PayloadType,
+			SequenceNumber: keyframe.SequenceNumber,
+			Timestamp:      keyframe.Timestamp,
+			SSRC:           keyframe.SSRC,
+		},
+		Payload: payload,
+	}
+	err := s.Peer.WriteRTPPacket(pkt)
+	if err != nil {
+		// Writing the keyframe will fail the same way and say so
+		return
+	}
+	if sent := m.sent.Load(); sent != nil {
+		(*sent)(s, pkt)
+	}
+	keyframe.SequenceNumber++
+	s.seqOffset++
+}
+
+// endAfterPanic closes a session whose packet write panicked. Like kick, this runs on the
+// session's own writer, so nobody else waits for it.
+func (m *Manager) endAfterPanic(s *Session) {
+	if !s.closed.CompareAndSwap(false, true) {
+		return
+	}
+	s.Logf("ending after a panic")
+	m.closeSession(s)
+}
+
+// checkLimits ends the session if its user has gone over their monthly cap or its bitrate is over the ceiling
+func (m *Manager) checkLimits(s *Session, monthTotal, size uint64, now time.Time) {
+	limit := m.Limit(s.User)
+
+	if limit.MonthlyGB > 0 && float64(monthTotal) > limit.MonthlyGB*1e9 {
+		m.kick(s, "monthly", fmt.Sprintf("monthly cap of %g GB reached", limit.MonthlyGB), monthTotal)
+		return
+	}
+
+	if limit.MaxKbps <= 0 {
+		return
+	}
+	if s.windowStart.IsZero() {
+		s.windowStart = now
+	}
+	s.windowBytes += size
+
+	elapsed := now.Sub(s.windowStart)
+	if elapsed < bitrateWindow {
+		return
+	}
+	kbps := float64(s.windowBytes) * 8 / elapsed.Seconds() / 1000
+	s.windowStart = now
+	s.windowBytes = 0
+
+	if kbps > float64(limit.MaxKbps) {
+		m.kick(s, "bitrate", fmt.Sprintf("bitrate %.0f kbps over the %d kbps ceiling", kbps, limit.MaxKbps), s.BytesSent())
+	}
+}
+
+// kick ends a session for going over a limit and publishes an event about it.
+// It is called from the session's writer, so closing the peer only holds up this session.
+func (m *Manager) kick(s *Session, limit, reason string, bytes uint64) {
+	// Stop sending to it straight away; only the first kick publishes
+	if !s.closed.CompareAndSwap(false, true) {
+		return
+	}
+
+	s.Logf("ending for %s: %s", s.User, reason)
+	m.bus.Publish(events.Event{
+		Type:    events.TypeBandwidthExceeded,
+		Camera:  s.Camera,
+		Message: fmt.Sprintf("viewer %s disconnected: %s", usageKey(s.User), reason),
+		Data: map[string]any{
+			"session": s.ID,
+			"user":    s.User,
+			"limit":   limit,
+			"bytes":   bytes,
+		},
+	})
+
+	m.closeSession(s)
+}
+
+// closeSession removes a session and closes its peer. Closing a peer in a bad state can panic too,
+// so that is recovered from as well.
+func (m *Manager) closeSession(s *Session) {
+	defer recovery.Recover("viewer_session", nil)
+	m.delete(s.ID)
+	s.Peer.Close()
+}
+
+// usageKey is who a session's bytes are counted against.
+// Share links count as "share:<id>", each one separately, and everyone counts as "anonymous" when logins are turned off.
+func usageKey(user string) string {
+	if user == "" {
+		return "anonymous"
+	}
+	return user
+}
@@ -0,0 +1,74 @@
+package viewers
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+	"github.com/nisarg-dave/camera-viewer/pkg/stream"
+
+	"github.com/pion/rtp"
+)
+
+// benchViewer is a viewer whose peer connection takes packets and does nothing with them, so only
+// the manager's own work is measured. Methods the packet path doesn't use aren't implemented.
+type benchViewer struct {
+	stream.Viewer
+}
+
+func (benchViewer) WriteRTPPacket(*rtp.Packet) error { return nil }
+func (benchViewer) OnStatusChannelOpen(func())       {}
+func (benchViewer) Close() error                     { return nil }
+
+// BenchmarkManagerWritePacket measures fanning one camera's packets out to its viewers, which
+// runs on the camera's goroutine for every packet, with 1, 10 and 100 viewers watching
+func BenchmarkManagerWritePacket(b *testing.B) {
+	for _, viewers := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("viewers=%d", viewers), func(b *testing.B) {
+			usage, err := LoadUsage(filepath.Join(b.TempDir(), "usage.json"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			manager := NewManager(events.NewBus(), usage, config.Bandwidth{})
+			defer manager.CloseAll()
+			sessions := make([]*Session, viewers)
+			for i := range sessions {
+				sessions[i] = &Session{ID: fmt.Sprintf("bench-%d", i), User: "bench", Camera: "bench", Peer: benchViewer{}}
+				manager.Add(sessions[i])
+				sessions[i].SetConnected(true)
+			}
+
+			// A keyframe every 100 packets, the rest FU-A fragments of ordinary pictures
+			packet := &rtp.Packet{
+				Header:  rtp.Header{Version: 2, PayloadType: 96, Timestamp: 90000},
+				Payload: make([]byte, 1200),
+			}
+			packet.Payload[0], packet.Payload[1] = 0x7c, 0x81
+			b.SetBytes(int64(packet.MarshalSize()))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := range b.N {
+				// The writers can't keep up with packets as fast as this, and dropping packets isn't
+				// what is being measured, so they are given time to catch up now and then
+				if i%(sessionQueuePackets/2) == 0 {
+					b.StopTimer()
+					for _, s := range sessions {
+						for len(s.queue) > 0 {
+							runtime.Gosched()
+						}
+					}
+					b.StartTimer()
+				}
+				packet.SequenceNumber = uint16(i)
+				if i%10 == 0 {
+					// The next picture, 25 a second
+					packet.Timestamp += 3600
+				}
+				manager.WritePacket("bench", packet, i%100 == 0, false)
+			}
+		})
+	}
+}
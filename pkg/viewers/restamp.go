@@ -0,0 +1,67 @@
+package viewers
+
+import (
+	"time"
+)
+
+// videoClockRate is the RTP clock of every video codec, 90kHz
+const videoClockRate = 90000
+
+// maxTimestampJump is how far a feed's timestamps may drift from the time between its pictures arriving
+// before they count as having jumped. Well beyond any jitter buffer or burst after a stall, well short
+// of what a browser waits out without freezing.
+const maxTimestampJump = time.Second
+
+// restamper puts a feed's RTP timestamps on one continuous timeline. Some cameras jump theirs forwards
+// or backwards, and a reconnected camera, or a restarted transcoder, starts again from a random one.
+// Browsers take a jump as the video being hours ahead or behind and freeze, so after one the feed
+// carries on from its last picture by as long as actually went by.
+// A camera that stops and comes back with timestamps that moved on with the clock is left alone.
+// Only the goroutine writing the feed's packets touches it.
+type restamper struct {
+	started bool
+	offset  uint32    // Added to the feed's timestamps
+	lastIn  uint32    // The last picture's timestamp as it arrived
+	lastOut uint32    // and as it was sent
+	lastAt  time.Time // When it arrived
+}
+
+// restamp returns the timestamp to send a packet with, and how far in from the last picture had jumped
+// if it had, or 0
+func (r *restamper) restamp(in uint32) (uint32, time.Duration) {
+	if !r.started {
+		r.started = true
+		r.lastIn, r.lastOut, r.lastAt = in, in, time.Now()
+		return in, 0
+	}
+	// The rest of a picture's packets share its timestamp
+	if in == r.lastIn {
+		return r.lastOut, 0
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(r.lastAt)
+	step := time.Duration(int32(in-r.lastIn)) * time.Second / videoClockRate
+	r.lastIn, r.lastAt = in, now
+
+	if drift := step - elapsed; drift > -maxTimestampJump && drift < maxTimestampJump {
+		r.lastOut = in + r.offset
+		return r.lastOut, 0
+	}
+
+	// At least one tick on, so the picture isn't taken as more of the last one
+	ticks := uint32(max(elapsed.Seconds()*videoClockRate, 1))
+	out := r.lastOut + ticks
+	r.offset = out - in
+	r.lastOut = out
+	return out, step
+}
+
+// restamper returns a feed's restamper
+func (m *Manager) restamper(feed string) *restamper {
+	if r, ok := m.restampers.Load(feed); ok {
+		return r.(*restamper)
+	}
+	r, _ := m.restampers.LoadOrStore(feed, &restamper{})
+	return r.(*restamper)
+}
@@ -0,0 +1,108 @@
+package viewers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/metrics"
+)
+
+// Startup breaks down how long a new viewer waited for video, in milliseconds.
+// Phases that haven't happened yet are left out.
+type Startup struct {
+	// Offer sent until the browser's answer arrived
+	SignalingMs float64 `json:"signaling_ms,omitempty"`
+	// Answer until ICE found a working network path
+	ICEMs float64 `json:"ice_ms,omitempty"`
+	// ICE connected until the DTLS handshake finished and the peer connection was up
+	DTLSMs float64 `json:"dtls_ms,omitempty"`
+	// Connected until the first packet was sent
+	FirstPacketMs float64 `json:"first_packet_ms,omitempty"`
+	// First packet until the first keyframe, before which the browser can't show anything
+	KeyframeWaitMs float64 `json:"keyframe_wait_ms,omitempty"`
+	// Offer until the first keyframe
+	TotalMs float64 `json:"total_ms,omitempty"`
+}
+
+// timeline records when each step of a session's startup happened
+type timeline struct {
+	mu            sync.Mutex
+	answered      time.Time
+	iceConnected  time.Time
+	connected     time.Time
+	firstPacket   time.Time
+	firstKeyframe time.Time
+}
+
+// MarkAnswered records that the browser's answer arrived
+func (s *Session) MarkAnswered() {
+	s.timeline.mark(&s.timeline.answered)
+}
+
+// MarkICEConnected records that ICE found a working path to the browser
+func (s *Session) MarkICEConnected() {
+	s.timeline.mark(&s.timeline.iceConnected)
+}
+
+// Startup returns how long each phase of the session's startup took
+func (s *Session) Startup() Startup {
+	t := &s.timeline
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return Startup{
+		SignalingMs:    phase(s.StartedAt, t.answered),
+		ICEMs:          phase(t.answered, t.iceConnected),
+		DTLSMs:         phase(t.iceConnected, t.connected),
+		FirstPacketMs:  phase(t.connected, t.firstPacket),
+		KeyframeWaitMs: phase(t.firstPacket, t.firstKeyframe),
+		TotalMs:        phase(s.StartedAt, t.firstKeyframe),
+	}
+}
+
+// mark sets a step's time the first time it happens
+func (t *timeline) mark(step *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if step.IsZero() {
+		*step = time.Now()
+	}
+}
+
+// packetSent records the first packet and first keyframe sent to the session.
+// It reports whether this packet was the first keyframe.
+func (t *timeline) packetSent(keyframe bool, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.firstPacket.IsZero() {
+		t.firstPacket = now
+	}
+	if keyframe && t.firstKeyframe.IsZero() {
+		t.firstKeyframe = now
+		return true
+	}
+	return false
+}
+
+// phase is the time between two steps in milliseconds, or zero if either hasn't happened
+func phase(from, to time.Time) float64 {
+	if from.IsZero() || to.IsZero() {
+		return 0
+	}
+	return float64(to.Sub(from)) / float64(time.Millisecond)
+}
+
+// reportStartup logs and records the startup phases once the first keyframe has been sent
+func reportStartup(s *Session) {
+	startup := s.Startup()
+	s.Logf("started in %.0fms: signaling %.0fms, ICE %.0fms, DTLS %.0fms, first packet %.0fms, keyframe wait %.0fms",
+		startup.TotalMs, startup.SignalingMs, startup.ICEMs, startup.DTLSMs, startup.FirstPacketMs, startup.KeyframeWaitMs)
+
+	metrics.ViewerStartup("signaling", startup.SignalingMs)
+	metrics.ViewerStartup("ice", startup.ICEMs)
+	metrics.ViewerStartup("dtls", startup.DTLSMs)
+	metrics.ViewerStartup("first_packet", startup.FirstPacketMs)
+	metrics.ViewerStartup("keyframe_wait", startup.KeyframeWaitMs)
+	metrics.ViewerStartup("total", startup.TotalMs)
+}
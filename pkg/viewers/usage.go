@@ -0,0 +1,153 @@
+package viewers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/atomicfile"
+)
+
+// Usage counts the bytes of video sent to each user this calendar month.
+// It is kept in memory and saved to disk every minute, so a crash loses at most a minute of counting.
+type Usage struct {
+	path string
+
+	mu    sync.Mutex
+	month string    // "2006-01"
+	next  time.Time // When the month after it starts
+	bytes map[string]uint64
+	dirty bool
+}
+
+type usageFile struct {
+	Month string            `json:"month"`
+	Bytes map[string]uint64 `json:"bytes"`
+}
+
+// LoadUsage reads the usage file at path. A missing file starts from zero.
+func LoadUsage(path string) (*Usage, error) {
+	usage := &Usage{
+		path:  path,
+		bytes: make(map[string]uint64),
+	}
+	usage.month, usage.next = currentMonth()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return usage, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage file: %w", err)
+	}
+
+	var saved usageFile
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse usage file %s: %w", path, err)
+	}
+
+	// Last month's numbers don't count against this month's cap
+	if saved.Month == usage.month && saved.Bytes != nil {
+		usage.bytes = saved.Bytes
+	}
+	return usage, nil
+}
+
+// Add counts n more bytes for user and returns their total for the month
+func (u *Usage) Add(user string, n uint64) uint64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.rollover()
+	u.bytes[user] += n
+	u.dirty = true
+	return u.bytes[user]
+}
+
+// Get returns the bytes sent to user this month
+func (u *Usage) Get(user string) uint64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.rollover()
+	return u.bytes[user]
+}
+
+// All returns the bytes sent to every user this month, and which month that is
+func (u *Usage) All() (string, map[string]uint64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.rollover()
+	return u.month, maps.Clone(u.bytes)
+}
+
+// rollover starts counting from zero when a new month begins. Must be called with mu held.
+// It runs for every packet sent, so it only compares times until the month is over.
+func (u *Usage) rollover() {
+	if time.Now().Before(u.next) {
+		return
+	}
+	month, next := currentMonth()
+	if month != u.month {
+		u.month = month
+		u.bytes = make(map[string]uint64)
+		u.dirty = true
+	}
+	u.next = next
+}
+
+// Run saves the usage every minute until stop is closed, then saves once more.
+// This blocks, so call it in a goroutine.
+func (u *Usage) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			u.save()
+			return
+		}
+		u.save()
+	}
+}
+
+func (u *Usage) save() {
+	err := u.Save()
+	if err != nil {
+		log.Printf("Failed to save bandwidth usage: %v", err)
+	}
+}
+
+// Save writes the counters to disk if they changed since the last save.
+// Run does this every minute; call it on shutdown so the last minute isn't lost.
+func (u *Usage) Save() error {
+	u.mu.Lock()
+	if !u.dirty {
+		u.mu.Unlock()
+		return nil
+	}
+	data, err := json.MarshalIndent(usageFile{Month: u.month, Bytes: u.bytes}, "", "  ")
+	u.dirty = false
+	u.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	return atomicfile.Write(u.path, data, 0o600)
+}
+
+// currentMonth returns this month as "2006-01" and when the next one starts
+func currentMonth() (string, time.Time) {
+	now := time.Now()
+	year, month, _ := now.Date()
+	return now.Format("2006-01"), time.Date(year, month+1, 1, 0, 0, 0, 0, now.Location())
+}
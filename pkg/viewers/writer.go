@@ -0,0 +1,109 @@
+package viewers
+
+import (
+	"github.com/nisarg-dave/camera-viewer/internal/metrics"
+	"github.com/nisarg-dave/camera-viewer/pkg/stream"
+
+	"github.com/pion/rtp"
+)
+
+// Each session's queue holds at most this many packets and bytes. Enough for a whole GOP from the
+// GOP cache at a few Mbps, and several seconds of a viewer's network stalling, without letting a
+// viewer who has stopped reading hold on to an unbounded amount of memory.
+const (
+	sessionQueuePackets = 4096
+	sessionQueueBytes   = 8 << 20
+)
+
+// queuedPacket is a packet waiting for a session's writer
+type queuedPacket struct {
+	pkt      *rtp.Packet          // The session's own copy of the header from the packet pool
+	shared   *stream.SharedPacket // What pkt's payload is in, one of whose references the queue holds
+	size     uint64
+	keyframe bool
+	replay   bool // Sent before, see Manager.replayGOP
+}
+
+// startWriter gives a session its queue and its writer goroutine, the only goroutine a viewer costs
+// on the packet path. It stops when the session is taken out of the manager.
+func (m *Manager) startWriter(s *Session) {
+	s.queue = make(chan queuedPacket, sessionQueuePackets)
+	s.done = make(chan struct{})
+	m.writers.Add(1)
+	go m.writer(s)
+}
+
+// Writers returns how many sessions have a writer goroutine running, for checking goroutines
+// grow with viewers and nothing else
+func (m *Manager) Writers() int {
+	return int(m.writers.Load())
+}
+
+// writer sends a session's queued packets to its peer until the session ends.
+// A viewer whose network is slow only holds up its own writer, never the camera or other viewers.
+func (m *Manager) writer(s *Session) {
+	defer m.writers.Add(-1)
+	cameraMetrics := metrics.ForCamera(s.Camera)
+
+	for {
+		select {
+		case <-s.done:
+			// Hand back whatever was still queued
+			for {
+				select {
+				case q := <-s.queue:
+					q.release()
+				default:
+					return
+				}
+			}
+		case q := <-s.queue:
+			s.queuedBytes.Add(-int64(q.size))
+			m.writeTo(s, q, cameraMetrics)
+			q.release()
+		}
+	}
+}
+
+// enqueue queues a packet for a session without blocking. A packet that doesn't fit in the queue
+// is dropped. Losing a disposable one (see stream.IsDisposable) only costs that picture; losing
+// any other breaks every picture until the next keyframe, so the session skips ahead to it.
+func (m *Manager) enqueue(s *Session, packet *stream.SharedPacket, size uint64, keyframe, disposable bool, cameraMetrics *metrics.Camera) {
+	// Each viewer gets its own copy of the header from the pool around the shared payload, both handed
+	// back once it is written
+	packet.Retain()
+	m.push(s, queuedPacket{pkt: stream.ClonePacket(&packet.Packet), shared: packet, size: size, keyframe: keyframe}, disposable, cameraMetrics)
+}
+
+// push is enqueue for a packet that is already the session's own copy, holding a reference to its shared packet
+func (m *Manager) push(s *Session, q queuedPacket, disposable bool, cameraMetrics *metrics.Camera) {
+	if s.queuedBytes.Add(int64(q.size)) <= sessionQueueBytes {
+		select {
+		case s.queue <- q:
+			return
+		default:
+		}
+	}
+	q.release()
+	s.queuedBytes.Add(-int64(q.size))
+
+	cameraMetrics.ViewerDrops.Inc()
+	if !disposable && !s.waitKeyframe.Swap(true) {
+		s.Logf("falling behind, skipping to the next keyframe")
+	}
+}
+
+// release hands the packet back once it has been written or dropped
+func (q queuedPacket) release() {
+	stream.ReleasePacket(q.pkt)
+	q.shared.Release()
+}
+
+// stop ends the session's writer. It is safe to call more than once.
+func (s *Session) stop() {
+	s.stopOnce.Do(func() {
+		if s.done != nil {
+			close(s.done)
+		}
+	})
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/logging"
+	"github.com/nisarg-dave/camera-viewer/pkg/stream"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/pion/rtp"
+)
+
+// probeSample is how long probe watches the video for by default. Cameras send a keyframe every
+// one to four seconds, so this sees a few.
+const probeSample = 10 * time.Second
+
+// runProbe asks a camera which media it offers, with DESCRIBE, and prints them with their SDP
+// fmtp lines. Then it plays the video for a while and prints what it actually got: resolution,
+// bitrate, frame rate and how often keyframes came.
+func runProbe(args []string) error {
+	flags := newFlagSet("probe", "<rtsp-url>")
+	timeout := flags.Duration("timeout", connectTimeout, "how long to wait for the camera")
+	sample := flags.Duration("sample", probeSample, "how long to watch the video for, 0 to only list the media")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("probe takes the camera's rtsp:// or rtsps:// URL")
+	}
+
+	rtspStream, url, err := openCamera(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	start := time.Now()
+	session, err := rtspStream.Describe(ctx, url)
+	if err != nil {
+		// The error can quote the URL, password and all
+		return errors.New(logging.Redact(err.Error()))
+	}
+
+	fmt.Printf("%s answered in %s\n", logging.Redact(url), time.Since(start).Round(time.Millisecond))
+	for _, media := range session.Medias {
+		for _, forma := range media.Formats {
+			fmt.Printf("  %-6s %-10s payload type %d, clock rate %d\n", media.Type, forma.Codec(), forma.PayloadType(), forma.ClockRate())
+			fmtp := fmtpLine(forma)
+			if fmtp != "" {
+				fmt.Printf("         a=fmtp:%d %s\n", forma.PayloadType(), fmtp)
+			}
+		}
+	}
+	if *sample <= 0 {
+		return nil
+	}
+
+	var stats probeStats
+	rtspStream.SetPacketHandler(func(pkt *rtp.Packet) {
+		stats.add(rtspStream.GetCodec(), pkt, time.Now())
+	})
+	sampleCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	connectCtx, cancelConnect := context.WithTimeout(sampleCtx, *timeout)
+	defer cancelConnect()
+	err = connectCamera(connectCtx, rtspStream)
+	if err != nil {
+		return err
+	}
+	defer rtspStream.Close()
+
+	codec := rtspStream.GetCodec()
+	fmt.Printf("\nPlaying %s video for %s, Ctrl+C stops early\n", codec, *sample)
+	select {
+	case <-time.After(*sample):
+	case <-sampleCtx.Done():
+	}
+	// No packets reach the handler once Close has returned
+	rtspStream.Close()
+
+	info, ok := rtspStream.VideoInfo()
+	if ok {
+		fmt.Printf("  resolution   %dx%d\n", info.Width, info.Height)
+	}
+	// stream.IsKeyframe doesn't know MPEG-4's keyframes
+	stats.print(codec != "MPEG4")
+	return nil
+}
+
+// fmtpLine returns a format's fmtp parameters as they appear in the SDP, sorted by name
+func fmtpLine(forma format.Format) string {
+	fmtp := forma.FMTP()
+	params := make([]string, 0, len(fmtp))
+	for key, value := range fmtp {
+		params = append(params, key+"="+value)
+	}
+	sort.Strings(params)
+	return strings.Join(params, ";")
+}
+
+// probeStats counts the video packets probe gets
+type probeStats struct {
+	mu      sync.Mutex
+	first   time.Time
+	last    time.Time
+	packets int
+	bytes   int64
+	lost    int
+	lastSeq uint16
+	// Pictures are told apart by their RTP timestamp
+	frames    int
+	lastTS    uint32
+	keyframes []probeKeyframe
+}
+
+// probeKeyframe is when a keyframe arrived, and how many pictures came before it, itself included
+type probeKeyframe struct {
+	at        time.Time
+	frame     int
+	timestamp uint32
+}
+
+// add counts a packet that arrived at now
+func (p *probeStats) add(codec string, pkt *rtp.Packet, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.packets == 0 {
+		p.first = now
+	} else {
+		// Sequence numbers wrap, so the gap is taken modulo 2^16
+		gap := pkt.SequenceNumber - p.lastSeq
+		if gap > 1 && gap < 1<<15 {
+			p.lost += int(gap - 1)
+		}
+	}
+	if p.packets == 0 || pkt.Timestamp != p.lastTS {
+		p.frames++
+		p.lastTS = pkt.Timestamp
+	}
+	// A keyframe counts once, however many of its packets (parameter sets, slices) IsKeyframe sees
+	if stream.IsKeyframe(codec, pkt.Payload) && (len(p.keyframes) == 0 || p.keyframes[len(p.keyframes)-1].timestamp != pkt.Timestamp) {
+		p.keyframes = append(p.keyframes, probeKeyframe{at: now, frame: p.frames, timestamp: pkt.Timestamp})
+	}
+	p.last = now
+	p.lastSeq = pkt.SequenceNumber
+	p.packets++
+	p.bytes += int64(pkt.MarshalSize())
+}
+
+// print writes out what was counted. canSeeKeyframes is false for codecs IsKeyframe doesn't know.
+func (p *probeStats) print(canSeeKeyframes bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	elapsed := p.last.Sub(p.first)
+	if p.packets < 2 || elapsed <= 0 {
+		fmt.Println("  no video arrived")
+		return
+	}
+	seconds := elapsed.Seconds()
+	fmt.Printf("  bitrate      %.0f kbit/s\n", float64(p.bytes)*8/seconds/1000)
+	// elapsed runs from the first picture to the last, so it spans one fewer than were counted
+	fmt.Printf("  frame rate   %.1f fps\n", float64(p.frames-1)/seconds)
+	fmt.Printf("  packets      %d, %d lost\n", p.packets, p.lost)
+
+	switch {
+	case !canSeeKeyframes:
+		fmt.Println("  keyframes    not known for this codec")
+	case len(p.keyframes) == 0:
+		fmt.Println("  keyframes    none, viewers will wait for one")
+	case len(p.keyframes) == 1:
+		fmt.Printf("  keyframes    1, every %s or more\n", elapsed.Round(100*time.Millisecond))
+	default:
+		first, last := p.keyframes[0], p.keyframes[len(p.keyframes)-1]
+		intervals := len(p.keyframes) - 1
+		interval := last.at.Sub(first.at) / time.Duration(intervals)
+		fmt.Printf("  keyframes    %d, every %s (%d frames)\n", len(p.keyframes), interval.Round(100*time.Millisecond), (last.frame-first.frame)/intervals)
+	}
+}
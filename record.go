@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/recorder"
+	"github.com/nisarg-dave/camera-viewer/internal/transcode"
+
+	"github.com/pion/rtp"
+)
+
+// videoRecording is where record sends the camera's packets: an MP4, or the raw stream
+type videoRecording interface {
+	WritePacket(pkt *rtp.Packet) error
+	// Close finishes the file, returning how many bytes or pictures were recorded
+	Close() (string, error)
+}
+
+// runRecord writes the camera's video, as it comes, to a file for a while: an MP4 when the file
+// name ends in .mp4, made without ffmpeg, and otherwise the raw H264, H265 or MPEG-4 stream.
+func runRecord(args []string) error {
+	flags := newFlagSet("record", "[camera-id | rtsp-url]")
+	var out, url string
+	flags.StringVar(&out, "o", "recording.mp4", "file to write, .mp4, or .h264, .h265 or .m4v for the raw stream")
+	flags.StringVar(&out, "out", "recording.mp4", "same as -o")
+	flags.StringVar(&url, "url", "", "the camera's rtsp:// or rtsps:// URL, instead of the argument")
+	duration := flags.Duration("duration", time.Minute, "how long to record for")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() > 1 || (url != "" && flags.NArg() > 0) {
+		flags.Usage()
+		return fmt.Errorf("record takes one camera")
+	}
+	if url == "" {
+		url = flags.Arg(0)
+	}
+	removeStaleRecordings()
+
+	rtspStream, _, err := openCamera(url)
+	if err != nil {
+		return err
+	}
+
+	// Packets arrive on the stream's goroutine; the file is only set up once the codec is known
+	var mu sync.Mutex
+	var recording videoRecording
+	var writeErr error
+	rtspStream.SetPacketHandler(func(pkt *rtp.Packet) {
+		mu.Lock()
+		defer mu.Unlock()
+		if recording == nil || writeErr != nil {
+			return
+		}
+		err := recording.WritePacket(pkt)
+		if errors.Is(err, transcode.ErrPictureLost) {
+			log.Printf("Lost a picture: %v", err)
+		} else if err != nil {
+			// The file can't take any more
+			writeErr = err
+		}
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = connectCamera(ctx, rtspStream)
+	if err != nil {
+		return err
+	}
+	defer rtspStream.Close()
+
+	codec := rtspStream.GetCodec()
+	// The recording goes to a file next to out and only takes its name once it is complete, so a crash
+	// or power cut never leaves a half-written out, least of all in place of an earlier recording.
+	// One such crash left behind is written over.
+	partial := out + ".tmp"
+	file, err := os.Create(partial)
+	if err != nil {
+		return fmt.Errorf("failed to create recording: %w", err)
+	}
+	defer file.Close()
+
+	var newRecording videoRecording
+	if strings.EqualFold(filepath.Ext(out), ".mp4") {
+		newRecording, err = newMP4Recording(file, codec, rtspStream.VideoParameterSets)
+	} else {
+		newRecording, err = newRawRecording(file, codec, rtspStream.VideoParameterSets)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(partial)
+		return err
+	}
+	mu.Lock()
+	recording = newRecording
+	mu.Unlock()
+	fmt.Printf("Recording %s video to %s for %s, Ctrl+C stops early\n", codec, out, *duration)
+
+	select {
+	case <-time.After(*duration):
+	case <-ctx.Done():
+	}
+	// No packets reach the handler once Close has returned
+	rtspStream.Close()
+
+	if writeErr != nil {
+		log.Printf("Stopped recording early: %v", writeErr)
+	}
+	recorded, err := recording.Close()
+	if err != nil {
+		file.Close()
+		os.Remove(partial)
+		return err
+	}
+	// Otherwise after a power cut the rename can reach the disk before the video
+	err = file.Sync()
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(partial, out)
+	}
+	if err != nil {
+		os.Remove(partial)
+		return fmt.Errorf("failed to write recording: %w", err)
+	}
+	fmt.Printf("Wrote %s (%s)\n", out, recorded)
+	return nil
+}
+
+// removeStaleRecordings removes what recordings that never finished, e.g. in a crash, left in the
+// temporary directory
+func removeStaleRecordings() {
+	removed, err := recorder.RemoveStale()
+	for _, path := range removed {
+		log.Printf("Removed %s, left over from a recording that didn't finish", path)
+	}
+	if err != nil {
+		log.Printf("Failed to remove temporary files of unfinished recordings: %v", err)
+	}
+}
+
+// mp4Recording records to an MP4 with the recorder package
+type mp4Recording struct {
+	*recorder.MP4
+}
+
+func newMP4Recording(out io.Writer, codec string, params func() [][]byte) (videoRecording, error) {
+	mp4, err := recorder.NewMP4(out, codec, params)
+	if err != nil {
+		return nil, err
+	}
+	return mp4Recording{mp4}, nil
+}
+
+func (r mp4Recording) Close() (string, error) {
+	return fmt.Sprintf("%d pictures", r.Pictures()), r.MP4.Close()
+}
+
+// rawRecording writes the camera's elementary stream as it is, which ffmpeg and VLC play. Like
+// recorder.MP4's, its writes are gathered into 1 MB chunks rather than made picture by picture.
+type rawRecording struct {
+	out     *bufio.Writer
+	video   *transcode.ElementaryStream
+	written int64
+}
+
+func newRawRecording(out io.Writer, codec string, params func() [][]byte) (videoRecording, error) {
+	video := transcode.NewElementaryStream(codec, params)
+	if video == nil {
+		return nil, fmt.Errorf("%s video can't be recorded", codec)
+	}
+	return &rawRecording{out: bufio.NewWriterSize(out, 1<<20), video: video}, nil
+}
+
+func (r *rawRecording) WritePacket(pkt *rtp.Packet) error {
+	data, _, err := r.video.Write(pkt)
+	if err != nil {
+		return err
+	}
+	n, err := r.out.Write(data)
+	r.written += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write recording: %w", err)
+	}
+	return nil
+}
+
+func (r *rawRecording) Close() (string, error) {
+	if r.written == 0 {
+		return "", fmt.Errorf("the camera sent no keyframe, so nothing was recorded")
+	}
+	err := r.out.Flush()
+	if err != nil {
+		return "", fmt.Errorf("failed to write recording: %w", err)
+	}
+	return fmt.Sprintf("%d bytes", r.written), nil
+}
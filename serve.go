@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+	"github.com/nisarg-dave/camera-viewer/pkg/server"
+	"github.com/nisarg-dave/camera-viewer/pkg/stream"
+)
+
+// runServe runs the server until it is stopped: by Ctrl+C or SIGTERM, or by the Windows service
+// manager when it runs as a service. Under systemd it reports when it is ready and keeps the
+// watchdog fed, see runService.
+func runServe(args []string) error {
+	flags := newFlagSet("serve", "")
+	checkConfig := flags.Bool("check-config", false, "check the configuration and exit without serving, like config validate")
+	pidfile := flags.String("pidfile", "", "write the process ID to this file while serving, for init systems that track it")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *checkConfig {
+		err = loadEnv()
+		if err != nil {
+			return err
+		}
+		return validateConfig(configPathFromEnv())
+	}
+	return runService(func(ctx context.Context, started func(*server.Server)) error {
+		err := loadEnv()
+		if err != nil {
+			return err
+		}
+		if *pidfile != "" {
+			err = writePidfile(*pidfile)
+			if err != nil {
+				return err
+			}
+			defer removePidfile(*pidfile)
+		}
+		removeStaleRecordings()
+		srv, err := newServer()
+		if err != nil {
+			return err
+		}
+		srv.OnReady(func() { started(srv) })
+		return srv.Run(ctx)
+	})
+}
+
+// newServer sets the server up from the environment and the config file
+func newServer() (*server.Server, error) {
+	camera, err := cameraFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	adminPassword, err := config.Env("ADMIN_PASSWORD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ADMIN_PASSWORD: %w", err)
+	}
+
+	// Optional JSON config file for things like webhooks that don't fit in env vars
+	configPath := configPathFromEnv()
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	opts := server.Options{
+		Config:        cfg,
+		ConfigPath:    configPath,
+		Camera:        camera,
+		AdminPassword: adminPassword,
+		Version:       version,
+		Commit:        commit,
+		BuildDate:     buildDate,
+	}
+	// Serving the UI from a directory instead of the binary shows changes to it without a rebuild
+	if dir := os.Getenv("FRONTEND_DIR"); dir != "" {
+		opts.Frontend = http.Dir(dir)
+	}
+	return server.New(opts)
+}
+
+// writePidfile writes the process ID to path, replacing what a server that didn't stop cleanly
+// left there
+func writePidfile(path string) error {
+	err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write pidfile: %w", err)
+	}
+	return nil
+}
+
+// removePidfile removes the pidfile, unless another server has written its own ID there since
+func removePidfile(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil || strings.TrimSpace(string(data)) != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	err = os.Remove(path)
+	if err != nil {
+		log.Printf("Failed to remove pidfile: %v", err)
+	}
+}
+
+// defaultRTSPPath is the camera's stream when RTSP_PATH isn't set
+const defaultRTSPPath = "/cam/realmonitor?channel=1&subtype=0"
+
+// configPathFromEnv returns where the config file is, CONFIG_FILE or config.json
+func configPathFromEnv() string {
+	configPath := os.Getenv("CONFIG_FILE")
+	if configPath == "" {
+		configPath = "config.json"
+	}
+	return configPath
+}
+
+// cameraFromEnv reads the camera's settings from the environment. Credentials can also come from
+// files, see config.Env.
+func cameraFromEnv() (server.Camera, error) {
+	username, err := config.Env("RTSP_USERNAME")
+	if err != nil {
+		return server.Camera{}, fmt.Errorf("failed to read RTSP_USERNAME: %w", err)
+	}
+	password, err := config.Env("RTSP_PASSWORD")
+	if err != nil {
+		return server.Camera{}, fmt.Errorf("failed to read RTSP_PASSWORD: %w", err)
+	}
+	failoverURL, err := config.Env("RTSP_FAILOVER_URL")
+	if err != nil {
+		return server.Camera{}, fmt.Errorf("failed to read RTSP_FAILOVER_URL: %w", err)
+	}
+	host := os.Getenv("RTSP_HOST")
+	port := os.Getenv("RTSP_PORT")
+	// Dahua's main stream unless RTSP_PATH says otherwise, e.g. from the camera's ONVIF stream URI
+	path := os.Getenv("RTSP_PATH")
+	if path == "" {
+		path = defaultRTSPPath
+	}
+
+	// RTSP_SCHEME=rtsps for cameras and NVRs that only offer RTSP over TLS
+	scheme := os.Getenv("RTSP_SCHEME")
+	if scheme == "" {
+		scheme = "rtsp"
+	}
+
+	return server.Camera{
+		// The camera ID is how events, and anything consuming them, refer to this camera
+		ID:          os.Getenv("CAMERA_ID"),
+		URL:         fmt.Sprintf("%s://%s:%s@%s:%s%s", scheme, username, password, host, port, path),
+		FailoverURL: failoverURL,
+		Host:        host,
+		Port:        port,
+		Username:    username,
+		Password:    password,
+		TLS: stream.TLSOptions{
+			CAFile:      os.Getenv("RTSP_TLS_CA_FILE"),
+			Fingerprint: os.Getenv("RTSP_TLS_FINGERPRINT"),
+		},
+	}, nil
+}
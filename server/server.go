@@ -0,0 +1,36 @@
+// Package server is where github.com/nisarg-dave/camera-viewer/pkg/server used to be. It only forwards to it.
+//
+// Deprecated: import github.com/nisarg-dave/camera-viewer/pkg/server instead. This package will be removed in v2.
+package server
+
+import (
+	"net/http"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/server"
+
+	"github.com/gorilla/websocket"
+)
+
+type (
+	Camera            = server.Camera
+	Options           = server.Options
+	Server            = server.Server
+	Signaler          = server.Signaler
+	Offer             = server.Offer
+	Answer            = server.Answer
+	Candidate         = server.Candidate
+	HTTPSignaler      = server.HTTPSignaler
+	WebSocketSignaler = server.WebSocketSignaler
+)
+
+func New(opts Options) (*Server, error) {
+	return server.New(opts)
+}
+
+func NewHTTPSignaler(url string, client *http.Client) *HTTPSignaler {
+	return server.NewHTTPSignaler(url, client)
+}
+
+func NewWebSocketSignaler(conn *websocket.Conn) *WebSocketSignaler {
+	return server.NewWebSocketSignaler(conn)
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/server"
+)
+
+// runService runs serve until Ctrl+C or SIGTERM (docker stop, systemctl stop) starts a graceful
+// shutdown. Under systemd with Type=notify, systemd is told once the server is listening and again
+// when it starts stopping, and with WatchdogSec the watchdog is fed while the server answers.
+// serve calls started once the server is listening.
+func runService(serve func(ctx context.Context, started func(*server.Server)) error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	stopping := context.AfterFunc(ctx, func() { sdNotify("STOPPING=1") })
+	defer stopping()
+	return serve(ctx, func(srv *server.Server) {
+		sdNotify("READY=1")
+		if interval := watchdogInterval(); interval > 0 {
+			go feedWatchdog(ctx, srv.Handler(), interval)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/nisarg-dave/camera-viewer/internal/logging"
+	"github.com/nisarg-dave/camera-viewer/pkg/server"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// serviceName is what the server is registered as with sc.exe create, see the README. The
+// service manager starts whichever service the binary is registered as, so it is only a default.
+const serviceName = "camera-viewer"
+
+// runService runs serve until Ctrl+C, or, when the Windows service manager started the server, until
+// the service is stopped or Windows shuts down. serve calls started once the server is listening,
+// which is when the service manager is told it is running.
+func runService(serve func(ctx context.Context, started func(*server.Server)) error) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return fmt.Errorf("failed to find out whether running as a service: %w", err)
+	}
+	if !isService {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		return serve(ctx, func(*server.Server) {})
+	}
+
+	// Services start in the system directory. The .env file, the config and the data are looked
+	// for next to the binary instead, and with no console the log goes there too.
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the binary: %w", err)
+	}
+	dir := filepath.Dir(exe)
+	err = os.Chdir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to change to the binary's directory: %w", err)
+	}
+	logFile, err := os.OpenFile(filepath.Join(dir, "camera-viewer.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer logFile.Close()
+	logging.SetOutput(logFile)
+
+	service := &windowsService{serve: serve}
+	err = svc.Run(serviceName, service)
+	if err != nil {
+		return fmt.Errorf("failed to run as a service: %w", err)
+	}
+	return service.err
+}
+
+// windowsService answers the service manager while the server runs
+type windowsService struct {
+	serve func(ctx context.Context, started func(*server.Server)) error
+	// Why the server stopped, when it wasn't asked to
+	err error
+}
+
+// Execute runs the server, stopping it when the service manager asks
+func (s *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.serve(ctx, func(*server.Server) {
+			status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+		})
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				log.Printf("Server stopped: %v", err)
+				s.err = err
+				// A service-specific exit code, so the service manager's recovery options apply
+				return true, 1
+			}
+			return false, 0
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+			}
+		}
+	}
+}
@@ -0,0 +1,556 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/logging"
+	"github.com/nisarg-dave/camera-viewer/internal/onvif"
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+	"github.com/nisarg-dave/camera-viewer/pkg/stream"
+
+	"github.com/joho/godotenv"
+)
+
+// discoveryTimeout is how long setup waits for cameras to answer its probe. They answer within a
+// second or so.
+const discoveryTimeout = 3 * time.Second
+
+// onvifTimeout bounds each ONVIF call setup makes
+const onvifTimeout = 10 * time.Second
+
+// runSetup asks a few questions, finding the camera with ONVIF and checking it can be logged in to
+// and played, and writes the .env file and the config file for a first run. Nothing is written
+// until every answer is in.
+func runSetup(args []string) error {
+	flags := newFlagSet("setup", "")
+	envPath := flags.String("env", ".env", "where to write the camera settings")
+	configPath := flags.String("config", "", "where to write the config file, CONFIG_FILE or config.json by default")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("setup takes no arguments")
+	}
+	// Settings that are already there are offered as the answers
+	err = loadEnv()
+	if err != nil {
+		return err
+	}
+	if *configPath == "" {
+		*configPath = configPathFromEnv()
+	}
+
+	p := newPrompter(os.Stdin, os.Stdout)
+	fmt.Printf("This finds your camera, checks it can be played, and writes %s and %s.\n", *envPath, *configPath)
+	fmt.Printf("Press Enter to take the answer in [brackets].\n\n")
+	for _, path := range []string{*envPath, *configPath} {
+		_, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		replace, err := p.confirm(fmt.Sprintf("%s already exists. Replace it?", path), false)
+		if err != nil {
+			return err
+		}
+		if !replace {
+			fmt.Println("Nothing was written.")
+			return nil
+		}
+	}
+
+	ctx := context.Background()
+	camera, err := setupCamera(ctx, p)
+	if err != nil {
+		return err
+	}
+	cfg, err := setupStorage(p)
+	if err != nil {
+		return err
+	}
+	if camera.mediaURL != "" {
+		// The camera can be asked for a keyframe when a viewer's picture breaks
+		cfg["keyframe_request"] = map[string]string{"type": "onvif", "url": camera.mediaURL, "profile_token": camera.profileToken}
+	}
+	fmt.Println()
+	adminPassword, err := p.password("Password for the admin user to log in to the web UI with (empty to have one made up and logged on the first run)")
+	if err != nil {
+		return err
+	}
+
+	env := camera.env()
+	if adminPassword != "" {
+		env["ADMIN_PASSWORD"] = adminPassword
+	}
+	err = writeEnvFile(*envPath, env)
+	if err != nil {
+		return err
+	}
+	err = writeSetupConfig(*configPath, cfg)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nWrote %s and %s.\n", *envPath, *configPath)
+
+	// What was written is checked the way serve will read it
+	loaded, err := config.Load(*configPath)
+	if err == nil {
+		err = loaded.Validate()
+	}
+	if err != nil {
+		fmt.Printf("The config file has problems to fix before serving:\n%v\n", err)
+	}
+	fmt.Printf("\nStart the server with `camera-viewer serve` and open http://localhost:8080/ to log in as admin.\n")
+	return nil
+}
+
+// cameraSettings are what setup found out about the camera, for the .env file
+type cameraSettings struct {
+	host, port, path   string
+	username, password string
+	// The ONVIF media service and profile of the stream, for keyframe requests. Empty when the
+	// camera was set up without ONVIF.
+	mediaURL, profileToken string
+}
+
+// url is the camera's stream, put together as cameraFromEnv does
+func (c cameraSettings) url() string {
+	return fmt.Sprintf("rtsp://%s:%s@%s:%s%s", c.username, c.password, c.host, c.port, c.path)
+}
+
+// env is the camera's settings as .env variables
+func (c cameraSettings) env() map[string]string {
+	env := map[string]string{
+		"RTSP_HOST":     c.host,
+		"RTSP_PORT":     c.port,
+		"RTSP_USERNAME": c.username,
+		"RTSP_PASSWORD": c.password,
+	}
+	if c.path != defaultRTSPPath {
+		env["RTSP_PATH"] = c.path
+	}
+	return env
+}
+
+// setupCamera finds the camera, on the network with ONVIF or from the address it is given, and
+// asks for its username and password until it plays, or the user settles for what they typed
+func setupCamera(ctx context.Context, p *prompter) (cameraSettings, error) {
+	var camera cameraSettings
+	device, err := chooseCamera(ctx, p)
+	if err != nil {
+		return camera, err
+	}
+	if device != nil {
+		camera.host = device.Host()
+	} else {
+		camera.host, err = p.ask("Camera's address", os.Getenv("RTSP_HOST"))
+		if err != nil {
+			return camera, err
+		}
+	}
+
+	fmt.Println()
+	username := envOr("RTSP_USERNAME", "admin")
+	for {
+		username, err = p.ask("Camera's username", username)
+		if err != nil {
+			return camera, err
+		}
+		camera.username = username
+		camera.password, err = p.password("Camera's password")
+		if err != nil {
+			return camera, err
+		}
+
+		found := false
+		if device != nil {
+			err = findStream(ctx, p, *device, &camera)
+			if errors.Is(err, onvif.ErrNotAuthorized) {
+				fmt.Printf("%v. If the password is right, check the camera's clock is set.\n", err)
+				continue
+			}
+			if err != nil {
+				fmt.Printf("Couldn't find the stream with ONVIF: %v\n", err)
+			}
+			found = err == nil
+		}
+		if !found {
+			err = askStream(p, &camera)
+			if err != nil {
+				return camera, err
+			}
+		}
+
+		var codec string
+		_, err = url.Parse(camera.url())
+		if err == nil {
+			fmt.Printf("Connecting to rtsp://%s:%s%s...\n", camera.host, camera.port, camera.path)
+			codec, err = tryCamera(ctx, camera.url())
+		} else {
+			// The .env settings are put together into a URL without escaping, see cameraFromEnv
+			err = fmt.Errorf("the username or password has a character that can't go in the camera's URL, like a space, # or ?")
+		}
+		if err == nil {
+			fmt.Printf("The camera is sending %s video.\n", codec)
+			return camera, nil
+		}
+		if errors.Is(err, stream.ErrAuthFailed) {
+			fmt.Println("The camera didn't accept the username and password.")
+		} else {
+			// The error can quote the URL, password and all
+			fmt.Printf("Couldn't play the camera's video: %s\n", logging.Redact(err.Error()))
+		}
+		again, err := p.confirm("Try again?", true)
+		if err != nil {
+			return camera, err
+		}
+		if !again {
+			keep, err := p.confirm("Write the settings anyway?", false)
+			if err != nil {
+				return camera, err
+			}
+			if !keep {
+				return camera, fmt.Errorf("setup stopped, nothing was written")
+			}
+			return camera, nil
+		}
+	}
+}
+
+// chooseCamera looks for cameras with ONVIF and asks which one it is, returning nil when it isn't
+// among them and its address is to be asked for instead
+func chooseCamera(ctx context.Context, p *prompter) (*onvif.Device, error) {
+	fmt.Println("Looking for ONVIF cameras on the network...")
+	devices, err := onvif.Discover(ctx, discoveryTimeout)
+	if err != nil {
+		fmt.Printf("Couldn't look for cameras: %v\n", err)
+	}
+	if len(devices) == 0 {
+		fmt.Println("No camera answered. It may have ONVIF turned off, or be on another network.")
+		return nil, nil
+	}
+
+	for i, device := range devices {
+		description := strings.TrimSpace(device.Name + " " + device.Hardware)
+		if description == "" {
+			description = "Camera"
+		}
+		fmt.Printf("  %d) %s at %s\n", i+1, description, device.Host())
+	}
+	for {
+		answer, err := p.ask(fmt.Sprintf("Which one is it, 1-%d, or 0 for another camera", len(devices)), "1")
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(answer)
+		if err == nil && n == 0 {
+			return nil, nil
+		}
+		if err == nil && n >= 1 && n <= len(devices) {
+			return &devices[n-1], nil
+		}
+		fmt.Printf("Answer a number from 0 to %d.\n", len(devices))
+	}
+}
+
+// findStream asks a camera found with ONVIF for its stream, with the username and password in
+// camera, and fills in camera's port, path and ONVIF settings. A camera with more than one stream
+// gets asked which one to watch.
+func findStream(ctx context.Context, p *prompter, device onvif.Device, camera *cameraSettings) error {
+	ctx, cancel := context.WithTimeout(ctx, onvifTimeout)
+	defer cancel()
+
+	deviceService := &onvif.Client{URL: device.XAddrs[0], Username: camera.username, Password: camera.password}
+	mediaURL, err := deviceService.GetMediaURL(ctx)
+	if err != nil {
+		return err
+	}
+	media := &onvif.Client{URL: mediaURL, Username: camera.username, Password: camera.password}
+	profiles, err := media.GetProfiles(ctx)
+	if err != nil {
+		return err
+	}
+	if len(profiles) == 0 {
+		return fmt.Errorf("the camera has no media profiles")
+	}
+
+	profile := profiles[0]
+	if len(profiles) > 1 {
+		fmt.Println("The camera has these streams:")
+		for i, profile := range profiles {
+			if profile.Encoding == "" {
+				fmt.Printf("  %d) %s, without video\n", i+1, profile.Name)
+				continue
+			}
+			fmt.Printf("  %d) %s, %s %dx%d\n", i+1, profile.Name, profile.Encoding, profile.Width, profile.Height)
+		}
+		for {
+			answer, err := p.ask(fmt.Sprintf("Which one should viewers watch, 1-%d", len(profiles)), "1")
+			if err != nil {
+				return err
+			}
+			n, err := strconv.Atoi(answer)
+			if err == nil && n >= 1 && n <= len(profiles) {
+				profile = profiles[n-1]
+				break
+			}
+			fmt.Printf("Answer a number from 1 to %d.\n", len(profiles))
+		}
+	}
+
+	uri, err := media.GetStreamURI(ctx, profile.Token)
+	if err != nil {
+		return err
+	}
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "rtsp" || parsed.Hostname() == "" {
+		return fmt.Errorf("the camera's stream URL %q isn't an rtsp:// URL", uri)
+	}
+	// The host stays the one the camera was found at, in case it reports an address of its own
+	// that isn't reachable from here
+	camera.port = parsed.Port()
+	if camera.port == "" {
+		camera.port = "554"
+	}
+	camera.path = parsed.EscapedPath()
+	if parsed.RawQuery != "" {
+		camera.path += "?" + parsed.RawQuery
+	}
+	camera.mediaURL, camera.profileToken = mediaURL, profile.Token
+	return nil
+}
+
+// askStream asks for the camera's RTSP port and stream path, for a camera set up without ONVIF.
+// The answers from the last time round are the defaults.
+func askStream(p *prompter, camera *cameraSettings) error {
+	if camera.port == "" {
+		camera.port, camera.path = envOr("RTSP_PORT", "554"), envOr("RTSP_PATH", defaultRTSPPath)
+	}
+	camera.mediaURL, camera.profileToken = "", ""
+	for {
+		port, err := p.ask("Camera's RTSP port", camera.port)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(port)
+		if err == nil && n >= 1 && n <= 65535 {
+			camera.port = port
+			break
+		}
+		fmt.Println("Answer a port number, usually 554.")
+	}
+	fmt.Println("The stream's path depends on the make, e.g. /cam/realmonitor?channel=1&subtype=0 for Dahua,")
+	fmt.Println("/Streaming/Channels/101 for Hikvision or /stream1 for TP-Link; the camera's manual has it.")
+	for {
+		path, err := p.ask("Stream path", camera.path)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(path, "/") {
+			camera.path = path
+			return nil
+		}
+		fmt.Println("The path starts with /.")
+	}
+}
+
+// tryCamera plays the camera's video, to check the username, password and path are right,
+// returning its codec
+func tryCamera(ctx context.Context, url string) (string, error) {
+	rtspStream := stream.NewRTSPStream(url)
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	err := rtspStream.Connect(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer rtspStream.Close()
+	return rtspStream.GetCodec(), nil
+}
+
+// setupStorage asks where the server keeps its data and how much free space to warn at, and
+// returns the config file's settings for them
+func setupStorage(p *prompter) (map[string]any, error) {
+	fmt.Println()
+	fmt.Println("The server keeps its users, sessions and certificates in a data directory.")
+	var dataDir string
+	for {
+		var err error
+		dataDir, err = p.ask("Data directory", "data")
+		if err != nil {
+			return nil, err
+		}
+		err = checkDataDir(dataDir)
+		if err == nil {
+			break
+		}
+		fmt.Printf("%v\n", err)
+	}
+
+	var minFree float64
+	for {
+		answer, err := p.ask("Warn when the data directory's disk has less free than this many GB", "1")
+		if err != nil {
+			return nil, err
+		}
+		minFree, err = strconv.ParseFloat(answer, 64)
+		if err == nil && minFree > 0 {
+			break
+		}
+		fmt.Println("Answer a number of GB, like 1 or 0.5.")
+	}
+	return map[string]any{
+		"data_dir": dataDir,
+		"storage":  map[string]float64{"min_free_gb": minFree},
+	}, nil
+}
+
+// checkDataDir creates the data directory if it isn't there, and checks the server can write to it
+func checkDataDir(dir string) error {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	file, err := os.CreateTemp(dir, ".setup-*")
+	if err != nil {
+		return fmt.Errorf("%s can't be written to: %w", dir, err)
+	}
+	file.Close()
+	os.Remove(file.Name())
+	return nil
+}
+
+// writeEnvFile writes the .env file. It holds the camera's password, so only its owner can read it.
+func writeEnvFile(path string, env map[string]string) error {
+	content, err := godotenv.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	content = "# Written by camera-viewer setup, see the README for the other settings\n" + content + "\n"
+	err = os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeSetupConfig writes the config file with only the settings setup asked about, leaving the
+// rest to their defaults
+func writeSetupConfig(path string, cfg map[string]any) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		err = os.MkdirAll(dir, 0o755)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+	err = os.WriteFile(path, append(data, '\n'), 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// envOr returns the environment variable name, or def when it isn't set
+func envOr(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// prompter asks questions on the terminal, one line per answer
+type prompter struct {
+	in   *bufio.Reader
+	file *os.File
+	out  io.Writer
+}
+
+func newPrompter(in *os.File, out io.Writer) *prompter {
+	return &prompter{in: bufio.NewReader(in), file: in, out: out}
+}
+
+// ask asks question and returns the answer, or def when the answer is empty
+func (p *prompter) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	answer, err := p.readLine()
+	if err != nil {
+		return "", err
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+// confirm asks a yes or no question
+func (p *prompter) confirm(question string, def bool) (bool, error) {
+	options := "y/N"
+	if def {
+		options = "Y/n"
+	}
+	for {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, options)
+		answer, err := p.readLine()
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+	}
+}
+
+// password asks for a password, without showing it as it is typed where the terminal allows. The
+// password is added to the secrets the log hides.
+func (p *prompter) password(question string) (string, error) {
+	fmt.Fprintf(p.out, "%s: ", question)
+	restore := hideInput(p.file)
+	answer, err := p.readLine()
+	restore()
+	fmt.Fprintln(p.out)
+	if err != nil {
+		return "", err
+	}
+	logging.AddSecret(answer)
+	return answer, nil
+}
+
+// readLine reads an answer, without the line ending; spaces are kept since a password can have them.
+// Running out of input, e.g. when it is piped in, is an error rather than an empty answer, which
+// would ask again for ever.
+func (p *prompter) readLine() (string, error) {
+	line, err := p.in.ReadString('\n')
+	if errors.Is(err, io.EOF) && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("setup needs answers, and there are no more: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nisarg-dave/camera-viewer/internal/transcode"
+
+	"github.com/pion/rtp"
+)
+
+// runSnapshot saves a still image of the camera's next keyframe, made with ffmpeg
+func runSnapshot(args []string) error {
+	flags := newFlagSet("snapshot", "[camera-id | rtsp-url]")
+	out := flags.String("o", "snapshot.jpg", "file to write, .jpg, .webp or .png")
+	ffmpeg := flags.String("ffmpeg", "", `ffmpeg binary, "ffmpeg" from the PATH when empty`)
+	timeout := flags.Duration("timeout", 30*time.Second, "how long to wait for the camera and a keyframe")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return fmt.Errorf("snapshot takes one camera")
+	}
+
+	var format string
+	switch strings.ToLower(filepath.Ext(*out)) {
+	case ".jpg", ".jpeg":
+		format = transcode.FormatJPEG
+	case ".webp":
+		format = transcode.FormatWebP
+	case ".png":
+		format = transcode.FormatPNG
+	default:
+		return fmt.Errorf("can't tell the image format from %s, use .jpg, .webp or .png", *out)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	rtspStream, _, err := openCamera(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	snapshotter := transcode.NewSnapshotter(*ffmpeg, rtspStream.VideoParameterSets)
+	rtspStream.SetPacketHandler(func(pkt *rtp.Packet) {
+		snapshotter.WritePacket(rtspStream.GetCodec(), pkt)
+	})
+	err = connectCamera(ctx, rtspStream)
+	if err != nil {
+		return err
+	}
+	defer rtspStream.Close()
+	if !transcode.CanSnapshot(rtspStream.GetCodec()) {
+		return fmt.Errorf("snapshots can't be taken of %s video", rtspStream.GetCodec())
+	}
+
+	image, err := snapshotter.Grab(ctx, format)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(*out, image, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	fmt.Printf("Wrote %s (%d bytes)\n", *out, len(image))
+	return nil
+}
@@ -0,0 +1,107 @@
+// Package stream is where github.com/nisarg-dave/camera-viewer/pkg/stream used to be. It only forwards to it.
+//
+// Deprecated: import github.com/nisarg-dave/camera-viewer/pkg/stream instead. This package will be removed in v2.
+package stream
+
+import (
+	"crypto/tls"
+
+	"github.com/nisarg-dave/camera-viewer/pkg/stream"
+
+	"github.com/pion/ice/v4"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+type (
+	AudioHandler       = stream.AudioHandler
+	LatencyStats       = stream.LatencyStats
+	SharedPacket       = stream.SharedPacket
+	PeerOption         = stream.PeerOption
+	RTSPStream         = stream.RTSPStream
+	Timeouts           = stream.Timeouts
+	VideoSource        = stream.VideoSource
+	VideoInfo          = stream.VideoInfo
+	PeerStats          = stream.PeerStats
+	CandidatePairStats = stream.CandidatePairStats
+	CandidateStats     = stream.CandidateStats
+	CameraStatus       = stream.CameraStatus
+	TLSOptions         = stream.TLSOptions
+	BatchConfig        = stream.BatchConfig
+	Viewer             = stream.Viewer
+	WebRTCPeer         = stream.WebRTCPeer
+	PeerConfig         = stream.PeerConfig
+)
+
+var (
+	ErrUnsupportedCodec  = stream.ErrUnsupportedCodec
+	ErrCameraUnreachable = stream.ErrCameraUnreachable
+	ErrAuthFailed        = stream.ErrAuthFailed
+	ErrPeerClosed        = stream.ErrPeerClosed
+	ErrNoCommonCodec     = stream.ErrNoCommonCodec
+	ErrInvalidAnswer     = stream.ErrInvalidAnswer
+)
+
+func IsKeyframe(codec string, payload []byte) bool {
+	return stream.IsKeyframe(codec, payload)
+}
+
+func IsDisposable(codec string, payload []byte) bool {
+	return stream.IsDisposable(codec, payload)
+}
+
+func CopyPacket(pkt *rtp.Packet) *SharedPacket {
+	return stream.CopyPacket(pkt)
+}
+
+func ClonePacket(pkt *rtp.Packet) *rtp.Packet {
+	return stream.ClonePacket(pkt)
+}
+
+func ReleasePacket(pkt *rtp.Packet) {
+	stream.ReleasePacket(pkt)
+}
+
+func HasParameterSets(codec string, payload []byte) bool {
+	return stream.HasParameterSets(codec, payload)
+}
+
+func ParameterSetsPayload(codec string, params [][]byte) []byte {
+	return stream.ParameterSetsPayload(codec, params)
+}
+
+func WithICEServers(servers ...webrtc.ICEServer) PeerOption {
+	return stream.WithICEServers(servers...)
+}
+
+func WithSettingEngine(engine webrtc.SettingEngine) PeerOption {
+	return stream.WithSettingEngine(engine)
+}
+
+func WithCodecPreferences(mimeTypes ...string) PeerOption {
+	return stream.WithCodecPreferences(mimeTypes...)
+}
+
+func WithDataChannel(label string, init *webrtc.DataChannelInit, setup func(*webrtc.DataChannel)) PeerOption {
+	return stream.WithDataChannel(label, init, setup)
+}
+
+func NewRTSPStream(rtspURL string) *RTSPStream {
+	return stream.NewRTSPStream(rtspURL)
+}
+
+func NewTLSConfig(options TLSOptions) (*tls.Config, error) {
+	return stream.NewTLSConfig(options)
+}
+
+func NewBatchedUDPMux(cfg BatchConfig) (ice.UDPMux, error) {
+	return stream.NewBatchedUDPMux(cfg)
+}
+
+func NewWebRTCPeer(options ...PeerOption) (*WebRTCPeer, error) {
+	return stream.NewWebRTCPeer(options...)
+}
+
+func NewWebRTCPeerWithConfig(peerConfig PeerConfig, options ...PeerOption) (*WebRTCPeer, error) {
+	return stream.NewWebRTCPeerWithConfig(peerConfig, options...)
+}
@@ -0,0 +1,78 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotify sends state, e.g. READY=1, to systemd's notification socket, see sd_notify(3). It does
+// nothing unless systemd started the server with Type=notify.
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	// A name starting with @ is in the abstract namespace, which Go handles the same way
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		log.Printf("Failed to notify systemd: %v", err)
+		return
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	if err != nil {
+		log.Printf("Failed to notify systemd: %v", err)
+	}
+}
+
+// watchdogInterval is how often systemd's watchdog wants to hear from the server, half its
+// WatchdogSec as sd_watchdog_enabled(3) suggests, or zero when the watchdog isn't on for us
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// feedWatchdog tells systemd's watchdog the server is alive every interval until ctx is cancelled,
+// as long as it answers its liveness check. A server that stops answering is restarted by systemd
+// once WatchdogSec has passed (with Restart=on-failure).
+func feedWatchdog(ctx context.Context, handler http.Handler, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if serverAnswers(handler) {
+			sdNotify("WATCHDOG=1")
+		} else {
+			log.Printf("The server failed its health check, so systemd's watchdog isn't told it is alive")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// serverAnswers sends GET /healthz through the server's handler, the way a liveness probe would
+// but without the network. A handler that hangs keeps the watchdog from being fed, as it should.
+func serverAnswers(handler http.Handler) bool {
+	request := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	// Which is what the access log shows as the client
+	request.RemoteAddr = "watchdog"
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder.Code == http.StatusOK
+}
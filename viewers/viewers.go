@@ -0,0 +1,29 @@
+// Package viewers is where github.com/nisarg-dave/camera-viewer/pkg/viewers used to be. It only forwards to it.
+//
+// Deprecated: import github.com/nisarg-dave/camera-viewer/pkg/viewers instead. This package will be removed in v2.
+package viewers
+
+import (
+	"github.com/nisarg-dave/camera-viewer/pkg/config"
+	"github.com/nisarg-dave/camera-viewer/pkg/events"
+	"github.com/nisarg-dave/camera-viewer/pkg/viewers"
+)
+
+type (
+	Session = viewers.Session
+	Manager = viewers.Manager
+	Startup = viewers.Startup
+	Usage   = viewers.Usage
+)
+
+var (
+	ErrICETimeout = viewers.ErrICETimeout
+)
+
+func NewManager(bus *events.Bus, usage *Usage, bandwidth config.Bandwidth) *Manager {
+	return viewers.NewManager(bus, usage, bandwidth)
+}
+
+func LoadUsage(path string) (*Usage, error) {
+	return viewers.LoadUsage(path)
+}